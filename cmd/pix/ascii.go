@@ -4,14 +4,11 @@ import (
 	"context"
 	"fmt"
 	"image"
-	"image/color/palette"
-	"image/draw"
-	"image/gif"
-	"image/png"
-	"log"
 	"os"
+	"path"
 	"strings"
 
+	"pix/pkg/anim"
 	"pix/pkg/ascii"
 	"pix/pkg/ascii/video"
 
@@ -45,7 +42,9 @@ func (a *Ascii) ParseCharset() ascii.Charset {
 	}
 }
 
-func (a *Ascii) OpenImage() (image.Image, error) {
+// OpenAnimation opens the input image, gifs, apngs and directories of frames
+// keep all of their frames
+func (a *Ascii) OpenAnimation() (*anim.Animation, error) {
 	var inputfile string
 	if a.Input != "" {
 		inputfile = string(a.Input)
@@ -55,12 +54,7 @@ func (a *Ascii) OpenImage() (image.Image, error) {
 		return nil, fmt.Errorf("no image supplied")
 	}
 
-	file, err := openImage(inputfile)
-	if err != nil {
-		return nil, err
-	} else {
-		return file, nil
-	}
+	return openAnimation(inputfile)
 }
 
 func (a *Ascii) CreateVideo(opts []ascii.Option, args []string) error {
@@ -71,122 +65,38 @@ func (a *Ascii) CreateVideo(opts []ascii.Option, args []string) error {
 	return nil
 }
 
-func getGifDimensions(gif *gif.GIF) (x, y int) {
-	var lowestX int
-	var lowestY int
-	var highestX int
-	var highestY int
-
-	for _, img := range gif.Image {
-		if img.Rect.Min.X < lowestX {
-			lowestX = img.Rect.Min.X
-		}
-		if img.Rect.Min.Y < lowestY {
-			lowestY = img.Rect.Min.Y
-		}
-		if img.Rect.Max.X > highestX {
-			highestX = img.Rect.Max.X
-		}
-		if img.Rect.Max.Y > highestY {
-			highestY = img.Rect.Max.Y
-		}
-	}
-
-	return highestX - lowestX, highestY - lowestY
-}
-
-// Decode reads and analyzes the given reader as a GIF image
-func SplitAnimatedGIF(gif *gif.GIF) (err error) {
-	imgWidth, imgHeight := getGifDimensions(gif)
-
-	overpaintImage := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
-	draw.Draw(overpaintImage, overpaintImage.Bounds(), gif.Image[0], image.Point{0, 0}, draw.Src)
-
-	for i, srcImg := range gif.Image {
-		draw.Draw(overpaintImage, overpaintImage.Bounds(), srcImg, image.Point{0, 0}, draw.Over)
-
-		// save current frame "stack". This will overwrite an existing file with that name
-		file, err := os.Create(fmt.Sprintf("%s%d%s", "frame", i, ".png"))
-		if err != nil {
-			return err
-		}
-
-		err = png.Encode(file, overpaintImage)
-		if err != nil {
-			return err
-		}
-
-		file.Close()
-	}
-
-	return nil
-}
-
-func (a *Ascii) CreateGif(optset []ascii.Option) error {
-	var inputfile string
-	if a.Input != "" {
-		inputfile = string(a.Input)
-	} else if a.Args.Image != "" {
-		inputfile = a.Args.Image
-	} else {
-		return fmt.Errorf("no image supplied")
+// CreateAnimation converts every frame of an animation, frames are converted
+// one at a time when interpolating since they share the font memory
+func (a *Ascii) CreateAnimation(frames *anim.Animation, optset []ascii.Option) error {
+	workers := 0
+	if a.Interpolate {
+		workers = 1
 	}
 
-	g, err := openGif(inputfile)
+	out, err := frames.Map(workers, func(_ int, img image.Image) (image.Image, error) {
+		return ascii.ConvertWithOpts(img, optset...)
+	})
 	if err != nil {
 		return err
 	}
 
-	imgWidth, imgHeight := getGifDimensions(g)
-	newg := &gif.GIF{}
-
-	var pimg *image.Paletted
-	pall := palette.Plan9
-
-	bounds := image.Rect(0, 0, imgWidth, imgHeight)
-	pimg = image.NewPaletted(bounds, pall)
-
-	// draw base gif image to regular image
-	overpaintImage := image.NewRGBA(bounds)
-	draw.Draw(overpaintImage, overpaintImage.Bounds(), g.Image[0], image.Point{0, 0}, draw.Src)
-
-	// ascii conversion
-	asciiimg, err := ascii.ConvertWithOpts(overpaintImage, optset...)
-	if err != nil {
-		return err
+	outname := a.Output
+	if outname == "" {
+		outname = "ascii.gif"
+		if a.Animated {
+			outname = "ascii.apng"
+		}
 	}
 
-	// create the initial frame
-	draw.Draw(pimg, overpaintImage.Bounds(), asciiimg, image.Point{0, 0}, draw.Over)
-
-	newg.Image = append(newg.Image, pimg)
-	newg.Delay = append(newg.Delay, g.Delay[0])
-
-	// maxGoroutines := 10
-	// guard := make(chan struct{}, maxGoroutines)
-
-	for i, srcImg := range g.Image {
-		// guard <- struct{}{}
-		// go func() {
-		draw.Draw(overpaintImage, overpaintImage.Bounds(), srcImg, image.Point{0, 0}, draw.Over)
-		pimg := image.NewPaletted(bounds, pall)
-
-		asciiimg, err := ascii.ConvertWithOpts(overpaintImage, optset...)
-		if err != nil {
-			// return err
-			log.Println(err)
+	// --gif always writes a gif, the full color apng needs --animated
+	if a.Gif && !a.Animated {
+		if outname != stdio && path.Ext(outname) != ".gif" {
+			outname = strings.TrimSuffix(outname, path.Ext(outname)) + ".gif"
 		}
-
-		draw.Draw(pimg, overpaintImage.Bounds(), asciiimg, image.Point{0, 0}, draw.Over)
-		// draw.Draw(pimg, overpaintImage.Bounds(), overpaintImage, image.ZP, draw.Over)
-
-		newg.Image = append(newg.Image, pimg)
-		newg.Delay = append(newg.Delay, g.Delay[i])
-		// <-guard
-		// }()
+		return saveGIF(out, frames, outname)
 	}
-	SaveAsGif(newg, "test.gif")
-	return nil
+
+	return saveAnimation(out, frames, outname)
 }
 
 func (a *Ascii) RunAscii() error {
@@ -222,20 +132,27 @@ func (a *Ascii) RunAscii() error {
 		optSet = append(optSet, ascii.Noise(a.Noise))
 	}
 
+	if a.Edges > 0 {
+		optSet = append(optSet, ascii.Edges(a.Edges))
+	}
+
 	if a.Video {
+		if opts.Mask != "" {
+			return fmt.Errorf("--mask can't be used with --video")
+		}
 		args := strings.Split(a.FFMpegArgs, " ")
 		return a.CreateVideo(optSet, args)
 	}
 
-	if a.Gif {
-		return a.CreateGif(optSet)
-	}
-
-	img, err := a.OpenImage()
+	frames, err := a.OpenAnimation()
 	if err != nil {
 		return err
 	}
 
+	if a.Gif || a.Animated || frames.Len() > 1 {
+		return a.CreateAnimation(frames, optSet)
+	}
+
 	var outname string
 	if a.Output != "" {
 		outname = string(a.Output)
@@ -243,10 +160,10 @@ func (a *Ascii) RunAscii() error {
 		outname = "ascii.png"
 	}
 
-	asciiimg, err := ascii.ConvertWithOpts(img, optSet...)
+	asciiimg, err := ascii.ConvertWithOpts(frames.Frames[0], optSet...)
 	if err != nil {
 		return err
 	}
 
-	return SaveImageToPNG(asciiimg, outname)
+	return saveImage(asciiimg, frames, outname)
 }
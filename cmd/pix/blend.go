@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"pix/pkg/blend"
+)
+
+// blendMode parses the --blend and --opacity flags of a command, ok is false
+// when neither is set and the effect replaces the image as before
+func blendMode(name string, opacity float64) (mode blend.Mode, ok bool, err error) {
+	if name == "" && opacity == 1 {
+		return blend.Normal, false, nil
+	}
+	if opacity < 0 || opacity > 1 {
+		return blend.Normal, false, fmt.Errorf("--opacity must be between 0 and 1")
+	}
+	if name != "" {
+		if mode, err = blend.ParseMode(name); err != nil {
+			return blend.Normal, false, err
+		}
+	}
+	return mode, true, nil
+}
+
+// blendOptions are the options every blend of a command uses, --linear
+// mixes the colors as light
+func blendOptions(opacity float64) []blend.Option {
+	return []blend.Option{blend.Opacity(opacity), blend.Linear(opts.Linear)}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"pix/pkg/blend"
 	"pix/pkg/filters"
 	"pix/pkg/glitch"
 	dither2 "pix/pkg/glitch/dither"
@@ -118,9 +119,15 @@ func (d *Dither) DitherODM(img image.Image, op string, pal []color.Color) (image
 	return dx.Dither(img), nil
 }
 
+// ditherStep is one error diffusion or ordered dither pass, names are resolved
+// once so a random pick is the same for every frame of an animation
+type ditherStep struct {
+	matrix dither.ErrorDiffusionMatrix
+	mapper dither.PixelMapper
+}
+
 func (d *Dither) DitherF() error {
 	var pal color.Palette
-	var img image.Image
 
 	if d.Verbose {
 		debug = log.Printf
@@ -136,8 +143,7 @@ func (d *Dither) DitherF() error {
 		return fmt.Errorf("no image supplied")
 	}
 
-	var err error
-	img, err = openImage(inputfile)
+	frames, err := openAnimation(inputfile)
 	if err != nil {
 		return err
 	}
@@ -163,9 +169,9 @@ func (d *Dither) DitherF() error {
 	// userProvidedPallete := (len(d.Palette) < 0 && d.PaletteFile == "" && d.ColorDepth < 1)
 	userProvidedPallete := (len(d.Palette) > 1 || d.PaletteFile != "")
 
-	// if no pallette, use image
+	// if no pallette, use image, animations share the palette of their first frame
 	if d.ColorDepth > 0 && !userProvidedPallete {
-		pal = glitch.GetColorPalette(img, d.ColorDepth)
+		pal = glitch.GetColorPalette(frames.Frames[0], d.ColorDepth)
 		debug("using color palette from quantization: %v", pal)
 	}
 
@@ -173,18 +179,36 @@ func (d *Dither) DitherF() error {
 		return fmt.Errorf("pallette empty")
 	}
 
-	bounds := img.Bounds()
-	if d.Scale {
-		var sfact int
-		if d.ScaleFactor > 0 {
-			sfact = d.ScaleFactor
-		} else {
-			sfact = 2
+	steps, err := d.ditherSteps()
+	if err != nil {
+		return err
+	}
+
+	mode, blending, err := blendMode(d.Blend, d.Opacity)
+	if err != nil {
+		return err
+	}
+
+	out, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+		dithered := d.ditherFrame(img, pal, steps)
+		if blending {
+			return blend.Blend(img, dithered, mode, blendOptions(d.Opacity)...)
 		}
-		img = imaging.Resize(img, bounds.Dx()/sfact, bounds.Dy()/sfact, imaging.NearestNeighbor)
+		return dithered, nil
+	})
+	if err != nil {
+		return err
 	}
 
-	dx := dither.NewDitherer(pal)
+	if d.Output != "" {
+		return saveAnimation(out, frames, d.Output)
+	}
+
+	return nil
+}
+
+func (d *Dither) ditherSteps() ([]ditherStep, error) {
+	var steps []ditherStep
 
 	for _, input := range d.DitherType {
 		userInput := strings.ReplaceAll(strings.ToLower(input), "-", "_")
@@ -196,25 +220,25 @@ func (d *Dither) DitherF() error {
 			var ok bool
 			name, dt, ok = RandomDither()
 			if !ok {
-				return fmt.Errorf("idk what the fuck is happening sis: %v %v %v", name, d, ok)
+				return nil, fmt.Errorf("idk what the fuck is happening sis: %v %v %v", name, d, ok)
 			}
 		} else {
 			matches := fuzzy.Find(userInput, DitherList)
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("ditherer not recognized: %v\naccepted values: %v", input, DitherList)
+			}
 			debug("score: %v", matches[0].Score)
 			name = matches[0].Str
 
 			var ok bool
 			dt, ok = ditherers[matches[0].Str]
 			if !ok {
-				return fmt.Errorf("ditherer not recognized: %v\naccepted values: %v", input, DitherList)
+				return nil, fmt.Errorf("ditherer not recognized: %v\naccepted values: %v", input, DitherList)
 			}
 		}
 
-		fmt.Printf("running dither: %v\n", name)
-		dx.Matrix = dt
-		dx.Serpentine = true
-		img = dx.Dither(img)
-		dx.Matrix = nil
+		fmt.Fprintf(os.Stderr, "running dither: %v\n", name)
+		steps = append(steps, ditherStep{matrix: dt})
 	}
 
 	for _, input := range d.ODM {
@@ -228,21 +252,50 @@ func (d *Dither) DitherF() error {
 			var ok bool
 			name, matrix, ok = RandomMatrix()
 			if !ok {
-				return fmt.Errorf("idk what the fuck is happening sis: %v %v %v", name, matrix, ok)
+				return nil, fmt.Errorf("idk what the fuck is happening sis: %v %v %v", name, matrix, ok)
 			}
 		} else {
 			var ok bool
 			matches := fuzzy.Find(userInput, MatrixList)
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("matrix type not found: %v", input)
+			}
 			name = matches[0].Str
 
 			matrix, ok = odmName[name]
 			if !ok {
-				return fmt.Errorf("matrix type not found: %v", input)
+				return nil, fmt.Errorf("matrix type not found: %v", input)
 			}
 		}
 
-		fmt.Printf("running dither matrix: %v\n", name)
-		dx.Mapper = dither.PixelMapperFromMatrix(matrix, float32(d.Threshold))
+		fmt.Fprintf(os.Stderr, "running dither matrix: %v\n", name)
+		steps = append(steps, ditherStep{mapper: dither.PixelMapperFromMatrix(matrix, float32(d.Threshold))})
+	}
+
+	return steps, nil
+}
+
+// ditherFrame runs every dither pass over a single image
+func (d *Dither) ditherFrame(img image.Image, pal color.Palette, steps []ditherStep) image.Image {
+	bounds := img.Bounds()
+	if d.Scale {
+		var sfact int
+		if d.ScaleFactor > 0 {
+			sfact = d.ScaleFactor
+		} else {
+			sfact = 2
+		}
+		img = imaging.Resize(img, bounds.Dx()/sfact, bounds.Dy()/sfact, imaging.NearestNeighbor)
+	}
+
+	for _, step := range steps {
+		dx := dither.NewDitherer(pal)
+		if step.matrix != nil {
+			dx.Matrix = step.matrix
+			dx.Serpentine = true
+		} else {
+			dx.Mapper = step.mapper
+		}
 		img = dx.Dither(img)
 	}
 
@@ -266,23 +319,7 @@ func (d *Dither) DitherF() error {
 		img = imaging.Resize(img, bounds.Dx(), bounds.Dy(), imaging.NearestNeighbor)
 	}
 
-	if d.Output == "-" {
-		WriteImageToStdout(img)
-		return nil
-	}
-
-	if d.Output != "" {
-		f, err := os.Create(string(d.Output))
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-
-		debug("saving image: %s", d.Output)
-		SaveImageToPNG(img, string(d.Output))
-	}
-
-	return nil
+	return img
 }
 
 func (d *Dither) DitherImage() error {
@@ -1,80 +1,329 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image"
-	"image/gif"
-	_ "image/jpeg"
 	"image/png"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"pix/pkg/anim"
+	"pix/pkg/gifenc"
+	"pix/pkg/icc"
+	"pix/pkg/imaging"
 )
 
-func SaveImageToPNG(img image.Image, filename string) error {
-	file, err := os.Create(filename)
+// stdio is the file name used to read from stdin or write to stdout
+const stdio = "-"
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// openInput opens a file for reading, "-" reads stdin
+func openInput(name string) (io.ReadCloser, error) {
+	if name == stdio {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// createOutput creates a file for writing, "-" writes to stdout
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == stdio {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(name)
+}
+
+// outputFormat picks the format to encode to, --format wins over the file
+// extension and stdout or files without an extension default to PNG
+func outputFormat(filename string) (imaging.Format, error) {
+	f, err := pickFormat(filename)
+	if err == nil && f == imaging.WEBP {
+		return -1, fmt.Errorf("webp images can be read but not written, use png or qoi for lossless output")
+	}
+	return f, err
+}
+
+func pickFormat(filename string) (imaging.Format, error) {
+	if opts.Format != "" {
+		f, err := imaging.FormatFromExtension(opts.Format)
+		if err != nil {
+			return -1, fmt.Errorf("unknown format %q: must be one of [png|jpeg|gif|tiff|bmp|qoi|pbm|pgm|ppm|pam]", opts.Format)
+		}
+		return f, nil
+	}
+
+	if filename == stdio || filepath.Ext(filename) == "" {
+		return imaging.PNG, nil
+	}
+
+	f, err := imaging.FormatFromFilename(filename)
 	if err != nil {
-		return err
+		return -1, fmt.Errorf("unknown output extension %q: must be one of [png|jpg|jpeg|gif|tif|tiff|bmp|qoi|pbm|pgm|ppm|pnm|pam] or set --format", filepath.Ext(filename))
+	}
+	return f, nil
+}
+
+// encodeOptions turns the global --quality and --png-compression flags into encoder settings
+func encodeOptions() ([]imaging.EncodeOption, error) {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = 95
+	}
+	if quality < 1 || quality > 100 {
+		return nil, fmt.Errorf("--quality must be between 1 and 100")
 	}
-	defer file.Close()
 
-	err = png.Encode(file, img)
+	level, err := pngCompression()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// inputs with other color profiles are converted to sRGB when they're read,
+	// --tag-srgb says so in the output
+	return []imaging.EncodeOption{
+		imaging.JPEGQuality(quality),
+		imaging.PNGCompressionLevel(level),
+		imaging.TagSRGB(opts.TagSRGB),
+	}, nil
+}
+
+// pngCompression parses the global --png-compression flag
+func pngCompression() (png.CompressionLevel, error) {
+	switch strings.ToLower(opts.PNGCompression) {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "none", "no":
+		return png.NoCompression, nil
+	case "fast", "speed":
+		return png.BestSpeed, nil
+	case "best", "size":
+		return png.BestCompression, nil
 	}
+	return 0, fmt.Errorf("unknown png compression %q: must be one of [default|none|fast|best]", opts.PNGCompression)
+}
 
-	return nil
+// isAPNG reports whether an animation should be written as an APNG rather
+// than a GIF, going by the extension or --format for stdout
+func isAPNG(filename string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if filename == stdio || opts.Format != "" {
+		ext = strings.ToLower(opts.Format)
+	}
+	return ext == "apng" || ext == "png"
 }
 
-func WriteImageToStdout(img image.Image) error {
-	return png.Encode(os.Stdout, img)
+// gifOptions turns the global --gif-* flags into encoder settings
+func gifOptions() ([]gifenc.Option, error) {
+	var gifOpts []gifenc.Option
+
+	if opts.GIFColors != 0 {
+		gifOpts = append(gifOpts, gifenc.Colors(opts.GIFColors))
+	}
+
+	switch strings.ToLower(opts.GIFPalette) {
+	case "", "global":
+	case "frame", "local":
+		gifOpts = append(gifOpts, gifenc.FramePalettes(true))
+	default:
+		return nil, fmt.Errorf("unknown gif palette %q: must be one of [global|frame]", opts.GIFPalette)
+	}
+
+	if opts.GIFDither != "" {
+		d, err := gifenc.ParseDither(opts.GIFDither)
+		if err != nil {
+			return nil, err
+		}
+		gifOpts = append(gifOpts, gifenc.Dithering(d))
+	}
+
+	return gifOpts, nil
 }
 
-func SaveAsGif(g *gif.GIF, filename string) error {
-	file, err := os.Create(filename)
+// saveImage encodes img to filename, or stdout for "-", in the format from
+// --format or the file extension. input is what the effect was applied to,
+// --mask blends img back into it.
+func saveImage(img image.Image, input *anim.Animation, filename string) error {
+	format, err := outputFormat(filename)
+	if err != nil {
+		return err
+	}
+
+	img, err = maskedImage(input, img)
+	if err != nil {
+		return err
+	}
+
+	encOpts, err := encodeOptions()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	err = gif.EncodeAll(file, g)
+	file, err := createOutput(filename)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	debug("saving %s image: %s", format, filename)
+	err = imaging.Encode(file, img, format, encOpts...)
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	return err
 }
 
-func openGif(imgpath string) (*gif.GIF, error) {
-	file, err := os.Open(imgpath)
+// openAnimation reads every frame of a gif, an apng or a directory of frames,
+// any other image is a single frame
+func openAnimation(imgpath string) (*anim.Animation, error) {
+	if info, err := os.Stat(imgpath); err == nil && info.IsDir() {
+		return anim.ReadDir(imgpath)
+	}
+
+	file, err := openInput(imgpath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	// gifs are messed up af
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error while decoding: %s", r)
+	a, err := anim.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w - known image formats are jpeg, png, gif, tiff, bmp, webp, qoi and pnm", err)
+	}
+
+	return a, nil
+}
+
+// saveAnimation writes a gif for .gif, an apng for .apng/.png or stdout and
+// a directory of frames for names ending in / or without an extension. A
+// single frame is saved like any other image. input is what --mask blends the
+// frames back into.
+func saveAnimation(a, input *anim.Animation, filename string) error {
+	if a.Len() == 1 {
+		return saveImage(a.Frames[0], input, filename)
+	}
+
+	a, err := masked(input, a)
+	if err != nil {
+		return err
+	}
+
+	if filename != stdio && (strings.HasSuffix(filename, "/") || filepath.Ext(filename) == "") {
+		format, err := outputFormat(filename)
+		if err != nil {
+			return err
+		}
+
+		encOpts, err := encodeOptions()
+		if err != nil {
+			return err
 		}
-	}()
 
-	img, err := gif.DecodeAll(file)
+		debug("saving %d %s frames to: %s", a.Len(), format, filename)
+		return a.WriteDir(filename, format, encOpts...)
+	}
+
+	if isAPNG(filename) || (filename == stdio && opts.Format == "") {
+		level, err := pngCompression()
+		if err != nil {
+			return err
+		}
+
+		return writeAnimation(filename, func(w io.Writer) error {
+			debug("saving %d frame APNG: %s", a.Len(), filename)
+			var buf bytes.Buffer
+			if err := a.EncodeAPNG(&buf, level); err != nil {
+				return err
+			}
+			data := buf.Bytes()
+			if opts.TagSRGB {
+				data = icc.TagPNG(data)
+			}
+			_, err := w.Write(data)
+			return err
+		})
+	}
+
+	if format, err := pickFormat(filename); err != nil || format != imaging.GIF {
+		return fmt.Errorf("animations can only be saved as gif, apng/png or a directory of frames: %s", filename)
+	}
+
+	return encodeGIF(a, filename)
+}
+
+// saveGIF encodes an animation to filename as a gif whatever the extension,
+// with -v the size is compared to the plain plan9 palette encoder
+func saveGIF(a, input *anim.Animation, filename string) error {
+	a, err := masked(input, a)
+	if err != nil {
+		return err
+	}
+	return encodeGIF(a, filename)
+}
+
+func encodeGIF(a *anim.Animation, filename string) error {
+	gifOpts, err := gifOptions()
 	if err != nil {
-		return nil, fmt.Errorf("gif decode: %v", err)
+		return err
 	}
 
-	return img, nil
+	// comparing means encoding a second time, only bother when it's printed
+	var stats gifenc.Stats
+	if opts.Verbose {
+		gifOpts = append(gifOpts, gifenc.Report(&stats))
+	}
+
+	err = writeAnimation(filename, func(w io.Writer) error {
+		debug("saving %d frame GIF: %s", a.Len(), filename)
+		return a.EncodeGIF(w, gifOpts...)
+	})
+	if err == nil && opts.Verbose {
+		debug("gif is %d bytes, %.0f%% smaller than the plan9 palette encoder (%d bytes)", stats.Size, stats.Saved()*100, stats.NaiveSize)
+	}
+	return err
+}
+
+func writeAnimation(filename string, encode func(w io.Writer) error) error {
+	file, err := createOutput(filename)
+	if err != nil {
+		return err
+	}
+
+	err = encode(file)
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+// animationName is the default output for an animated input, gifs stay gifs
+// and everything else becomes an apng
+func animationName(base, input string) string {
+	if strings.EqualFold(filepath.Ext(input), ".gif") {
+		return base + ".gif"
+	}
+	return base + ".apng"
 }
 
+// openImage decodes an image in any registered format from a file or stdin
+// for "-", the EXIF orientation of photos is applied and embedded color profiles
+// are converted to sRGB
 func openImage(imgpath string) (image.Image, error) {
-	file, err := os.Open(imgpath)
+	file, err := openInput(imgpath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	img, _, err := image.Decode(file)
+	img, err := imaging.Decode(file, imaging.AutoOrientation(true), imaging.ConvertProfile(true))
 	if err != nil {
-		return nil, fmt.Errorf("%w - known image formats are jpeg and png", err)
+		return nil, fmt.Errorf("%w - known image formats are jpeg, png, gif, tiff, bmp, webp, qoi and pnm", err)
 	}
 
 	return img, nil
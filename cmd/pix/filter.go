@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"pix/pkg/edge"
+	"pix/pkg/filters"
+	"pix/pkg/imaging"
+)
+
+// filterFrame applies every requested filter to a single image, in the order
+// they are listed in the help, edges and kernel are the parsed --edges and
+// --kernel
+func (f *Filters) filterFrame(img image.Image, edges edge.Detector, kernel *imaging.Kernel, border imaging.Border) image.Image {
+	if f.Blur > 0 {
+		if opts.Linear {
+			img = imaging.BlurLinear(img, f.Blur)
+		} else {
+			img = imaging.Blur(img, f.Blur)
+		}
+	}
+
+	if f.Sharpen > 0 {
+		img = imaging.Sharpen(img, f.Sharpen)
+	}
+
+	if kernel != nil {
+		img = imaging.Convolve(img, *kernel, &imaging.ConvolveOptions{Border: border})
+	}
+
+	if edges != nil {
+		img = edges(img)
+	}
+
+	if f.Sketch > 0 {
+		img = edge.Sketch(img, f.Sketch)
+	}
+
+	if f.Contrast != 0 {
+		img = imaging.AdjustContrast(img, f.Contrast)
+	}
+
+	if f.Brightness != 0 {
+		img = imaging.AdjustBrightness(img, f.Brightness)
+	}
+
+	if f.Saturation != 0 {
+		img = imaging.AdjustSaturation(img, f.Saturation)
+	}
+
+	if f.Gamma > 0 {
+		img = imaging.AdjustGamma(img, f.Gamma)
+	}
+
+	if f.Hue != 0 {
+		img = imaging.AdjustHue(img, f.Hue)
+	}
+
+	if f.Greyscale {
+		img = imaging.Grayscale(img)
+	}
+
+	if f.Invert {
+		img = imaging.Invert(img)
+	}
+
+	if f.Emboss {
+		img = filters.Emboss(img)
+	}
+
+	if f.Bloom {
+		img = filters.Bloom(img)
+	}
+
+	return img
+}
+
+// deep reports whether the filters can run on a 16-bit image without losing
+// precision, edges, sketches, emboss, bloom and masks only work at 8 bits
+func (f *Filters) deep() bool {
+	return f.Edges == "" && f.Sketch <= 0 && !f.Emboss && !f.Bloom && opts.Mask == ""
+}
+
+// kernel parses --kernel and --border, the kernel is read from a file when
+// --kernel names one
+func (f *Filters) kernel() (*imaging.Kernel, imaging.Border, error) {
+	border := imaging.BorderClamp
+	if f.Border != "" {
+		var err error
+		if border, err = imaging.ParseBorder(f.Border); err != nil {
+			return nil, border, err
+		}
+	}
+	if f.Kernel == "" {
+		return nil, border, nil
+	}
+
+	spec := f.Kernel
+	if info, err := os.Stat(spec); err == nil && info.Mode().IsRegular() {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, border, err
+		}
+		spec = string(data)
+	}
+
+	kernel, err := imaging.ParseKernel(spec)
+	if err != nil {
+		return nil, border, err
+	}
+	return &kernel, border, nil
+}
+
+// filterFloat is filterFrame at float precision
+func (f *Filters) filterFloat(img *imaging.FloatImage, kernel *imaging.Kernel, border imaging.Border) *imaging.FloatImage {
+	if f.Blur > 0 {
+		img = imaging.BlurFloat(imaging.ToFloat(img, opts.Linear), f.Blur)
+		img = imaging.ToFloat(img, false)
+	}
+
+	if f.Sharpen > 0 {
+		img = imaging.SharpenFloat(img, f.Sharpen)
+	}
+
+	if kernel != nil {
+		img = imaging.ConvolveFloat(img, *kernel, &imaging.ConvolveOptions{Border: border})
+	}
+
+	if f.Contrast != 0 {
+		img = imaging.AdjustContrastFloat(img, f.Contrast)
+	}
+
+	if f.Brightness != 0 {
+		img = imaging.AdjustBrightnessFloat(img, f.Brightness)
+	}
+
+	if f.Saturation != 0 {
+		img = imaging.AdjustSaturationFloat(img, f.Saturation)
+	}
+
+	if f.Gamma > 0 {
+		img = imaging.AdjustGammaFloat(img, f.Gamma)
+	}
+
+	if f.Hue != 0 {
+		img = imaging.AdjustHueFloat(img, f.Hue)
+	}
+
+	if f.Greyscale {
+		img = imaging.GrayscaleFloat(img)
+	}
+
+	if f.Invert {
+		img = imaging.InvertFloat(img)
+	}
+
+	return img
+}
+
+func (f *Filters) Run() error {
+	var inputfile string
+	if f.Input != "" {
+		inputfile = string(f.Input)
+	} else if f.Args.Image != "" {
+		inputfile = f.Args.Image
+	} else {
+		return fmt.Errorf("no image supplied")
+	}
+
+	var edges edge.Detector
+	if f.Edges != "" {
+		var err error
+		if edges, err = edge.Parse(f.Edges); err != nil {
+			return err
+		}
+	}
+
+	kernel, border, err := f.kernel()
+	if err != nil {
+		return err
+	}
+
+	frames, err := openAnimation(inputfile)
+	if err != nil {
+		return err
+	}
+
+	outname := f.Output
+	if outname == "" {
+		outname = "output.png"
+		if frames.Len() > 1 {
+			outname = animationName("output", inputfile)
+		}
+	}
+
+	// 16-bit stills stay 16-bit in formats that can store it
+	if frames.Deep != nil && f.deep() {
+		debug("filtering at 16 bits per channel")
+		img := f.filterFloat(imaging.ToFloat(frames.Deep, false), kernel, border)
+		return saveImage(img.NRGBA64(), frames, outname)
+	}
+
+	out, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+		return f.filterFrame(img, edges, kernel, border), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveAnimation(out, frames, outname)
+}
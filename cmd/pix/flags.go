@@ -42,6 +42,20 @@ import (
 type Options struct {
 	Verbose bool `short:"v" long:"verbose" description:"print debugging information and verbose output"`
 	Version bool `short:"V" long:"version" description:"display version info and exit"`
+
+	Format         string `long:"format" description:"output image format, defaults to the output file extension or png [png|jpeg|gif|tiff|bmp|qoi|pbm|pgm|ppm|pam]"`
+	Quality        int    `long:"quality" description:"jpeg output quality from 1 - 100 [95]"`
+	PNGCompression string `long:"png-compression" description:"png compression level [default|none|fast|best]"`
+	GIFColors      int    `long:"gif-colors" description:"most colors in a gif palette from 2 - 256 [256]"`
+	GIFPalette     string `long:"gif-palette" description:"quantize one palette for the whole gif or one for every frame [global|frame]"`
+	GIFDither      string `long:"gif-dither" description:"dithering used when reducing gif colors [fs|none|ordered|bluenoise]"`
+
+	Mask       string  `long:"mask" description:"only apply the effect inside a mask: an image file, rect:x0,y0,x1,y1, ellipse:x0,y0,x1,y1, poly:x,y,x,y,x,y..., luma:min,max, hue:degrees,width or subject (coordinates can be a % of the image)"`
+	MaskInvert bool    `long:"mask-invert" description:"apply the effect outside the mask instead"`
+	Feather    float64 `long:"feather" description:"soften the edge of the mask over N pixels"`
+
+	Linear  bool `long:"linear" description:"resize, blur and blend in linear light instead of on sRGB values, fine detail and fades keep their brightness"`
+	TagSRGB bool `long:"tag-srgb" description:"mark png and apng output with an sRGB chunk and embed an sRGB profile in jpeg output"`
 }
 
 type Pixels struct {
@@ -54,18 +68,20 @@ type Pixels struct {
 }
 
 type Ascii struct {
-	Input         string  `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument)"`
-	Output        string  `short:"o" long:"output" description:"save image/gif as output file"`
+	Input         string  `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output        string  `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
 	Charset       string  `short:"c" long:"charset" description:"character set to use from lightest to darkest ie (.*!@#$%)"`
 	CharsetPreset string  `short:"C" long:"char-preset" description:"character preset to use [limited|extended|block] "`
 	FontPT        float64 `short:"p" long:"font-size" description:"font size to use"`
 	Font          string  `short:"f" long:"font" description:"font to use, must be monospaced"`
 	Interpolate   bool    `short:"I" long:"interpolate" description:"interpolate font so that when converting successive images (gifs) the font changes less"`
 	Noise         int     `short:"n" long:"noise" description:"add random noise"`
+	Edges         float64 `short:"e" long:"edges" description:"draw strong edges with | / - \\ along their direction, how strong from 0 - 1, 0.2 is a good start"`
 	FFMpegArgs    string  `short:"F" long:"ffmpeg" description:"extra ffmpeg args to use when converting videos"`
 
-	Gif   bool `short:"g" long:"gif" description:"output as gif"`
-	Video bool `short:"v" long:"video" description:"process each frame of a video or gif"`
+	Gif      bool `short:"g" long:"gif" description:"output as gif"`
+	Animated bool `short:"a" long:"animated" description:"output an animation, full color APNG for .apng/.png outputs or GIF for .gif (animated inputs always keep every frame)"`
+	Video    bool `short:"v" long:"video" description:"process each frame of a video or gif"`
 
 	Args struct {
 		Image string
@@ -74,8 +90,8 @@ type Ascii struct {
 
 type Dither struct {
 	Verbose      bool     `short:"v" long:"verbose" description:"print debugging information and verbose output"`
-	Input        string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument)"`
-	Output       string   `short:"o" long:"output" description:"save image/gif as output file"`
+	Input        string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output       string   `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
 	Threshold    float64  `short:"t" long:"threshold" description:"float from 0.0 - 1.0"`
 	Palette      []string `short:"p" long:"palette" description:"supply a set of hex colors to apply a color dithering effect, reduces colors to the closest supplied color for each pixel"`
 	PaletteFile  string   `short:"P" long:"palette-file" description:"supply a set of colors from a file, uses regex to extract any valid hex color (can use messy files, like terminal theme files, json, etc...)"`
@@ -90,13 +106,66 @@ type Dither struct {
 	ListMatrices bool     `short:"x" long:"ls-matrix" description:"list matrix map filters"`
 	ODM          []string `short:"m" long:"ordered" description:"ordered dither matrix type dithering"`
 
+	Blend   string  `long:"blend" description:"composite the dither over the original with a blend mode [normal|multiply|screen|overlay|soft-light|hard-light|color-dodge|color-burn|linear-dodge|linear-burn|difference|exclusion|hue|saturation|color|luminosity]"`
+	Opacity float64 `long:"opacity" default:"1" description:"opacity of the dither over the original from 0.0 - 1.0"`
+
 	Args struct {
 		Image string
 	} `positional-args:"yes" positional-arg-name:"IMAGE"`
 }
 
 type Filters struct {
-	Amount float64 `short:"t" long:"threshold" description:"glitch threshold"`
+	Input      string  `short:"i" long:"input" description:"input image file, gif, apng or directory of frames, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output     string  `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
+	Blur       float64 `short:"b" long:"blur" description:"gaussian blur sigma"`
+	Sharpen    float64 `short:"s" long:"sharpen" description:"sharpen sigma"`
+	Kernel     string  `short:"K" long:"kernel" description:"convolve with a kernel written as its size and weights eg \"3x3: 0 -1 0 -1 5 -1 0 -1 0\", a file holding one, or a built-in [box|gaussian|motion|unsharp|sharpen|outline|ridge|emboss] with settings after a colon eg motion:15,45"`
+	Border     string  `long:"border" description:"how the kernel reads past the edges of the image [clamp|wrap|mirror|constant]"`
+	Edges      string  `short:"E" long:"edges" description:"replace the image with its edges in white on black [sobel|scharr|prewitt|log|canny|dog|xdog], settings follow a colon eg canny:1.4,0.1,0.25"`
+	Sketch     float64 `short:"k" long:"sketch" description:"pencil sketch, the value is the size of the strokes, 8 is a good start"`
+	Contrast   float64 `short:"c" long:"contrast" description:"change contrast by a percentage from -100 to 100"`
+	Brightness float64 `short:"l" long:"brightness" description:"change brightness by a percentage from -100 to 100"`
+	Saturation float64 `short:"S" long:"saturation" description:"change saturation by a percentage from -100 to 500"`
+	Gamma      float64 `short:"g" long:"gamma" description:"gamma correction, less than 1 darkens and more than 1 lightens"`
+	Hue        float64 `short:"u" long:"hue" description:"rotate hue by degrees from -180 to 180"`
+	Greyscale  bool    `short:"G" long:"greyscale" description:"convert to greyscale"`
+	Invert     bool    `short:"n" long:"invert" description:"invert colors"`
+	Emboss     bool    `short:"e" long:"emboss" description:"emboss"`
+	Bloom      bool    `short:"B" long:"bloom" description:"bloom the highlights"`
+
+	Args struct {
+		Image string
+	} `positional-args:"yes" positional-arg-name:"IMAGE"`
+}
+
+type Paint struct {
+	Input    string  `short:"i" long:"input" description:"input image file, gif, apng or directory of frames, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output   string  `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
+	Style    string  `short:"t" long:"style" default:"anisotropic" description:"smoothing filter to paint with [kuwahara|generalized|anisotropic|bilateral|guided|median]"`
+	Radius   int     `short:"r" long:"radius" default:"6" description:"size of the strokes in pixels"`
+	Strength float64 `short:"x" long:"strength" description:"how flat the strokes are, the sharpness of the blend for generalized and anisotropic (8), the color sigma for bilateral (30) and epsilon for guided (0.02)"`
+	Passes   int     `short:"p" long:"passes" default:"1" description:"times to run the filter, more passes flatten more"`
+
+	Args struct {
+		Image string
+	} `positional-args:"yes" positional-arg-name:"IMAGE"`
+}
+
+type Resize struct {
+	Input        string `short:"i" long:"input" description:"input image file, gif, apng or directory of frames, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output       string `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
+	Width        int    `short:"W" long:"width" description:"output width, 0 keeps the aspect ratio or the width with --content-aware"`
+	Height       int    `short:"H" long:"height" description:"output height, 0 keeps the aspect ratio or the height with --content-aware"`
+	Ratio        string `short:"r" long:"ratio" description:"change the aspect ratio eg 16:9 or 21:9 by cropping the longer side, or carving it with --content-aware"`
+	Expand       bool   `long:"expand" description:"reach --ratio by growing the shorter side with --content-aware instead"`
+	ContentAware bool   `short:"c" long:"content-aware" description:"seam carve, remove or duplicate the least detailed paths through the image instead of scaling it"`
+	Protect      string `long:"protect" description:"mask of what seams must avoid, the same specs as --mask eg subject"`
+	Remove       string `long:"remove" description:"mask of what to carve out of the image first, the same specs as --mask"`
+	Backward     bool   `long:"backward-energy" description:"find seams by the gradient alone, straight lines may bend"`
+
+	Args struct {
+		Image string
+	} `positional-args:"yes" positional-arg-name:"IMAGE"`
 }
 
 // color palette generation
@@ -105,11 +174,16 @@ type Pally struct {
 	Palette     []string `short:"p" long:"palette" description:"supply a set of hex colors to apply a color dithering effect, reduces colors to the closest supplied color for each pixel"`
 	PaletteFile string   `short:"P" long:"palette-file" description:"supply a set of colors from a file, uses regex to extract any valid hex color (can use messy files, like terminal theme files, json, etc...)"`
 	ColorDepth  int      `short:"c" long:"color-depth" description:"create palette from the supplied image of N colors. Less is more aesthetic, more is more accurate to source."`
-	Input       string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument)"`
-	Output      string   `short:"o" long:"output" description:"save image/gif as output file"`
+	Input       string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output      string   `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
 	ApplyColor  bool     `short:"a" long:"apply" description:"apply a palette to an image - must provide an input image"`
 	PrintAnsi   bool     `short:"e" long:"ansi" description:"print ANSI escape codes for each color"`
 
+	GradientMap string `short:"g" long:"gradient-map" description:"map the lightness of the image through a gradient of the colors instead of snapping to the nearest one: palette (the colors in order), duotone, tritone or a preset [sepia|cyanotype|noir|gameboy|synthwave|sunset|thermal]"`
+	Interpolate string `long:"interpolate" default:"oklab" description:"color space the gradient blends in [oklab|lch|linear]"`
+	Stops       string `long:"stops" description:"comma separated positions of the gradient colors from 0.0 - 1.0, evenly spaced by default"`
+	Sort        bool   `long:"sort" description:"sort the colors from dark to light before building the gradient"`
+
 	Args struct {
 		Image string
 	} `positional-args:"yes" positional-arg-name:"IMAGE"`
@@ -117,6 +191,7 @@ type Pally struct {
 
 type Glitch struct {
 	Gif         bool     `short:"g" long:"gif" description:"create a gif"`
+	Animated    bool     `short:"a" long:"animated" description:"create an animation, full color APNG for .apng/.png outputs or GIF for .gif"`
 	Verbose     bool     `short:"v" long:"verbose" description:"verbose output - show glitch steps as they occur"`
 	Palette     []string `short:"p" long:"palette" description:"supply a set of hex colors to apply a color dithering effect, reduces colors to the closest supplied color for each pixel"`
 	PaletteFile string   `short:"P" long:"palette-file" description:"supply a set of colors from a file, uses regex to extract any valid hex color (can use messy files, like terminal theme files, json, etc...)"`
@@ -125,8 +200,36 @@ type Glitch struct {
 	FrameDelay  int      `short:"d" long:"delay" description:"delay in between frames in milliseconds"`
 	FrameCount  int      `short:"f" long:"frames" description:"amount of frames to create and glitch"`
 	ColorDepth  int      `short:"c" long:"color-depth" description:"create palette from the supplied image of N colors. Less is more aesthetic, more is more accurate to source."`
-	Input       string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument)"`
-	Output      string   `short:"o" long:"output" description:"save image/gif as output file"`
+	Input       string   `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Output      string   `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
+
+	Databend          string  `short:"b" long:"databend" description:"corrupt the compressed bytes of the image instead of shifting pixels [jpeg|png]"`
+	DatabendIntensity float64 `short:"B" long:"databend-intensity" default:"0.3" description:"how much of the image to corrupt from 0.0 - 1.0"`
+
+	Only           []string `long:"only" description:"only pick from these transforms, comma separated or repeated"`
+	Exclude        []string `long:"exclude" description:"never pick these transforms, comma separated or repeated"`
+	Weights        []string `long:"weights" description:"how often transforms are picked as name=weight, eg bayer=3 (default 1)"`
+	Iterations     int      `long:"iterations" description:"rounds of transforms to run, two transforms per round (default 11)"`
+	ListTransforms bool     `long:"ls-transforms" description:"list glitch transforms"`
+
+	Blend   string  `long:"blend" description:"composite the glitch over the original with a blend mode [normal|multiply|screen|overlay|soft-light|hard-light|color-dodge|color-burn|linear-dodge|linear-burn|difference|exclusion|hue|saturation|color|luminosity]"`
+	Opacity float64 `long:"opacity" default:"1" description:"opacity of the glitch over the original from 0.0 - 1.0"`
+
+	Recipe string  `long:"recipe" description:"save every step of the glitch to a JSON recipe"`
+	Replay string  `long:"replay" description:"replay a JSON recipe saved with --recipe, on the same or another image"`
+	Mutate float64 `long:"mutate" description:"with --replay, change the recipe from 0.0 - 1.0 for a variation of the glitch (-s seeds the changes)"`
+
+	Sonify       string `short:"S" long:"sonify" description:"run the pixels through a chain of audio effects instead of shifting them, eg \"echo:0.3,0.5;bitcrush:4\""`
+	SonifyOrder  string `long:"sonify-order" default:"rows" description:"order the pixels are played in [rows|columns|planar]"`
+	SonifyExport string `long:"sonify-export" description:"write the pixels (after --sonify) to an 8 bit WAV to edit in an audio editor instead of saving an image"`
+	SonifyImport string `long:"sonify-import" description:"read the pixels back from an edited WAV, the input image gives the size"`
+
+	Datamosh     bool    `short:"m" long:"datamosh" description:"smear the frames of an animation or video along their motion, like a video with its keyframes removed"`
+	MoshKeyframe int     `long:"mosh-keyframe" description:"let a real frame through every N frames, 0 only keeps the first"`
+	MoshBlock    int     `long:"mosh-block" default:"16" description:"size of the blocks motion is tracked for"`
+	MoshBlend    float64 `long:"mosh-blend" description:"mix the real frames back in from 0.0 - 1.0"`
+	Video        bool    `long:"video" description:"process each frame of a video with ffmpeg, -o is the output video"`
+	FFMpegArgs   string  `short:"F" long:"ffmpeg" description:"extra ffmpeg args to use when converting videos"`
 
 	Args struct {
 		Image string
@@ -134,15 +237,18 @@ type Glitch struct {
 }
 
 type VHS struct {
-	Input       string  `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument)"`
-	Overlay     string  `short:"m" long:"mask" description:"image to overlay over the base image (pixel images)"`
-	Output      string  `short:"o" long:"output" description:"save image/gif as output file"`
+	Input       string  `short:"i" long:"input" description:"input image file, explicit flag (also accepts a trailing positional argument), use - for stdin"`
+	Overlay     string  `short:"m" long:"overlay" description:"image to overlay over the base image (pixel images)"`
+	Output      string  `short:"o" long:"output" description:"save image/gif as output file, use - for stdout"`
 	Mix         int     `short:"x" long:"mix" description:"idk"`
 	Gif         bool    `short:"g" long:"gif" description:"output as gif"`
 	Video       bool    `short:"v" long:"video" description:"process each frame of a video or gif"`
 	Scale       bool    `short:"s" long:"scale" description:"rescale image down and then up to accentuate fx"`
 	ScaleFactor float64 `short:"S" long:"scale-factor" description:"the amount to resize the dither effect"`
 
+	Blend   string  `long:"blend" description:"composite the overlay over every frame with a blend mode before the vhs effect [normal|multiply|screen|overlay|soft-light|hard-light|color-dodge|color-burn|linear-dodge|linear-burn|difference|exclusion|hue|saturation|color|luminosity]"`
+	Opacity float64 `long:"opacity" default:"1" description:"opacity of the overlay from 0.0 - 1.0"`
+
 	Args struct {
 		Image string
 	} `positional-args:"yes" positional-arg-name:"IMAGE"`
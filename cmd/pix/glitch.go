@@ -1,22 +1,35 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
 	_ "image/jpeg"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
+	"pix/pkg/anim"
+	"pix/pkg/ascii/video"
 	"pix/pkg/colors"
 	"pix/pkg/glitch"
+	"pix/pkg/glitch/databend"
+	"pix/pkg/glitch/sonify"
 )
 
 func (g *Glitch) GlitchImage() error {
 	var pal color.Palette
 	var img image.Image
 
+	if g.ListTransforms {
+		for _, t := range glitch.Registered() {
+			fmt.Fprintf(os.Stdout, "%s\t%v\n", t.Name, t.Weight)
+		}
+		return nil
+	}
+
 	cparser := colors.NewParser()
 
 	// open image file
@@ -29,16 +42,21 @@ func (g *Glitch) GlitchImage() error {
 		return fmt.Errorf("no image supplied")
 	}
 
-	var err error
-	img, err = openImage(inputfile)
-	if err != nil {
-		return err
-	}
-
 	if g.Verbose {
 		glitch.GlitchSetDebug(true)
 	}
 
+	// videos are streamed through ffmpeg a frame at a time
+	var frames *anim.Animation
+	var err error
+	if !g.Video {
+		frames, err = openAnimation(inputfile)
+		if err != nil {
+			return err
+		}
+		img = frames.Frames[0]
+	}
+
 	if len(g.Palette) > 0 {
 		err := cparser.ParseString(strings.Join(g.Palette, " "))
 		if err != nil {
@@ -63,6 +81,9 @@ func (g *Glitch) GlitchImage() error {
 	}
 
 	// if no pallette, use image
+	if g.ColorDepth > 0 && g.Video {
+		return fmt.Errorf("color depth needs an image to build the palette from, it can't be used with --video")
+	}
 	if g.ColorDepth > 0 {
 		pal = glitch.GetColorPalette(img, g.ColorDepth)
 	}
@@ -89,50 +110,330 @@ func (g *Glitch) GlitchImage() error {
 		oppys = append(oppys, glitch.GlitchFrameDelay(g.FrameDelay))
 	}
 
+	if only := splitList(g.Only); len(only) > 0 {
+		oppys = append(oppys, glitch.GlitchOnly(only...))
+	}
+
+	if exclude := splitList(g.Exclude); len(exclude) > 0 {
+		oppys = append(oppys, glitch.GlitchExclude(exclude...))
+	}
+
+	if len(g.Weights) > 0 {
+		weights := map[string]float64{}
+		for _, w := range splitList(g.Weights) {
+			name, value, ok := strings.Cut(w, "=")
+			weight, err := strconv.ParseFloat(value, 64)
+			if !ok || err != nil {
+				return fmt.Errorf("bad weight %q: must be name=weight", w)
+			}
+			weights[name] = weight
+		}
+		oppys = append(oppys, glitch.GlitchWeights(weights))
+	}
+
+	if g.Iterations > 0 {
+		oppys = append(oppys, glitch.GlitchIterations(g.Iterations))
+	}
+
+	mode, blending, err := blendMode(g.Blend, g.Opacity)
+	if err != nil {
+		return err
+	}
+	if blending {
+		oppys = append(oppys, glitch.GlitchBlend(mode, g.Opacity), glitch.GlitchBlendLinear(opts.Linear))
+	}
+
+	if g.Databend != "" {
+		format, err := databend.ParseFormat(g.Databend)
+		if err != nil {
+			return err
+		}
+		oppys = append(oppys, glitch.GlitchDatabend(format, g.DatabendIntensity))
+	}
+
+	if g.Sonify != "" || g.SonifyExport != "" || g.SonifyImport != "" {
+		chain, err := sonify.ParseChain(g.Sonify)
+		if err != nil {
+			return err
+		}
+		order, err := sonify.ParseOrder(g.SonifyOrder)
+		if err != nil {
+			return err
+		}
+		sopts := []sonify.Option{sonify.Ordering(order)}
+
+		if (g.SonifyExport != "" || g.SonifyImport != "") && (g.Video || frames.Len() > 1) {
+			return fmt.Errorf("wav export and import only work on still images")
+		}
+
+		if g.SonifyImport != "" {
+			if img, err = importWAV(g.SonifyImport, img, sopts); err != nil {
+				return err
+			}
+			frames = anim.New([]image.Image{img}, 0)
+		}
+
+		if g.SonifyExport != "" {
+			return exportWAV(g.SonifyExport, img, chain, sopts)
+		}
+
+		oppys = append(oppys, glitch.GlitchSonify(chain, order))
+	}
+
 	var outname string
 	if g.Output != "" {
 		outname = string(g.Output)
 	}
 
-	if g.Gif {
+	replay, err := g.replay()
+	if err != nil {
+		return err
+	}
+	if (g.Recipe != "" || replay != nil) && (g.Video || g.Datamosh) {
+		return fmt.Errorf("recipes can't record or replay --video or --datamosh")
+	}
+
+	var recipe glitch.Recipe
+	if g.Recipe != "" {
+		oppys = append(oppys, glitch.GlitchRecord(&recipe))
+	}
+
+	if g.Video {
+		return g.GlitchVideo(inputfile, outname, oppys)
+	}
+
+	// animated inputs glitch every frame instead of generating frames from one image
+	if frames.Len() > 1 {
 		if outname == "" {
-			outname = "output.gif"
+			outname = animationName("output", inputfile)
 		}
 
-		if path.Ext(outname) != ".gif" {
-			outname = strings.TrimSuffix(outname, path.Ext(outname)) + ".gif"
+		var out *anim.Animation
+		if g.Datamosh {
+			out, err = g.mosh(frames)
+		} else {
+			// frames are glitched in parallel, each records its own recipe
+			recipes := make([]glitch.Recipe, frames.Len())
+			out, err = frames.Map(0, func(i int, img image.Image) (image.Image, error) {
+				opts := oppys
+				if g.Recipe != "" {
+					opts = append(opts[:len(opts):len(opts)], glitch.GlitchRecord(&recipes[i]))
+				}
+				if replay != nil {
+					opts = append(opts[:len(opts):len(opts)], glitch.GlitchReplay(replay.Frame(i)))
+				}
+				return glitch.GlitchWithOpts(img, opts...)
+			})
+
+			for i := range recipes {
+				if i == 0 {
+					recipe = recipes[0]
+				} else {
+					recipe.Frames = append(recipe.Frames, recipes[i].Frames...)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := saveAnimation(out, frames, outname); err != nil {
+			return err
+		}
+		return g.saveRecipe(&recipe)
+	}
+
+	if replay != nil {
+		oppys = append(oppys, glitch.GlitchReplay(replay))
+	}
+
+	if g.Animated && outname == "" {
+		outname = "output.apng"
+	}
+
+	if g.Gif || g.Animated {
+		if outname == "" {
+			outname = "output.gif"
 		}
 
-		outfile, err := os.Create(outname)
+		out, err := glitch.GlitchAnimation(img, oppys...)
 		if err != nil {
 			return err
 		}
-		defer outfile.Close()
 
-		_, err = glitch.GlitchGif(
-			img,
-			outfile,
-			oppys...,
-		)
+		if g.Datamosh {
+			if out, err = g.mosh(out); err != nil {
+				return err
+			}
+		}
+
+		if g.Animated && isAPNG(outname) {
+			err = saveAnimation(out, frames, outname)
+		} else {
+			// anything but an apng is a gif
+			if outname != stdio && path.Ext(outname) != ".gif" {
+				outname = strings.TrimSuffix(outname, path.Ext(outname)) + ".gif"
+			}
+			err = saveGIF(out, frames, outname)
+		}
 		if err != nil {
 			return err
 		}
+		return g.saveRecipe(&recipe)
+	}
 
-	} else {
-		if outname == "" {
-			outname = "output.png"
+	if g.Datamosh {
+		return fmt.Errorf("datamosh needs more than one frame: use an animated input, --video or -g/-a")
+	}
+
+	if outname == "" {
+		outname = "output.png"
+	}
+
+	out, err := glitch.GlitchWithOpts(
+		img,
+		oppys...,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := saveImage(out, frames, outname); err != nil {
+		return err
+	}
+	return g.saveRecipe(&recipe)
+}
+
+// replay reads the recipe to replay, mutated when asked
+func (g *Glitch) replay() (*glitch.Recipe, error) {
+	if g.Replay == "" {
+		if g.Mutate != 0 {
+			return nil, fmt.Errorf("mutate needs a recipe to change, use it with --replay")
 		}
+		return nil, nil
+	}
+
+	file, err := openInput(g.Replay)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	recipe, err := glitch.ReadRecipe(file)
+	if err != nil {
+		return nil, err
+	}
+	if g.Mutate == 0 {
+		return recipe, nil
+	}
+	return recipe.Mutate(g.Mutate, glitch.NewRand(g.Seed))
+}
 
-		out, err := glitch.GlitchWithOpts(
-			img,
-			oppys...,
-		)
+// saveRecipe writes the recorded recipe when --recipe is set
+func (g *Glitch) saveRecipe(recipe *glitch.Recipe) error {
+	if g.Recipe == "" {
+		return nil
+	}
+	if len(recipe.Frames) == 0 {
+		return fmt.Errorf("nothing was glitched to record a recipe from")
+	}
+
+	file, err := createOutput(g.Recipe)
+	if err != nil {
+		return err
+	}
+
+	err = recipe.Write(file)
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+func (g *Glitch) datamosher() (*glitch.Datamosher, error) {
+	return glitch.NewDatamosher(
+		glitch.DatamoshBlockSize(g.MoshBlock),
+		glitch.DatamoshKeyframes(g.MoshKeyframe),
+		glitch.DatamoshBlend(g.MoshBlend),
+	)
+}
+
+// mosh datamoshes the frames one at a time, every frame builds on the last
+func (g *Glitch) mosh(frames *anim.Animation) (*anim.Animation, error) {
+	m, err := g.datamosher()
+	if err != nil {
+		return nil, err
+	}
+
+	return frames.Map(1, func(_ int, img image.Image) (image.Image, error) {
+		return m.Next(img)
+	})
+}
+
+// GlitchVideo runs every frame of a video through ffmpeg, datamoshing them or
+// glitching each one on its own
+func (g *Glitch) GlitchVideo(inputfile, outname string, oppys []glitch.GlitchOption) error {
+	if outname == "" {
+		return fmt.Errorf("no output video supplied")
+	}
+	if opts.Mask != "" {
+		return fmt.Errorf("--mask can't be used with --video")
+	}
+
+	fn := func(img image.Image) (image.Image, error) {
+		return glitch.GlitchWithOpts(img, oppys...)
+	}
+	if g.Datamosh {
+		m, err := g.datamosher()
 		if err != nil {
 			return err
 		}
+		fn = m.Next
+	}
 
-		SaveImageToPNG(out, outname)
+	args := strings.Split(g.FFMpegArgs, " ")
+	return video.ConvertFunc(context.Background(), inputfile, outname, fn, args...)
+}
+
+// exportWAV writes the pixels of img to a WAV after running them through the chain
+func exportWAV(filename string, img image.Image, chain sonify.Chain, opts []sonify.Option) error {
+	sonified, err := sonify.Sonify(img, chain, opts...)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	file, err := createOutput(filename)
+	if err != nil {
+		return err
+	}
+
+	err = sonify.Export(file, sonified, opts...)
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	return err
+}
+
+// importWAV reads the pixels of an edited WAV back into img
+func importWAV(filename string, img image.Image, opts []sonify.Option) (image.Image, error) {
+	file, err := openInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return sonify.Import(file, img, opts...)
+}
+
+// splitList splits comma separated flag values, the flag can also be repeated
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
 }
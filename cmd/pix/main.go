@@ -21,6 +21,8 @@ var (
 	asciiopts  Ascii
 	coloropts  Pally
 	vhsopts    VHS
+	paintopts  Paint
+	resizeopts Resize
 )
 
 var parser = flags.NewParser(&opts, flags.Default)
@@ -35,12 +37,18 @@ func Pixxy(args []string) error {
 	case "dither":
 		ditheropts.Threshold = 0.333 // set default
 		return ditheropts.DitherImage()
+	case "filter":
+		return filteropts.Run()
 	case "ascii":
 		return asciiopts.RunAscii()
 	case "color":
 		return coloropts.GetColors()
 	case "vhs":
 		return vhsopts.Run()
+	case "paint":
+		return paintopts.Run()
+	case "resize":
+		return resizeopts.Run()
 	default:
 		return nil
 	}
@@ -82,6 +90,16 @@ func init() {
 		log.Fatal(err)
 	}
 
+	_, err = parser.AddCommand("paint", "smooth an image into painted strokes while keeping its edges", "", &paintopts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = parser.AddCommand("resize", "resize, crop or seam carve an image to a new size or aspect ratio", "", &resizeopts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	_, err = parser.AddCommand("version", "print version and debugging info", "print version and debugging info", &opts)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"pix/pkg/anim"
+	"pix/pkg/mask"
+)
+
+// masked blends the frames of a through the global --mask into the frames of
+// input, the image the effect was applied to. Animations made from a still
+// image all use that image.
+func masked(input, a *anim.Animation) (*anim.Animation, error) {
+	if opts.Mask == "" {
+		if opts.MaskInvert || opts.Feather != 0 {
+			return nil, fmt.Errorf("--mask-invert and --feather need a --mask")
+		}
+		return a, nil
+	}
+	if input == nil || input.Len() == 0 {
+		return nil, fmt.Errorf("--mask needs an input image to blend the effect into")
+	}
+	if opts.Feather < 0 {
+		return nil, fmt.Errorf("--feather must be 0 or more")
+	}
+	// the mask is drawn over the input, it can't follow pixels that moved
+	if in, out := input.Bounds(), a.Bounds(); in.Size() != out.Size() {
+		return nil, fmt.Errorf("--mask can't be used when the effect changes the size of the image (%dx%d to %dx%d)", in.Dx(), in.Dy(), out.Dx(), out.Dy())
+	}
+
+	src, err := mask.Parse(opts.Mask)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys and the subject depend on the frame, so every input frame gets its own
+	masks := make([]*image.Alpha, min(a.Len(), input.Len()))
+	for i := range masks {
+		m, err := src(input.Frames[i])
+		if err != nil {
+			return nil, err
+		}
+		if opts.MaskInvert {
+			mask.Invert(m)
+		}
+		masks[i] = mask.Feather(m, opts.Feather)
+	}
+	debug("masking %d frames with %s", a.Len(), opts.Mask)
+
+	return a.Map(0, func(i int, img image.Image) (image.Image, error) {
+		return mask.Blend(input.Frames[i%len(masks)], img, masks[i%len(masks)])
+	})
+}
+
+// maskedImage is masked for a single image
+func maskedImage(input *anim.Animation, img image.Image) (image.Image, error) {
+	if opts.Mask == "" && !opts.MaskInvert && opts.Feather == 0 {
+		return img, nil
+	}
+	a, err := masked(input, anim.New([]image.Image{img}, 0))
+	if err != nil {
+		return nil, err
+	}
+	return a.Frames[0], nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"pix/pkg/anim"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.Point{}, draw.Src)
+	return img
+}
+
+func TestMasked(t *testing.T) {
+	mask := opts.Mask
+	defer func() { opts.Mask = mask }()
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	input := anim.New([]image.Image{solidImage(20, 10, red)}, 0)
+	opts.Mask = "rect:0,0,10,10"
+
+	// an effect the size of the input only shows inside the mask
+	out, err := masked(input, anim.New([]image.Image{solidImage(20, 10, blue)}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := out.Frames[0]
+	if c := color.RGBAModel.Convert(img.At(2, 5)); c != blue {
+		t.Errorf("masked pixel is %v, want the effect", c)
+	}
+	if c := color.RGBAModel.Convert(img.At(17, 5)); c != red {
+		t.Errorf("unmasked pixel is %v, want the input", c)
+	}
+
+	// resizing, carving and ascii output move pixels away from the mask
+	for _, size := range []image.Point{{40, 20}, {16, 10}, {20, 9}} {
+		_, err := masked(input, anim.New([]image.Image{solidImage(size.X, size.Y, blue)}, 0))
+		if err == nil || !strings.Contains(err.Error(), "changes the size") {
+			t.Errorf("%v: expected an error masking a resized effect, got %v", size, err)
+		}
+	}
+
+	if _, err := masked(nil, out); err == nil {
+		t.Error("expected an error masking without an input")
+	}
+}
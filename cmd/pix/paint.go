@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"pix/pkg/imaging"
+	"pix/pkg/kuwahara"
+)
+
+// painter parses the style into a filter with the radius and strength, a
+// strength of 0 is the default for the style
+func (p *Paint) painter() (func(image.Image) *image.NRGBA, error) {
+	radius := max(p.Radius, 1)
+	strength := func(def float64) float64 {
+		if p.Strength > 0 {
+			return p.Strength
+		}
+		return def
+	}
+
+	switch strings.ToLower(p.Style) {
+	case "kuwahara":
+		return func(img image.Image) *image.NRGBA {
+			return kuwahara.KuwaharaNRGBA(imaging.Clone(img), uint(radius))
+		}, nil
+	case "generalized":
+		q := strength(8)
+		return func(img image.Image) *image.NRGBA { return kuwahara.Generalized(img, radius, q) }, nil
+	case "anisotropic":
+		q := strength(8)
+		return func(img image.Image) *image.NRGBA { return kuwahara.Anisotropic(img, radius, q) }, nil
+	case "bilateral":
+		// the blur reaches out twice its sigma
+		sigma := strength(30)
+		return func(img image.Image) *image.NRGBA { return imaging.Bilateral(img, float64(radius)/2, sigma) }, nil
+	case "guided":
+		eps := strength(0.02)
+		return func(img image.Image) *image.NRGBA { return imaging.Guided(img, radius, eps) }, nil
+	case "median":
+		return func(img image.Image) *image.NRGBA { return imaging.Median(img, radius) }, nil
+	}
+	return nil, fmt.Errorf("unknown style %q: must be one of [kuwahara|generalized|anisotropic|bilateral|guided|median]", p.Style)
+}
+
+func (p *Paint) Run() error {
+	var inputfile string
+	if p.Input != "" {
+		inputfile = p.Input
+	} else if p.Args.Image != "" {
+		inputfile = p.Args.Image
+	} else {
+		return fmt.Errorf("no image supplied")
+	}
+
+	paint, err := p.painter()
+	if err != nil {
+		return err
+	}
+
+	frames, err := openAnimation(inputfile)
+	if err != nil {
+		return err
+	}
+
+	outname := p.Output
+	if outname == "" {
+		outname = "output.png"
+		if frames.Len() > 1 {
+			outname = animationName("output", inputfile)
+		}
+	}
+
+	out, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+		dst := paint(img)
+		for i := 1; i < p.Passes; i++ {
+			dst = paint(dst)
+		}
+		return dst, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveAnimation(out, frames, outname)
+}
@@ -6,8 +6,10 @@ import (
 	"image/color"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
+	"pix/pkg/anim"
 	"pix/pkg/ansi"
 	"pix/pkg/colors"
 	"pix/pkg/quantize"
@@ -15,7 +17,7 @@ import (
 
 func (p *Pally) GetColors() error {
 	var pal color.Palette
-	var img image.Image
+	var frames *anim.Animation
 
 	cparser := colors.NewParser()
 
@@ -29,14 +31,14 @@ func (p *Pally) GetColors() error {
 
 	if inputfile != "" {
 		var err error
-		img, err = openImage(inputfile)
+		frames, err = openAnimation(inputfile)
 		if err != nil {
 			return err
 		}
 
-		// if no pallette, use image
+		// if no pallette, use image, animations use their first frame
 		if p.ColorDepth > 0 {
-			pal = ansi.GetColorPalette(img, p.ColorDepth)
+			pal = ansi.GetColorPalette(frames.Frames[0], p.ColorDepth)
 		}
 	}
 
@@ -64,7 +66,8 @@ func (p *Pally) GetColors() error {
 		pal = append(pal, cparser.Colors...)
 	}
 
-	if stdinOpen() {
+	// stdin holds the image when it is the input
+	if inputfile != stdio && stdinOpen() {
 		b, err := io.ReadAll(os.Stdin)
 		line := string(b)
 
@@ -76,46 +79,109 @@ func (p *Pally) GetColors() error {
 		pal = append(pal, cparser.Colors...)
 	}
 
+	if p.GradientMap != "" && !gradientModes[p.GradientMap] {
+		preset, err := colors.Preset(p.GradientMap)
+		if err != nil {
+			return fmt.Errorf("unknown --gradient-map %q: must be one of [palette|duotone|tritone|%s]", p.GradientMap, strings.Join(colors.PresetNames(), "|"))
+		}
+		pal = preset
+	}
+
 	pal = removeDuplicate(pal)
 
 	if len(pal) == 0 {
 		return fmt.Errorf("no colors were found")
 	}
 
+	// the colors can be piped, unless the image is going to stdout
+	var w io.Writer = os.Stdout
+	if p.Output == stdio {
+		w = os.Stderr
+	}
+
 	for _, c := range pal {
 		fg, bg := ansi.ColorToAnsi(c)
 		r, g, b, _ := c.RGBA()
 		fmt.Fprintf(os.Stderr, "%s  %s ", bg, ansi.CLEAR)
 
-		fmt.Fprintf(os.Stdout, "#%x%x%x", r/255, g/255, b/255)
+		fmt.Fprintf(w, "#%x%x%x", r/255, g/255, b/255)
 
 		if p.PrintAnsi {
-			fmt.Fprintf(os.Stderr, "fg: \\e%s bg: \\e%s", fg[1:], bg[1:])
+			fmt.Fprintf(w, "fg: \\e%s bg: \\e%s", fg[1:], bg[1:])
 		}
-		println()
+		fmt.Fprintln(w)
 	}
 
-	if p.ApplyColor || (p.Input != "" && p.Output != "") {
+	if p.ApplyColor || p.GradientMap != "" || (p.Input != "" && p.Output != "") {
 		if inputfile == "" {
 			return fmt.Errorf("no image supplied to apply a color palette to")
 		}
 
-		var err error
-		img, err = openImage(inputfile)
-		if err != nil {
-			return err
+		apply := func(img image.Image) image.Image {
+			return quantize.ApplyQuantization(img, pal)
+		}
+		if p.GradientMap != "" {
+			gradient, err := p.gradient(pal)
+			if err != nil {
+				return err
+			}
+			apply = func(img image.Image) image.Image {
+				return gradient.Map(img)
+			}
 		}
 
 		var outname string
 		if p.Output != "" {
 			outname = string(p.Output)
+		} else if frames.Len() > 1 {
+			outname = animationName("output", inputfile)
 		} else {
 			outname = "output.png"
 		}
 
-		output := quantize.ApplyQuantization(img, pal)
-		SaveImageToPNG(output, outname)
+		output, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+			return apply(img), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return saveAnimation(output, frames, outname)
 	}
 
 	return nil
 }
+
+// gradientModes are the --gradient-map values that use the given palette
+// rather than a preset
+var gradientModes = map[string]bool{"palette": true, "duotone": true, "tritone": true}
+
+// gradient builds the gradient for --gradient-map from the palette
+func (p *Pally) gradient(pal color.Palette) (*colors.Gradient, error) {
+	interp, err := colors.ParseInterpolation(p.Interpolate)
+	if err != nil {
+		return nil, err
+	}
+	opts := []colors.GradientOption{colors.Interpolate(interp), colors.SortByLightness(p.Sort)}
+
+	switch p.GradientMap {
+	case "duotone":
+		opts = append(opts, colors.Tones(2))
+	case "tritone":
+		opts = append(opts, colors.Tones(3))
+	}
+
+	if p.Stops != "" {
+		var stops []float64
+		for _, s := range splitList([]string{p.Stops}) {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad gradient stop %q: must be a number from 0.0 - 1.0", s)
+			}
+			stops = append(stops, v)
+		}
+		opts = append(opts, colors.Stops(stops...))
+	}
+
+	return colors.NewGradient(pal, opts...)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"pix/pkg/imaging"
+	"pix/pkg/mask"
+	"pix/pkg/seam"
+)
+
+// parseRatio reads an aspect ratio as w:h, wxh or a single number
+func parseRatio(s string) (float64, error) {
+	w, h, ok := strings.Cut(strings.ToLower(s), ":")
+	if !ok {
+		w, h, ok = strings.Cut(strings.ToLower(s), "x")
+	}
+	if !ok {
+		h = "1"
+	}
+
+	fw, errw := strconv.ParseFloat(strings.TrimSpace(w), 64)
+	fh, errh := strconv.ParseFloat(strings.TrimSpace(h), 64)
+	if errw != nil || errh != nil || fw <= 0 || fh <= 0 {
+		return 0, fmt.Errorf("bad aspect ratio %q: must look like 16:9", s)
+	}
+	return fw / fh, nil
+}
+
+// size is the output size for an input of w x h
+func (r *Resize) size(w, h int) (int, int, error) {
+	if r.Ratio == "" {
+		width, height := r.Width, r.Height
+		if r.ContentAware {
+			// carving only changes the sides it is asked to
+			if width == 0 {
+				width = w
+			}
+			if height == 0 {
+				height = h
+			}
+		}
+		return width, height, nil
+	}
+
+	ratio, err := parseRatio(r.Ratio)
+	if err != nil {
+		return 0, 0, err
+	}
+	wide := float64(w)/float64(h) > ratio
+	switch {
+	case wide && !r.Expand:
+		return max(int(math.Round(float64(h)*ratio)), 1), h, nil
+	case wide:
+		return w, max(int(math.Round(float64(w)/ratio)), 1), nil
+	case !r.Expand:
+		return w, max(int(math.Round(float64(w)/ratio)), 1), nil
+	}
+	return max(int(math.Round(float64(h)*ratio)), 1), h, nil
+}
+
+// carve seam carves a frame, the masks are built from the frame itself
+func (r *Resize) carve(img image.Image, width, height int, protect, remove mask.Source) (image.Image, error) {
+	options := []seam.Option{seam.ForwardEnergy(!r.Backward)}
+	if protect != nil {
+		m, err := protect(img)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, seam.Protect(m))
+	}
+	if remove != nil {
+		m, err := remove(img)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, seam.Remove(m))
+	}
+	return seam.Resize(img, width, height, options...)
+}
+
+func (r *Resize) Run() error {
+	var inputfile string
+	if r.Input != "" {
+		inputfile = r.Input
+	} else if r.Args.Image != "" {
+		inputfile = r.Args.Image
+	} else {
+		return fmt.Errorf("no image supplied")
+	}
+
+	if opts.Mask != "" {
+		return fmt.Errorf("--mask can't be used with resize, the effect changes the size of the image")
+	}
+	if r.Ratio != "" && (r.Width != 0 || r.Height != 0) {
+		return fmt.Errorf("use either --ratio or --width and --height")
+	}
+	// carving something out alone grows the image back to its size
+	if r.Ratio == "" && r.Width <= 0 && r.Height <= 0 && r.Remove == "" {
+		return fmt.Errorf("give a --width, a --height or a --ratio")
+	}
+	if r.Width < 0 || r.Height < 0 {
+		return fmt.Errorf("--width and --height must be 0 or more")
+	}
+	if !r.ContentAware && (r.Expand || r.Protect != "" || r.Remove != "" || r.Backward) {
+		return fmt.Errorf("--expand, --protect, --remove and --backward-energy need --content-aware")
+	}
+
+	var protect, remove mask.Source
+	var err error
+	if r.Protect != "" {
+		if protect, err = mask.Parse(r.Protect); err != nil {
+			return err
+		}
+	}
+	if r.Remove != "" {
+		if remove, err = mask.Parse(r.Remove); err != nil {
+			return err
+		}
+	}
+
+	frames, err := openAnimation(inputfile)
+	if err != nil {
+		return err
+	}
+
+	bounds := frames.Bounds()
+	width, height, err := r.size(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return err
+	}
+	debug("resizing %dx%d to %dx%d", bounds.Dx(), bounds.Dy(), width, height)
+
+	outname := r.Output
+	if outname == "" {
+		outname = "output.png"
+		if frames.Len() > 1 {
+			outname = animationName("output", inputfile)
+		}
+	}
+
+	out, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+		switch {
+		case r.ContentAware:
+			return r.carve(img, width, height, protect, remove)
+		case r.Ratio != "":
+			return imaging.CropCenter(img, width, height), nil
+		}
+		return resize(img, width, height, imaging.Lanczos), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return saveAnimation(out, frames, outname)
+}
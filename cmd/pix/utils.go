@@ -7,6 +7,8 @@ import (
 	"image/draw"
 	"math/rand"
 	"os"
+
+	"pix/pkg/imaging"
 )
 
 const MAXC = (1 << 16) - 1
@@ -55,6 +57,14 @@ func imageToRGBA(src image.Image) *image.RGBA {
 	return dst
 }
 
+// resize scales img with the filter, in linear light with --linear
+func resize(img image.Image, width, height int, filter imaging.ResampleFilter) image.Image {
+	if opts.Linear {
+		return imaging.ResizeLinear(img, width, height, filter)
+	}
+	return imaging.Resize(img, width, height, filter)
+}
+
 func RandomChannel() Channel {
 	r := rand.Float32()
 	if r < 0.33 {
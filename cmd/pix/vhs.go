@@ -1,16 +1,14 @@
 package main
 
 import (
-	"fmt"
 	"image"
 	"image/color"
 
+	"pix/pkg/blend"
 	"pix/pkg/imaging"
 	"pix/pkg/pixlib"
 )
 
-var fuck = fmt.Printf
-
 // ApplyScanlines applies scanlines
 func ApplyScanlines(destImage *image.RGBA) {
 	bounds := destImage.Bounds()
@@ -34,7 +32,12 @@ func (v *VHS) Run() error {
 	// 	return fmt.Errorf("provide an input image")
 	// }
 
-	img, err := openImage(string(v.Input))
+	inputfile := v.Input
+	if inputfile == "" {
+		inputfile = v.Args.Image
+	}
+
+	frames, err := openAnimation(inputfile)
 	if err != nil {
 		return err
 	}
@@ -44,9 +47,7 @@ func (v *VHS) Run() error {
 		return err
 	}
 
-	bounds := img.Bounds()
-	bounds2 := img2.Bounds()
-	outimg := imageToRGBA(img)
+	bounds := frames.Bounds()
 
 	if v.Scale {
 		var sfact float64
@@ -57,16 +58,54 @@ func (v *VHS) Run() error {
 		}
 
 		img2 = imaging.Resize(img2, int(float64(bounds.Dx())*sfact), int(float64(bounds.Dy())*sfact), imaging.NearestNeighbor)
-		SaveImageToPNG(img2, "testing.png")
+	}
+	debug("overlay bounds: %v", img2.Bounds())
+
+	mode, blending, err := blendMode(v.Blend, v.Opacity)
+	if err != nil {
+		return err
 	}
 
-	bounds2 = img2.Bounds()
+	// the overlay is stretched over the frames to blend it
+	overlay := img2
+	if blending && img2.Bounds().Size() != bounds.Size() {
+		overlay = resize(img2, bounds.Dx(), bounds.Dy(), imaging.Lanczos)
+	}
+
+	out, err := frames.Map(0, func(_ int, img image.Image) (image.Image, error) {
+		if blending {
+			blended, err := blend.Blend(img, overlay, mode, blendOptions(v.Opacity)...)
+			if err != nil {
+				return nil, err
+			}
+			img = blended
+		}
+		return vhsFrame(img, img2), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	outname := v.Output
+	if outname == "" {
+		outname = "output.png"
+		if frames.Len() > 1 {
+			outname = animationName("output", inputfile)
+		}
+	}
+
+	return saveAnimation(out, frames, outname)
+}
+
+// vhsFrame applies the vhs effect to a single image
+func vhsFrame(img, img2 image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	bounds2 := img2.Bounds()
+	outimg := imageToRGBA(img)
 
 	xF := bounds2.Min.X
 	yF := bounds2.Min.Y
 
-	fuck("%v %v\n", xF, yF)
-
 	red := color.RGBA{0xff, 0, 0, 0xff}
 	green := color.RGBA{0, 0xff, 0, 0xff}
 	blue := color.RGBA{0, 0, 0xff, 0xff}
@@ -119,5 +158,5 @@ func (v *VHS) Run() error {
 
 	ApplyScanlines(outimg)
 
-	return SaveImageToPNG(outimg, "output.png")
+	return outimg
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pix/pkg/colors"
+	"pix/pkg/imaging"
+	"pix/pkg/montage"
+)
+
+// parseCellSize parses a thumbnail size like 320x180, a single number makes square cells
+func parseCellSize(s string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		h = w
+	}
+	width, err1 := strconv.Atoi(strings.TrimSpace(w))
+	height, err2 := strconv.Atoi(strings.TrimSpace(h))
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("couldn't parse cell size. Format must be '<width>x<height>' ex: 320x180")
+	}
+	return width, height, nil
+}
+
+// parseBackground returns the first hex color in s
+func parseBackground(s string) (color.Color, error) {
+	cparser := colors.NewParser()
+	if err := cparser.ParseString(s); err != nil {
+		return nil, err
+	}
+	if len(cparser.Colors) == 0 {
+		return nil, fmt.Errorf("couldn't parse background color %q, must be a hex color ex: #1d2021", s)
+	}
+	return cparser.Colors[0], nil
+}
+
+// sheetResults returns what goes on the contact sheet, ranked results keep their
+// order, duplicate groups are laid out one after another and everything else is sorted by path
+func sheetResults(groups [][]candidate) []result {
+	if opts.Duplicates {
+		var res []result
+		for _, g := range groups {
+			for _, c := range g {
+				res = append(res, newResult(c.path, &indexEntry{Width: c.width, Height: c.height, Format: c.format, Size: c.size}))
+			}
+		}
+		return res
+	}
+
+	if !COLOR_QUERY.active() {
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].Path < results[j].Path
+		})
+	}
+	return results
+}
+
+// writeContactSheet renders thumbnails of the results to name, results that
+// don't fit on one page go to name-2.png, name-3.png and so on
+func writeContactSheet(name string, res []result) error {
+	if len(res) == 0 {
+		return fmt.Errorf("contact sheet: no images matched")
+	}
+
+	cw, ch, err := parseCellSize(opts.CellSize)
+	if err != nil {
+		return err
+	}
+	bg, err := parseBackground(opts.Background)
+	if err != nil {
+		return err
+	}
+
+	m, err := montage.New(
+		montage.Columns(opts.Columns),
+		montage.Rows(opts.Rows),
+		montage.CellSize(cw, ch),
+		montage.Padding(opts.Padding),
+		montage.Background(bg),
+		montage.Captions(!opts.NoCaptions),
+	)
+	if err != nil {
+		return err
+	}
+
+	tiles := make([]montage.Tile, len(res))
+	for i, r := range res {
+		tiles[i] = montage.FileTile(r.Path,
+			filepath.Base(r.Path),
+			fmt.Sprintf("%dx%d %s", r.Width, r.Height, r.Ratio),
+		)
+	}
+
+	for i, page := range m.Pages(tiles) {
+		sheet, err := m.Sheet(page)
+		if err != nil {
+			return err
+		}
+		pageName := montage.PageName(name, i+1)
+		if err := imaging.Save(sheet, pageName); err != nil {
+			return err
+		}
+		debug("contact sheet: %s (%d images)", pageName, len(page))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"pix/pkg/phash"
+)
+
+// candidate is an image that passed the filters and was hashed for duplicate detection
+type candidate struct {
+	path   string
+	width  int
+	height int
+	size   int64
+	format string
+	hash   phash.Hash
+}
+
+var (
+	candidatesMu sync.Mutex
+	candidates   []candidate
+)
+
+func addCandidate(c candidate) {
+	candidatesMu.Lock()
+	candidates = append(candidates, c)
+	candidatesMu.Unlock()
+}
+
+// groupDuplicates clusters candidates whose hashes are within maxDistance of each other.
+// Grouping is transitive, if a~b and b~c then a, b and c end up in the same group.
+func groupDuplicates(cands []candidate, maxDistance int) [][]candidate {
+	parent := make([]int, len(cands))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(cands); i++ {
+		for j := i + 1; j < len(cands); j++ {
+			if phash.Distance(cands[i].hash, cands[j].hash) <= maxDistance {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	byRoot := make(map[int][]candidate)
+	for i, c := range cands {
+		root := find(i)
+		byRoot[root] = append(byRoot[root], c)
+	}
+
+	var groups [][]candidate
+	for _, g := range byRoot {
+		if len(g) < 2 {
+			continue
+		}
+		// best resolution first, larger files win ties since they are usually less compressed
+		sort.Slice(g, func(i, j int) bool {
+			pi, pj := g[i].width*g[i].height, g[j].width*g[j].height
+			if pi != pj {
+				return pi > pj
+			}
+			if g[i].size != g[j].size {
+				return g[i].size > g[j].size
+			}
+			return g[i].path < g[j].path
+		})
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0].path < groups[j][0].path
+	})
+	return groups
+}
+
+// printDuplicates writes each group with the best member first and the others indented below it.
+// Structured outputs get one row per member tagged with its group, null output
+// only lists the members that aren't the best so they can be piped to rm.
+func printDuplicates(w io.Writer, groups [][]candidate) {
+	if _, ok := out.(*plainPrinter); !ok {
+		_, null := out.(*nullPrinter)
+		for i, g := range groups {
+			for j, c := range g {
+				if null && j == 0 {
+					continue
+				}
+				res := newResult(c.path, &indexEntry{Width: c.width, Height: c.height, Format: c.format, Size: c.size})
+				res.Group = i + 1
+				res.Best = j == 0
+				out.print(res)
+			}
+		}
+		return
+	}
+
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		best := g[0]
+		fmt.Fprintf(w, "%s\n", best.path)
+		debug("best: %s [%dx%d %d bytes]", best.path, best.width, best.height, best.size)
+		for _, c := range g[1:] {
+			fmt.Fprintf(w, "  %s\n", c.path)
+			debug("  dup: %s [%dx%d %d bytes] distance %d", c.path, c.width, c.height, c.size, phash.Distance(best.hash, c.hash))
+		}
+	}
+}
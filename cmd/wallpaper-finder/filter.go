@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fileFilter holds the resolution, orientation, format and file size filters
+type fileFilter struct {
+	minWidth      int
+	minHeight     int
+	minMegapixels float64
+	portrait      bool
+	landscape     bool
+	square        bool
+	formats       map[string]bool
+	maxSize       int64
+}
+
+// orientation reports whether any orientation filter is set
+func (f *fileFilter) orientation() bool {
+	return f.portrait || f.landscape || f.square
+}
+
+// match reports whether the indexed file passes every filter. Orientations are
+// or'ed together so --portrait --square matches both.
+func (f *fileFilter) match(e *indexEntry) bool {
+	if e.Width < f.minWidth || e.Height < f.minHeight {
+		return false
+	}
+
+	if f.minMegapixels > 0 && float64(e.Width)*float64(e.Height)/1e6 < f.minMegapixels {
+		return false
+	}
+
+	if f.orientation() {
+		ok := (f.portrait && e.Height > e.Width) ||
+			(f.landscape && e.Width > e.Height) ||
+			(f.square && e.Width == e.Height)
+		if !ok {
+			return false
+		}
+	}
+
+	if len(f.formats) > 0 && !f.formats[e.Format] {
+		return false
+	}
+
+	if f.maxSize > 0 && e.Size > f.maxSize {
+		return false
+	}
+
+	return true
+}
+
+// normalizeFormat maps extension style names to the names registered with the image package
+func normalizeFormat(s string) string {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "."))
+	switch s {
+	case "jpg":
+		return "jpeg"
+	case "tif":
+		return "tiff"
+	}
+	return s
+}
+
+// parseSize parses a file size like 500K, 5MB or 1.5GiB, units are powers of 1024
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+
+	mult := 1.0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("couldn't parse size: format must be a number with an optional unit ex: 500K, 5MB, 1G")
+	}
+	return int64(n * mult), nil
+}
+
+// parseFileFilter builds the global file filter from the command line options
+func parseFileFilter() error {
+	if opts.MinWidth < 0 || opts.MinHeight < 0 || opts.MinMegapixels < 0 {
+		return fmt.Errorf("minimum resolution can't be negative")
+	}
+
+	FILE_FILTER.minWidth = opts.MinWidth
+	FILE_FILTER.minHeight = opts.MinHeight
+	FILE_FILTER.minMegapixels = opts.MinMegapixels
+	FILE_FILTER.portrait = opts.Portrait
+	FILE_FILTER.landscape = opts.Landscape
+	FILE_FILTER.square = opts.Square
+
+	if len(opts.Formats) > 0 {
+		FILE_FILTER.formats = make(map[string]bool)
+		for _, f := range opts.Formats {
+			FILE_FILTER.formats[normalizeFormat(f)] = true
+		}
+	}
+
+	if opts.MaxSize != "" {
+		size, err := parseSize(opts.MaxSize)
+		if err != nil {
+			return err
+		}
+		FILE_FILTER.maxSize = size
+	}
+
+	return nil
+}
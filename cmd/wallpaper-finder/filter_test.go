@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"1234", 1234},
+		{" 10 ", 10},
+		{"10B", 10},
+		{"500K", 500 << 10},
+		{"500k", 500 << 10},
+		{"2KiB", 2 << 10},
+		{"1.5K", 1536},
+		{"5MB", 5 << 20},
+		{"5 MB", 5 << 20},
+		{"5mib", 5 << 20},
+		{"1G", 1 << 30},
+		{"1.5GiB", 3 << 29},
+	}
+	for _, tc := range testCases {
+		got, err := parseSize(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %d want %d", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "K", "MB", "-5", "-5K", "abc", "5X", "5TB", "1,5K"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
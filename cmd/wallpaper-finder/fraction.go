@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 )
 
 // gcd calculates the greatest common divisor of two integers.
@@ -18,18 +19,43 @@ func simplifyFraction(numerator, denominator int64) (int64, int64) {
 	return numerator / g, denominator / g
 }
 
-// floatToFraction converts a float32 to a simplified fraction string.
+// floatToFraction converts a float32 to a simplified fraction string, ie 1.7777 becomes "16/9".
+// The closest fraction with a denominator of at most 1000 is found using continued fractions.
 func floatToFraction(f float32) (string, error) {
 	if f == 0 {
 		return "0/1", nil
 	}
+	if f < 0 || math.IsInf(float64(f), 0) || math.IsNaN(float64(f)) {
+		return "", fmt.Errorf("can't convert %v to a fraction", f)
+	}
+
+	const maxDenominator = 1000
+	const epsilon = 1e-4
+
+	// convergents h/k of the continued fraction expansion of x
+	x := float64(f)
+	h0, h1 := int64(0), int64(1)
+	k0, k1 := int64(1), int64(0)
+	for {
+		a := int64(math.Floor(x))
+		h0, h1 = h1, a*h1+h0
+		k0, k1 = k1, a*k1+k0
 
-	// Convert float32 to int64, rounding towards zero.
-	n := int64(float64(f) * 10000) // Multiply by 10000 to get more precision for conversion.
-	d := int64(10000)              // Denominator is always 10^4 for simplicity.
+		if k1 > maxDenominator {
+			// the previous convergent was the best one within range
+			h1, k1 = h0, k0
+			break
+		}
+
+		frac := x - float64(a)
+		if math.Abs(float64(f)-float64(h1)/float64(k1)) < epsilon || frac < epsilon {
+			break
+		}
+		x = 1 / frac
+	}
 
 	// Simplify the fraction.
-	simplifiedN, simplifiedD := simplifyFraction(n, d)
+	simplifiedN, simplifiedD := simplifyFraction(h1, k1)
 
 	// Convert the simplified fraction back to a string.
 	fractionStr := fmt.Sprintf("%d/%d", simplifiedN, simplifiedD)
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatToFraction(t *testing.T) {
+	testCases := []struct {
+		in   float32
+		want string
+	}{
+		{16.0 / 9, "16/9"},
+		{21.0 / 9, "7/3"},
+		{4.0 / 3, "4/3"},
+		{1, "1/1"},
+		{0, "0/1"},
+		{2560.0 / 1080, "64/27"},
+		{1.6, "8/5"},
+		// the next convergent has a denominator past 1000, so it gives up
+		// on the closest one found before it
+		{1.0005, "1/1"},
+		{1.0 / 1500, "0/1"},
+	}
+	for _, tc := range testCases {
+		got, err := floatToFraction(tc.in)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: got %s want %s", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []float32{-1, float32(math.Inf(1)), float32(math.NaN())} {
+		if _, err := floatToFraction(in); err == nil {
+			t.Errorf("expected an error for %v", in)
+		}
+	}
+}
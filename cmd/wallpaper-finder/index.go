@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pix/pkg/phash"
+)
+
+// indexVersion is bumped whenever indexEntry changes in an incompatible way
+const indexVersion = 1
+
+// index is an on-disk store of everything wallpaper-finder knows about a file.
+// Files are only opened again when their size or modification time changes, so
+// re-runs over a large library cost about as much as listing its directories.
+type index struct {
+	mu      sync.Mutex
+	path    string
+	dirty   bool
+	seen    map[string]bool
+	Version int
+	Entries map[string]*indexEntry
+}
+
+// indexEntry is only valid while the files modification time and size match
+type indexEntry struct {
+	ModTime int64
+	Size    int64
+	Width   int
+	Height  int
+	Format  string
+	Hashes  map[phash.Kind]phash.Hash
+	Stats   *colorStats
+}
+
+// defaultIndexPath returns the index location inside the users cache directory
+func defaultIndexPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "pixxy", "wallpaper-finder.idx")
+}
+
+// openIndex loads the index at path. A missing or outdated file gives an empty index,
+// as does reindex which throws away everything that was stored before.
+func openIndex(path string, reindex bool) (*index, error) {
+	idx := &index{
+		path:    path,
+		seen:    make(map[string]bool),
+		Version: indexVersion,
+		Entries: make(map[string]*indexEntry),
+	}
+
+	if reindex {
+		idx.dirty = true
+		return idx, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stored := &index{}
+	if err := gob.NewDecoder(file).Decode(stored); err != nil || stored.Version != indexVersion {
+		debug("discarding unreadable or outdated index %s: %v", path, err)
+		idx.dirty = true
+		return idx, nil
+	}
+
+	idx.Entries = stored.Entries
+	return idx, nil
+}
+
+// lookup returns the stored entry for path if the file hasn't changed since it was indexed
+func (idx *index) lookup(path string, info os.FileInfo) (*indexEntry, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.seen[path] = true
+
+	e, ok := idx.Entries[path]
+	if !ok || e.ModTime != info.ModTime().UnixNano() || e.Size != info.Size() {
+		return nil, false
+	}
+	return e, true
+}
+
+// store adds or replaces the entry for path
+func (idx *index) store(path string, e *indexEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.Entries[path] = e
+	idx.dirty = true
+}
+
+// touch marks the index as modified after an entry gained hashes or color stats
+func (idx *index) touch() {
+	idx.mu.Lock()
+	idx.dirty = true
+	idx.mu.Unlock()
+}
+
+// prune drops entries below the given roots for files that were deleted. Files
+// that weren't visited because a narrower --extension skipped them are kept.
+func (idx *index) prune(roots []string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for path := range idx.Entries {
+		if idx.seen[path] {
+			continue
+		}
+		for _, root := range roots {
+			if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+				if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+					debug("pruning %s from the index", path)
+					delete(idx.Entries, path)
+					idx.dirty = true
+				}
+				break
+			}
+		}
+	}
+}
+
+// save writes the index back to disk if anything changed
+func (idx *index) save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := idx.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(file).Encode(idx); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// hash returns the perceptual hash of the entry, decoding the image only if it isn't indexed yet
+func (idx *index) hash(e *indexEntry, kind phash.Kind, decode func() (image.Image, error)) (phash.Hash, error) {
+	if h, ok := e.Hashes[kind]; ok {
+		return h, nil
+	}
+
+	img, err := decode()
+	if err != nil {
+		return 0, err
+	}
+
+	if e.Hashes == nil {
+		e.Hashes = make(map[phash.Kind]phash.Hash)
+	}
+	e.Hashes[kind] = phash.Compute(img, kind)
+	if idx != nil {
+		idx.touch()
+	}
+	return e.Hashes[kind], nil
+}
+
+// stats returns the color statistics of the entry, decoding the image only if they aren't indexed yet
+func (idx *index) stats(e *indexEntry, decode func() (image.Image, error)) (colorStats, error) {
+	if e.Stats != nil {
+		return *e.Stats, nil
+	}
+
+	img, err := decode()
+	if err != nil {
+		return colorStats{}, err
+	}
+
+	s := computeStats(img)
+	e.Stats = &s
+	if idx != nil {
+		idx.touch()
+	}
+	return s, nil
+}
+
+// examine opens a new or changed file and reads its dimensions and format
+func examine(path string, info os.FileInfo) (*indexEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, DecodeError
+	}
+
+	return &indexEntry{
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Width:   cfg.Width,
+		Height:  cfg.Height,
+		Format:  format,
+	}, nil
+}
+
+// decodeFile fully decodes the image at path
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, DecodeError
+	}
+	return img, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"pix/pkg/phash"
+)
+
+// writePNG writes a w x h image of c with a lighter square so the hashes aren't trivial
+func writePNG(t *testing.T, path string, w, h int, c color.NRGBA) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := c
+			if x < w/2 && y < h/2 {
+				p.R, p.G, p.B = 255-c.R/2, 255-c.G/2, 255-c.B/2
+			}
+			img.SetNRGBA(x, y, p)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// indexDir runs every file in dir matching pattern through the index like
+// walkFunc does and returns the files that had to be examined again
+func indexDir(t *testing.T, idx *index, dir, pattern string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var examined []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry, ok := idx.lookup(path, info)
+		if !ok {
+			examined = append(examined, filepath.Base(path))
+			if entry, err = examine(path, info); err != nil {
+				t.Fatal(err)
+			}
+			idx.store(path, entry)
+		}
+
+		decode := func() (image.Image, error) { return decodeFile(path) }
+		if _, err := idx.hash(entry, phash.DHash, decode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := idx.stats(entry, decode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Strings(examined)
+	return examined
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	idxPath := filepath.Join(t.TempDir(), "cache", "wallpaper-finder.idx")
+
+	writePNG(t, filepath.Join(dir, "a.png"), 64, 36, color.NRGBA{200, 30, 30, 255})
+	writePNG(t, filepath.Join(dir, "b.png"), 48, 48, color.NRGBA{30, 200, 30, 255})
+	writePNG(t, filepath.Join(dir, "c.png"), 36, 64, color.NRGBA{30, 30, 200, 255})
+
+	idx, err := openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indexDir(t, idx, dir, "*.png"); len(got) != 3 {
+		t.Fatalf("first run examined %v, want every file", got)
+	}
+	idx.prune([]string{dir})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+	first := idx.Entries
+
+	// everything survives a reload and nothing has to be opened again
+	idx, err = openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Entries) != 3 {
+		t.Fatalf("reloaded %d entries, want 3", len(idx.Entries))
+	}
+	for path, want := range first {
+		got := idx.Entries[path]
+		if got == nil {
+			t.Fatalf("%s is missing after reload", path)
+		}
+		if got.Width != want.Width || got.Height != want.Height || got.Format != want.Format {
+			t.Errorf("%s: got %dx%d %s want %dx%d %s", path, got.Width, got.Height, got.Format, want.Width, want.Height, want.Format)
+		}
+		if got.Hashes[phash.DHash] != want.Hashes[phash.DHash] {
+			t.Errorf("%s: hash %v want %v", path, got.Hashes[phash.DHash], want.Hashes[phash.DHash])
+		}
+		if got.Stats == nil || got.Stats.Hue != want.Stats.Hue || got.Stats.Luminance != want.Stats.Luminance || len(got.Stats.Palette) != len(want.Stats.Palette) {
+			t.Errorf("%s: stats %+v want %+v", path, got.Stats, want.Stats)
+		}
+	}
+	if got := indexDir(t, idx, dir, "*.png"); len(got) != 0 {
+		t.Errorf("unchanged files were examined again: %v", got)
+	}
+	if idx.dirty {
+		t.Error("index is dirty without any changes")
+	}
+
+	// a changed modification time means the file is examined again and a
+	// deleted file is pruned
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "b.png"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "c.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err = openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indexDir(t, idx, dir, "*.png"); len(got) != 1 || got[0] != "b.png" {
+		t.Errorf("examined %v after touching b.png, want [b.png]", got)
+	}
+
+	// entries outside of the walked roots are kept
+	other := filepath.Join(filepath.Dir(dir), "elsewhere", "d.png")
+	idx.store(other, &indexEntry{Width: 1, Height: 1})
+	idx.prune([]string{dir})
+	if _, ok := idx.Entries[filepath.Join(dir, "c.png")]; ok {
+		t.Error("deleted c.png was not pruned")
+	}
+	if _, ok := idx.Entries[other]; !ok {
+		t.Error("an entry outside of the roots was pruned")
+	}
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err = openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Entries) != 3 {
+		t.Errorf("reloaded %d entries after pruning, want 3", len(idx.Entries))
+	}
+	if e := idx.Entries[filepath.Join(dir, "b.png")]; e == nil || e.ModTime != later.UnixNano() {
+		t.Error("b.png was not updated in the saved index")
+	}
+
+	// reindex throws everything away
+	idx, err = openIndex(idxPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Entries) != 0 || !idx.dirty {
+		t.Errorf("reindex kept %d entries, dirty %v", len(idx.Entries), idx.dirty)
+	}
+}
+
+func TestIndexNarrowerExtensions(t *testing.T) {
+	dir := t.TempDir()
+	idxPath := filepath.Join(t.TempDir(), "wallpaper-finder.idx")
+
+	writePNG(t, filepath.Join(dir, "a.png"), 64, 36, color.NRGBA{200, 30, 30, 255})
+	writePNG(t, filepath.Join(dir, "b.png"), 48, 48, color.NRGBA{30, 200, 30, 255})
+	img, err := decodeFile(filepath.Join(dir, "b.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dir, "b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(file, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	idx, err := openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indexDir(t, idx, dir, "*.*"); len(got) != 3 {
+		t.Fatalf("first run examined %v, want every file", got)
+	}
+	idx.prune([]string{dir})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+	jpgEntry := *idx.Entries[filepath.Join(dir, "b.jpg")]
+
+	// a run with -e png doesn't visit the jpg, its hashes and stats stay cached
+	idx, err = openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDir(t, idx, dir, "*.png")
+	idx.prune([]string{dir})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err = openIndex(idxPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := idx.Entries[filepath.Join(dir, "b.jpg")]
+	if e == nil {
+		t.Fatal("the jpg was pruned by a run that only looked for pngs")
+	}
+	if e.Hashes[phash.DHash] != jpgEntry.Hashes[phash.DHash] || e.Stats == nil {
+		t.Error("the jpg lost its hash or color stats")
+	}
+	if got := indexDir(t, idx, dir, "*.*"); len(got) != 0 {
+		t.Errorf("a full run examined %v again", got)
+	}
+}
+
+func TestIndexRebuild(t *testing.T) {
+	dir := t.TempDir()
+
+	outdated := filepath.Join(dir, "outdated.idx")
+	old := &index{
+		path:    outdated,
+		dirty:   true,
+		Version: indexVersion - 1,
+		Entries: map[string]*indexEntry{"/a.png": {Width: 1, Height: 1}},
+	}
+	if err := old.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.idx")
+	if err := os.WriteFile(corrupt, []byte("not an index"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{outdated, corrupt, filepath.Join(dir, "missing.idx")} {
+		idx, err := openIndex(path, false)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		if len(idx.Entries) != 0 {
+			t.Errorf("%s: kept %d entries", filepath.Base(path), len(idx.Entries))
+		}
+		if idx.Version != indexVersion {
+			t.Errorf("%s: version %d want %d", filepath.Base(path), idx.Version, indexVersion)
+		}
+	}
+
+	// the rebuilt index replaces the unreadable one
+	idx, err := openIndex(corrupt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !idx.dirty {
+		t.Error("a rebuilt index isn't saved")
+	}
+	idx.store("/b.png", &indexEntry{Width: 2, Height: 2})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = openIndex(corrupt, false); err != nil || len(idx.Entries) != 1 {
+		t.Errorf("rebuilt index didn't load: %v", err)
+	}
+}
@@ -15,7 +15,12 @@ import (
 	"strconv"
 	"strings"
 
+	"pix/pkg/phash"
+	_ "pix/pkg/pnm"
+	_ "pix/pkg/qoi"
+
 	"github.com/jessevdk/go-flags"
+	_ "golang.org/x/image/webp"
 )
 
 var opts struct {
@@ -25,6 +30,33 @@ var opts struct {
 	Color          bool     `short:"c" long:"color" description:"print paths with color"`
 	FollowSymlinks bool     `short:"f" long:"follow" description:"follow symlinks"`
 	Verbose        bool     `short:"v" long:"verbose" description:"print debugging information and verbose output"`
+	Duplicates     bool     `short:"D" long:"duplicates" description:"group near-duplicate images and report the best resolution member of each group"`
+	Hash           string   `short:"H" long:"hash" description:"perceptual hash used to find duplicates [ahash|dhash|phash]" default:"dhash"`
+	Distance       int      `long:"distance" description:"maximum hamming distance (0-64) for two images to count as duplicates" default:"10"`
+	IndexPath      string   `long:"index-path" description:"path of the index that stores dimensions, hashes and colors of every file seen"`
+	Reindex        bool     `long:"reindex" description:"throw away the index and examine every file again"`
+	NoIndex        bool     `long:"no-index" description:"don't read or write the index"`
+	SimilarTo      string   `short:"s" long:"similar-to" description:"rank images by how close their palette is to the hex colors found in a file (ie a terminal theme)"`
+	Dark           bool     `long:"dark" description:"only match dark images"`
+	Light          bool     `long:"light" description:"only match light images"`
+	MinSaturation  float64  `long:"min-saturation" description:"minimum average saturation from 0.0 - 1.0"`
+	DominantHue    string   `long:"dominant-hue" description:"dominant hue in degrees with an optional tolerance ie (200±20, 200+-20 or 200:20) or a range ie 350-20"`
+	MinWidth       int      `long:"min-width" description:"minimum width in pixels"`
+	MinHeight      int      `long:"min-height" description:"minimum height in pixels"`
+	MinMegapixels  float64  `long:"min-megapixels" description:"minimum resolution in megapixels ie (8.3 for 4K)"`
+	Portrait       bool     `long:"portrait" description:"only match images taller than they are wide"`
+	Landscape      bool     `long:"landscape" description:"only match images wider than they are tall"`
+	Square         bool     `long:"square" description:"only match square images"`
+	Formats        []string `long:"format" description:"only match images decoded as this format, regardless of extension ie (--format jpeg --format png)"`
+	MaxSize        string   `long:"max-size" description:"maximum file size ie (500K, 5MB, 1G)"`
+	Output         string   `short:"o" long:"output" description:"output format [plain|json|csv|null]" default:"plain"`
+	ContactSheet   string   `long:"contact-sheet" description:"also render thumbnails of every match to this image, extra pages are numbered ie (out.png, out-2.png)"`
+	Columns        int      `long:"columns" description:"thumbnails per row on the contact sheet" default:"6"`
+	Rows           int      `long:"rows" description:"rows per contact sheet page, 0 puts everything on one page" default:"8"`
+	CellSize       string   `long:"cell-size" description:"size of each contact sheet thumbnail <width>x<height>" default:"320x180"`
+	Padding        int      `long:"padding" description:"pixels of space around each contact sheet thumbnail" default:"8"`
+	Background     string   `long:"background" description:"contact sheet background color" default:"#1d2021"`
+	NoCaptions     bool     `long:"no-captions" description:"don't write the filename and resolution under each thumbnail"`
 }
 
 type Aspect struct {
@@ -38,6 +70,10 @@ type Aspect struct {
 
 var ASPECT_RATIO float32
 var CURRENT_PATH string
+var HASH_KIND phash.Kind
+var INDEX *index
+var COLOR_QUERY colorQuery
+var FILE_FILTER fileFilter
 
 func (self *Aspect) isRatio() bool {
 	ratio := self.Width / self.Height
@@ -144,33 +180,100 @@ func walkFunc(path string, info os.FileInfo, err error) error {
 
 	debug("match %v", path)
 
-	file, err := os.Open(path)
+	key, err := filepath.Abs(path)
 	if err != nil {
-		// debug("open err: %v", path)
-		return fmt.Errorf("error opening file: %w", err)
+		key = path
 	}
-	defer file.Close()
 
-	img, _, err := image.DecodeConfig(file)
-	if err != nil {
-		// debug("decode err: %v - format %v", path, format)
-		// return fmt.Errorf("error decoding image: %s - %w", path, err)
-		return DecodeError
+	// only files that are new or changed since the last run get opened
+	var entry *indexEntry
+	var ok bool
+	if INDEX != nil {
+		entry, ok = INDEX.lookup(key, info)
+	}
+	if !ok {
+		entry, err = examine(path, info)
+		if err != nil {
+			// debug("decode err: %v - format %v", path, format)
+			// return fmt.Errorf("error decoding image: %s - %w", path, err)
+			return err
+		}
+		if INDEX != nil {
+			INDEX.store(key, entry)
+		}
+	}
+
+	if !FILE_FILTER.match(entry) {
+		return nil
 	}
 
 	aspect := &Aspect{
-		Width:           float32(img.Width),
-		Height:          float32(img.Height),
+		Width:           float32(entry.Width),
+		Height:          float32(entry.Height),
 		Ratio:           ASPECT_RATIO,
 		upper_tolerance: (100 + opts.Tolerance) / 100,
 		lower_tolerance: (100 - opts.Tolerance) / 100,
 	}
 
-	if aspect.isRatio() {
-		// fmt.Fprintf(os.Stdout, "%s [\x1b[32m %.2f \x1b[0m]\n", path, aspect.calculated_ratio)
-		fmt.Fprintf(os.Stdout, "%s\n", path)
+	// full decodes are expensive, only do one when a hash or color stats aren't indexed yet
+	var decoded image.Image
+	decode := func() (image.Image, error) {
+		if decoded != nil {
+			return decoded, nil
+		}
+		m, err := decodeFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoded = m
+		return m, nil
+	}
+
+	// when looking for duplicates the ratio is only a filter if it was asked for
+	if opts.Duplicates {
+		if opts.Ratio != "" && !aspect.isRatio() {
+			return nil
+		}
+
+		hash, err := INDEX.hash(entry, HASH_KIND, decode)
+		if err != nil {
+			return err
+		}
+
+		addCandidate(candidate{
+			path:   path,
+			width:  entry.Width,
+			height: entry.Height,
+			size:   entry.Size,
+			format: entry.Format,
+			hash:   hash,
+		})
+		return nil
+	}
+
+	// an orientation filter replaces the default 16x9 ratio unless one was asked for
+	if (opts.Ratio != "" || !FILE_FILTER.orientation()) && !aspect.isRatio() {
+		return nil
+	}
+
+	res := newResult(path, entry)
+
+	if COLOR_QUERY.active() {
+		stats, err := INDEX.stats(entry, decode)
+		if err != nil {
+			return err
+		}
+
+		score, ok := COLOR_QUERY.match(stats)
+		if !ok {
+			return nil
+		}
+
+		debug("score %.3f %v", score, path)
+		res.Score = score
 	}
 
+	addResult(res)
 	return nil
 }
 
@@ -191,19 +294,62 @@ func parseRatio(r string) (float32, error) {
 }
 
 func Wall(args []string) error {
+	if !opts.NoIndex {
+		indexPath := opts.IndexPath
+		if indexPath == "" {
+			indexPath = defaultIndexPath()
+		}
+
+		var err error
+		INDEX, err = openIndex(indexPath, opts.Reindex)
+		if err != nil {
+			return err
+		}
+		debug("index: %s (%d entries)", indexPath, len(INDEX.Entries))
+	}
+
 	// var exitErrors []error
 	for _, p := range args {
 		CURRENT_PATH = p
 		Walk(p, walkFunc)
 	}
 
-	return nil
+	var groups [][]candidate
+	if opts.Duplicates {
+		groups = groupDuplicates(candidates, opts.Distance)
+		printDuplicates(os.Stdout, groups)
+	} else if COLOR_QUERY.active() {
+		printResults(results)
+	}
+
+	if err := out.flush(); err != nil {
+		return err
+	}
+
+	if opts.ContactSheet != "" {
+		if err := writeContactSheet(opts.ContactSheet, sheetResults(groups)); err != nil {
+			return err
+		}
+	}
+
+	if INDEX == nil {
+		return nil
+	}
+
+	var roots []string
+	for _, p := range args {
+		if abs, err := filepath.Abs(p); err == nil {
+			roots = append(roots, abs)
+		}
+	}
+	INDEX.prune(roots)
+	return INDEX.save()
 }
 
 // set default supported extensions
 func SetExtensions() {
 	if len(opts.Extensions) < 1 {
-		opts.Extensions = append(opts.Extensions, ".png", ".jpg", ".jpeg")
+		opts.Extensions = append(opts.Extensions, ".png", ".jpg", ".jpeg", ".webp")
 	}
 }
 
@@ -224,6 +370,13 @@ var msg string = `Examples:
   wallpaper-finder ~/Pictures ~/hdd/Pictures
   wallpaper-finder -r 16x9 ~/Pictures
   wallpaper-finder -e png ~/Pictures
+  wallpaper-finder --duplicates --hash phash --distance 8 ~/Pictures
+  wallpaper-finder --similar-to ~/.config/kitty/theme.conf ~/Pictures
+  wallpaper-finder --dark --dominant-hue 200±20 ~/Pictures
+  wallpaper-finder --portrait --min-height 1920 --max-size 5MB ~/Pictures
+  wallpaper-finder --format jpeg -o null ~/Pictures | xargs -0 feh
+  wallpaper-finder --min-megapixels 8 -o json ~/Pictures
+  wallpaper-finder --dark --contact-sheet dark.png --columns 4 ~/Pictures
 `
 
 func main() {
@@ -259,6 +412,24 @@ func main() {
 		debug = log.Printf
 	}
 
+	HASH_KIND, err = phash.ParseKind(opts.Hash)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := parseColorQuery(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := parseFileFilter(); err != nil {
+		log.Fatal(err)
+	}
+
+	out, err = newPrinter(os.Stdout, opts.Output, opts.Color)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	debug("OPTIONS %v - ARGS %v", opts, args)
 	rat, _ := floatToFraction(ASPECT_RATIO)
 	debug("aspect_ratio: %v %v", ASPECT_RATIO, rat)
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"pix/pkg/colors"
+	"pix/pkg/imaging"
+	"pix/pkg/quantize"
+)
+
+// size of the longest side of the thumbnail that color statistics are computed on
+const statsThumbSize = 64
+
+// colorStats summarizes the colors of an image
+type colorStats struct {
+	Palette    []color.RGBA
+	Luminance  float64 // average luminance 0-1
+	Saturation float64 // average HSV saturation 0-1
+	Hue        float64 // dominant hue in degrees, -1 when the image is mostly gray
+}
+
+// computeStats extracts a small dominant palette and average luminance and
+// saturation from a downscaled copy of the image
+func computeStats(img image.Image) colorStats {
+	small := imaging.Fit(img, statsThumbSize, statsThumbSize, imaging.Box)
+
+	var stats colorStats
+	for _, c := range quantize.Palette(small, 3) {
+		stats.Palette = append(stats.Palette, c)
+	}
+
+	// saturation weighted hue histogram with 10 degree bins
+	var hues [36]float64
+	var lum, sat, total float64
+
+	b := small.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := y*small.Stride + x*4
+			p := small.Pix[i : i+4 : i+4]
+			if p[3] == 0 {
+				continue
+			}
+			r, g, bl := float64(p[0])/255, float64(p[1])/255, float64(p[2])/255
+			h, s, v := rgbToHSV(r, g, bl)
+
+			lum += 0.299*r + 0.587*g + 0.114*bl
+			sat += s
+			total++
+
+			if s > 0.15 && v > 0.15 {
+				hues[int(h/10)%36] += s * v
+			}
+		}
+	}
+
+	if total > 0 {
+		stats.Luminance = lum / total
+		stats.Saturation = sat / total
+	}
+
+	stats.Hue = -1
+	var best, weight float64
+	for i, w := range hues {
+		weight += w
+		if w > best {
+			best = w
+			stats.Hue = float64(i)*10 + 5
+		}
+	}
+	// a handful of colorful pixels don't make a dominant hue
+	if total == 0 || weight/total < 0.05 {
+		stats.Hue = -1
+	}
+
+	return stats
+}
+
+// rgbToHSV converts 0-1 RGB values to a 0-360 hue and 0-1 saturation and value
+func rgbToHSV(r, g, b float64) (float64, float64, float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	d := max - min
+
+	var h, s float64
+	if max > 0 {
+		s = d / max
+	}
+
+	if d > 0 {
+		switch max {
+		case r:
+			h = math.Mod((g-b)/d, 6)
+		case g:
+			h = (b-r)/d + 2
+		default:
+			h = (r-g)/d + 4
+		}
+		h *= 60
+		if h < 0 {
+			h += 360
+		}
+	}
+
+	return h, s, max
+}
+
+// colorDistance is the "redmean" weighted RGB distance normalized to 0-1
+func colorDistance(c1, c2 color.Color) float64 {
+	r1, g1, b1, _ := c1.RGBA()
+	r2, g2, b2, _ := c2.RGBA()
+
+	rm := (float64(r1>>8) + float64(r2>>8)) / 2
+	dr := float64(r1>>8) - float64(r2>>8)
+	dg := float64(g1>>8) - float64(g2>>8)
+	db := float64(b1>>8) - float64(b2>>8)
+
+	d := math.Sqrt((2+rm/256)*dr*dr + 4*dg*dg + (2+(255-rm)/256)*db*db)
+	return d / 765 // distance between black and white
+}
+
+// paletteDistance is the symmetric average nearest color distance between two palettes
+func paletteDistance(theme []color.Color, pal []color.RGBA) float64 {
+	if len(theme) == 0 || len(pal) == 0 {
+		return 1
+	}
+
+	other := make([]color.Color, len(pal))
+	for i, c := range pal {
+		other[i] = c
+	}
+
+	return (nearestAverage(theme, other) + nearestAverage(other, theme)) / 2
+}
+
+// nearestAverage averages the distance from each color in a to its closest color in b
+func nearestAverage(a, b []color.Color) float64 {
+	var sum float64
+	for _, c1 := range a {
+		best := math.MaxFloat64
+		for _, c2 := range b {
+			best = math.Min(best, colorDistance(c1, c2))
+		}
+		sum += best
+	}
+	return sum / float64(len(a))
+}
+
+// hueRange is a hue in degrees with a tolerance in either direction
+type hueRange struct {
+	center    float64
+	tolerance float64
+}
+
+// parseHueRange parses "200±20", "200+-20", "200:20", a lone "200" (±15) or a
+// range from one hue to another "350-20", which wraps around through 0
+func parseHueRange(s string) (hueRange, error) {
+	s = strings.TrimSpace(s)
+	hr := hueRange{tolerance: 15}
+
+	var center, tol string
+	var cut bool
+	for _, sep := range []string{"±", "+-", "+/-", ":", ","} {
+		if before, after, ok := strings.Cut(s, sep); ok {
+			center, tol, cut = before, after, true
+			break
+		}
+	}
+	if !cut {
+		// a leading - is a negative hue, not a range
+		if i := strings.Index(s[min(len(s), 1):], "-"); i >= 0 {
+			return parseHueSpan(s, s[:i+1], s[i+2:])
+		}
+		center = s
+	}
+
+	c, err := strconv.ParseFloat(strings.TrimSpace(center), 64)
+	if err != nil {
+		return hr, fmt.Errorf("couldn't parse hue: %q must be in the format <degrees>±<tolerance> ex: 200±20", s)
+	}
+	hr.center = math.Mod(math.Mod(c, 360)+360, 360)
+
+	if cut {
+		t, err := strconv.ParseFloat(strings.TrimSpace(tol), 64)
+		if err != nil || t < 0 {
+			return hr, fmt.Errorf("couldn't parse hue tolerance: %q must be in the format <degrees>±<tolerance> ex: 200±20", s)
+		}
+		hr.tolerance = t
+	}
+
+	return hr, nil
+}
+
+// parseHueSpan parses the hues from and to of a range, going clockwise from
+// one to the other
+func parseHueSpan(s, from, to string) (hueRange, error) {
+	f, errf := strconv.ParseFloat(strings.TrimSpace(from), 64)
+	t, errt := strconv.ParseFloat(strings.TrimSpace(to), 64)
+	if errf != nil || errt != nil {
+		return hueRange{}, fmt.Errorf("couldn't parse hue range: %q must be in the format <degrees>-<degrees> ex: 350-20", s)
+	}
+
+	f = math.Mod(math.Mod(f, 360)+360, 360)
+	span := math.Mod(math.Mod(t-f, 360)+360, 360)
+	return hueRange{center: math.Mod(f+span/2, 360), tolerance: span / 2}, nil
+}
+
+// distance returns the distance around the color wheel from hue to the center
+func (hr hueRange) distance(hue float64) float64 {
+	d := math.Abs(hue - hr.center)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// colorQuery holds every color based filter, each one that is set contributes to the match score
+type colorQuery struct {
+	theme  []color.Color
+	dark   bool
+	light  bool
+	minSat float64
+	hue    *hueRange
+}
+
+// active reports whether any color filter is set, if none are there is no need to decode images
+func (q *colorQuery) active() bool {
+	return len(q.theme) > 0 || q.dark || q.light || q.minSat > 0 || q.hue != nil
+}
+
+// match returns a 0-1 score of how well the stats match the query, or false if
+// a hard filter rejects the image
+func (q *colorQuery) match(s colorStats) (float64, bool) {
+	var score float64
+	var n int
+
+	if len(q.theme) > 0 {
+		score += 1 - paletteDistance(q.theme, s.Palette)
+		n++
+	}
+
+	if q.dark {
+		if s.Luminance > 0.4 {
+			return 0, false
+		}
+		score += 1 - s.Luminance
+		n++
+	}
+
+	if q.light {
+		if s.Luminance < 0.6 {
+			return 0, false
+		}
+		score += s.Luminance
+		n++
+	}
+
+	if q.minSat > 0 {
+		if s.Saturation < q.minSat {
+			return 0, false
+		}
+		score += s.Saturation
+		n++
+	}
+
+	if q.hue != nil {
+		if s.Hue < 0 {
+			return 0, false
+		}
+		d := q.hue.distance(s.Hue)
+		if d > q.hue.tolerance {
+			return 0, false
+		}
+		if q.hue.tolerance > 0 {
+			score += 1 - d/(q.hue.tolerance*2)
+		} else {
+			score++
+		}
+		n++
+	}
+
+	if n == 0 {
+		return 0, true
+	}
+	return score / float64(n), true
+}
+
+// loadTheme parses every hex color from the given file
+func loadTheme(path string) ([]color.Color, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cparser := colors.NewParser()
+	if err := cparser.ParseFile(f); err != nil {
+		return nil, err
+	}
+	if len(cparser.Colors) == 0 {
+		return nil, fmt.Errorf("no colors found in %s", path)
+	}
+	return cparser.Colors, nil
+}
+
+// parseColorQuery builds the global color query from the command line options
+func parseColorQuery() error {
+	if opts.Dark && opts.Light {
+		return fmt.Errorf("--dark and --light are mutually exclusive")
+	}
+
+	if opts.MinSaturation < 0 || opts.MinSaturation > 1 {
+		return fmt.Errorf("--min-saturation must be between 0.0 and 1.0")
+	}
+
+	COLOR_QUERY.dark = opts.Dark
+	COLOR_QUERY.light = opts.Light
+	COLOR_QUERY.minSat = opts.MinSaturation
+
+	if opts.SimilarTo != "" {
+		theme, err := loadTheme(opts.SimilarTo)
+		if err != nil {
+			return err
+		}
+		COLOR_QUERY.theme = theme
+	}
+
+	if opts.DominantHue != "" {
+		hr, err := parseHueRange(opts.DominantHue)
+		if err != nil {
+			return err
+		}
+		COLOR_QUERY.hue = &hr
+	}
+
+	return nil
+}
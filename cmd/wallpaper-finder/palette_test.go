@@ -0,0 +1,118 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestParseHueRange(t *testing.T) {
+	testCases := []struct {
+		in        string
+		center    float64
+		tolerance float64
+	}{
+		{"200±20", 200, 20},
+		{"200+-20", 200, 20},
+		{"200:20", 200, 20},
+		{"200", 200, 15},
+		{"-20±5", 340, 5},
+		{"370", 10, 15},
+		{"90-150", 120, 30},
+		{"350-20", 5, 15},
+		{"300 - 60", 0, 60},
+	}
+	for _, tc := range testCases {
+		hr, err := parseHueRange(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+		if math.Abs(hr.center-tc.center) > 1e-9 || math.Abs(hr.tolerance-tc.tolerance) > 1e-9 {
+			t.Errorf("%q: got %v±%v want %v±%v", tc.in, hr.center, hr.tolerance, tc.center, tc.tolerance)
+		}
+	}
+
+	for _, in := range []string{"", "red", "200±", "200±x", "200±-5", "-", "350-", "-20-", "10-20-30", "a-b"} {
+		if _, err := parseHueRange(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestHueRangeWraps(t *testing.T) {
+	hr, err := parseHueRange("350-20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hue := range []float64{350, 355, 0, 5, 20} {
+		if d := hr.distance(hue); d > hr.tolerance+1e-9 {
+			t.Errorf("%v is %v from %v±%v", hue, d, hr.center, hr.tolerance)
+		}
+	}
+	for _, hue := range []float64{340, 25, 180} {
+		if d := hr.distance(hue); d <= hr.tolerance {
+			t.Errorf("%v should be outside %v±%v", hue, hr.center, hr.tolerance)
+		}
+	}
+}
+
+// fixture is a grey image with the top rows painted c
+func fixture(rows int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if y < rows {
+				img.Set(x, y, c)
+			} else {
+				img.Set(x, y, color.Gray{128})
+			}
+		}
+	}
+	return img
+}
+
+func TestColorQuery(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	hue := func(s string) *hueRange {
+		hr, err := parseHueRange(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &hr
+	}
+
+	testCases := []struct {
+		name  string
+		rows  int // of 64 that are red
+		query colorQuery
+		match bool
+	}{
+		{"solid red in a wrapping range", 64, colorQuery{hue: hue("350-20")}, true},
+		{"solid red outside the range", 64, colorQuery{hue: hue("120±30")}, false},
+		{"solid red is saturated", 64, colorQuery{minSat: 0.9}, true},
+		{"solid red isn't light", 64, colorQuery{light: true}, false},
+		{"an eighth red is dominant", 8, colorQuery{hue: hue("0±10")}, true},
+		{"a few red rows aren't", 2, colorQuery{hue: hue("0±10")}, false},
+		{"mostly grey isn't saturated", 8, colorQuery{minSat: 0.5}, false},
+		{"similar palette", 64, colorQuery{theme: []color.Color{red}}, true},
+	}
+	for _, tc := range testCases {
+		stats := computeStats(fixture(tc.rows, red))
+		score, ok := tc.query.match(stats)
+		if ok != tc.match {
+			t.Errorf("%s: matched %v with %+v", tc.name, ok, stats)
+		}
+		if ok && (score <= 0 || score > 1) {
+			t.Errorf("%s: score %v", tc.name, score)
+		}
+	}
+
+	stats := computeStats(fixture(64, red))
+	if stats.Hue != 5 || stats.Saturation != 1 || len(stats.Palette) == 0 {
+		t.Errorf("solid red stats %+v", stats)
+	}
+	if grey := computeStats(fixture(0, red)); grey.Hue != -1 {
+		t.Errorf("grey has a dominant hue of %v", grey.Hue)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// result is an image that matched every filter
+type result struct {
+	Path   string  `json:"path"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Ratio  string  `json:"ratio"`
+	Format string  `json:"format"`
+	Size   int64   `json:"size"`
+	Score  float64 `json:"score,omitempty"`
+	Group  int     `json:"group,omitempty"`
+	Best   bool    `json:"best,omitempty"`
+}
+
+// newResult fills in a result from an index entry
+func newResult(path string, e *indexEntry) result {
+	ratio, err := floatToFraction(float32(e.Width) / float32(e.Height))
+	if err != nil {
+		ratio = ""
+	}
+	return result{
+		Path:   path,
+		Width:  e.Width,
+		Height: e.Height,
+		Ratio:  ratio,
+		Format: e.Format,
+		Size:   e.Size,
+	}
+}
+
+var (
+	resultsMu sync.Mutex
+	results   []result
+	out       printer
+)
+
+// addResult prints the result right away unless results have to be ranked first
+func addResult(r result) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	if COLOR_QUERY.active() {
+		results = append(results, r)
+		return
+	}
+	out.print(r)
+	// keep them around for the contact sheet
+	if opts.ContactSheet != "" {
+		results = append(results, r)
+	}
+}
+
+// printResults prints the collected results from the best to the worst match
+func printResults(res []result) {
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Path < res[j].Path
+	})
+
+	for _, r := range res {
+		out.print(r)
+	}
+}
+
+// printer writes results in one of the output formats
+type printer interface {
+	print(r result)
+	flush() error
+}
+
+// newPrinter returns a printer for the given --output format
+func newPrinter(w io.Writer, format string, colored bool) (printer, error) {
+	switch format {
+	case "", "plain", "text":
+		return &plainPrinter{w: w, color: colored}, nil
+	case "json":
+		return &jsonPrinter{w: w}, nil
+	case "csv":
+		return &csvPrinter{w: csv.NewWriter(w)}, nil
+	case "null", "nul", "0":
+		return &nullPrinter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %q must be one of [plain|json|csv|null]", format)
+}
+
+// plainPrinter prints one path per line
+type plainPrinter struct {
+	w     io.Writer
+	color bool
+}
+
+func (p *plainPrinter) print(r result) {
+	if p.color {
+		fmt.Fprintf(p.w, "%s [\x1b[32m %dx%d \x1b[0m|\x1b[35m %s \x1b[0m]\n", r.Path, r.Width, r.Height, r.Ratio)
+		return
+	}
+	fmt.Fprintf(p.w, "%s\n", r.Path)
+}
+
+func (p *plainPrinter) flush() error { return nil }
+
+// nullPrinter separates paths with NUL bytes for xargs -0
+type nullPrinter struct {
+	w io.Writer
+}
+
+func (p *nullPrinter) print(r result) {
+	fmt.Fprintf(p.w, "%s\x00", r.Path)
+}
+
+func (p *nullPrinter) flush() error { return nil }
+
+// jsonPrinter streams a JSON array of results
+type jsonPrinter struct {
+	w     io.Writer
+	count int
+}
+
+func (p *jsonPrinter) print(r result) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		debug("json: %v", err)
+		return
+	}
+	if p.count == 0 {
+		fmt.Fprint(p.w, "[\n  ")
+	} else {
+		fmt.Fprint(p.w, ",\n  ")
+	}
+	p.w.Write(b)
+	p.count++
+}
+
+func (p *jsonPrinter) flush() error {
+	if p.count == 0 {
+		_, err := fmt.Fprintln(p.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(p.w, "\n]")
+	return err
+}
+
+// csvPrinter writes a header followed by one row per result
+type csvPrinter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (p *csvPrinter) print(r result) {
+	if !p.header {
+		p.w.Write([]string{"path", "width", "height", "ratio", "format", "size", "score", "group", "best"})
+		p.header = true
+	}
+	p.w.Write([]string{
+		r.Path,
+		strconv.Itoa(r.Width),
+		strconv.Itoa(r.Height),
+		r.Ratio,
+		r.Format,
+		strconv.FormatInt(r.Size, 10),
+		strconv.FormatFloat(r.Score, 'f', 4, 64),
+		strconv.Itoa(r.Group),
+		strconv.FormatBool(r.Best),
+	})
+}
+
+func (p *csvPrinter) flush() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func init() {
+	out = &plainPrinter{w: os.Stdout}
+}
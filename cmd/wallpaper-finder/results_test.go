@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+var printerResults = []result{
+	{Path: "/walls/a.png", Width: 3840, Height: 2160, Ratio: "16/9", Format: "png", Size: 1048576},
+	{Path: "/walls/b, \"quoted\".jpg", Width: 2560, Height: 1080, Ratio: "64/27", Format: "jpeg", Size: 512, Score: 0.875, Group: 2, Best: true},
+}
+
+func TestPrinters(t *testing.T) {
+	testCases := []struct {
+		format string
+		want   string
+	}{
+		{"json", "[\n" +
+			`  {"path":"/walls/a.png","width":3840,"height":2160,"ratio":"16/9","format":"png","size":1048576},` + "\n" +
+			`  {"path":"/walls/b, \"quoted\".jpg","width":2560,"height":1080,"ratio":"64/27","format":"jpeg","size":512,"score":0.875,"group":2,"best":true}` + "\n" +
+			"]\n"},
+		{"csv", "path,width,height,ratio,format,size,score,group,best\n" +
+			"/walls/a.png,3840,2160,16/9,png,1048576,0.0000,0,false\n" +
+			`"/walls/b, ""quoted"".jpg",2560,1080,64/27,jpeg,512,0.8750,2,true` + "\n"},
+		{"null", "/walls/a.png\x00/walls/b, \"quoted\".jpg\x00"},
+		{"plain", "/walls/a.png\n/walls/b, \"quoted\".jpg\n"},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		p, err := newPrinter(&buf, tc.format, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range printerResults {
+			p.print(r)
+		}
+		if err := p.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.format, got, tc.want)
+		}
+	}
+}
+
+func TestPrintersEmpty(t *testing.T) {
+	// no matches still gives valid json and nothing at all for the others
+	for format, want := range map[string]string{"json": "[]\n", "csv": "", "null": "", "plain": ""} {
+		var buf bytes.Buffer
+		p, err := newPrinter(&buf, format, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: got %q want %q", format, got, want)
+		}
+	}
+
+	if _, err := newPrinter(&bytes.Buffer{}, "yaml", false); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
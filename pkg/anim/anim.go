@@ -0,0 +1,205 @@
+// Package anim is a format independent model of an animated image. Frames are
+// always full canvases with the disposal of the source format already applied,
+// so effects can treat every frame like a still image.
+package anim
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"pix/pkg/icc"
+	"pix/pkg/imaging"
+)
+
+// DefaultDelay is used for frames that don't come with a delay, like a directory of images
+const DefaultDelay = 100 * time.Millisecond
+
+// Animation is a sequence of same sized frames
+type Animation struct {
+	Frames []*image.NRGBA
+	Delays []time.Duration
+	// LoopCount is the number of times the animation plays, 0 loops forever
+	LoopCount int
+	// Deep is the full 16 bits per channel of a still image that has them,
+	// Frames[0] is its 8-bit copy. Map doesn't keep it.
+	Deep *image.NRGBA64
+}
+
+// New returns an animation of the given frames, shown for delay each
+func New(frames []image.Image, delay time.Duration) *Animation {
+	a := &Animation{}
+	for _, f := range frames {
+		a.Append(f, delay)
+	}
+	return a
+}
+
+// Append adds a frame, it is cropped or padded to the size of the first frame
+func (a *Animation) Append(img image.Image, delay time.Duration) {
+	b := img.Bounds()
+	if len(a.Frames) > 0 {
+		b = image.Rectangle{Min: b.Min, Max: b.Min.Add(a.Bounds().Size())}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	a.Frames = append(a.Frames, dst)
+	a.Delays = append(a.Delays, delay)
+}
+
+// Len returns the number of frames
+func (a *Animation) Len() int {
+	return len(a.Frames)
+}
+
+// Bounds returns the size of the canvas
+func (a *Animation) Bounds() image.Rectangle {
+	if len(a.Frames) == 0 {
+		return image.Rectangle{}
+	}
+	return a.Frames[0].Bounds()
+}
+
+// Duration is how long one loop of the animation takes
+func (a *Animation) Duration() time.Duration {
+	var d time.Duration
+	for _, delay := range a.Delays {
+		d += delay
+	}
+	return d
+}
+
+// Map runs fn over every frame using up to workers goroutines and returns a
+// new animation with the results in the original order, delays and loop count
+// are kept. Use 1 worker when fn depends on the frame before it, 0 uses one per CPU.
+func (a *Animation) Map(workers int, fn func(i int, frame image.Image) (image.Image, error)) (*Animation, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	out := make([]image.Image, len(a.Frames))
+	errs := make([]error, len(a.Frames))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(a.Frames)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i], errs[i] = fn(i, a.Frames[i])
+			}
+		}()
+	}
+
+	for i := range a.Frames {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	res := &Animation{LoopCount: a.LoopCount}
+	for i, img := range out {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, errs[i])
+		}
+		if img == nil {
+			return nil, fmt.Errorf("frame %d: no image returned", i)
+		}
+		res.Append(img, a.Delays[i])
+	}
+
+	return res, nil
+}
+
+// ErrFormat is returned when the data isn't an image format that can be animated
+var ErrFormat = errors.New("anim: unknown format")
+
+// Decode reads a GIF, an APNG or any other registered image format as a
+// single frame animation, the EXIF orientation of photos is applied and
+// embedded color profiles are converted to sRGB. 16-bit stills are kept in Deep.
+func Decode(r io.Reader) (*Animation, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(8)
+	if err != nil && len(magic) < 3 {
+		return nil, ErrFormat
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("GIF8")):
+		return DecodeGIF(br)
+	case bytes.HasPrefix(magic, []byte("\x89PNG\r\n\x1a\n")):
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		a, err := DecodeAPNG(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		a.convertProfile(data)
+		if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err == nil && a.Len() == 1 && deepModel(cfg.ColorModel) {
+			img, err := imaging.Decode(bytes.NewReader(data), imaging.ConvertProfile(true))
+			if err != nil {
+				return nil, err
+			}
+			a.Deep = toNRGBA64(img)
+		}
+		return a, nil
+	}
+
+	img, err := imaging.Decode(br, imaging.AutoOrientation(true), imaging.ConvertProfile(true))
+	if err != nil {
+		return nil, err
+	}
+	a := New([]image.Image{img}, 0)
+	if imaging.HighBitDepth(img) {
+		a.Deep = toNRGBA64(img)
+	}
+	return a, nil
+}
+
+// deepModel reports whether a png stores 16 bits per channel
+func deepModel(m color.Model) bool {
+	return m == color.NRGBA64Model || m == color.RGBA64Model || m == color.Gray16Model
+}
+
+func toNRGBA64(img image.Image) *image.NRGBA64 {
+	if n, ok := img.(*image.NRGBA64); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// convertProfile converts the frames to sRGB from the profile embedded in
+// data, profiles that can't be converted are ignored
+func (a *Animation) convertProfile(data []byte) {
+	profile, err := icc.Extract(data)
+	if err != nil || profile == nil {
+		return
+	}
+	p, err := icc.Parse(profile)
+	if err != nil || p.IsSRGB() {
+		return
+	}
+	t, err := icc.NewTransform(p)
+	if err != nil {
+		return
+	}
+	for i, f := range a.Frames {
+		a.Frames[i] = t.Image(f).(*image.NRGBA)
+	}
+}
@@ -0,0 +1,320 @@
+package anim
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"pix/pkg/icc"
+	"pix/pkg/imaging"
+)
+
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func paletted(r image.Rectangle, idx uint8) *image.Paletted {
+	p := image.NewPaletted(r, color.Palette{color.Transparent, color.White, color.Black})
+	for i := range p.Pix {
+		p.Pix[i] = idx
+	}
+	return p
+}
+
+func TestFromGIFDisposal(t *testing.T) {
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			paletted(image.Rect(0, 0, 4, 4), 1),
+			paletted(image.Rect(0, 0, 2, 2), 2),
+			paletted(image.Rect(2, 2, 4, 4), 2),
+			paletted(image.Rect(2, 0, 4, 2), 2),
+		},
+		Delay:     []int{10, 20, 30, 40},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		LoopCount: 2,
+		Config:    image.Config{Width: 4, Height: 4},
+	}
+
+	a := FromGIF(g)
+	if a.Len() != 4 || a.LoopCount != 3 {
+		t.Fatalf("got %d frames looping %d times", a.Len(), a.LoopCount)
+	}
+	if a.Delays[1] != 200*time.Millisecond {
+		t.Errorf("delay %v want 200ms", a.Delays[1])
+	}
+
+	white, black, clear := color.NRGBA{255, 255, 255, 255}, color.NRGBA{0, 0, 0, 255}, color.NRGBA{}
+	tests := []struct {
+		frame int
+		x, y  int
+		want  color.NRGBA
+	}{
+		{1, 0, 0, black},
+		{1, 3, 3, white},
+		// frame 1 is cleared to transparent before frame 2
+		{2, 0, 0, clear},
+		{2, 3, 3, black},
+		// frame 2 is undone before frame 3
+		{3, 3, 3, white},
+		{3, 0, 0, clear},
+		{3, 3, 0, black},
+	}
+	for _, tt := range tests {
+		if got := a.Frames[tt.frame].NRGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("frame %d at %d,%d: got %v want %v", tt.frame, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestLoopCount(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5} {
+		a := testAnimation()
+		a.LoopCount = n
+
+		var buf bytes.Buffer
+		if err := a.EncodeGIF(&buf); err != nil {
+			t.Fatal(err)
+		}
+		b, err := DecodeGIF(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.LoopCount != n {
+			t.Errorf("%d loops came back as %d", n, b.LoopCount)
+		}
+	}
+}
+
+func testAnimation() *Animation {
+	a := New(nil, 0)
+	a.Append(solid(8, 6, color.NRGBA{255, 0, 0, 255}), 50*time.Millisecond)
+	a.Append(solid(8, 6, color.NRGBA{0, 0, 255, 255}), 120*time.Millisecond)
+	a.Append(solid(8, 6, color.NRGBA{0, 255, 0, 128}), 80*time.Millisecond)
+	a.LoopCount = 2
+	return a
+}
+
+func TestAPNGRoundTrip(t *testing.T) {
+	a := testAnimation()
+
+	var buf bytes.Buffer
+	if err := a.EncodeAPNG(&buf, png.BestSpeed); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != a.Len() || b.LoopCount != a.LoopCount {
+		t.Fatalf("got %d frames looping %d, want %d looping %d", b.Len(), b.LoopCount, a.Len(), a.LoopCount)
+	}
+	for i := range a.Frames {
+		if !bytes.Equal(a.Frames[i].Pix, b.Frames[i].Pix) {
+			t.Errorf("frame %d differs", i)
+		}
+		if a.Delays[i] != b.Delays[i] {
+			t.Errorf("frame %d: delay %v want %v", i, b.Delays[i], a.Delays[i])
+		}
+	}
+}
+
+func TestGIFRoundTrip(t *testing.T) {
+	a := testAnimation()
+
+	var buf bytes.Buffer
+	if err := a.EncodeGIF(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != a.Len() || b.LoopCount != a.LoopCount || b.Duration() != a.Duration() {
+		t.Fatalf("got %d frames looping %d for %v", b.Len(), b.LoopCount, b.Duration())
+	}
+	if got := b.Frames[0].NRGBAAt(3, 3); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("first frame is %v", got)
+	}
+}
+
+func TestDecodeStill(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(3, 3, palette.Plan9[10])); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Len() != 1 || a.Bounds() != image.Rect(0, 0, 3, 3) {
+		t.Errorf("got %d frames of %v", a.Len(), a.Bounds())
+	}
+	if a.Deep != nil {
+		t.Error("an 8-bit png came with a 16-bit copy")
+	}
+}
+
+func TestDecodeDeep(t *testing.T) {
+	deep := image.NewNRGBA64(image.Rect(0, 0, 4, 1))
+	for x := 0; x < 4; x++ {
+		deep.SetNRGBA64(x, 0, color.NRGBA64{uint16(0x8000 + x), 0x1234, 0xfedc, 0xffff})
+	}
+
+	encoders := map[string]func(*bytes.Buffer) error{
+		"png":  func(buf *bytes.Buffer) error { return png.Encode(buf, deep) },
+		"tiff": func(buf *bytes.Buffer) error { return imaging.Encode(buf, deep, imaging.TIFF) },
+	}
+	for name, encode := range encoders {
+		var buf bytes.Buffer
+		if err := encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		a, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Deep == nil {
+			t.Fatalf("%s: no 16-bit copy", name)
+		}
+		// the steps are lost in the 8-bit frame but not in the copy
+		for x := 0; x < 4; x++ {
+			if got, want := a.Deep.NRGBA64At(x, 0), deep.NRGBA64At(x, 0); got != want {
+				t.Errorf("%s: got %v want %v", name, got, want)
+			}
+		}
+		if got := a.Frames[0].NRGBAAt(3, 0); got.R != 0x80 {
+			t.Errorf("%s: 8-bit frame is %v", name, got)
+		}
+	}
+}
+
+// linearProfile is the sRGB profile with a straight tone curve, its values are linear light
+func linearProfile() []byte {
+	p := append([]byte(nil), icc.SRGB()...)
+	for i := 0; i < int(binary.BigEndian.Uint32(p[128:])); i++ {
+		e := p[132+i*12:]
+		if string(e[:4]) != "rTRC" {
+			continue
+		}
+		curv := p[binary.BigEndian.Uint32(e[4:]):]
+		n := int(binary.BigEndian.Uint32(curv[8:]))
+		for j := 0; j < n; j++ {
+			binary.BigEndian.PutUint16(curv[12+2*j:], uint16(j*65535/(n-1)))
+		}
+	}
+	return p
+}
+
+func TestDecodeProfile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(3, 3, color.NRGBA{128, 128, 128, 255})); err != nil {
+		t.Fatal(err)
+	}
+
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(linearProfile())
+	zw.Close()
+	chunk := append([]byte("iCCPlinear\x00\x00"), z.Bytes()...)
+
+	// the profile goes after the signature and the header chunk
+	data := append([]byte(nil), buf.Bytes()[:33]...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(chunk)-4))
+	data = append(data, chunk...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+	data = append(data, buf.Bytes()[33:]...)
+
+	a, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// half the light is a lighter grey in sRGB
+	if got := a.Frames[0].NRGBAAt(1, 1); got.R < 186 || got.R > 189 || got.R != got.B {
+		t.Errorf("linear grey converted to %v", got)
+	}
+}
+
+func TestMapKeepsOrder(t *testing.T) {
+	a := New(nil, 0)
+	for i := 0; i < 20; i++ {
+		a.Append(solid(2, 2, color.Gray{uint8(i)}), time.Duration(i)*time.Millisecond)
+	}
+
+	b, err := a.Map(4, func(i int, frame image.Image) (image.Image, error) {
+		// later frames finish first
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return solid(2, 2, color.Gray{255 - frame.(*image.NRGBA).Pix[0]}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, f := range b.Frames {
+		if got := f.Pix[0]; got != uint8(255-i) {
+			t.Errorf("frame %d has value %d", i, got)
+		}
+		if b.Delays[i] != a.Delays[i] {
+			t.Errorf("frame %d: delay %v want %v", i, b.Delays[i], a.Delays[i])
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	a := testAnimation()
+	a.Frames = append(a.Frames, a.Frames...)
+	a.Delays = append(a.Delays, a.Delays...)
+	if err := a.WriteDir(dir, imaging.PNG); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stray file that isn't an image is ignored
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != a.Len() {
+		t.Fatalf("got %d frames want %d", b.Len(), a.Len())
+	}
+	for i := range a.Frames {
+		if !bytes.Equal(a.Frames[i].Pix, b.Frames[i].Pix) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	names := []string{"frame10.png", "frame2.png", "frame1.png", "a.png", "frame02b.png"}
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+
+	want := []string{"a.png", "frame1.png", "frame2.png", "frame02b.png", "frame10.png"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got %v want %v", names, want)
+		}
+	}
+}
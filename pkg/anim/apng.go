@@ -0,0 +1,47 @@
+package anim
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"pix/pkg/apng"
+)
+
+// FromAPNG composites the frames of an APNG, applying their blend and dispose ops
+func FromAPNG(p *apng.APNG) *Animation {
+	a := &Animation{LoopCount: p.LoopCount}
+	for i, f := range p.Render() {
+		a.Append(f, p.Frames[i].Delay)
+	}
+	return a
+}
+
+// DecodeAPNG reads every frame of an APNG, a regular PNG is a single frame
+func DecodeAPNG(r io.Reader) (*Animation, error) {
+	p, err := apng.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return FromAPNG(p), nil
+}
+
+// ToAPNG converts the animation to an APNG, frames after the first only store
+// the area that changed
+func (a *Animation) ToAPNG() *apng.APNG {
+	frames := make([]image.Image, len(a.Frames))
+	for i, f := range a.Frames {
+		frames[i] = f
+	}
+	return apng.New(frames, a.Delays, a.LoopCount)
+}
+
+// EncodeAPNG writes the animation to w as an APNG
+func (a *Animation) EncodeAPNG(w io.Writer, level png.CompressionLevel) error {
+	if a.Len() == 0 {
+		return fmt.Errorf("anim: no frames to encode")
+	}
+	enc := apng.Encoder{CompressionLevel: level}
+	return enc.Encode(w, a.ToAPNG())
+}
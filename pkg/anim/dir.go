@@ -0,0 +1,119 @@
+package anim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"pix/pkg/imaging"
+)
+
+// ReadDir loads every image in a directory as a frame, in natural order so
+// frame2.png comes before frame10.png. Files that aren't images are skipped.
+func ReadDir(dir string) (*Animation, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		if _, err := imaging.FormatFromFilename(e.Name()); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no images found in %s", dir)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return naturalLess(names[i], names[j])
+	})
+
+	a := &Animation{}
+	for _, name := range names {
+		img, err := imaging.Open(filepath.Join(dir, name), imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if a.Len() > 0 && img.Bounds().Size() != a.Bounds().Size() {
+			return nil, fmt.Errorf("%s: frame is %v but the first frame is %v", name, img.Bounds().Size(), a.Bounds().Size())
+		}
+		a.Append(img, DefaultDelay)
+	}
+
+	return a, nil
+}
+
+// WriteDir saves every frame to dir as frame_0001.<ext>, frame_0002.<ext> and so on
+func (a *Animation) WriteDir(dir string, format imaging.Format, opts ...imaging.EncodeOption) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(format.String())
+	width := max(4, len(fmt.Sprint(a.Len())))
+	for i, f := range a.Frames {
+		name := filepath.Join(dir, fmt.Sprintf("frame_%0*d.%s", width, i+1, ext))
+		if err := imaging.Save(f, name, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open reads an animation from a GIF, an APNG, a directory of frames or any
+// other image as a single frame
+func Open(path string) (*Animation, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return ReadDir(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// naturalLess compares strings treating runs of digits as numbers
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digitPrefix(s string) string {
+	i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if i < 0 {
+		return s
+	}
+	return s[:i]
+}
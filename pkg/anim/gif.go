@@ -0,0 +1,100 @@
+package anim
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"pix/pkg/gifenc"
+)
+
+// FromGIF composites the frames of a GIF, applying every frame's disposal method
+func FromGIF(g *gif.GIF) *Animation {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, f := range g.Image {
+			bounds = bounds.Union(f.Bounds())
+		}
+	}
+
+	a := &Animation{LoopCount: gifToLoops(g.LoopCount)}
+	canvas := image.NewNRGBA(bounds)
+
+	for i, f := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var saved *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			saved = image.NewNRGBA(bounds)
+			copy(saved.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, f.Bounds(), f, f.Bounds().Min, draw.Over)
+
+		var delay time.Duration
+		if i < len(g.Delay) {
+			delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		a.Append(canvas, delay)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			// most viewers clear to transparent rather than the background color
+			draw.Draw(canvas, f.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+
+	return a
+}
+
+// DecodeGIF reads every frame of a GIF
+func DecodeGIF(r io.Reader) (a *Animation, err error) {
+	// broken gifs can panic the decoder
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("gif decode: %v", rec)
+		}
+	}()
+
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("gif decode: %w", err)
+	}
+	return FromGIF(g), nil
+}
+
+// EncodeGIF writes the animation to w as a GIF with palettes quantized from
+// the frames, see gifenc for the options
+func (a *Animation) EncodeGIF(w io.Writer, opts ...gifenc.Option) error {
+	if a.Len() == 0 {
+		return fmt.Errorf("anim: no frames to encode")
+	}
+
+	frames := make([]image.Image, len(a.Frames))
+	for i, f := range a.Frames {
+		frames[i] = f
+	}
+
+	opts = append([]gifenc.Option{gifenc.LoopCount(a.LoopCount)}, opts...)
+	return gifenc.Encode(w, frames, a.Delays, opts...)
+}
+
+// gifToLoops converts the GIF loop count, where 0 loops forever and -1 plays once
+func gifToLoops(n int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n < 0:
+		return 1
+	default:
+		return n + 1
+	}
+}
@@ -0,0 +1,180 @@
+// Package apng implements an encoder and decoder for animated PNG images.
+//
+// Frames are stored in full color with alpha, unlike GIF there is no palette
+// to squeeze every frame through. The specification is at
+// https://wiki.mozilla.org/APNG_Specification
+package apng
+
+import (
+	"image"
+	"image/draw"
+	"time"
+)
+
+// DisposeOp says what happens to the frame area before the next frame is drawn
+type DisposeOp uint8
+
+const (
+	// DisposeNone leaves the canvas as is
+	DisposeNone DisposeOp = iota
+	// DisposeBackground clears the frame area to transparent black
+	DisposeBackground
+	// DisposePrevious restores the frame area to what it was before the frame was drawn
+	DisposePrevious
+)
+
+// BlendOp says how the frame is drawn onto the canvas
+type BlendOp uint8
+
+const (
+	// BlendSource replaces the frame area, alpha included
+	BlendSource BlendOp = iota
+	// BlendOver composites the frame over the canvas
+	BlendOver
+)
+
+// Frame is a single frame of the animation. The bounds of Image are where the
+// frame is placed on the canvas, so frames can cover just the area that changed.
+type Frame struct {
+	Image   image.Image
+	Delay   time.Duration
+	Dispose DisposeOp
+	Blend   BlendOp
+}
+
+// APNG is an animation, the first frame is also what viewers that don't
+// support APNG show.
+type APNG struct {
+	Frames []Frame
+	// LoopCount is the number of times the animation plays, 0 loops forever
+	LoopCount int
+	// Width and Height are the size of the canvas, when 0 the bounds of the first frame are used
+	Width, Height int
+}
+
+// bounds returns the canvas rectangle
+func (a *APNG) bounds() image.Rectangle {
+	if a.Width > 0 && a.Height > 0 {
+		return image.Rect(0, 0, a.Width, a.Height)
+	}
+	if len(a.Frames) == 0 {
+		return image.Rectangle{}
+	}
+	b := a.Frames[0].Image.Bounds()
+	return image.Rect(0, 0, b.Max.X, b.Max.Y)
+}
+
+// New builds an animation from full canvas frames. Every frame after the first
+// is cropped to the area that changed since the frame before it, which keeps
+// files small when only part of the image moves.
+func New(frames []image.Image, delays []time.Duration, loopCount int) *APNG {
+	a := &APNG{LoopCount: loopCount}
+	if len(frames) == 0 {
+		return a
+	}
+
+	canvas := frames[0].Bounds()
+	a.Width, a.Height = canvas.Dx(), canvas.Dy()
+
+	var prev *image.NRGBA
+	for i, f := range frames {
+		cur := toNRGBA(f, canvas)
+
+		var delay time.Duration
+		if i < len(delays) {
+			delay = delays[i]
+		} else if len(delays) > 0 {
+			delay = delays[len(delays)-1]
+		}
+
+		img := image.Image(cur)
+		if prev != nil {
+			img = cur.SubImage(changed(prev, cur))
+		}
+
+		a.Frames = append(a.Frames, Frame{
+			Image:   img,
+			Delay:   delay,
+			Dispose: DisposeNone,
+			Blend:   BlendSource,
+		})
+		prev = cur
+	}
+
+	return a
+}
+
+// changed returns the smallest rectangle holding every pixel that differs
+// between two images of the same size. Identical frames still get a 1x1
+// rectangle since APNG frames can't be empty.
+func changed(a, b *image.NRGBA) image.Rectangle {
+	r := b.Bounds()
+	minX, minY, maxX, maxY := r.Max.X, r.Max.Y, r.Min.X, r.Min.Y
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		ra := a.Pix[(y-r.Min.Y)*a.Stride : (y-r.Min.Y)*a.Stride+r.Dx()*4]
+		rb := b.Pix[(y-r.Min.Y)*b.Stride : (y-r.Min.Y)*b.Stride+r.Dx()*4]
+		for x := 0; x < len(rb); x += 4 {
+			if ra[x] == rb[x] && ra[x+1] == rb[x+1] && ra[x+2] == rb[x+2] && ra[x+3] == rb[x+3] {
+				continue
+			}
+			px := r.Min.X + x/4
+			minX, maxX = min(minX, px), max(maxX, px+1)
+			minY, maxY = min(minY, y), max(maxY, y+1)
+		}
+	}
+
+	if minX >= maxX {
+		return image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Min.Y+1)
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// toNRGBA copies img into a new NRGBA image with the given bounds
+func toNRGBA(img image.Image, bounds image.Rectangle) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// Render composites the frames onto the canvas, applying their blend and
+// dispose ops, and returns what is on screen for each frame.
+func (a *APNG) Render() []*image.NRGBA {
+	bounds := a.bounds()
+	canvas := image.NewNRGBA(bounds)
+	out := make([]*image.NRGBA, 0, len(a.Frames))
+
+	for i, f := range a.Frames {
+		r := f.Image.Bounds().Intersect(bounds)
+
+		var saved *image.NRGBA
+		dispose := f.Dispose
+		if dispose == DisposePrevious && i == 0 {
+			// nothing to go back to, the spec treats it as clearing to the background
+			dispose = DisposeBackground
+		}
+		if dispose == DisposePrevious {
+			saved = image.NewNRGBA(r)
+			draw.Draw(saved, r, canvas, r.Min, draw.Src)
+		}
+
+		op := draw.Src
+		if f.Blend == BlendOver {
+			op = draw.Over
+		}
+		draw.Draw(canvas, r, f.Image, r.Min, op)
+
+		snapshot := image.NewNRGBA(bounds)
+		copy(snapshot.Pix, canvas.Pix)
+		out = append(out, snapshot)
+
+		switch dispose {
+		case DisposeBackground:
+			draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+		case DisposePrevious:
+			draw.Draw(canvas, r, saved, r.Min, draw.Src)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,182 @@
+package apng
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// movingSquare draws a square that moves one step to the right every frame
+func movingSquare(n int, alpha bool) []image.Image {
+	var frames []image.Image
+	for i := 0; i < n; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				c := color.NRGBA{uint8(x * 6), uint8(y * 8), 90, 255}
+				if alpha {
+					c.A = uint8(x * 6)
+				}
+				if x >= 5+i*3 && x < 13+i*3 && y >= 10 && y < 18 {
+					c = color.NRGBA{255, 0, 0, 255}
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		frames = append(frames, img)
+	}
+	return frames
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, alpha := range []bool{false, true} {
+		frames := movingSquare(5, alpha)
+		delays := []time.Duration{100 * time.Millisecond, 40 * time.Millisecond}
+		a := New(frames, delays, 3)
+
+		// every frame after the first only covers the area the square moved through
+		for i, f := range a.Frames[1:] {
+			if got, want := f.Image.Bounds(), image.Rect(5+i*3, 10, 16+i*3, 18); got != want {
+				t.Errorf("alpha=%v frame %d: cropped to %v want %v", alpha, i+1, got, want)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+
+		// viewers without APNG support see the first frame
+		first, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("alpha=%v: not a valid png: %v", alpha, err)
+		}
+		if !equal(toNRGBA(first, first.Bounds()), frames[0].(*image.NRGBA)) {
+			t.Errorf("alpha=%v: default image differs from the first frame", alpha)
+		}
+
+		got, err := DecodeAll(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.LoopCount != 3 || len(got.Frames) != 5 {
+			t.Fatalf("alpha=%v: got %d frames looping %d times", alpha, len(got.Frames), got.LoopCount)
+		}
+		if got.Frames[0].Delay != delays[0] || got.Frames[4].Delay != delays[1] {
+			t.Errorf("alpha=%v: got delays %v and %v", alpha, got.Frames[0].Delay, got.Frames[4].Delay)
+		}
+
+		for i, r := range got.Render() {
+			if !equal(r, frames[i].(*image.NRGBA)) {
+				t.Errorf("alpha=%v frame %d: rendered frame differs from the original", alpha, i)
+			}
+		}
+	}
+}
+
+func TestRenderOps(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	half := color.NRGBA{0, 255, 0, 128}
+
+	solid := func(r image.Rectangle, c color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(r)
+		for i := 0; i < len(img.Pix); i += 4 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+		}
+		return img
+	}
+
+	a := &APNG{Frames: []Frame{
+		{Image: solid(image.Rect(0, 0, 4, 4), red)},
+		{Image: solid(image.Rect(1, 1, 3, 3), blue), Dispose: DisposePrevious},
+		{Image: solid(image.Rect(0, 0, 2, 2), half), Blend: BlendOver, Dispose: DisposeBackground},
+		{Image: solid(image.Rect(3, 3, 4, 4), blue)},
+	}}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := decoded.Render()
+	checks := []struct {
+		frame, x, y int
+		want        color.NRGBA
+	}{
+		{1, 1, 1, blue},
+		// the blue square was disposed back to red before frame 2
+		{2, 2, 2, red},
+		{3, 3, 3, blue},
+		// frame 2 cleared its area to transparent
+		{3, 0, 0, color.NRGBA{}},
+		{3, 2, 0, red},
+	}
+	for _, c := range checks {
+		if got := frames[c.frame].NRGBAAt(c.x, c.y); got != c.want {
+			t.Errorf("frame %d at %d,%d: got %v want %v", c.frame, c.x, c.y, got, c.want)
+		}
+	}
+
+	// green over red at half opacity
+	if got := frames[2].NRGBAAt(0, 0); got.A != 255 || got.R < 120 || got.G < 120 {
+		t.Errorf("blended pixel: got %v", got)
+	}
+}
+
+func TestDecodePlainPNG(t *testing.T) {
+	img := movingSquare(1, true)[0]
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Frames) != 1 || a.Frames[0].Image.Bounds() != img.Bounds() {
+		t.Fatalf("got %d frames", len(a.Frames))
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	Encode(&buf, New(movingSquare(3, false), nil, 0))
+	data := buf.Bytes()
+
+	if _, err := DecodeAll(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Error("truncated: expected an error")
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-20] ^= 0xff
+	if _, err := DecodeAll(bytes.NewReader(corrupt)); err == nil {
+		t.Error("bad checksum: expected an error")
+	}
+
+	if _, err := DecodeAll(bytes.NewReader([]byte("GIF89a not a png"))); err != ErrFormat {
+		t.Errorf("not a png: got %v want ErrFormat", err)
+	}
+}
+
+func equal(a, b *image.NRGBA) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	for y := 0; y < a.Bounds().Dy(); y++ {
+		ra := a.Pix[y*a.Stride : y*a.Stride+a.Bounds().Dx()*4]
+		rb := b.Pix[y*b.Stride : y*b.Stride+b.Bounds().Dx()*4]
+		if !bytes.Equal(ra, rb) {
+			return false
+		}
+	}
+	return true
+}
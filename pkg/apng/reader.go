@@ -0,0 +1,287 @@
+package apng
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+// ErrFormat is returned when the data isn't a valid PNG or APNG
+var ErrFormat = errors.New("apng: invalid format")
+
+// limits that protect against corrupt headers
+const (
+	maxChunkSize = 1 << 30
+	maxFrames    = 1 << 16
+)
+
+type frameControl struct {
+	width, height int
+	x, y          int
+	delay         time.Duration
+	dispose       DisposeOp
+	blend         BlendOp
+}
+
+type chunk struct {
+	name string
+	data []byte
+}
+
+func readChunk(r io.Reader) (chunk, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return chunk{}, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n > maxChunkSize {
+		return chunk{}, ErrFormat
+	}
+
+	data := make([]byte, n+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return chunk{}, unexpectedEOF(err)
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data[:n])
+	if crc.Sum32() != binary.BigEndian.Uint32(data[n:]) {
+		return chunk{}, fmt.Errorf("apng: bad checksum in %s chunk", hdr[4:])
+	}
+
+	return chunk{name: string(hdr[4:]), data: data[:n]}, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func parseFCTL(data []byte) (frameControl, error) {
+	if len(data) != 26 {
+		return frameControl{}, ErrFormat
+	}
+
+	num := binary.BigEndian.Uint16(data[20:])
+	den := binary.BigEndian.Uint16(data[22:])
+	if den == 0 {
+		den = 100
+	}
+
+	fc := frameControl{
+		width:   int(binary.BigEndian.Uint32(data[4:])),
+		height:  int(binary.BigEndian.Uint32(data[8:])),
+		x:       int(binary.BigEndian.Uint32(data[12:])),
+		y:       int(binary.BigEndian.Uint32(data[16:])),
+		delay:   time.Duration(num) * time.Second / time.Duration(den),
+		dispose: DisposeOp(data[24]),
+		blend:   BlendOp(data[25]),
+	}
+	if fc.width <= 0 || fc.height <= 0 || fc.dispose > DisposePrevious || fc.blend > BlendOver {
+		return frameControl{}, ErrFormat
+	}
+	return fc, nil
+}
+
+// DecodeAll reads every frame of an APNG. A regular PNG decodes to an
+// animation with a single frame.
+func DecodeAll(r io.Reader) (*APNG, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != pngHeader {
+		return nil, ErrFormat
+	}
+
+	var (
+		ihdr     []byte
+		extra    []chunk // PLTE, tRNS and friends every frame needs to decode
+		animated bool
+		a        = &APNG{}
+		fc       *frameControl
+		data     [][]byte
+		sawIDAT  bool
+		single   [][]byte // IDAT of a plain PNG or a default image that isn't part of the animation
+	)
+
+	flush := func() error {
+		if fc == nil {
+			return nil
+		}
+		img, err := decodeFrame(ihdr, extra, fc.width, fc.height, data)
+		if err != nil {
+			return err
+		}
+		if len(a.Frames) >= maxFrames {
+			return ErrFormat
+		}
+
+		a.Frames = append(a.Frames, Frame{
+			Image:   offset(img, fc.x, fc.y),
+			Delay:   fc.delay,
+			Dispose: fc.dispose,
+			Blend:   fc.blend,
+		})
+		fc, data = nil, nil
+		return nil
+	}
+
+	for {
+		c, err := readChunk(r)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		switch c.name {
+		case "IHDR":
+			if len(c.data) != 13 {
+				return nil, ErrFormat
+			}
+			ihdr = c.data
+			a.Width = int(binary.BigEndian.Uint32(c.data[0:]))
+			a.Height = int(binary.BigEndian.Uint32(c.data[4:]))
+
+		case "acTL":
+			if len(c.data) != 8 {
+				return nil, ErrFormat
+			}
+			animated = true
+			a.LoopCount = int(binary.BigEndian.Uint32(c.data[4:]))
+
+		case "fcTL":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			f, err := parseFCTL(c.data)
+			if err != nil {
+				return nil, err
+			}
+			if f.x+f.width > a.Width || f.y+f.height > a.Height {
+				return nil, ErrFormat
+			}
+			fc = &f
+
+		case "IDAT":
+			sawIDAT = true
+			if fc != nil {
+				data = append(data, c.data)
+			} else {
+				single = append(single, c.data)
+			}
+
+		case "fdAT":
+			if fc == nil || len(c.data) < 4 {
+				return nil, ErrFormat
+			}
+			data = append(data, c.data[4:])
+
+		case "IEND":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if ihdr == nil || !sawIDAT {
+				return nil, ErrFormat
+			}
+			if !animated || len(a.Frames) == 0 {
+				img, err := decodeFrame(ihdr, extra, a.Width, a.Height, single)
+				if err != nil {
+					return nil, err
+				}
+				a.Frames = []Frame{{Image: img}}
+			}
+			return a, nil
+
+		default:
+			// chunks before the image data like the palette and gamma apply to every frame
+			if !sawIDAT && ihdr != nil {
+				extra = append(extra, c)
+			}
+		}
+	}
+}
+
+// decodeFrame rewraps the image data of a frame into a standalone PNG so
+// image/png does the actual decoding
+func decodeFrame(ihdr []byte, extra []chunk, width, height int, data [][]byte) (image.Image, error) {
+	if ihdr == nil || len(data) == 0 {
+		return nil, ErrFormat
+	}
+
+	var buf bytes.Buffer
+	e := &encoder{}
+	e.w = bufio.NewWriter(&buf)
+	e.w.WriteString(pngHeader)
+
+	hdr := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(height))
+	e.writeChunk("IHDR", hdr)
+
+	for _, c := range extra {
+		e.writeChunk(c.name, c.data)
+	}
+	for _, d := range data {
+		e.writeChunk("IDAT", d)
+	}
+	e.writeChunk("IEND", nil)
+	if err := e.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return png.Decode(&buf)
+}
+
+// offset moves an image decoded at 0,0 to its place on the canvas
+func offset(img image.Image, x, y int) image.Image {
+	if x == 0 && y == 0 {
+		return img
+	}
+
+	switch m := img.(type) {
+	case *image.NRGBA:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.RGBA:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.NRGBA64:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.RGBA64:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.Gray:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.Gray16:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	case *image.Paletted:
+		m.Rect = m.Rect.Add(image.Pt(x, y))
+	default:
+		b := img.Bounds()
+		dst := image.NewNRGBA(b.Add(image.Pt(x, y)))
+		for py := b.Min.Y; py < b.Max.Y; py++ {
+			for px := b.Min.X; px < b.Max.X; px++ {
+				dst.Set(px+x, py+y, img.At(px, py))
+			}
+		}
+		return dst
+	}
+	return img
+}
+
+// Decode returns the first frame of an APNG, or the image of a regular PNG
+func Decode(r io.Reader) (image.Image, error) {
+	a, err := DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return a.Frames[0].Image, nil
+}
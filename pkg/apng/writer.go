@@ -0,0 +1,349 @@
+package apng
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+const (
+	colorTypeRGB  = 2
+	colorTypeRGBA = 6
+)
+
+// row filters from the PNG specification
+const (
+	ftNone = iota
+	ftSub
+	ftUp
+	ftAverage
+	ftPaeth
+	nFilter
+)
+
+// Encoder configures encoding of animations
+type Encoder struct {
+	CompressionLevel png.CompressionLevel
+}
+
+// Encode writes the animation to w with the default compression
+func Encode(w io.Writer, a *APNG) error {
+	var e Encoder
+	return e.Encode(w, a)
+}
+
+type encoder struct {
+	w     *bufio.Writer
+	err   error
+	seq   uint32
+	level int
+	bpp   int // bytes per pixel
+	zbuf  bytes.Buffer
+	zw    *zlib.Writer
+}
+
+// Encode writes the animation to w
+func (enc *Encoder) Encode(w io.Writer, a *APNG) error {
+	if len(a.Frames) == 0 {
+		return errors.New("apng: no frames to encode")
+	}
+
+	bounds := a.bounds()
+	if bounds.Empty() {
+		return errors.New("apng: empty canvas")
+	}
+
+	// the first frame is also the default image so it has to cover the whole canvas
+	if a.Frames[0].Image.Bounds() != bounds {
+		return errors.New("apng: the first frame must cover the whole canvas")
+	}
+
+	for _, f := range a.Frames {
+		if f.Image == nil || f.Image.Bounds().Empty() || !f.Image.Bounds().In(bounds) {
+			return errors.New("apng: every frame must be a non empty area inside the canvas")
+		}
+	}
+
+	e := &encoder{
+		w:     bufio.NewWriter(w),
+		level: zlibLevel(enc.CompressionLevel),
+		bpp:   3,
+	}
+
+	colorType := byte(colorTypeRGB)
+	for _, f := range a.Frames {
+		if !opaque(f.Image) {
+			colorType, e.bpp = colorTypeRGBA, 4
+			break
+		}
+	}
+
+	e.w.WriteString(pngHeader)
+
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(bounds.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(bounds.Dy()))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = colorType
+	e.writeChunk("IHDR", ihdr[:])
+
+	var actl [8]byte
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(a.Frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.LoopCount))
+	e.writeChunk("acTL", actl[:])
+
+	for i, f := range a.Frames {
+		e.writeFCTL(f)
+
+		data, err := e.compress(f.Image)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			e.writeChunk("IDAT", data)
+			continue
+		}
+
+		fdat := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, e.seq)
+		e.seq++
+		copy(fdat[4:], data)
+		e.writeChunk("fdAT", fdat)
+	}
+
+	e.writeChunk("IEND", nil)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func (e *encoder) writeChunk(name string, data []byte) {
+	if e.err != nil {
+		return
+	}
+
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], name)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+
+	var footer [4]byte
+	binary.BigEndian.PutUint32(footer[:], crc.Sum32())
+
+	if _, e.err = e.w.Write(hdr[:]); e.err != nil {
+		return
+	}
+	if _, e.err = e.w.Write(data); e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(footer[:])
+}
+
+func (e *encoder) writeFCTL(f Frame) {
+	b := f.Image.Bounds()
+	num, den := delayFraction(f.Delay)
+
+	var fctl [26]byte
+	binary.BigEndian.PutUint32(fctl[0:], e.seq)
+	binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+	binary.BigEndian.PutUint32(fctl[12:], uint32(b.Min.X))
+	binary.BigEndian.PutUint32(fctl[16:], uint32(b.Min.Y))
+	binary.BigEndian.PutUint16(fctl[20:], num)
+	binary.BigEndian.PutUint16(fctl[22:], den)
+	fctl[24] = byte(f.Dispose)
+	fctl[25] = byte(f.Blend)
+	e.seq++
+	e.writeChunk("fcTL", fctl[:])
+}
+
+// delayFraction turns a delay into the numerator and denominator of a
+// fraction of a second, in milliseconds when it fits and hundredths otherwise
+func delayFraction(d time.Duration) (uint16, uint16) {
+	ms := d.Milliseconds()
+	switch {
+	case ms <= 0:
+		return 0, 1000
+	case ms <= 0xffff:
+		return uint16(ms), 1000
+	case ms/10 <= 0xffff:
+		return uint16(ms / 10), 100
+	default:
+		return 0xffff, 1
+	}
+}
+
+// compress filters and deflates the pixels of one frame
+func (e *encoder) compress(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	e.zbuf.Reset()
+	if e.zw == nil {
+		zw, err := zlib.NewWriterLevel(&e.zbuf, e.level)
+		if err != nil {
+			return nil, err
+		}
+		e.zw = zw
+	} else {
+		e.zw.Reset(&e.zbuf)
+	}
+
+	src := toNRGBA(img, b)
+	n := b.Dx() * e.bpp
+
+	// index 0 of every row holds the filter type
+	cur := make([]byte, n+1)
+	prev := make([]byte, n+1)
+	var out [nFilter][]byte
+	for i := range out {
+		out[i] = make([]byte, n+1)
+	}
+
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+b.Dx()*4]
+		if e.bpp == 4 {
+			copy(cur[1:], row)
+		} else {
+			for x, j := 0, 1; x < len(row); x, j = x+4, j+3 {
+				cur[j], cur[j+1], cur[j+2] = row[x], row[x+1], row[x+2]
+			}
+		}
+
+		f := filter(out, cur, prev, e.bpp, e.level == zlib.NoCompression)
+		if _, err := e.zw.Write(f); err != nil {
+			return nil, err
+		}
+		cur, prev = prev, cur
+	}
+
+	if err := e.zw.Close(); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), e.zbuf.Bytes()...), nil
+}
+
+// filter applies every row filter and returns the one with the smallest sum
+// of absolute differences, the same heuristic image/png uses
+func filter(out [nFilter][]byte, cur, prev []byte, bpp int, none bool) []byte {
+	if none {
+		cur[0] = ftNone
+		return cur
+	}
+
+	best, bestSum := ftNone, sumAbs(cur[1:])
+	n := len(cur)
+
+	up := out[ftUp]
+	for i := 1; i < n; i++ {
+		up[i] = cur[i] - prev[i]
+	}
+
+	sub := out[ftSub]
+	for i := 1; i < n; i++ {
+		if i <= bpp {
+			sub[i] = cur[i]
+		} else {
+			sub[i] = cur[i] - cur[i-bpp]
+		}
+	}
+
+	avg := out[ftAverage]
+	for i := 1; i < n; i++ {
+		var left int
+		if i > bpp {
+			left = int(cur[i-bpp])
+		}
+		avg[i] = cur[i] - uint8((left+int(prev[i]))/2)
+	}
+
+	paeth := out[ftPaeth]
+	for i := 1; i < n; i++ {
+		var a, c uint8
+		if i > bpp {
+			a, c = cur[i-bpp], prev[i-bpp]
+		}
+		paeth[i] = cur[i] - paethPredictor(a, prev[i], c)
+	}
+
+	for _, ft := range []int{ftSub, ftUp, ftAverage, ftPaeth} {
+		if s := sumAbs(out[ft][1:]); s < bestSum {
+			best, bestSum = ft, s
+		}
+	}
+
+	if best == ftNone {
+		cur[0] = ftNone
+		return cur
+	}
+	out[best][0] = byte(best)
+	return out[best]
+}
+
+func sumAbs(b []byte) int {
+	sum := 0
+	for _, v := range b {
+		sum += abs(int(int8(v)))
+	}
+	return sum
+}
+
+func paethPredictor(a, b, c uint8) uint8 {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func zlibLevel(l png.CompressionLevel) int {
+	switch l {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+// opaque reports whether every pixel of the image is fully opaque
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
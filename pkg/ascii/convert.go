@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
+
+	"pix/pkg/edge"
 )
 
 // Convert renders the given image using ascii characters
@@ -65,6 +67,12 @@ func convert(img image.Image, opts *options) (image.Image, error) {
 	// appropriately instead of individual code points
 	rs := []rune(opts.charset)
 
+	// Gradients to pick line glyphs along the edges
+	var grads *edge.Gradients
+	if opts.edges > 0 {
+		grads = edge.Gradient(img, edge.Sobel)
+	}
+
 	// Loop over the new image's coordinates
 	for y := bounds.Min.Y; y < bounds.Max.Y; y += pf.height {
 		for x := bounds.Min.X; x < bounds.Max.X; x += pf.width {
@@ -109,6 +117,11 @@ func convert(img image.Image, opts *options) (image.Image, error) {
 
 			// Draw the rune
 			char := string(rs[index])
+			if grads != nil {
+				if glyph, ok := edgeGlyph(grads, image.Rect(x, y, x+pf.width, y+pf.height), opts.edges); ok {
+					char = string(glyph)
+				}
+			}
 			pf.drawString(char, clr, newImg, x, y)
 		}
 	}
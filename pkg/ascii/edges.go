@@ -0,0 +1,46 @@
+package ascii
+
+import (
+	"image"
+	"math"
+
+	"pix/pkg/edge"
+)
+
+// edgeGlyph picks the line character for the edge running through cell, ok
+// is false when the edges in it are weaker than threshold. The gradients of
+// the cell are averaged as a structure tensor so opposite sides of a thin
+// line don't cancel out.
+func edgeGlyph(g *edge.Gradients, cell image.Rectangle, threshold float64) (glyph rune, ok bool) {
+	cell = cell.Intersect(g.Rect)
+	if cell.Empty() {
+		return 0, false
+	}
+
+	var xx, yy, xy float64
+	for y := cell.Min.Y; y < cell.Max.Y; y++ {
+		for x := cell.Min.X; x < cell.Max.X; x++ {
+			gx, gy := g.At(x, y)
+			xx += gx * gx
+			yy += gy * gy
+			xy += gx * gy
+		}
+	}
+	n := float64(cell.Dx() * cell.Dy())
+	if math.Sqrt((xx+yy)/n) < threshold {
+		return 0, false
+	}
+
+	// the edge runs across the gradient, angles go clockwise as y points down
+	angle := math.Atan2(2*xy, xx-yy)/2*180/math.Pi + 90
+	angle = math.Mod(angle+180, 180)
+	switch {
+	case angle < 22.5 || angle >= 157.5:
+		return '-', true
+	case angle < 67.5:
+		return '\\', true
+	case angle < 112.5:
+		return '|', true
+	}
+	return '/', true
+}
@@ -6,6 +6,7 @@ import (
 	"golang.org/x/image/math/fixed"
 	"image"
 	"image/color"
+	"image/draw"
 
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
@@ -55,7 +56,7 @@ func parseFont(f *opentype.Font, pts float64) (parsedFont, error) {
 	}, nil
 }
 
-func (pf parsedFont) drawString(s string, clr color.Color, dst *image.RGBA, x, y int) {
+func (pf parsedFont) drawString(s string, clr color.Color, dst draw.Image, x, y int) {
 	d := &font.Drawer{
 		Dst:  dst,
 		Src:  image.NewUniform(clr),
@@ -64,3 +65,53 @@ func (pf parsedFont) drawString(s string, clr color.Color, dst *image.RGBA, x, y
 	}
 	d.DrawString(s)
 }
+
+// Label draws short strings like captions onto images with a font at a fixed size
+type Label struct {
+	pf parsedFont
+}
+
+// NewLabel returns a Label for the given font, the embedded font is used if f is nil
+func NewLabel(f *opentype.Font, pts float64) (*Label, error) {
+	if pts <= 0 {
+		return nil, errors.New("font size cannot be smaller than 0")
+	}
+	if f == nil {
+		f = defaultFont
+	}
+	pf, err := parseFont(f, pts)
+	if err != nil {
+		return nil, err
+	}
+	return &Label{pf: pf}, nil
+}
+
+// Height returns the height of a line of text in pixels
+func (l *Label) Height() int {
+	return l.pf.face.Metrics().Height.Ceil()
+}
+
+// Width returns the width of s in pixels
+func (l *Label) Width(s string) int {
+	return font.MeasureString(l.pf.face, s).Ceil()
+}
+
+// Fit shortens s with a trailing ellipsis until it is at most width pixels wide
+func (l *Label) Fit(s string, width int) string {
+	if l.Width(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 {
+		r = r[:len(r)-1]
+		if t := string(r) + "…"; l.Width(t) <= width {
+			return t
+		}
+	}
+	return ""
+}
+
+// Draw writes s with its top left corner at x, y
+func (l *Label) Draw(dst draw.Image, s string, clr color.Color, x, y int) {
+	l.pf.drawString(s, clr, dst, x, y+l.pf.face.Metrics().Ascent.Ceil())
+}
@@ -12,6 +12,7 @@ type options struct {
 	fontPts float64
 	mem     *Memory
 	noise   int
+	edges   float64
 }
 
 // Option is a function which is supplied to
@@ -23,6 +24,7 @@ type options struct {
 //   - FontPts -> Font size in pts
 //   - Font -> Font
 //   - Interpolate -> Interpolation of characters
+//   - Edges -> Line glyphs along edges
 type Option func(args *options) error
 
 // CSet changes the character set that the convertor uses
@@ -85,3 +87,17 @@ func Interpolate(mem *Memory) Option {
 		return nil
 	}
 }
+
+// Edges draws the characters over strong edges with one of | / - \
+// following the direction of the edge, like line art. The threshold is
+// how strong an edge has to be from 0 - 1, about 0.2 picks up the outlines
+// of most photos.
+func Edges(threshold float64) Option {
+	return func(args *options) error {
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("edge threshold must be between 0 and 1")
+		}
+		args.edges = threshold
+		return nil
+	}
+}
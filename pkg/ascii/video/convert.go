@@ -17,7 +17,20 @@ import (
 	"pix/pkg/ascii/video/internal/parse"
 )
 
+// FrameFunc processes one frame of a video, frames arrive in order so it can
+// keep state from one frame to the next
+type FrameFunc func(img image.Image) (image.Image, error)
+
+// Convert converts every frame of a video to ascii
 func Convert(ctx context.Context, src, dst string, opts []ascii.Option, args ...string) error {
+	return ConvertFunc(ctx, src, dst, func(img image.Image) (image.Image, error) {
+		return ascii.ConvertWithOpts(img, opts...)
+	}, args...)
+}
+
+// ConvertFunc decodes the video at src with ffmpeg, runs every frame through
+// fn and encodes the result to dst
+func ConvertFunc(ctx context.Context, src, dst string, fn FrameFunc, args ...string) error {
 	imgD, ffDuration, ffProgress, errD := decode(ctx, src)
 	imgE, errE := encode(ctx, dst, args...)
 
@@ -44,21 +57,9 @@ func Convert(ctx context.Context, src, dst string, opts []ascii.Option, args ...
 	}()
 
 	// Handle the decoding/encoding
-	for img := range imgD {
-		asciiImg, err := ascii.ConvertWithOpts(img, opts...)
-		if err != nil {
-			close(imgE)
-			return err
-		}
-
-		imgE <- asciiImg
-		err = <-errE
-		if err != nil {
-			close(imgE)
-			return err
-		}
+	if err := process(imgD, imgE, errE, fn); err != nil {
+		return err
 	}
-	close(imgE)
 
 	select {
 	case err := <-errD:
@@ -73,6 +74,25 @@ func Convert(ctx context.Context, src, dst string, opts []ascii.Option, args ...
 	return nil
 }
 
+// process runs the decoded frames through fn and hands them to the encoder,
+// waiting for it to acknowledge each one. The encoder is closed when done.
+func process(imgD <-chan image.Image, imgE chan<- image.Image, errE <-chan error, fn FrameFunc) error {
+	defer close(imgE)
+
+	for img := range imgD {
+		out, err := fn(img)
+		if err != nil {
+			return err
+		}
+
+		imgE <- out
+		if err := <-errE; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func encode(ctx context.Context, path string, args ...string) (chan<- image.Image, <-chan error) {
 	// Make the channels
 	errC := make(chan error, 1)
@@ -0,0 +1,82 @@
+package video
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// fakeEncoder collects frames like the ffmpeg encoder does, acknowledging each one
+func fakeEncoder(fail int) (chan image.Image, chan error, *[]image.Image) {
+	imgC := make(chan image.Image)
+	errC := make(chan error, 1)
+	var got []image.Image
+
+	go func() {
+		for img := range imgC {
+			if len(got) == fail {
+				errC <- errors.New("encoder failed")
+				continue
+			}
+			got = append(got, img)
+			errC <- nil
+		}
+		close(errC)
+	}()
+
+	return imgC, errC, &got
+}
+
+func frames(n int) <-chan image.Image {
+	c := make(chan image.Image, n)
+	for i := 0; i < n; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		img.SetNRGBA(0, 0, color.NRGBA{uint8(i), 0, 0, 255})
+		c <- img
+	}
+	close(c)
+	return c
+}
+
+func TestProcessInOrder(t *testing.T) {
+	imgE, errE, got := fakeEncoder(-1)
+
+	// the frame func keeps state, like a datamosh does
+	seen := 0
+	err := process(frames(5), imgE, errE, func(img image.Image) (image.Image, error) {
+		if r := img.(*image.NRGBA).Pix[0]; int(r) != seen {
+			t.Errorf("frame %d arrived as frame %d", r, seen)
+		}
+		seen++
+		return img, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for the encoder to finish
+	for range errE {
+	}
+	if len(*got) != 5 {
+		t.Errorf("encoded %d frames, want 5", len(*got))
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	imgE, errE, _ := fakeEncoder(-1)
+	err := process(frames(3), imgE, errE, func(image.Image) (image.Image, error) {
+		return nil, errors.New("frame failed")
+	})
+	if err == nil || err.Error() != "frame failed" {
+		t.Errorf("got %v, want the frame error", err)
+	}
+
+	imgE, errE, _ = fakeEncoder(1)
+	err = process(frames(3), imgE, errE, func(img image.Image) (image.Image, error) {
+		return img, nil
+	})
+	if err == nil || err.Error() != "encoder failed" {
+		t.Errorf("got %v, want the encoder error", err)
+	}
+}
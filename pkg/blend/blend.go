@@ -0,0 +1,329 @@
+// Package blend composites one image over another with the blend modes of
+// image editors, following the W3C compositing spec: the separable modes
+// work on each channel and hue, saturation, color and luminosity mix the
+// hue, saturation and brightness of the two.
+package blend
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	"pix/pkg/colors"
+)
+
+// Mode decides how a source pixel mixes with the backdrop under it
+type Mode int
+
+const (
+	Normal Mode = iota
+	Multiply
+	Screen
+	Overlay
+	SoftLight
+	HardLight
+	ColorDodge
+	ColorBurn
+	LinearDodge
+	LinearBurn
+	Difference
+	Exclusion
+	Hue
+	Saturation
+	Color
+	Luminosity
+)
+
+var modeNames = []string{
+	"normal",
+	"multiply",
+	"screen",
+	"overlay",
+	"soft-light",
+	"hard-light",
+	"color-dodge",
+	"color-burn",
+	"linear-dodge",
+	"linear-burn",
+	"difference",
+	"exclusion",
+	"hue",
+	"saturation",
+	"color",
+	"luminosity",
+}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
+}
+
+// Modes lists every blend mode
+func Modes() []Mode {
+	modes := make([]Mode, len(modeNames))
+	for i := range modes {
+		modes[i] = Mode(i)
+	}
+	return modes
+}
+
+// ParseMode reads a mode by name, dashes are optional and add is linear dodge
+func ParseMode(s string) (Mode, error) {
+	name := strings.ToLower(strings.NewReplacer("-", "", "_", "", " ", "").Replace(s))
+	if name == "add" {
+		return LinearDodge, nil
+	}
+	for i, n := range modeNames {
+		if strings.ReplaceAll(n, "-", "") == name {
+			return Mode(i), nil
+		}
+	}
+	return Normal, fmt.Errorf("unknown blend mode %q: must be one of [%s]", s, strings.Join(modeNames, "|"))
+}
+
+type options struct {
+	opacity float64
+	mask    *image.Alpha
+	linear  bool
+}
+
+type Option func(*options) error
+
+// Opacity fades the source from 0 (only the backdrop) to 1 (the default)
+func Opacity(o float64) Option {
+	return func(args *options) error {
+		if o < 0 || o > 1 {
+			return fmt.Errorf("opacity must be between 0 and 1")
+		}
+		args.opacity = o
+		return nil
+	}
+}
+
+// Mask only blends where m is opaque, it lines up with the backdrop
+func Mask(m *image.Alpha) Option {
+	return func(args *options) error {
+		if m == nil {
+			return fmt.Errorf("mask is nil")
+		}
+		args.mask = m
+		return nil
+	}
+}
+
+// Linear mixes the colors as linear light instead of sRGB values, fades and
+// soft edges then keep their brightness the way light does
+func Linear(enabled bool) Option {
+	return func(args *options) error {
+		args.linear = enabled
+		return nil
+	}
+}
+
+// Blend composites src over backdrop with the mode and returns the result,
+// src is lined up with the top left of the backdrop
+func Blend(backdrop, src image.Image, mode Mode, opts ...Option) (*image.NRGBA, error) {
+	args := &options{opacity: 1}
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(args); err != nil {
+			return nil, err
+		}
+	}
+	if mode < 0 || int(mode) >= len(modeNames) {
+		return nil, fmt.Errorf("unknown blend mode %v", mode)
+	}
+
+	// channel values from 0 - 255 to 0 - 1, as linear light if asked for
+	var decode [256]float64
+	for i := range decode {
+		decode[i] = float64(i) / 255
+		if args.linear {
+			decode[i] = colors.SRGBToLinear(decode[i])
+		}
+	}
+	encode := func(v float64) uint8 {
+		v = clamp(v)
+		if args.linear {
+			v = colors.LinearToSRGB(v)
+		}
+		return uint8(math.Round(v * 255))
+	}
+
+	bounds := backdrop.Bounds()
+	out := toNRGBA(backdrop)
+	s := toNRGBA(src)
+	offset := s.Bounds().Min.Sub(bounds.Min)
+	area := bounds.Intersect(s.Bounds().Sub(offset))
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			i := out.PixOffset(x, y)
+			j := s.PixOffset(x+offset.X, y+offset.Y)
+
+			as := float64(s.Pix[j+3]) / 255 * args.opacity
+			if args.mask != nil {
+				as *= float64(args.mask.AlphaAt(x, y).A) / 255
+			}
+			if as == 0 {
+				continue
+			}
+
+			d := out.Pix[i : i+4 : i+4]
+			ab := float64(d[3]) / 255
+			cb := [3]float64{decode[d[0]], decode[d[1]], decode[d[2]]}
+			cs := [3]float64{decode[s.Pix[j]], decode[s.Pix[j+1]], decode[s.Pix[j+2]]}
+
+			mixed := mix(mode, cb, cs)
+			ao := as + ab*(1-as)
+			for c := range cb {
+				// where the backdrop is transparent the source shows as it is
+				v := (1-ab)*cs[c] + ab*mixed[c]
+				v = (as*v + (1-as)*ab*cb[c]) / ao
+				d[c] = encode(v)
+			}
+			d[3] = uint8(math.Round(ao * 255))
+		}
+	}
+
+	return out, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+	return out
+}
+
+// mix is the blended color of backdrop b and source s
+func mix(mode Mode, b, s [3]float64) [3]float64 {
+	switch mode {
+	case Hue:
+		return setLum(setSat(s, sat(b)), lum(b))
+	case Saturation:
+		return setLum(setSat(b, sat(s)), lum(b))
+	case Color:
+		return setLum(s, lum(b))
+	case Luminosity:
+		return setLum(b, lum(s))
+	}
+
+	var out [3]float64
+	for c := range out {
+		out[c] = separable(mode, b[c], s[c])
+	}
+	return out
+}
+
+func separable(mode Mode, b, s float64) float64 {
+	switch mode {
+	case Multiply:
+		return b * s
+	case Screen:
+		return b + s - b*s
+	case Overlay:
+		return separable(HardLight, s, b)
+	case HardLight:
+		if s <= 0.5 {
+			return b * 2 * s
+		}
+		return separable(Screen, b, 2*s-1)
+	case SoftLight:
+		if s <= 0.5 {
+			return b - (1-2*s)*b*(1-b)
+		}
+		d := math.Sqrt(b)
+		if b <= 0.25 {
+			d = ((16*b-12)*b + 4) * b
+		}
+		return b + (2*s-1)*(d-b)
+	case ColorDodge:
+		if b == 0 {
+			return 0
+		}
+		if s == 1 {
+			return 1
+		}
+		return math.Min(1, b/(1-s))
+	case ColorBurn:
+		if b == 1 {
+			return 1
+		}
+		if s == 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-b)/s)
+	case LinearDodge:
+		return math.Min(1, b+s)
+	case LinearBurn:
+		return math.Max(0, b+s-1)
+	case Difference:
+		return math.Abs(b - s)
+	case Exclusion:
+		return b + s - 2*b*s
+	}
+	return s
+}
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	for i := range c {
+		c[i] += d
+	}
+	return clipColor(c)
+}
+
+func clipColor(c [3]float64) [3]float64 {
+	l := lum(c)
+	lo := math.Min(c[0], math.Min(c[1], c[2]))
+	hi := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if lo < 0 {
+			c[i] = l + (c[i]-l)*l/(l-lo)
+		}
+		if hi > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(hi-l)
+		}
+	}
+	return c
+}
+
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+// setSat stretches c to saturation s keeping the order of its channels
+func setSat(c [3]float64, s float64) [3]float64 {
+	lo, mid, hi := 0, 1, 2
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+	if c[mid] > c[hi] {
+		mid, hi = hi, mid
+	}
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+
+	var out [3]float64
+	if c[hi] > c[lo] {
+		out[mid] = (c[mid] - c[lo]) * s / (c[hi] - c[lo])
+		out[hi] = s
+	}
+	return out
+}
+
+func clamp(v float64) float64 {
+	return math.Min(1, math.Max(0, v))
+}
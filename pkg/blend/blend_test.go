@@ -0,0 +1,170 @@
+package blend
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func pixel(c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.SetNRGBA(0, 0, c)
+	return img
+}
+
+func near(a, b color.NRGBA) bool {
+	d := func(x, y uint8) bool { return x-y <= 1 || y-x <= 1 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func TestModes(t *testing.T) {
+	backdrop := color.NRGBA{200, 100, 50, 255}
+	src := color.NRGBA{100, 150, 250, 255}
+
+	for _, tc := range []struct {
+		mode Mode
+		want color.NRGBA
+	}{
+		{Normal, src},
+		{Multiply, color.NRGBA{78, 59, 49, 255}},
+		{Screen, color.NRGBA{222, 191, 251, 255}},
+		{Overlay, color.NRGBA{189, 118, 98, 255}},
+		{HardLight, color.NRGBA{157, 127, 247, 255}},
+		{SoftLight, color.NRGBA{191, 111, 111, 255}},
+		{ColorDodge, color.NRGBA{255, 243, 255, 255}},
+		{ColorBurn, color.NRGBA{115, 0, 46, 255}},
+		{LinearDodge, color.NRGBA{255, 250, 255, 255}},
+		{LinearBurn, color.NRGBA{45, 0, 45, 255}},
+		{Difference, color.NRGBA{100, 50, 200, 255}},
+		{Exclusion, color.NRGBA{143, 132, 202, 255}},
+	} {
+		out, err := Blend(pixel(backdrop), pixel(src), tc.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.NRGBAAt(0, 0); !near(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestNonSeparable(t *testing.T) {
+	red := color.NRGBA{200, 40, 40, 255}
+	blue := color.NRGBA{40, 40, 200, 255}
+	grey := color.NRGBA{128, 128, 128, 255}
+
+	lum := func(c color.NRGBA) float64 { return lum([3]float64{float64(c.R), float64(c.G), float64(c.B)}) }
+
+	// color takes the hue and saturation of blue and the brightness of red
+	out, _ := Blend(pixel(red), pixel(blue), Color)
+	got := out.NRGBAAt(0, 0)
+	if got.B <= got.R || got.B <= got.G {
+		t.Errorf("color blend %v isn't blue", got)
+	}
+	if d := lum(got) - lum(red); d > 2 || d < -2 {
+		t.Errorf("color blend changed the brightness from %.0f to %.0f", lum(red), lum(got))
+	}
+
+	// luminosity over grey keeps it grey
+	out, _ = Blend(pixel(grey), pixel(red), Luminosity)
+	if got := out.NRGBAAt(0, 0); got.R != got.G || got.G != got.B {
+		t.Errorf("luminosity blend over grey is %v", got)
+	}
+
+	// saturation from grey takes all the color out
+	out, _ = Blend(pixel(red), pixel(grey), Saturation)
+	if got := out.NRGBAAt(0, 0); got.R != got.G || got.G != got.B {
+		t.Errorf("saturation blend with grey is %v", got)
+	}
+
+	// hue keeps the saturation and brightness of the backdrop
+	out, _ = Blend(pixel(red), pixel(blue), Hue)
+	if got := out.NRGBAAt(0, 0); got.B <= got.R {
+		t.Errorf("hue blend %v isn't blue", got)
+	}
+}
+
+func TestOpacityAndMask(t *testing.T) {
+	backdrop := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	for x := 0; x < 2; x++ {
+		backdrop.SetNRGBA(x, 0, color.NRGBA{0, 0, 0, 255})
+		src.SetNRGBA(x, 0, color.NRGBA{200, 200, 200, 255})
+	}
+	m := image.NewAlpha(backdrop.Bounds())
+	m.SetAlpha(0, 0, color.Alpha{255})
+
+	out, err := Blend(backdrop, src, Normal, Opacity(0.5), Mask(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.NRGBAAt(0, 0); !near(got, color.NRGBA{100, 100, 100, 255}) {
+		t.Errorf("half opacity gave %v", got)
+	}
+	if got := out.NRGBAAt(1, 0); got != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("masked out pixel changed to %v", got)
+	}
+	if backdrop.NRGBAAt(0, 0) != (color.NRGBA{0, 0, 0, 255}) {
+		t.Error("the backdrop was changed")
+	}
+
+	if _, err := Blend(backdrop, src, Normal, Opacity(2)); err == nil {
+		t.Error("expected an error for opacity 2")
+	}
+	if _, err := Blend(backdrop, src, Normal, nil); err == nil {
+		t.Error("expected an error for a nil option")
+	}
+}
+
+func TestLinear(t *testing.T) {
+	black, white := pixel(color.NRGBA{0, 0, 0, 255}), pixel(color.NRGBA{255, 255, 255, 255})
+
+	// half the light of white is brighter than half its sRGB value
+	out, err := Blend(black, white, Normal, Opacity(0.5), Linear(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.NRGBAAt(0, 0); !near(got, color.NRGBA{188, 188, 188, 255}) {
+		t.Errorf("linear fade gave %v", got)
+	}
+
+	// blacks and whites come out the same either way
+	out, _ = Blend(white, black, Multiply, Linear(true))
+	if got := out.NRGBAAt(0, 0); got != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("linear multiply gave %v", got)
+	}
+}
+
+func TestTransparency(t *testing.T) {
+	// over nothing the source shows as it is, whatever the mode
+	src := color.NRGBA{100, 150, 250, 255}
+	out, _ := Blend(pixel(color.NRGBA{}), pixel(src), Multiply)
+	if got := out.NRGBAAt(0, 0); !near(got, src) {
+		t.Errorf("multiply over transparent gave %v", got)
+	}
+
+	// a transparent source leaves the backdrop
+	backdrop := color.NRGBA{10, 20, 30, 255}
+	out, _ = Blend(pixel(backdrop), pixel(color.NRGBA{}), Screen)
+	if got := out.NRGBAAt(0, 0); got != backdrop {
+		t.Errorf("transparent source changed the backdrop to %v", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, m := range Modes() {
+		got, err := ParseMode(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseMode(%q) = %v, %v", m.String(), got, err)
+		}
+	}
+	if m, _ := ParseMode("SoftLight"); m != SoftLight {
+		t.Errorf("SoftLight parsed as %v", m)
+	}
+	if m, _ := ParseMode("add"); m != LinearDodge {
+		t.Errorf("add parsed as %v", m)
+	}
+	if _, err := ParseMode("nope"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
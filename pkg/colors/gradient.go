@@ -0,0 +1,268 @@
+package colors
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/muesli/gamut"
+)
+
+// Interpolation is the color space a gradient blends its colors in
+type Interpolation int
+
+const (
+	// InterpolateOklab blends evenly to the eye
+	InterpolateOklab Interpolation = iota
+	// InterpolateLCh blends around the hue wheel, keeping colors saturated
+	InterpolateLCh
+	// InterpolateLinear blends the light of the colors like paint on a screen
+	InterpolateLinear
+)
+
+var interpolationNames = []string{"oklab", "lch", "linear"}
+
+func (i Interpolation) String() string {
+	if i < 0 || int(i) >= len(interpolationNames) {
+		return fmt.Sprintf("Interpolation(%d)", int(i))
+	}
+	return interpolationNames[i]
+}
+
+// ParseInterpolation reads an interpolation by name
+func ParseInterpolation(s string) (Interpolation, error) {
+	switch strings.ToLower(s) {
+	case "oklab", "lab":
+		return InterpolateOklab, nil
+	case "lch", "oklch":
+		return InterpolateLCh, nil
+	case "linear", "rgb":
+		return InterpolateLinear, nil
+	}
+	return InterpolateOklab, fmt.Errorf("unknown interpolation %q: must be one of [oklab|lch|linear]", s)
+}
+
+// gradientSteps is the resolution of the lookup table used by Map
+const gradientSteps = 1024
+
+// Gradient maps a position from 0 - 1 to a color along a palette
+type Gradient struct {
+	pos    []float64
+	colors []Oklab
+	interp Interpolation
+	lut    [gradientSteps]color.NRGBA
+}
+
+type gradientOptions struct {
+	stops  []float64
+	interp Interpolation
+	sort   bool
+	tones  int
+}
+
+type GradientOption func(*gradientOptions) error
+
+// Stops places the colors at positions from 0 - 1 instead of evenly, there
+// must be one for every color and they can't go backwards
+func Stops(pos ...float64) GradientOption {
+	return func(args *gradientOptions) error {
+		for i, p := range pos {
+			if p < 0 || p > 1 {
+				return fmt.Errorf("gradient stops must be between 0 and 1")
+			}
+			if i > 0 && p < pos[i-1] {
+				return fmt.Errorf("gradient stops must be in order")
+			}
+		}
+		args.stops = pos
+		return nil
+	}
+}
+
+// Interpolate sets the color space colors are blended in, Oklab by default
+func Interpolate(i Interpolation) GradientOption {
+	return func(args *gradientOptions) error {
+		if i < 0 || int(i) >= len(interpolationNames) {
+			return fmt.Errorf("unknown interpolation %v", i)
+		}
+		args.interp = i
+		return nil
+	}
+}
+
+// SortByLightness orders the palette from dark to light, so the shadows of an
+// image get the dark colors
+func SortByLightness(b bool) GradientOption {
+	return func(args *gradientOptions) error {
+		args.sort = b
+		return nil
+	}
+}
+
+// Tones keeps n colors spread over the lightness of the palette, from the
+// darkest to the lightest: 2 for a duotone and 3 for a tritone
+func Tones(n int) GradientOption {
+	return func(args *gradientOptions) error {
+		if n < 2 {
+			return fmt.Errorf("a gradient needs at least 2 tones")
+		}
+		args.tones = n
+		return nil
+	}
+}
+
+// NewGradient builds a gradient through the palette in order
+func NewGradient(pal []color.Color, opts ...GradientOption) (*Gradient, error) {
+	args := &gradientOptions{}
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(args); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pal) == 0 {
+		return nil, fmt.Errorf("a gradient needs at least 1 color")
+	}
+
+	labs := make([]Oklab, len(pal))
+	for i, c := range pal {
+		labs[i] = ToLinear(c).Oklab()
+	}
+
+	if args.sort || args.tones > 0 {
+		sort.SliceStable(labs, func(i, j int) bool { return labs[i].L < labs[j].L })
+	}
+	if args.tones > 0 && len(labs) > args.tones {
+		tones := make([]Oklab, args.tones)
+		for i := range tones {
+			tones[i] = labs[int(math.Round(float64(i*(len(labs)-1))/float64(args.tones-1)))]
+		}
+		labs = tones
+	}
+
+	pos := args.stops
+	if pos == nil {
+		pos = make([]float64, len(labs))
+		for i := range pos {
+			if len(labs) > 1 {
+				pos[i] = float64(i) / float64(len(labs)-1)
+			}
+		}
+	}
+	if len(pos) != len(labs) {
+		return nil, fmt.Errorf("got %d gradient stops for %d colors", len(pos), len(labs))
+	}
+
+	g := &Gradient{pos: pos, colors: labs, interp: args.interp}
+	for i := range g.lut {
+		g.lut[i] = g.At(float64(i) / (gradientSteps - 1))
+	}
+	return g, nil
+}
+
+// At is the color at position t from 0 - 1
+func (g *Gradient) At(t float64) color.NRGBA {
+	n := len(g.colors)
+	if t <= g.pos[0] || n == 1 {
+		return g.colors[0].Linear().NRGBA()
+	}
+	if t >= g.pos[n-1] {
+		return g.colors[n-1].Linear().NRGBA()
+	}
+
+	i := sort.SearchFloat64s(g.pos, t)
+	if g.pos[i] == t {
+		return g.colors[i].Linear().NRGBA()
+	}
+	a, b := g.colors[i-1], g.colors[i]
+	f := (t - g.pos[i-1]) / (g.pos[i] - g.pos[i-1])
+
+	return g.lerp(a, b, f).NRGBA()
+}
+
+func (g *Gradient) lerp(a, b Oklab, f float64) Linear {
+	lerp := func(x, y float64) float64 { return x + (y-x)*f }
+
+	switch g.interp {
+	case InterpolateLCh:
+		ca, cb := a.LCh(), b.LCh()
+		// greys have no hue, they take the hue of the other color
+		const grey = 0.02
+		if ca.C < grey {
+			ca.H = cb.H
+		}
+		if cb.C < grey {
+			cb.H = ca.H
+		}
+		// the short way around the hue wheel
+		d := math.Mod(cb.H-ca.H+540, 360) - 180
+		return LCh{lerp(ca.L, cb.L), lerp(ca.C, cb.C), ca.H + d*f}.Oklab().Linear()
+	case InterpolateLinear:
+		la, lb := a.Linear(), b.Linear()
+		return Linear{lerp(la.R, lb.R), lerp(la.G, lb.G), lerp(la.B, lb.B)}
+	}
+	return Oklab{lerp(a.L, b.L), lerp(a.A, b.A), lerp(a.B, b.B)}.Linear()
+}
+
+// Map replaces every pixel with the color of the gradient at its lightness,
+// black gets the start of the gradient and white the end. Alpha is kept.
+func (g *Gradient) Map(img image.Image) *image.NRGBA {
+	var linear [256]float64
+	for i := range linear {
+		linear[i] = SRGBToLinear(float64(i) / 255)
+	}
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			l := Linear{linear[c.R], linear[c.G], linear[c.B]}.Oklab().L
+
+			mapped := g.lut[int(math.Round(math.Min(1, math.Max(0, l))*(gradientSteps-1)))]
+			mapped.A = c.A
+			out.SetNRGBA(x, y, mapped)
+		}
+	}
+	return out
+}
+
+// presets are gradients from dark to light
+var presets = map[string][]string{
+	"sepia":     {"#1b1209", "#704c2c", "#e8d3b0"},
+	"cyanotype": {"#0b2545", "#1d5a8a", "#e6eef5"},
+	"noir":      {"#000000", "#ffffff"},
+	"gameboy":   {"#0f380f", "#306230", "#8bac0f", "#9bbc0f"},
+	"synthwave": {"#1a0033", "#7a00c2", "#ff2e97", "#ffd319"},
+	"sunset":    {"#2d0b3a", "#b2334d", "#f6a04d", "#fff1b8"},
+	"thermal":   {"#000000", "#3b0f70", "#b5367a", "#fb8761", "#fcfdbf"},
+}
+
+// PresetNames lists the preset gradients
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset is the palette of a preset gradient
+func Preset(name string) ([]color.Color, error) {
+	hex, ok := presets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown gradient preset %q: must be one of [%s]", name, strings.Join(PresetNames(), "|"))
+	}
+	pal := make([]color.Color, len(hex))
+	for i, h := range hex {
+		pal[i] = gamut.Hex(h)
+	}
+	return pal, nil
+}
@@ -0,0 +1,145 @@
+package colors
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestOklabRoundTrip(t *testing.T) {
+	for _, c := range []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}, {255, 0, 0, 255}, {12, 200, 99, 255}} {
+		lab := ToLinear(c).Oklab()
+		if got := lab.LCh().Oklab().Linear().NRGBA(); got != c {
+			t.Errorf("%v came back as %v", c, got)
+		}
+	}
+
+	if l := Lightness(color.White); math.Abs(l-1) > 1e-3 {
+		t.Errorf("white has lightness %v, want 1", l)
+	}
+	if l := Lightness(color.Black); l != 0 {
+		t.Errorf("black has lightness %v, want 0", l)
+	}
+}
+
+func TestGradientEnds(t *testing.T) {
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	for _, interp := range []Interpolation{InterpolateOklab, InterpolateLCh, InterpolateLinear} {
+		g, err := NewGradient([]color.Color{red, blue}, Interpolate(interp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.At(0) != red || g.At(1) != blue {
+			t.Errorf("%v: ends are %v and %v", interp, g.At(0), g.At(1))
+		}
+	}
+}
+
+func TestGradientInterpolation(t *testing.T) {
+	black, white := color.NRGBA{0, 0, 0, 255}, color.NRGBA{255, 255, 255, 255}
+
+	// half the light is brighter than half the lightness
+	lin, _ := NewGradient([]color.Color{black, white}, Interpolate(InterpolateLinear))
+	lab, _ := NewGradient([]color.Color{black, white})
+	if l, o := lin.At(0.5).R, lab.At(0.5).R; l != 188 || o >= l {
+		t.Errorf("middle grey is %d in linear and %d in oklab", l, o)
+	}
+
+	// lch keeps the middle of red to blue saturated, oklab goes through a dull purple
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	lch, _ := NewGradient([]color.Color{red, blue}, Interpolate(InterpolateLCh))
+	ok, _ := NewGradient([]color.Color{red, blue})
+	chroma := func(c color.NRGBA) float64 { return ToLinear(c).Oklab().LCh().C }
+	if chroma(lch.At(0.5)) <= chroma(ok.At(0.5)) {
+		t.Errorf("lch middle %v isn't more saturated than oklab %v", lch.At(0.5), ok.At(0.5))
+	}
+}
+
+func TestGradientStops(t *testing.T) {
+	pal := []color.Color{color.Black, color.White}
+	g, err := NewGradient(pal, Stops(0.25, 0.75))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.At(0.2) != (color.NRGBA{0, 0, 0, 255}) || g.At(0.8) != (color.NRGBA{255, 255, 255, 255}) {
+		t.Error("colors before the first and after the last stop should be solid")
+	}
+
+	for _, opts := range [][]GradientOption{
+		{Stops(0, 0.5, 1)},
+		{Stops(0.5, 0.2)},
+		{Stops(-1, 1)},
+		{Tones(1)},
+		{nil},
+	} {
+		if _, err := NewGradient(pal, opts...); err == nil {
+			t.Errorf("expected an error for %v", opts)
+		}
+	}
+}
+
+func TestGradientTones(t *testing.T) {
+	pal := []color.Color{
+		color.NRGBA{200, 200, 50, 255},
+		color.NRGBA{10, 10, 40, 255},
+		color.NRGBA{120, 40, 40, 255},
+		color.NRGBA{250, 250, 240, 255},
+		color.NRGBA{60, 90, 60, 255},
+	}
+
+	duo, err := NewGradient(pal, Tones(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duo.At(0) != pal[1] || duo.At(1) != pal[3] {
+		t.Errorf("duotone goes from %v to %v, want the darkest and lightest", duo.At(0), duo.At(1))
+	}
+
+	tri, _ := NewGradient(pal, Tones(3))
+	if tri.At(0.5) != pal[4] {
+		t.Errorf("tritone middle is %v, want %v", tri.At(0.5), pal[4])
+	}
+
+	sorted, _ := NewGradient(pal, SortByLightness(true))
+	for i := 1; i < len(sorted.colors); i++ {
+		if sorted.colors[i].L < sorted.colors[i-1].L {
+			t.Fatal("sorted palette isn't dark to light")
+		}
+	}
+}
+
+func TestGradientMap(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 128})
+	img.SetNRGBA(2, 0, color.NRGBA{255, 0, 0, 255})
+
+	pal, err := Preset("sepia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ := NewGradient(pal)
+	out := g.Map(img)
+
+	if got := out.NRGBAAt(0, 0); got != g.At(0) {
+		t.Errorf("black mapped to %v, want %v", got, g.At(0))
+	}
+	want := g.At(1)
+	want.A = 128
+	if got := out.NRGBAAt(1, 0); got != want {
+		t.Errorf("white mapped to %v, want %v", got, want)
+	}
+	if got := out.NRGBAAt(2, 0); got == g.At(0) || got == g.At(1) {
+		t.Errorf("red mapped to an end of the gradient %v", got)
+	}
+
+	if _, err := Preset("nope"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+	for _, name := range PresetNames() {
+		if _, err := Preset(name); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package colors
+
+import (
+	"image/color"
+	"math"
+)
+
+// SRGBToLinear undoes the sRGB transfer curve of a channel from 0 - 1
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB applies the sRGB transfer curve to a linear channel from 0 - 1
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Linear is a color as linear light RGB from 0 - 1, what the sRGB values of
+// a color stand for before the transfer curve
+type Linear struct {
+	R, G, B float64
+}
+
+// Oklab is a color in the Oklab space, lightness L goes from 0 - 1 and equal
+// steps look about equally different
+type Oklab struct {
+	L, A, B float64
+}
+
+// LCh is Oklab in polar form, chroma C and hue H in degrees
+type LCh struct {
+	L, C, H float64
+}
+
+// ToLinear converts any color, the alpha is dropped
+func ToLinear(c color.Color) Linear {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return Linear{
+		SRGBToLinear(float64(n.R) / 255),
+		SRGBToLinear(float64(n.G) / 255),
+		SRGBToLinear(float64(n.B) / 255),
+	}
+}
+
+// NRGBA converts back to 8 bit sRGB, out of gamut channels are clipped
+func (c Linear) NRGBA() color.NRGBA {
+	to8 := func(v float64) uint8 {
+		return uint8(math.Round(LinearToSRGB(math.Min(1, math.Max(0, v))) * 255))
+	}
+	return color.NRGBA{to8(c.R), to8(c.G), to8(c.B), 255}
+}
+
+// Oklab converts linear RGB to Oklab
+func (c Linear) Oklab() Oklab {
+	l := math.Cbrt(0.4122214708*c.R + 0.5363325363*c.G + 0.0514459929*c.B)
+	m := math.Cbrt(0.2119034982*c.R + 0.6806995451*c.G + 0.1073969566*c.B)
+	s := math.Cbrt(0.0883024619*c.R + 0.2817188376*c.G + 0.6299787005*c.B)
+
+	return Oklab{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// Linear converts Oklab back to linear RGB
+func (c Oklab) Linear() Linear {
+	l := c.L + 0.3963377774*c.A + 0.2158037573*c.B
+	m := c.L - 0.1055613458*c.A - 0.0638541728*c.B
+	s := c.L - 0.0894841775*c.A - 1.2914855480*c.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return Linear{
+		4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s,
+	}
+}
+
+// LCh converts Oklab to its polar form
+func (c Oklab) LCh() LCh {
+	h := math.Atan2(c.B, c.A) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return LCh{c.L, math.Hypot(c.A, c.B), h}
+}
+
+// Oklab converts back from the polar form
+func (c LCh) Oklab() Oklab {
+	h := c.H * math.Pi / 180
+	return Oklab{c.L, c.C * math.Cos(h), c.C * math.Sin(h)}
+}
+
+// Lightness is the Oklab lightness of c from 0 - 1
+func Lightness(c color.Color) float64 {
+	return ToLinear(c).Oklab().L
+}
@@ -0,0 +1,83 @@
+package edge
+
+import (
+	"image"
+	"math"
+)
+
+// Canny traces edges one pixel wide. The image is blurred by sigma to ignore
+// noise, only the strongest pixel across each edge is kept and edges have to
+// reach high somewhere to be kept, following them down to low. Both
+// thresholds are fractions (0 - 1) of the strongest gradient in the image.
+func Canny(img image.Image, sigma, low, high float64) *image.Gray {
+	p := luma(img).blur(sigma)
+	g := gradient(p, img.Bounds(), Sobel)
+	mag := g.magnitude()
+	w, h := mag.w, mag.h
+
+	var strongest float64
+	for _, v := range mag.v {
+		strongest = math.Max(strongest, v)
+	}
+	if low > high {
+		low, high = high, low
+	}
+	low, high = low*strongest, high*strongest
+
+	// non-maximum suppression, compare each pixel with its two neighbours
+	// along the gradient, rounded to one of four directions
+	thin := newPlane(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			m := mag.v[i]
+			if m == 0 || m < low {
+				continue
+			}
+			dx, dy := direction(g.X[i], g.Y[i])
+			if m >= mag.at(x+dx, y+dy) && m > mag.at(x-dx, y-dy) {
+				thin.v[i] = m
+			}
+		}
+	}
+
+	// hysteresis, grow the strong edges through the weak pixels touching them
+	out := image.NewGray(img.Bounds())
+	var stack []int
+	for i, v := range thin.v {
+		if v >= high && v > 0 {
+			out.Pix[i/w*out.Stride+i%w] = 255
+			stack = append(stack, i)
+		}
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%w, i/w
+		for ny := max(y-1, 0); ny <= min(y+1, h-1); ny++ {
+			for nx := max(x-1, 0); nx <= min(x+1, w-1); nx++ {
+				j := ny*w + nx
+				if thin.v[j] >= low && thin.v[j] > 0 && out.Pix[ny*out.Stride+nx] == 0 {
+					out.Pix[ny*out.Stride+nx] = 255
+					stack = append(stack, j)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// direction rounds a gradient to the nearest of the horizontal, vertical and
+// diagonal neighbours
+func direction(gx, gy float64) (dx, dy int) {
+	angle := math.Mod(math.Atan2(gy, gx)*180/math.Pi+180, 180)
+	switch {
+	case angle < 22.5 || angle >= 157.5:
+		return 1, 0
+	case angle < 67.5:
+		return 1, 1
+	case angle < 112.5:
+		return 0, 1
+	}
+	return -1, 1
+}
@@ -0,0 +1,81 @@
+package edge
+
+import (
+	"image"
+	"math"
+)
+
+// DoG is the thresholded difference of Gaussians, white lines along the dark
+// side of every edge. sigma sets the line width, the wider blur is k times
+// larger (1.6 looks like the Laplacian of Gaussian) and tau just under 1 picks
+// up fainter edges the closer it gets to 1.
+func DoG(img image.Image, sigma, k, tau float64) *image.Gray {
+	src := luma(img)
+	fine, coarse := src.blur(sigma), src.blur(sigma*k)
+	out := newPlane(src.w, src.h)
+	for i := range out.v {
+		if fine.v[i]-tau*coarse.v[i] <= 0 {
+			out.v[i] = 1
+		}
+	}
+	return out.gray(img.Bounds())
+}
+
+// XDoG are the settings of the extended difference of Gaussians, which
+// sharpens the image with the difference of two blurs and then softly
+// thresholds it, for ink drawing and woodcut looks
+type XDoG struct {
+	// Sigma is the blur of the finer Gaussian, the width of the lines
+	Sigma float64
+	// K is how much wider the coarser Gaussian is
+	K float64
+	// P is the strength of the sharpening, larger values give bolder lines
+	P float64
+	// Epsilon is the brightness (0 - 1) under which pixels start to be inked,
+	// higher values fill the darker areas
+	Epsilon float64
+	// Phi is how steep the threshold is, large values give hard edged ink
+	Phi float64
+}
+
+// DefaultXDoG is a clean pen drawing
+var DefaultXDoG = XDoG{Sigma: 1, K: 1.6, P: 20, Epsilon: 0.1, Phi: 10}
+
+// Apply draws the line art of img, white where the ink goes
+func (x XDoG) Apply(img image.Image) *image.Gray {
+	if x.Sigma <= 0 {
+		x.Sigma = DefaultXDoG.Sigma
+	}
+	if x.K <= 1 {
+		x.K = DefaultXDoG.K
+	}
+
+	src := luma(img)
+	fine, coarse := src.blur(x.Sigma), src.blur(x.Sigma*x.K)
+	out := newPlane(src.w, src.h)
+	for i := range out.v {
+		d := (1+x.P)*fine.v[i] - x.P*coarse.v[i]
+		if d >= x.Epsilon {
+			continue
+		}
+		out.v[i] = -math.Tanh(x.Phi * (d - x.Epsilon))
+	}
+	return out.gray(img.Bounds())
+}
+
+// Sketch is a pencil drawing of img, the brightness divided by a blur of
+// itself like a color dodge of the inverted blur. sigma is the size of the
+// strokes, dark lines follow edges and flat areas turn to paper.
+func Sketch(img image.Image, sigma float64) *image.Gray {
+	src := luma(img)
+	blurred := src.blur(sigma)
+	out := newPlane(src.w, src.h)
+	for i, v := range src.v {
+		if b := blurred.v[i]; b > 0 {
+			out.v[i] = v / b
+		} else {
+			out.v[i] = 1
+		}
+	}
+	return out.gray(img.Bounds())
+}
@@ -0,0 +1,128 @@
+// Package edge finds the edges in an image. Gradient maps come from the Sobel,
+// Scharr and Prewitt operators or a Laplacian of Gaussian, Canny traces thin
+// connected edges and the difference of Gaussians draws stylized line art.
+// Edge maps are greyscale images the size of the source, white where the
+// edges are.
+package edge
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Operator is the kernel used to measure the gradient
+type Operator int
+
+const (
+	Sobel Operator = iota
+	Scharr
+	Prewitt
+)
+
+// kernels are the horizontal derivatives, the vertical ones are their transpose.
+// They're scaled so a step from black to white has a gradient of 1.
+var kernels = map[Operator][9]float64{
+	Sobel:   {-1 / 4., 0, 1 / 4., -2 / 4., 0, 2 / 4., -1 / 4., 0, 1 / 4.},
+	Scharr:  {-3 / 16., 0, 3 / 16., -10 / 16., 0, 10 / 16., -3 / 16., 0, 3 / 16.},
+	Prewitt: {-1 / 3., 0, 1 / 3., -1 / 3., 0, 1 / 3., -1 / 3., 0, 1 / 3.},
+}
+
+// ParseOperator parses the name of an operator
+func ParseOperator(name string) (Operator, error) {
+	switch strings.ToLower(name) {
+	case "sobel":
+		return Sobel, nil
+	case "scharr":
+		return Scharr, nil
+	case "prewitt":
+		return Prewitt, nil
+	}
+	return Sobel, fmt.Errorf("unknown operator %q: must be one of [sobel|scharr|prewitt]", name)
+}
+
+func (op Operator) String() string {
+	switch op {
+	case Scharr:
+		return "scharr"
+	case Prewitt:
+		return "prewitt"
+	}
+	return "sobel"
+}
+
+// Gradients is how fast and in which direction the brightness of an image
+// changes at every pixel, X grows to the right and Y downwards
+type Gradients struct {
+	X, Y []float64
+	Rect image.Rectangle
+}
+
+// Gradient measures the gradients of the brightness of img
+func Gradient(img image.Image, op Operator) *Gradients {
+	return gradient(luma(img), img.Bounds(), op)
+}
+
+func gradient(p *plane, bounds image.Rectangle, op Operator) *Gradients {
+	k := kernels[op]
+	g := &Gradients{X: make([]float64, p.w*p.h), Y: make([]float64, p.w*p.h), Rect: bounds}
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			var gx, gy float64
+			for j := -1; j <= 1; j++ {
+				for i := -1; i <= 1; i++ {
+					v := p.at(x+i, y+j)
+					gx += v * k[(j+1)*3+i+1]
+					gy += v * k[(i+1)*3+j+1]
+				}
+			}
+			g.X[y*p.w+x], g.Y[y*p.w+x] = gx, gy
+		}
+	}
+	return g
+}
+
+// At is the gradient at x, y of the source image
+func (g *Gradients) At(x, y int) (gx, gy float64) {
+	if !(image.Point{x, y}.In(g.Rect)) {
+		return 0, 0
+	}
+	i := (y-g.Rect.Min.Y)*g.Rect.Dx() + x - g.Rect.Min.X
+	return g.X[i], g.Y[i]
+}
+
+// magnitude is the strength of the gradients
+func (g *Gradients) magnitude() *plane {
+	p := newPlane(g.Rect.Dx(), g.Rect.Dy())
+	for i := range p.v {
+		p.v[i] = math.Hypot(g.X[i], g.Y[i])
+	}
+	return p
+}
+
+// Magnitude maps the strength of the gradients, a hard edge from black to
+// white is white
+func (g *Gradients) Magnitude() *image.Gray {
+	return g.magnitude().gray(g.Rect)
+}
+
+// LoG is the Laplacian of Gaussian, how sharply the brightness bends after a
+// blur of sigma. Edges show as a pair of lines, one on either side, and
+// larger sigmas only keep coarser edges.
+func LoG(img image.Image, sigma float64) *image.Gray {
+	if sigma <= 0 {
+		sigma = 1
+	}
+	p := luma(img).blur(sigma)
+	out := newPlane(p.w, p.h)
+	// the response to a step is about 0.24 / sigma², scale it back to 1
+	scale := sigma * sigma / 0.242
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			l := p.at(x-1, y) + p.at(x+1, y) + p.at(x, y-1) + p.at(x, y+1) - 4*p.at(x, y)
+			out.v[y*p.w+x] = math.Abs(l) * scale
+		}
+	}
+	return out.gray(img.Bounds())
+}
@@ -0,0 +1,137 @@
+package edge
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// step is black on the left and white from x = 20 on
+func step() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint8(0)
+			if x >= 20 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestGradient(t *testing.T) {
+	img := step()
+	for _, op := range []Operator{Sobel, Scharr, Prewitt} {
+		g := Gradient(img, op)
+		gx, gy := g.At(20, 10)
+		if math.Abs(gx-1) > 1e-9 || gy != 0 {
+			t.Errorf("%v: gradient across the step is %v, %v", op, gx, gy)
+		}
+		if gx, gy := g.At(5, 10); gx != 0 || gy != 0 {
+			t.Errorf("%v: gradient in the flat part is %v, %v", op, gx, gy)
+		}
+
+		m := g.Magnitude()
+		if m.GrayAt(19, 10).Y != 255 || m.GrayAt(5, 10).Y != 0 {
+			t.Errorf("%v: magnitude %v", op, m.Pix[10*m.Stride+16:10*m.Stride+24])
+		}
+	}
+
+	if op, err := ParseOperator("Scharr"); err != nil || op != Scharr {
+		t.Errorf("parsed %v, %v", op, err)
+	}
+	if _, err := ParseOperator("roberts"); err == nil {
+		t.Error("expected an error for an unknown operator")
+	}
+}
+
+func TestLoG(t *testing.T) {
+	m := LoG(step(), 2)
+	// a line either side of the edge and nothing on it or far away
+	if m.GrayAt(17, 10).Y < 128 || m.GrayAt(22, 10).Y < 128 {
+		t.Errorf("no lines beside the edge: %v", m.Pix[10*m.Stride+14:10*m.Stride+26])
+	}
+	if m.GrayAt(5, 10).Y != 0 || m.GrayAt(35, 10).Y != 0 {
+		t.Error("flat parts have edges")
+	}
+}
+
+func TestCanny(t *testing.T) {
+	img := step()
+	// a faint notch that hysteresis should drop
+	for y := 2; y < 4; y++ {
+		img.SetNRGBA(5, y, color.NRGBA{10, 10, 10, 255})
+	}
+
+	m := Canny(img, 1.4, 0.2, 0.5)
+	for y := 1; y < 19; y++ {
+		n := 0
+		for x := 0; x < 40; x++ {
+			if m.GrayAt(x, y).Y == 255 {
+				n++
+				if x < 18 || x > 21 {
+					t.Fatalf("edge at %d, %d", x, y)
+				}
+			}
+		}
+		if n != 1 {
+			t.Fatalf("row %d has an edge %d pixels wide", y, n)
+		}
+	}
+}
+
+func TestDoG(t *testing.T) {
+	m := DoG(step(), 1, 1.6, 0.98)
+	if m.GrayAt(18, 10).Y != 255 {
+		t.Errorf("no line on the dark side: %v", m.Pix[10*m.Stride+14:10*m.Stride+26])
+	}
+	if m.GrayAt(22, 10).Y != 0 || m.GrayAt(35, 10).Y != 0 {
+		t.Error("lines on the light side")
+	}
+
+	x := DefaultXDoG.Apply(step())
+	if x.GrayAt(19, 10).Y < 200 || x.GrayAt(35, 10).Y != 0 {
+		t.Errorf("xdog %v", x.Pix[10*x.Stride+14:10*x.Stride+26])
+	}
+	// a high epsilon inks the dark areas too
+	fill := XDoG{Sigma: 1, K: 1.6, P: 20, Epsilon: 0.5, Phi: 10}.Apply(step())
+	if fill.GrayAt(5, 10).Y != 255 {
+		t.Errorf("dark area is %d", fill.GrayAt(5, 10).Y)
+	}
+}
+
+func TestSketch(t *testing.T) {
+	img := step()
+	// a grey bar in the white half
+	for y := 0; y < 20; y++ {
+		img.SetNRGBA(30, y, color.NRGBA{128, 128, 128, 255})
+	}
+	m := Sketch(img, 4)
+	if m.GrayAt(35, 10).Y < 240 || m.GrayAt(5, 10).Y != 255 {
+		t.Error("flat areas should be paper")
+	}
+	if m.GrayAt(30, 10).Y > 160 {
+		t.Errorf("the bar is %d", m.GrayAt(30, 10).Y)
+	}
+}
+
+func TestParse(t *testing.T) {
+	img := step()
+	for _, spec := range []string{"sobel", "scharr:1", "prewitt", "log", "log:3", "canny", "canny:2,0.1,0.3", "dog", "xdog", "XDoG:1,1.6,20,0.2,50"} {
+		d, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if m := d(img); m.Bounds() != img.Bounds() {
+			t.Errorf("%s: bounds %v", spec, m.Bounds())
+		}
+	}
+	for _, spec := range []string{"", "nope", "canny:a", "log:1,2", "sketch"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
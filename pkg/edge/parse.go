@@ -0,0 +1,91 @@
+package edge
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Detector makes the edge map of an image
+type Detector func(img image.Image) *image.Gray
+
+// Parse reads a detector spec, a name with optional comma separated settings:
+//
+//	sobel:sigma
+//	scharr:sigma
+//	prewitt:sigma
+//	log:sigma
+//	canny:sigma,low,high
+//	dog:sigma,k,tau
+//	xdog:sigma,k,p,epsilon,phi
+//
+// The gradient operators blur by sigma first (0 by default), log defaults to
+// a sigma of 2, canny to 1.4,0.1,0.25, dog to 1,1.6,0.98 and xdog to DefaultXDoG.
+func Parse(spec string) (Detector, error) {
+	name, args, _ := strings.Cut(spec, ":")
+	var values []string
+	if args != "" {
+		values = strings.Split(args, ",")
+	}
+
+	switch name = strings.ToLower(name); name {
+	case "sobel", "scharr", "prewitt":
+		v, err := parseFloats(values, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad edge detector %q: %w", spec, err)
+		}
+		op, _ := ParseOperator(name)
+		return func(img image.Image) *image.Gray {
+			return gradient(luma(img).blur(v[0]), img.Bounds(), op).Magnitude()
+		}, nil
+
+	case "log":
+		v, err := parseFloats(values, 2)
+		if err != nil {
+			return nil, fmt.Errorf("bad edge detector %q: %w", spec, err)
+		}
+		return func(img image.Image) *image.Gray { return LoG(img, v[0]) }, nil
+
+	case "canny":
+		v, err := parseFloats(values, 1.4, 0.1, 0.25)
+		if err != nil {
+			return nil, fmt.Errorf("bad edge detector %q: %w", spec, err)
+		}
+		return func(img image.Image) *image.Gray { return Canny(img, v[0], v[1], v[2]) }, nil
+
+	case "dog":
+		v, err := parseFloats(values, 1, 1.6, 0.98)
+		if err != nil {
+			return nil, fmt.Errorf("bad edge detector %q: %w", spec, err)
+		}
+		return func(img image.Image) *image.Gray { return DoG(img, v[0], v[1], v[2]) }, nil
+
+	case "xdog":
+		d := DefaultXDoG
+		v, err := parseFloats(values, d.Sigma, d.K, d.P, d.Epsilon, d.Phi)
+		if err != nil {
+			return nil, fmt.Errorf("bad edge detector %q: %w", spec, err)
+		}
+		x := XDoG{Sigma: v[0], K: v[1], P: v[2], Epsilon: v[3], Phi: v[4]}
+		return x.Apply, nil
+	}
+
+	return nil, fmt.Errorf("unknown edge detector %q: must be one of [sobel|scharr|prewitt|log|canny|dog|xdog]", spec)
+}
+
+// parseFloats parses up to len(defaults) values, missing ones are the defaults
+func parseFloats(values []string, defaults ...float64) ([]float64, error) {
+	if len(values) > len(defaults) {
+		return nil, fmt.Errorf("expected at most %d values", len(defaults))
+	}
+	out := append([]float64(nil), defaults...)
+	for i, s := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
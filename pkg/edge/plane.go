@@ -0,0 +1,96 @@
+package edge
+
+import (
+	"image"
+	"math"
+
+	"pix/pkg/imaging"
+)
+
+// plane is a single channel image from 0 - 1, the edges repeat past the bounds
+type plane struct {
+	w, h int
+	v    []float64
+}
+
+func newPlane(w, h int) *plane {
+	return &plane{w: w, h: h, v: make([]float64, w*h)}
+}
+
+// luma is the brightness of img, transparent pixels count as black
+func luma(img image.Image) *plane {
+	src := imaging.Clone(img)
+	p := newPlane(src.Rect.Dx(), src.Rect.Dy())
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			c := src.Pix[y*src.Stride+x*4 : y*src.Stride+x*4+4]
+			l := 0.299*float64(c[0]) + 0.587*float64(c[1]) + 0.114*float64(c[2])
+			p.v[y*p.w+x] = l * float64(c[3]) / (255 * 255)
+		}
+	}
+	return p
+}
+
+func (p *plane) at(x, y int) float64 {
+	return p.v[clamp(y, 0, p.h-1)*p.w+clamp(x, 0, p.w-1)]
+}
+
+// blur is a gaussian blur, a sigma of 0 copies the plane
+func (p *plane) blur(sigma float64) *plane {
+	out := newPlane(p.w, p.h)
+	if sigma <= 0 {
+		copy(out.v, p.v)
+		return out
+	}
+
+	size := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, size*2+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - size)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	// the rows then the columns
+	tmp := newPlane(p.w, p.h)
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				v += p.at(x+k-size, y) * weight
+			}
+			tmp.v[y*p.w+x] = v
+		}
+	}
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				v += tmp.at(x, y+k-size) * weight
+			}
+			out.v[y*p.w+x] = v
+		}
+	}
+	return out
+}
+
+// gray maps the plane to a greyscale image with the bounds of the source,
+// values are clamped to 0 - 1
+func (p *plane) gray(bounds image.Rectangle) *image.Gray {
+	g := image.NewGray(bounds)
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			v := math.Min(math.Max(p.v[y*p.w+x], 0), 1)
+			g.Pix[y*g.Stride+x] = uint8(v*255 + 0.5)
+		}
+	}
+	return g
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -8,7 +8,9 @@ import (
 	"image/gif"
 	_ "image/png" // For frame decoding
 	"os"
+	"time"
 
+	"pix/pkg/gifenc"
 	"pix/pkg/imaging"
 	"pix/pkg/quantize"
 
@@ -49,44 +51,22 @@ func DitherBayer(img image.Image, str float32, colors []color.Color) image.Image
 	return d.Dither(img)
 }
 
-// Dither a gif / array of images
+// Dither a gif / array of images to the palette, frames only store what
+// changed since the frame before
 func DitherGIF(imgs []image.Image, palette []color.Color) (gif.GIF, error) {
-	d := dither.NewDitherer(palette)
-	d.Matrix = dither.FloydSteinberg // Why not?
-	numFrames := len(imgs)
-
-	if numFrames < 2 {
+	if len(imgs) < 2 {
 		return gif.GIF{}, fmt.Errorf("must have more than one frame to create a gif")
 	}
 
-	// Decode first frame and get image.Config for use in gif.GIF.
-	// gif.GIF requires *image.Paletted is used, so DitherPaletted
-	// is called instead of Dither.
-	firstFrame, config := d.DitherPalettedConfig(imgs[0])
-	frames := make([]*image.Paletted, numFrames)
-	frames[0] = firstFrame
-
-	// Decode other frames
-	for i := 1; i < numFrames; i++ {
-		frames[i] = d.DitherPaletted(imgs[i])
-	}
-
 	// Frame delay - same for each frame
-	delays := make([]int, numFrames)
-	for i := range delays {
-		delays[i] = 7
-	}
-
-	// Setup GIF and encode
-	g := gif.GIF{
-		Image: frames,
-		Delay: delays,
-		// By specifying a Config, we can set a global color table for the GIF.
-		// This is more efficient then each frame having its own color table, which
-		// is the default when there's no config.
-		Config: config,
+	g, err := gifenc.Build(imgs, []time.Duration{70 * time.Millisecond},
+		gifenc.Palette(palette),
+		gifenc.Dithering(gifenc.FloydSteinberg), // Why not?
+	)
+	if err != nil {
+		return gif.GIF{}, err
 	}
-	return g, nil
+	return *g, nil
 }
 
 // dither an array of images into a gif on the filesystem
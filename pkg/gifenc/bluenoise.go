@@ -0,0 +1,110 @@
+package gifenc
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const blueNoiseSize = 64
+
+var (
+	blueNoiseOnce   sync.Once
+	blueNoiseMatrix *thresholdMatrix
+)
+
+// blueNoise returns a 64x64 blue noise threshold matrix, built once. Blue noise
+// hides the dithering pattern better than bayer without the crawling of error
+// diffusion between frames.
+func blueNoise() *thresholdMatrix {
+	blueNoiseOnce.Do(func() {
+		blueNoiseMatrix = newThresholdMatrix(blueNoiseSize, voidAndCluster(blueNoiseSize, 1.5, 1))
+	})
+	return blueNoiseMatrix
+}
+
+// voidAndCluster ranks every cell of a size*size tile using Ulichney's
+// void-and-cluster method, points are added to the largest gaps first so any
+// threshold gives evenly spread points.
+func voidAndCluster(size int, sigma float64, seed int64) []int {
+	n := size * size
+
+	// gaussian weights by toroidal offset
+	kernel := make([]float64, n)
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			x, y := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			kernel[dy*size+dx] = math.Exp(-(x*x + y*y) / (2 * sigma * sigma))
+		}
+	}
+
+	pattern := make([]bool, n)
+	energy := make([]float64, n)
+	toggle := func(p []bool, e []float64, i int) {
+		p[i] = !p[i]
+		sign := 1.0
+		if !p[i] {
+			sign = -1
+		}
+		px, py := i%size, i/size
+		for y := 0; y < size; y++ {
+			row := ((y - py + size) % size) * size
+			for x := 0; x < size; x++ {
+				e[y*size+x] += sign * kernel[row+(x-px+size)%size]
+			}
+		}
+	}
+
+	// tightest cluster is the set point with the most energy, the largest void
+	// is the empty point with the least
+	extreme := func(p []bool, e []float64, set bool) int {
+		best := -1
+		for i := range p {
+			if p[i] != set {
+				continue
+			}
+			if best < 0 || (set && e[i] > e[best]) || (!set && e[i] < e[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	// a random start, relaxed until moving the tightest cluster to the largest
+	// void doesn't change anything
+	r := rand.New(rand.NewSource(seed))
+	ones := n / 10
+	for _, i := range r.Perm(n)[:ones] {
+		toggle(pattern, energy, i)
+	}
+	for step := 0; step < n; step++ {
+		cluster := extreme(pattern, energy, true)
+		toggle(pattern, energy, cluster)
+		void := extreme(pattern, energy, false)
+		if void == cluster {
+			toggle(pattern, energy, cluster)
+			break
+		}
+		toggle(pattern, energy, void)
+	}
+
+	ranks := make([]int, n)
+
+	// rank the starting points by removing the tightest clusters
+	p := append([]bool(nil), pattern...)
+	e := append([]float64(nil), energy...)
+	for rank := ones - 1; rank >= 0; rank-- {
+		i := extreme(p, e, true)
+		toggle(p, e, i)
+		ranks[i] = rank
+	}
+
+	// then fill the largest voids until every point is ranked
+	for rank := ones; rank < n; rank++ {
+		i := extreme(pattern, energy, false)
+		toggle(pattern, energy, i)
+		ranks[i] = rank
+	}
+
+	return ranks
+}
@@ -0,0 +1,125 @@
+package gifenc
+
+import (
+	"image"
+	"math"
+)
+
+// draw converts the source pixels inside dst's bounds to palette indexes.
+// Unchanged pixels and see through pixels use the transparent index, they
+// neither take nor spread any dithering error.
+func (o *options) draw(dst *image.Paletted, src *image.NRGBA, same []bool, transparent int) {
+	n := len(dst.Palette)
+	if transparent >= 0 {
+		n--
+	}
+	m := newMatcher(dst.Palette, n)
+
+	var matrix *thresholdMatrix
+	switch o.dither {
+	case Ordered:
+		matrix = bayer8x8()
+	case BlueNoise:
+		matrix = blueNoise()
+	}
+	// smaller palettes have colors further apart and need a stronger pattern
+	amount := float32(256 / math.Cbrt(float64(n)))
+
+	rect := dst.Rect
+	w := rect.Dx()
+	// error rows with a pixel of padding on each side
+	cur := make([]float32, (w+2)*3)
+	next := make([]float32, (w+2)*3)
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			k := (y-rect.Min.Y)*w + x - rect.Min.X
+			pi := dst.PixOffset(x, y)
+			si := src.PixOffset(x, y)
+
+			if transparent >= 0 && ((same != nil && same[k]) || src.Pix[si+3] < 0x80) {
+				dst.Pix[pi] = uint8(transparent)
+				continue
+			}
+
+			r, g, b := float32(src.Pix[si]), float32(src.Pix[si+1]), float32(src.Pix[si+2])
+			e := (x - rect.Min.X + 1) * 3
+
+			switch o.dither {
+			case FloydSteinberg:
+				r, g, b = r+cur[e], g+cur[e+1], b+cur[e+2]
+			case Ordered, BlueNoise:
+				t := matrix.at(x, y) * amount
+				r, g, b = r+t, g+t, b+t
+			}
+
+			idx := m.index(clamp(r), clamp(g), clamp(b))
+			dst.Pix[pi] = idx
+
+			if o.dither == FloydSteinberg {
+				c := m.colors[idx]
+				er, eg, eb := r-float32(c.r), g-float32(c.g), b-float32(c.b)
+				spread := func(row []float32, at int, f float32) {
+					row[at] += er * f
+					row[at+1] += eg * f
+					row[at+2] += eb * f
+				}
+				spread(cur, e+3, 7.0/16)
+				spread(next, e-3, 3.0/16)
+				spread(next, e, 5.0/16)
+				spread(next, e+3, 1.0/16)
+			}
+		}
+
+		cur, next = next, cur
+		clear(next)
+	}
+}
+
+func clamp(v float32) int32 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 255:
+		return 255
+	}
+	return int32(v + 0.5)
+}
+
+// thresholdMatrix is a tiled pattern of offsets from -0.5 to 0.5
+type thresholdMatrix struct {
+	size   int
+	values []float32
+}
+
+func (t *thresholdMatrix) at(x, y int) float32 {
+	return t.values[(y%t.size)*t.size+x%t.size]
+}
+
+// newThresholdMatrix spreads the ranks 0 to size*size-1 evenly around zero
+func newThresholdMatrix(size int, ranks []int) *thresholdMatrix {
+	t := &thresholdMatrix{size: size, values: make([]float32, len(ranks))}
+	for i, r := range ranks {
+		t.values[i] = (float32(r)+0.5)/float32(len(ranks)) - 0.5
+	}
+	return t
+}
+
+// bayer8x8 is the classic recursive ordered dither pattern
+func bayer8x8() *thresholdMatrix {
+	ranks := []int{0}
+	for size := 1; size < 8; size *= 2 {
+		next := make([]int, size*size*4)
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := ranks[y*size+x] * 4
+				next[y*size*2+x] = v
+				next[y*size*2+x+size] = v + 2
+				next[(y+size)*size*2+x] = v + 3
+				next[(y+size)*size*2+x+size] = v + 1
+			}
+		}
+		ranks = next
+	}
+	return newThresholdMatrix(8, ranks)
+}
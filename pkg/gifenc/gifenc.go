@@ -0,0 +1,416 @@
+// Package gifenc builds GIFs that look better and are smaller than converting
+// every frame to a fixed palette. Palettes are quantized from the frames, only
+// the part of a frame that changed is stored and pixels that stay the same are
+// left transparent so they compress to almost nothing.
+package gifenc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dither is the dithering used when a frame is reduced to its palette
+type Dither int
+
+const (
+	NoDither Dither = iota
+	FloydSteinberg
+	Ordered
+	BlueNoise
+)
+
+func (d Dither) String() string {
+	switch d {
+	case NoDither:
+		return "none"
+	case FloydSteinberg:
+		return "fs"
+	case Ordered:
+		return "ordered"
+	case BlueNoise:
+		return "bluenoise"
+	}
+	return fmt.Sprintf("Dither(%d)", int(d))
+}
+
+// ParseDither parses a dither name, [none|fs|ordered|bluenoise]
+func ParseDither(s string) (Dither, error) {
+	switch strings.ToLower(s) {
+	case "none", "no", "off":
+		return NoDither, nil
+	case "fs", "floyd", "floydsteinberg", "floyd-steinberg":
+		return FloydSteinberg, nil
+	case "ordered", "bayer":
+		return Ordered, nil
+	case "bluenoise", "blue-noise", "blue":
+		return BlueNoise, nil
+	}
+	return NoDither, fmt.Errorf("unknown gif dither %q: must be one of [none|fs|ordered|bluenoise]", s)
+}
+
+// Stats compares the size of a GIF to the same frames converted to the Plan9
+// palette with Floyd-Steinberg dithering, what image/gif users usually do
+type Stats struct {
+	Size      int64
+	NaiveSize int64
+}
+
+// Saved is the fraction of the naive size that was saved
+func (s Stats) Saved() float64 {
+	if s.NaiveSize == 0 {
+		return 0
+	}
+	return 1 - float64(s.Size)/float64(s.NaiveSize)
+}
+
+type options struct {
+	colors        int
+	palette       color.Palette
+	framePalettes bool
+	dither        Dither
+	optimize      bool
+	loopCount     int
+	stats         *Stats
+}
+
+// Option changes how the GIF is built
+type Option func(o *options) error
+
+// Colors sets the most colors a palette can have, including the transparent
+// color used for unchanged pixels
+func Colors(n int) Option {
+	return func(o *options) error {
+		if n < 2 || n > 256 {
+			return fmt.Errorf("gif colors must be between 2 and 256")
+		}
+		o.colors = n
+		return nil
+	}
+}
+
+// Palette uses a fixed palette instead of quantizing one from the frames
+func Palette(p color.Palette) Option {
+	return func(o *options) error {
+		if len(p) < 1 || len(p) > 255 {
+			return fmt.Errorf("gif palette must have between 1 and 255 colors")
+		}
+		o.palette = p
+		return nil
+	}
+}
+
+// FramePalettes quantizes a palette for every frame instead of one palette
+// shared by the whole animation, better colors when the scenes change at the
+// cost of a color table per frame
+func FramePalettes(enabled bool) Option {
+	return func(o *options) error {
+		o.framePalettes = enabled
+		return nil
+	}
+}
+
+// Dithering sets the dithering used when reducing colors, Floyd-Steinberg by default
+func Dithering(d Dither) Option {
+	return func(o *options) error {
+		if d < NoDither || d > BlueNoise {
+			return fmt.Errorf("unknown gif dither %v", d)
+		}
+		o.dither = d
+		return nil
+	}
+}
+
+// Optimize crops frames to the area that changed and makes unchanged pixels
+// transparent, on by default
+func Optimize(enabled bool) Option {
+	return func(o *options) error {
+		o.optimize = enabled
+		return nil
+	}
+}
+
+// LoopCount sets how many times the animation plays, 0 loops forever
+func LoopCount(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("loop count cannot be negative")
+		}
+		o.loopCount = n
+		return nil
+	}
+}
+
+// Report fills in s when encoding, the frames are encoded a second time with
+// the naive encoder to compare so only use it when the numbers are shown
+func Report(s *Stats) Option {
+	return func(o *options) error {
+		o.stats = s
+		return nil
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		colors:   256,
+		dither:   FloydSteinberg,
+		optimize: true,
+	}
+
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Build converts the frames to a GIF, every frame is drawn over the first
+// frame's bounds and shown for its delay. The last delay is reused when there
+// are fewer delays than frames.
+func Build(frames []image.Image, delays []time.Duration, opts ...Option) (*gif.GIF, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return o.build(frames, delays)
+}
+
+// Encode builds a GIF from the frames and writes it to w
+func Encode(w io.Writer, frames []image.Image, delays []time.Duration, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	g, err := o.build(frames, delays)
+	if err != nil {
+		return err
+	}
+
+	cw := &countingWriter{w: w}
+	if err := gif.EncodeAll(cw, g); err != nil {
+		return err
+	}
+
+	if o.stats != nil {
+		naive := &countingWriter{w: io.Discard}
+		if err := gif.EncodeAll(naive, Naive(frames, delays, o.loopCount)); err != nil {
+			return err
+		}
+		*o.stats = Stats{Size: cw.n, NaiveSize: naive.n}
+	}
+
+	return nil
+}
+
+// Naive converts every full frame to the Plan9 palette with Floyd-Steinberg dithering
+func Naive(frames []image.Image, delays []time.Duration, loopCount int) *gif.GIF {
+	g := &gif.GIF{LoopCount: loopsToGIF(loopCount)}
+	for i, f := range frames {
+		b := f.Bounds()
+		p := image.NewPaletted(b, palette.Plan9)
+		draw.FloydSteinberg.Draw(p, b, f, b.Min)
+		g.Image = append(g.Image, p)
+		g.Delay = append(g.Delay, delayAt(delays, i))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	return g
+}
+
+func (o *options) build(frames []image.Image, delays []time.Duration) (*gif.GIF, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("gif: no frames to encode")
+	}
+
+	bounds := image.Rect(0, 0, frames[0].Bounds().Dx(), frames[0].Bounds().Dy())
+	srcs := make([]*image.NRGBA, len(frames))
+	for i, f := range frames {
+		srcs[i] = image.NewNRGBA(bounds)
+		draw.Draw(srcs[i], bounds, f, f.Bounds().Min, draw.Src)
+	}
+
+	// frames with see through pixels are cleared before the next frame is
+	// drawn, so they can't be built on top of the frame before
+	transparent := hasTransparency(srcs)
+	optimize := o.optimize && !transparent && len(srcs) > 1
+	reserve := transparent || optimize
+
+	ncolors := o.colors
+	if reserve {
+		ncolors--
+	}
+
+	global := o.palette
+	if len(global) > ncolors {
+		return nil, fmt.Errorf("gif palette has %d colors but only %d fit", len(global), ncolors)
+	}
+	if global == nil && !o.framePalettes {
+		global = buildPalette(srcs, nil, ncolors)
+	}
+	if global != nil && reserve {
+		global = append(global[:len(global):len(global)], color.Transparent)
+	}
+
+	g := &gif.GIF{
+		Image:     make([]*image.Paletted, len(srcs)),
+		Delay:     make([]int, len(srcs)),
+		Disposal:  make([]byte, len(srcs)),
+		LoopCount: loopsToGIF(o.loopCount),
+		Config:    image.Config{Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+	if global != nil {
+		g.Config.ColorModel = global
+	}
+
+	// frames only depend on their source and the source before them
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(srcs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var prev *image.NRGBA
+				if optimize && i > 0 {
+					prev = srcs[i-1]
+				}
+				g.Image[i] = o.frame(srcs[i], prev, global, ncolors, reserve)
+			}
+		}()
+	}
+	for i := range srcs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range srcs {
+		g.Delay[i] = delayAt(delays, i)
+		g.Disposal[i] = gif.DisposalNone
+		if transparent {
+			g.Disposal[i] = gif.DisposalBackground
+		}
+	}
+
+	return g, nil
+}
+
+// frame converts one frame to its palette, with a previous frame only the
+// changed rectangle is kept and unchanged pixels use the transparent index
+func (o *options) frame(src, prev *image.NRGBA, global color.Palette, ncolors int, reserve bool) *image.Paletted {
+	rect := src.Bounds()
+	var same []bool
+	if prev != nil {
+		rect, same = changed(prev, src)
+	}
+
+	pal := global
+	if pal == nil {
+		pal = buildPalette([]*image.NRGBA{src}, &region{rect, same}, ncolors)
+		if reserve {
+			pal = append(pal, color.Transparent)
+		}
+	}
+
+	dst := image.NewPaletted(rect, pal)
+	transparent := -1
+	if reserve {
+		transparent = len(pal) - 1
+	}
+	o.draw(dst, src, same, transparent)
+
+	return dst
+}
+
+// changed returns the smallest rectangle holding every pixel that differs
+// between the frames, and which pixels inside of it stayed the same
+func changed(prev, cur *image.NRGBA) (image.Rectangle, []bool) {
+	b := cur.Bounds()
+	rect := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := cur.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x, i = x+1, i+4 {
+			if samePixel(prev.Pix[i:i+4], cur.Pix[i:i+4]) {
+				continue
+			}
+			rect = rect.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+
+	// nothing moved, gifs still need a frame to hold the delay
+	if rect.Empty() {
+		return image.Rect(b.Min.X, b.Min.Y, b.Min.X+1, b.Min.Y+1), []bool{true}
+	}
+
+	same := make([]bool, 0, rect.Dx()*rect.Dy())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		i := cur.PixOffset(rect.Min.X, y)
+		for x := rect.Min.X; x < rect.Max.X; x, i = x+1, i+4 {
+			same = append(same, samePixel(prev.Pix[i:i+4], cur.Pix[i:i+4]))
+		}
+	}
+
+	return rect, same
+}
+
+func samePixel(a, b []uint8) bool {
+	return a[0] == b[0] && a[1] == b[1] && a[2] == b[2] && a[3] == b[3]
+}
+
+// hasTransparency reports if any pixel is see through enough to become the transparent color
+func hasTransparency(frames []*image.NRGBA) bool {
+	for _, f := range frames {
+		for i := 3; i < len(f.Pix); i += 4 {
+			if f.Pix[i] < 0x80 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delayAt converts a delay to 100ths of a second
+func delayAt(delays []time.Duration, i int) int {
+	if len(delays) == 0 {
+		return 0
+	}
+	d := delays[min(i, len(delays)-1)]
+	return int((d + 5*time.Millisecond) / (10 * time.Millisecond))
+}
+
+// loopsToGIF converts a play count to the GIF loop count, where 0 loops
+// forever and -1 plays once
+func loopsToGIF(n int) int {
+	switch {
+	case n == 0:
+		return 0
+	case n == 1:
+		return -1
+	default:
+		return n - 1
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
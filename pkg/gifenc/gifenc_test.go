@@ -0,0 +1,196 @@
+package gifenc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"sort"
+	"testing"
+	"time"
+)
+
+// gradient draws a smooth background with a square that moves every frame
+func gradient(n int) []image.Image {
+	var frames []image.Image
+	for i := 0; i < n; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+		for y := 0; y < 48; y++ {
+			for x := 0; x < 64; x++ {
+				c := color.NRGBA{uint8(x * 4), uint8(y * 5), 120, 255}
+				if x >= 4+i*4 && x < 12+i*4 && y >= 10 && y < 18 {
+					c = color.NRGBA{255, 255, 0, 255}
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		frames = append(frames, img)
+	}
+	return frames
+}
+
+// render composites the decoded frames like a viewer would
+func render(g *gif.GIF) []*image.NRGBA {
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var out []*image.NRGBA
+	for i, f := range g.Image {
+		draw.Draw(canvas, f.Bounds(), f, f.Bounds().Min, draw.Over)
+		frame := image.NewNRGBA(canvas.Bounds())
+		copy(frame.Pix, canvas.Pix)
+		out = append(out, frame)
+		if g.Disposal[i] == gif.DisposalBackground {
+			draw.Draw(canvas, f.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return out
+}
+
+// meanError is the average difference per channel between two images
+func meanError(a image.Image, b *image.NRGBA) float64 {
+	var sum float64
+	bounds := b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c1 := color.NRGBAModel.Convert(a.At(x, y)).(color.NRGBA)
+			c2 := b.NRGBAAt(x, y)
+			for _, d := range []int{int(c1.R) - int(c2.R), int(c1.G) - int(c2.G), int(c1.B) - int(c2.B)} {
+				sum += float64(max(d, -d))
+			}
+		}
+	}
+	return sum / float64(bounds.Dx()*bounds.Dy()*3)
+}
+
+func TestEncode(t *testing.T) {
+	frames := gradient(5)
+
+	for _, d := range []Dither{NoDither, FloydSteinberg, Ordered, BlueNoise} {
+		for _, perFrame := range []bool{false, true} {
+			var buf bytes.Buffer
+			var stats Stats
+			err := Encode(&buf, frames, []time.Duration{70 * time.Millisecond}, Dithering(d), FramePalettes(perFrame), LoopCount(3), Report(&stats))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stats.Size != int64(buf.Len()) || stats.Saved() <= 0 {
+				t.Errorf("%v: %d bytes isn't smaller than the naive %d bytes", d, stats.Size, stats.NaiveSize)
+			}
+
+			g, err := gif.DecodeAll(&buf)
+			if err != nil {
+				t.Fatalf("%v: %v", d, err)
+			}
+			if len(g.Image) != 5 || g.LoopCount != 2 || g.Delay[4] != 7 {
+				t.Fatalf("%v: got %d frames, loop count %d and delay %d", d, len(g.Image), g.LoopCount, g.Delay[4])
+			}
+
+			// only the area the square moved through is stored
+			for i, f := range g.Image[1:] {
+				if want := image.Rect(4+i*4, 10, 16+i*4, 18); f.Bounds() != want {
+					t.Errorf("%v: frame %d is %v want %v", d, i+1, f.Bounds(), want)
+				}
+			}
+
+			for i, f := range render(g) {
+				if e := meanError(frames[i], f); e > 8 {
+					t.Errorf("%v per frame %v: frame %d is off by %.1f on average", d, perFrame, i, e)
+				}
+			}
+		}
+	}
+}
+
+func TestTransparency(t *testing.T) {
+	var frames []image.Image
+	for i := 0; i < 3; i++ {
+		img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		draw.Draw(img, image.Rect(i*3, 0, i*3+4, 10), image.NewUniform(color.NRGBA{200, 10, 10, 255}), image.Point{}, draw.Src)
+		frames = append(frames, img)
+	}
+
+	g, err := Build(frames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, f := range render(g) {
+		if g.Disposal[i] != gif.DisposalBackground {
+			t.Errorf("frame %d isn't cleared", i)
+		}
+		if _, _, _, a := f.At((i*3+6)%10, 5).RGBA(); a != 0 {
+			t.Errorf("frame %d: expected a transparent pixel", i)
+		}
+		if _, _, _, a := f.At(i*3+1, 5).RGBA(); a == 0 {
+			t.Errorf("frame %d: expected the bar to be visible", i)
+		}
+	}
+}
+
+func TestStillFrames(t *testing.T) {
+	frames := gradient(1)
+	frames = append(frames, frames[0], frames[0])
+
+	g, err := Build(frames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range g.Image[1:] {
+		if f.Bounds().Dx()*f.Bounds().Dy() != 1 {
+			t.Errorf("an unchanged frame should be a single pixel, got %v", f.Bounds())
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if _, err := Build(gradient(1), nil, Colors(300)); err == nil {
+		t.Error("expected an error for too many colors")
+	}
+	if _, err := Build(gradient(2), nil, Colors(4), Palette(color.Palette{color.Black, color.White, color.Black, color.White})); err == nil {
+		t.Error("expected an error for a palette that doesn't fit next to the transparent color")
+	}
+
+	g, err := Build(gradient(2), nil, Palette(color.Palette{color.Black, color.White}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := g.Config.ColorModel.(color.Palette); len(p) != 3 {
+		t.Errorf("fixed palette plus transparency should be 3 colors, got %d", len(p))
+	}
+
+	for _, name := range []string{"none", "fs", "ordered", "bluenoise"} {
+		d, err := ParseDither(name)
+		if err != nil || d.String() != name {
+			t.Errorf("%s parsed as %v, %v", name, d, err)
+		}
+	}
+	if _, err := ParseDither("sparkles"); err == nil {
+		t.Error("expected an error for an unknown dither")
+	}
+}
+
+func TestBlueNoise(t *testing.T) {
+	ranks := voidAndCluster(16, 1.5, 1)
+	sorted := append([]int(nil), ranks...)
+	sort.Ints(sorted)
+	for i, r := range sorted {
+		if r != i {
+			t.Fatalf("ranks aren't a permutation: %v", sorted)
+		}
+	}
+
+	// the lowest 1/8th of the ranks should be spread out, no two of them next to each other
+	for i, r := range ranks {
+		if r >= 32 {
+			continue
+		}
+		x, y := i%16, i/16
+		for _, n := range [][2]int{{1, 0}, {0, 1}} {
+			j := ((y+n[1])%16)*16 + (x+n[0])%16
+			if ranks[j] < 32 {
+				t.Errorf("ranks %d and %d are neighbors", r, ranks[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package gifenc
+
+import (
+	"image"
+	"image/color"
+
+	"pix/pkg/quantize"
+)
+
+// maxSamples caps the pixels handed to the quantizer, long animations are sampled evenly
+const maxSamples = 1 << 19
+
+// region limits quantizing to a rectangle, skipping the pixels that didn't change
+type region struct {
+	rect image.Rectangle
+	same []bool
+}
+
+// buildPalette quantizes up to n colors from the opaque pixels of the frames
+func buildPalette(frames []*image.NRGBA, r *region, n int) color.Palette {
+	rect := frames[0].Bounds()
+	if r != nil {
+		rect = r.rect
+	}
+
+	total := rect.Dx() * rect.Dy() * len(frames)
+	step := max(1, (total+maxSamples-1)/maxSamples)
+
+	pixels := make([]color.RGBA, 0, min(total, maxSamples))
+	k := 0
+	for _, f := range frames {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			i := f.PixOffset(rect.Min.X, y)
+			for x := rect.Min.X; x < rect.Max.X; x, i, k = x+1, i+4, k+1 {
+				if k%step != 0 || f.Pix[i+3] < 0x80 {
+					continue
+				}
+				if r != nil && r.same != nil && r.same[(y-rect.Min.Y)*rect.Dx()+x-rect.Min.X] {
+					continue
+				}
+				pixels = append(pixels, color.RGBA{f.Pix[i], f.Pix[i+1], f.Pix[i+2], 0xff})
+			}
+		}
+	}
+
+	colors := quantize.MedianCut(pixels, n)
+	if len(colors) == 0 {
+		return color.Palette{color.Black}
+	}
+
+	pal := make(color.Palette, len(colors))
+	for i, c := range colors {
+		pal[i] = c
+	}
+	return pal
+}
+
+type rgb struct {
+	r, g, b int32
+}
+
+// matcher finds the closest palette color, results are cached since frames
+// usually repeat a lot of colors
+type matcher struct {
+	colors []rgb
+	cache  map[int32]uint8
+}
+
+// newMatcher matches against the first n colors of the palette, leaving out the transparent color
+func newMatcher(p color.Palette, n int) *matcher {
+	m := &matcher{
+		colors: make([]rgb, n),
+		cache:  make(map[int32]uint8),
+	}
+	for i, c := range p[:n] {
+		r, g, b, _ := c.RGBA()
+		m.colors[i] = rgb{int32(r >> 8), int32(g >> 8), int32(b >> 8)}
+	}
+	return m
+}
+
+func (m *matcher) index(r, g, b int32) uint8 {
+	key := r<<16 | g<<8 | b
+	if idx, ok := m.cache[key]; ok {
+		return idx
+	}
+
+	best, bestDist := 0, int32(-1)
+	for i, c := range m.colors {
+		dr, dg, db := r-c.r, g-c.g, b-c.b
+		dist := dr*dr + dg*dg + db*db
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+			if dist == 0 {
+				break
+			}
+		}
+	}
+
+	// error diffusion can reach a lot of colors, don't let the cache grow forever
+	if len(m.cache) > 1<<18 {
+		clear(m.cache)
+	}
+	m.cache[key] = uint8(best)
+	return uint8(best)
+}
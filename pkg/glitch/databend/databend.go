@@ -0,0 +1,127 @@
+// Package databend glitches images the old fashioned way, by encoding them and
+// corrupting the compressed bytes before decoding them again. Headers are left
+// alone so the damage shows up as smeared blocks and shifted colors instead of
+// a file that won't open.
+package databend
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Format is the encoding that gets corrupted
+type Format int
+
+const (
+	// JPEG corrupts the entropy coded scan data, giving blocky color shifts
+	// that spread to the right and down
+	JPEG Format = iota
+	// PNG corrupts the filter type of rows and the filtered bytes, giving
+	// smears that run down the image
+	PNG
+)
+
+func (f Format) String() string {
+	switch f {
+	case JPEG:
+		return "jpeg"
+	case PNG:
+		return "png"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat parses a databend format name, [jpeg|png]
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "jpeg", "jpg":
+		return JPEG, nil
+	case "png":
+		return PNG, nil
+	}
+	return JPEG, fmt.Errorf("unknown databend format %q: must be one of [jpeg|png]", s)
+}
+
+// Bend corrupts img through format, intensity goes from 0 to 1 and rng picks
+// what gets corrupted so the same seed gives the same glitch
+func Bend(img image.Image, format Format, intensity float64, rng *rand.Rand) (image.Image, error) {
+	if intensity < 0 || intensity > 1 {
+		return nil, fmt.Errorf("databend intensity must be between 0 and 1")
+	}
+	// there is nothing to encode
+	if img.Bounds().Empty() {
+		return img, nil
+	}
+
+	switch format {
+	case JPEG:
+		return bendJPEG(img, intensity, rng)
+	case PNG:
+		return bendPNG(img, intensity, rng)
+	}
+	return nil, fmt.Errorf("unknown databend format %v", format)
+}
+
+// mutation replaces the byte at pos
+type mutation struct {
+	pos   int
+	value byte
+}
+
+// apply returns a copy of data with the first n mutations applied
+func apply(data []byte, mutations []mutation, n int) []byte {
+	out := append([]byte(nil), data...)
+	for _, m := range mutations[:n] {
+		out[m.pos] = m.value
+	}
+	return out
+}
+
+// safeDecode decodes data, turning decoder panics on broken input into errors
+func safeDecode(decode func(io.Reader) (image.Image, error), data []byte) (img image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			img, err = nil, fmt.Errorf("databend: decoder panic: %v", r)
+		}
+	}()
+	return decode(bytes.NewReader(data))
+}
+
+// decodeMost applies the mutations in file order and decodes the result. When
+// everything together breaks the decoder the longest run of mutations that
+// still decodes is found with a binary search, so the image keeps as much of
+// the damage as the decoder can live with. Decoders that give back part of the
+// image along with an error count as decoding, the missing part is damage too.
+func decodeMost(decode func(io.Reader) (image.Image, error), data []byte, mutations []mutation) (image.Image, error) {
+	sort.Slice(mutations, func(i, j int) bool { return mutations[i].pos < mutations[j].pos })
+
+	if img, _ := safeDecode(decode, apply(data, mutations, len(mutations))); img != nil {
+		return img, nil
+	}
+
+	best, err := safeDecode(decode, data)
+	if best == nil {
+		if err == nil {
+			err = fmt.Errorf("databend: the decoder returned no image")
+		}
+		return nil, err
+	}
+
+	// lo always decodes and hi never does
+	lo, hi := 0, len(mutations)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if img, _ := safeDecode(decode, apply(data, mutations, mid)); img != nil {
+			lo, best = mid, img
+		} else {
+			hi = mid
+		}
+	}
+
+	return best, nil
+}
@@ -0,0 +1,201 @@
+package databend
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y * 2), uint8(x ^ y), 255})
+		}
+	}
+	return img
+}
+
+func differs(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return true
+	}
+	ab, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestBend(t *testing.T) {
+	src := testImage()
+
+	var clean bytes.Buffer
+	if err := jpeg.Encode(&clean, src, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		t.Fatal(err)
+	}
+	cleanJPEG, _ := jpeg.Decode(&clean)
+
+	for _, format := range []Format{JPEG, PNG} {
+		for _, intensity := range []float64{0, 0.5, 1} {
+			out, err := Bend(src, format, intensity, rand.New(rand.NewSource(7)))
+			if err != nil {
+				t.Fatalf("%v %v: %v", format, intensity, err)
+			}
+			if out.Bounds().Size() != src.Bounds().Size() {
+				t.Fatalf("%v: size changed to %v", format, out.Bounds())
+			}
+
+			again, _ := Bend(src, format, intensity, rand.New(rand.NewSource(7)))
+			if differs(out, again) {
+				t.Errorf("%v %v: the same seed gave a different glitch", format, intensity)
+			}
+
+			reference := image.Image(src)
+			if format == JPEG {
+				reference = cleanJPEG
+			}
+			if intensity > 0 && !differs(out, reference) {
+				t.Errorf("%v %v: nothing was corrupted", format, intensity)
+			}
+		}
+	}
+
+	if _, err := Bend(src, PNG, 2, rand.New(rand.NewSource(1))); err == nil {
+		t.Error("expected an error for an intensity over 1")
+	}
+}
+
+func TestScanRange(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	start, end, err := scanRange(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start < 100 || data[end] != 0xff || data[end+1] != 0xd9 {
+		t.Errorf("scan should run until EOI, ends at % x", data[end:end+2])
+	}
+
+	if _, _, err := scanRange([]byte{0xff, 0xd8, 0x00}); err == nil {
+		t.Error("expected an error without a scan")
+	}
+}
+
+func TestDecodeMost(t *testing.T) {
+	data := make([]byte, 16)
+	var mutations []mutation
+	for i := range data {
+		mutations = append(mutations, mutation{15 - i, 1})
+	}
+
+	// the decoder gives up once more than 5 bytes are set, and panics past 10
+	decode := func(r io.Reader) (image.Image, error) {
+		b, _ := io.ReadAll(r)
+		n := bytes.Count(b, []byte{1})
+		if n > 10 {
+			panic("too broken")
+		}
+		if n > 5 {
+			return nil, errors.New("broken")
+		}
+		return image.NewGray(image.Rect(0, 0, n, 1)), nil
+	}
+
+	img, err := decodeMost(decode, data, mutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 5 {
+		t.Errorf("expected the first 5 mutations to be kept, got %d", img.Bounds().Dx())
+	}
+
+	// a partial image along with an error is still an image
+	partial := func(r io.Reader) (image.Image, error) {
+		img, err := decode(r)
+		if err != nil {
+			return image.NewGray(image.Rect(0, 0, 10, 1)), err
+		}
+		return img, nil
+	}
+
+	img, err = decodeMost(partial, data, mutations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 10 {
+		t.Errorf("expected the partial image of 10 mutations, got %d", img.Bounds().Dx())
+	}
+
+	// with no image at all the clean data has to decode
+	broken := func(r io.Reader) (image.Image, error) { return nil, errors.New("broken") }
+	if _, err := decodeMost(broken, data, mutations); err == nil {
+		t.Error("expected an error when nothing decodes")
+	}
+}
+
+func TestBendAlpha(t *testing.T) {
+	src := testImage()
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 160; x++ {
+			src.Pix[y*src.Stride+x*4+3] = uint8(x)
+		}
+	}
+
+	// at 0 only a row filter is swapped, the rest of the alpha comes through
+	out, err := Bend(src, PNG, 0, rand.New(rand.NewSource(7)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var same int
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			if color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA).A == src.NRGBAAt(x, y).A {
+				same++
+			}
+		}
+	}
+	if same < 160*120*9/10 {
+		t.Errorf("only %d of %d pixels kept their alpha", same, 160*120)
+	}
+}
+
+func TestBendEmpty(t *testing.T) {
+	for _, format := range []Format{JPEG, PNG} {
+		src := image.NewNRGBA(image.Rect(0, 0, 0, 0))
+		out, err := Bend(src, format, 1, rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if out != image.Image(src) {
+			t.Errorf("%v: expected the empty image back", format)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, s := range []string{"jpeg", "png"} {
+		f, err := ParseFormat(s)
+		if err != nil || f.String() != s {
+			t.Errorf("%s parsed as %v, %v", s, f, err)
+		}
+	}
+	if _, err := ParseFormat("gif"); err == nil {
+		t.Error("expected an error for gif")
+	}
+}
@@ -0,0 +1,92 @@
+package databend
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math/rand"
+)
+
+// jpegQuality is low enough that blocks are large and the scan is small, so
+// every corrupted byte covers a good part of the image
+const jpegQuality = 60
+
+func bendJPEG(img image.Image, intensity float64, rng *rand.Rand) (image.Image, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	start, end, err := scanRange(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// corrupted huffman codes make the decoder read more bits than the scan
+	// has, padding before EOI gives it something to read instead of failing
+	data := make([]byte, 0, buf.Len()+end-start)
+	data = append(data, buf.Bytes()[:end]...)
+	data = append(data, make([]byte, end-start)...)
+	data = append(data, buf.Bytes()[end:]...)
+
+	// one corrupted byte per ~2KB of scan at full intensity
+	count := 1 + int(intensity*float64(end-start)/2048)
+
+	var mutations []mutation
+	for tries := 0; len(mutations) < count && tries < count*10; tries++ {
+		pos := start + 1 + rng.Intn(end-start-1)
+
+		// 0xff starts a marker and is followed by a stuffed zero in the scan,
+		// touching either would end the scan early
+		if data[pos] == 0xff || data[pos-1] == 0xff {
+			continue
+		}
+
+		value := byte(rng.Intn(0xff))
+		if rng.Intn(2) == 0 {
+			// a single flipped bit is subtler than a random byte
+			value = data[pos] ^ 1<<rng.Intn(8)
+		}
+		if value == 0xff {
+			continue
+		}
+
+		mutations = append(mutations, mutation{pos, value})
+	}
+
+	return decodeMost(jpeg.Decode, data, mutations)
+}
+
+// scanRange finds the entropy coded data of the first scan, it starts after
+// the SOS header and ends at the first marker that isn't a restart marker
+func scanRange(data []byte) (start, end int, err error) {
+	i := 2 // SOI
+	for {
+		if i+4 > len(data) || data[i] != 0xff {
+			return 0, 0, fmt.Errorf("databend: no scan found in jpeg")
+		}
+
+		marker := data[i+1]
+		length := int(data[i+2])<<8 | int(data[i+3])
+		i += 2 + length
+		if marker == 0xda {
+			break
+		}
+	}
+
+	start = i
+	for end = start; end+1 < len(data); end++ {
+		if data[end] != 0xff {
+			continue
+		}
+		if next := data[end+1]; next != 0x00 && (next < 0xd0 || next > 0xd7) {
+			break
+		}
+	}
+
+	if end-start < 2 {
+		return 0, 0, fmt.Errorf("databend: jpeg scan is empty")
+	}
+	return start, end, nil
+}
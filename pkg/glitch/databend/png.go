@@ -0,0 +1,183 @@
+package databend
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"math/rand"
+)
+
+// png filter types
+const (
+	filterNone = iota
+	filterSub
+	filterUp
+	filterAverage
+	filterPaeth
+	numFilters
+)
+
+// png color types
+const (
+	colorRGB  = 2
+	colorRGBA = 6
+)
+
+func bendPNG(img image.Image, intensity float64, rng *rand.Rand) (image.Image, error) {
+	b := img.Bounds()
+	rgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	// opaque rows are RGB so corrupting them can't punch holes in the alpha,
+	// transparent images keep theirs and it gets corrupted along with the rest
+	bpp, colorType := 3, byte(colorRGB)
+	if !rgba.Opaque() {
+		bpp, colorType = 4, colorRGBA
+	}
+
+	// every row gets a random filter, each filter smears differently when its
+	// type byte is swapped for another one
+	stride := 1 + b.Dx()*bpp
+	raw := make([]byte, stride*b.Dy())
+	prev := make([]byte, b.Dx()*bpp)
+	cur := make([]byte, b.Dx()*bpp)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			copy(cur[x*bpp:], rgba.Pix[y*rgba.Stride+x*4:y*rgba.Stride+x*4+bpp])
+		}
+
+		row := raw[y*stride : (y+1)*stride]
+		row[0] = byte(rng.Intn(numFilters))
+		filterRow(row[1:], cur, prev, row[0], bpp)
+		prev, cur = cur, prev
+	}
+
+	var mutations []mutation
+
+	// change the filter of some rows, the decoder undoes the wrong filter
+	for i := 0; i < 1+int(intensity*float64(b.Dy())/8); i++ {
+		pos := rng.Intn(b.Dy()) * stride
+		mutations = append(mutations, mutation{pos, byte((int(raw[pos]) + 1 + rng.Intn(numFilters-1)) % numFilters)})
+	}
+
+	// and corrupt some filtered bytes, up, average and paeth rows carry the damage down
+	for i := 0; i < int(intensity*float64(len(raw))/4096); i++ {
+		pos := rng.Intn(len(raw))
+		if pos%stride == 0 {
+			continue
+		}
+		mutations = append(mutations, mutation{pos, byte(rng.Intn(256))})
+	}
+
+	return decodeMost(func(r io.Reader) (image.Image, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if err := writePNG(&buf, b.Dx(), b.Dy(), colorType, data); err != nil {
+			return nil, err
+		}
+		return png.Decode(&buf)
+	}, raw, mutations)
+}
+
+// filterRow filters cur into dst, prev is the unfiltered row above and bpp
+// the bytes per pixel
+func filterRow(dst, cur, prev []byte, filter byte, bpp int) {
+	for i := range cur {
+		var left, up, upLeft byte
+		if i >= bpp {
+			left, upLeft = cur[i-bpp], prev[i-bpp]
+		}
+		up = prev[i]
+
+		switch filter {
+		case filterNone:
+			dst[i] = cur[i]
+		case filterSub:
+			dst[i] = cur[i] - left
+		case filterUp:
+			dst[i] = cur[i] - up
+		case filterAverage:
+			dst[i] = cur[i] - byte((int(left)+int(up))/2)
+		case filterPaeth:
+			dst[i] = cur[i] - paeth(left, up, upLeft)
+		}
+	}
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// writePNG writes an 8 bit RGB or RGBA png from rows that are already filtered
+func writePNG(w io.Writer, width, height int, colorType byte, raw []byte) error {
+	if _, err := w.Write([]byte("\x89PNG\r\n\x1a\n")); err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = colorType
+	if err := writeChunk(w, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	var idat bytes.Buffer
+	zw := zlib.NewWriter(&idat)
+	if _, err := zw.Write(raw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := writeChunk(w, "IDAT", idat.Bytes()); err != nil {
+		return err
+	}
+
+	return writeChunk(w, "IEND", nil)
+}
+
+func writeChunk(w io.Writer, name string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], name)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package glitch
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Datamosher imitates a video with its keyframes removed. Motion between the
+// real frames is estimated per block and applied to the last output instead
+// of the real frame, so old pixels get dragged around by the new motion.
+// Frames have to be passed in order, the state carries over between them.
+type Datamosher struct {
+	blockSize int
+	search    int
+	keyframe  int
+	blend     float64
+
+	frame int
+	prev  []uint8 // luma of the previous real frame
+	ref   *image.NRGBA
+}
+
+// DatamoshOption changes how frames are moshed
+type DatamoshOption func(d *Datamosher) error
+
+// DatamoshBlockSize sets the size of the blocks motion is estimated for, 16 by
+// default like the macroblocks of most codecs
+func DatamoshBlockSize(n int) DatamoshOption {
+	return func(d *Datamosher) error {
+		if n < 2 {
+			return fmt.Errorf("datamosh block size must be at least 2")
+		}
+		d.blockSize = n
+		return nil
+	}
+}
+
+// DatamoshSearch sets how many pixels a block can move between frames, 8 by default
+func DatamoshSearch(n int) DatamoshOption {
+	return func(d *Datamosher) error {
+		if n < 1 {
+			return fmt.Errorf("datamosh search radius must be at least 1")
+		}
+		d.search = n
+		return nil
+	}
+}
+
+// DatamoshKeyframes lets a real frame through every n frames, 0 only keeps the first
+func DatamoshKeyframes(n int) DatamoshOption {
+	return func(d *Datamosher) error {
+		if n < 0 {
+			return fmt.Errorf("datamosh keyframe interval cannot be negative")
+		}
+		d.keyframe = n
+		return nil
+	}
+}
+
+// DatamoshBlend mixes the real frame into the moshed one from 0.0 - 1.0, a bit
+// of blend keeps the image readable while it smears
+func DatamoshBlend(b float64) DatamoshOption {
+	return func(d *Datamosher) error {
+		if b < 0 || b > 1 {
+			return fmt.Errorf("datamosh blend must be between 0 and 1")
+		}
+		d.blend = b
+		return nil
+	}
+}
+
+func NewDatamosher(opts ...DatamoshOption) (*Datamosher, error) {
+	d := &Datamosher{
+		blockSize: 16,
+		search:    8,
+	}
+
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(d); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// Reset starts over, the next frame is a keyframe
+func (d *Datamosher) Reset() {
+	d.frame = 0
+	d.prev = nil
+	d.ref = nil
+}
+
+// Next moshes the next frame of the sequence
+func (d *Datamosher) Next(img image.Image) (image.Image, error) {
+	b := img.Bounds()
+	cur := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(cur, cur.Bounds(), img, b.Min, draw.Src)
+	luma := lumaPlane(cur)
+
+	keyframe := d.ref == nil || d.ref.Bounds() != cur.Bounds() ||
+		(d.keyframe > 0 && d.frame%d.keyframe == 0)
+	d.frame++
+
+	if keyframe {
+		d.prev, d.ref = luma, cur
+		out := image.NewNRGBA(cur.Bounds())
+		copy(out.Pix, cur.Pix)
+		return out, nil
+	}
+
+	w, h := cur.Bounds().Dx(), cur.Bounds().Dy()
+	out := image.NewNRGBA(cur.Bounds())
+	for by := 0; by < h; by += d.blockSize {
+		for bx := 0; bx < w; bx += d.blockSize {
+			block := image.Rect(bx, by, min(bx+d.blockSize, w), min(by+d.blockSize, h))
+			dx, dy := d.motion(luma, d.prev, w, h, block)
+			moveBlock(out, d.ref, block, dx, dy)
+		}
+	}
+
+	if d.blend > 0 {
+		for i := range out.Pix {
+			out.Pix[i] = uint8(float64(out.Pix[i])*(1-d.blend) + float64(cur.Pix[i])*d.blend + 0.5)
+		}
+	}
+
+	d.prev, d.ref = luma, out
+	result := image.NewNRGBA(out.Bounds())
+	copy(result.Pix, out.Pix)
+	return result, nil
+}
+
+// Datamosh moshes a whole sequence of frames
+func Datamosh(frames []image.Image, opts ...DatamoshOption) ([]image.Image, error) {
+	d, err := NewDatamosher(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]image.Image, len(frames))
+	for i, f := range frames {
+		if out[i], err = d.Next(f); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// motion finds where the block of the current frame came from in the previous
+// frame with a three step search, cheaper than trying every offset and good
+// enough for smearing
+func (d *Datamosher) motion(cur, prev []uint8, w, h int, block image.Rectangle) (int, int) {
+	bestX, bestY := 0, 0
+	best := sad(cur, prev, w, h, block, 0, 0)
+	if best == 0 {
+		return 0, 0
+	}
+
+	for step := max(1, (d.search+1)/2); step >= 1; step /= 2 {
+		cx, cy := bestX, bestY
+		for _, o := range [8][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}} {
+			dx, dy := cx+o[0]*step, cy+o[1]*step
+			if abs(dx) > d.search || abs(dy) > d.search {
+				continue
+			}
+			if s := sad(cur, prev, w, h, block, dx, dy); s < best {
+				best, bestX, bestY = s, dx, dy
+			}
+		}
+	}
+
+	return bestX, bestY
+}
+
+// sad is the sum of absolute luma differences between the block and the
+// previous frame offset by dx, dy, pixels outside the frame are clamped
+func sad(cur, prev []uint8, w, h int, block image.Rectangle, dx, dy int) int {
+	sum := 0
+	for y := block.Min.Y; y < block.Max.Y; y++ {
+		py := clampInt(y+dy, 0, h-1) * w
+		for x := block.Min.X; x < block.Max.X; x++ {
+			diff := int(cur[y*w+x]) - int(prev[py+clampInt(x+dx, 0, w-1)])
+			sum += abs(diff)
+		}
+	}
+	return sum
+}
+
+// moveBlock copies the block from src offset by dx, dy into dst
+func moveBlock(dst, src *image.NRGBA, block image.Rectangle, dx, dy int) {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := block.Min.Y; y < block.Max.Y; y++ {
+		sy := clampInt(y+dy, 0, h-1)
+		for x := block.Min.X; x < block.Max.X; x++ {
+			si := src.PixOffset(clampInt(x+dx, 0, w-1), sy)
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[si:si+4])
+		}
+	}
+}
+
+func lumaPlane(img *image.NRGBA) []uint8 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	luma := make([]uint8, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+			luma[y*w+x] = uint8((299*r + 587*g + 114*b) / 1000)
+		}
+	}
+	return luma
+}
+
+func clampInt(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,130 @@
+package glitch
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// wave is a smooth texture shifted right by dx, smooth so block matching has
+// a single best offset
+func wave(w, h, dx int, phase float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx := float64(x-dx) + phase
+			v := 128 + 60*math.Sin(fx/9) + 60*math.Cos(float64(y)/11+fx/23)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(255 - v), uint8(v / 2), 255})
+		}
+	}
+	return img
+}
+
+// meanDiff is the average difference per channel inside r
+func meanDiff(a, b *image.NRGBA, r image.Rectangle) float64 {
+	sum, n := 0, 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i, j := a.PixOffset(x, y), b.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				sum += abs(int(a.Pix[i+c]) - int(b.Pix[j+c]))
+				n++
+			}
+		}
+	}
+	return float64(sum) / float64(n)
+}
+
+func TestDatamoshFirstFrame(t *testing.T) {
+	src := wave(64, 48, 0, 0)
+	out, err := Datamosh([]image.Image{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := meanDiff(out[0].(*image.NRGBA), src, src.Bounds()); d != 0 {
+		t.Errorf("first frame changed, mean diff %v", d)
+	}
+}
+
+func TestDatamoshFollowsMotion(t *testing.T) {
+	var frames []image.Image
+	for i := 0; i < 4; i++ {
+		frames = append(frames, wave(96, 64, 3*i, 0))
+	}
+
+	out, err := Datamosh(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with nothing but a pan the stale frame moved along with the motion looks
+	// like the real frame, apart from the edge pixels coming into view
+	inner := image.Rect(16, 0, 96, 64)
+	for i := 1; i < len(out); i++ {
+		if d := meanDiff(out[i].(*image.NRGBA), frames[i].(*image.NRGBA), inner); d > 4 {
+			t.Errorf("frame %d: mean diff %v from a panned frame", i, d)
+		}
+	}
+}
+
+func TestDatamoshSceneCut(t *testing.T) {
+	a := wave(64, 48, 0, 0)
+	b := wave(64, 48, 0, 100)
+	frames := []image.Image{a, a, b}
+
+	out, err := Datamosh(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new scene only shows up as motion, the pixels are still the old ones
+	moshed := out[2].(*image.NRGBA)
+	if d := meanDiff(moshed, b, b.Bounds()); d < 20 {
+		t.Errorf("scene cut came through, mean diff %v", d)
+	}
+	if d := meanDiff(out[1].(*image.NRGBA), a, a.Bounds()); d != 0 {
+		t.Errorf("still frame changed, mean diff %v", d)
+	}
+}
+
+func TestDatamoshKeyframes(t *testing.T) {
+	a := wave(64, 48, 0, 0)
+	b := wave(64, 48, 0, 100)
+	frames := []image.Image{a, b, b, b}
+
+	out, err := Datamosh(frames, DatamoshKeyframes(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := meanDiff(out[1].(*image.NRGBA), b, b.Bounds()); d < 20 {
+		t.Errorf("frame 1 should be moshed, mean diff %v", d)
+	}
+	if d := meanDiff(out[2].(*image.NRGBA), b, b.Bounds()); d != 0 {
+		t.Errorf("keyframe was moshed, mean diff %v", d)
+	}
+}
+
+func TestDatamoshBlend(t *testing.T) {
+	a := wave(64, 48, 0, 0)
+	b := wave(64, 48, 0, 100)
+
+	full, err := Datamosh([]image.Image{a, b}, DatamoshBlend(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := meanDiff(full[1].(*image.NRGBA), b, b.Bounds()); d != 0 {
+		t.Errorf("blend 1 should give the real frame, mean diff %v", d)
+	}
+
+	if _, err := NewDatamosher(DatamoshBlend(2)); err == nil {
+		t.Error("expected an error for blend out of range")
+	}
+	if _, err := NewDatamosher(DatamoshBlockSize(1)); err == nil {
+		t.Error("expected an error for block size 1")
+	}
+	if _, err := NewDatamosher(nil); err == nil {
+		t.Error("expected an error for a nil option")
+	}
+}
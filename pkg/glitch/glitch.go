@@ -2,27 +2,34 @@ package glitch
 
 import (
 	"crypto/md5"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
-	"image/color/palette"
 	"image/draw"
 	"image/gif"
 	"io"
 	"log"
-	"math"
 	"math/rand"
-	"os"
+	"strings"
+	"time"
 
 	// dither2 "github.com/makeworld-the-better-one/dither/v2"
-	"pix/pkg/glitch/dither"
+	"pix/pkg/anim"
+	"pix/pkg/apng"
+	"pix/pkg/blend"
+	"pix/pkg/gifenc"
+	"pix/pkg/glitch/databend"
 	"pix/pkg/glitch/effects"
-	"pix/pkg/glitch/utils"
+	"pix/pkg/glitch/sonify"
 	"pix/pkg/quantize"
 )
 
 var debug = func(string, ...interface{}) {}
 
+// defaultIterations is how many rounds of transforms a glitch runs
+const defaultIterations = 11
+
 type glitch_options struct {
 	brightness   float64
 	glitchFactor float64
@@ -32,6 +39,30 @@ type glitch_options struct {
 	gif          bool
 	colors       []color.Color
 	frameDelay   int
+
+	databend          bool
+	databendFormat    databend.Format
+	databendIntensity float64
+
+	sonify      bool
+	sonifyFx    sonify.Chain
+	sonifyOrder sonify.Order
+
+	blending    bool
+	blendMode   blend.Mode
+	opacity     float64
+	blendLinear bool
+
+	only       map[string]bool
+	exclude    map[string]bool
+	weights    map[string]float64
+	params     map[string]Params
+	iterations int
+	recipe     *Recipe
+	replay     *Recipe
+	replayed   int
+
+	rng *rand.Rand
 }
 
 type GlitchOption func(args *glitch_options) error
@@ -100,22 +131,207 @@ func GlitchFrameDelay(c int) GlitchOption {
 	}
 }
 
+// GlitchDatabend corrupts the image by encoding it as a jpeg or png and
+// mutating the compressed bytes instead of shifting pixels around, intensity
+// goes from 0 to 1. The seed picks which bytes are corrupted.
+func GlitchDatabend(format databend.Format, intensity float64) GlitchOption {
+	return func(args *glitch_options) error {
+		if intensity < 0 || intensity > 1 {
+			return fmt.Errorf("databend intensity must be between 0 and 1")
+		}
+		args.databend = true
+		args.databendFormat = format
+		args.databendIntensity = intensity
+		return nil
+	}
+}
+
+// GlitchSonify runs the pixels through audio effects instead of shifting
+// them around, an empty chain only applies the other effects
+func GlitchSonify(chain sonify.Chain, order sonify.Order) GlitchOption {
+	return func(args *glitch_options) error {
+		if order < sonify.Rows || order > sonify.Planar {
+			return fmt.Errorf("unknown sonify order %v", order)
+		}
+		args.sonify = true
+		args.sonifyFx = chain
+		args.sonifyOrder = order
+		return nil
+	}
+}
+
+// GlitchOnly only picks from the named transforms
+func GlitchOnly(names ...string) GlitchOption {
+	return func(args *glitch_options) error {
+		if args.only == nil {
+			args.only = map[string]bool{}
+		}
+		for _, name := range names {
+			t, ok := lookup(name)
+			if !ok {
+				return unknownTransform(name)
+			}
+			args.only[strings.ToLower(t.Name)] = true
+		}
+		return nil
+	}
+}
+
+// GlitchExclude never picks the named transforms
+func GlitchExclude(names ...string) GlitchOption {
+	return func(args *glitch_options) error {
+		if args.exclude == nil {
+			args.exclude = map[string]bool{}
+		}
+		for _, name := range names {
+			t, ok := lookup(name)
+			if !ok {
+				return unknownTransform(name)
+			}
+			args.exclude[strings.ToLower(t.Name)] = true
+		}
+		return nil
+	}
+}
+
+// GlitchWeights changes how often transforms are picked, a transform with
+// weight 2 is picked twice as often as one with weight 1
+func GlitchWeights(weights map[string]float64) GlitchOption {
+	return func(args *glitch_options) error {
+		if args.weights == nil {
+			args.weights = map[string]float64{}
+		}
+		for name, w := range weights {
+			t, ok := lookup(name)
+			if !ok {
+				return unknownTransform(name)
+			}
+			if w < 0 {
+				return fmt.Errorf("transform %s: weight cannot be negative", t.Name)
+			}
+			args.weights[strings.ToLower(t.Name)] = w
+		}
+		return nil
+	}
+}
+
+// GlitchParams overrides the params of a transform
+func GlitchParams(name string, params Params) GlitchOption {
+	return func(args *glitch_options) error {
+		t, ok := lookup(name)
+		if !ok {
+			return unknownTransform(name)
+		}
+		if args.params == nil {
+			args.params = map[string]Params{}
+		}
+		args.params[strings.ToLower(t.Name)] = params
+		return nil
+	}
+}
+
+// GlitchIterations sets how many rounds of transforms run, each round runs two
+func GlitchIterations(n int) GlitchOption {
+	return func(args *glitch_options) error {
+		if n <= 0 {
+			return fmt.Errorf("iterations must be a positive integer")
+		}
+		args.iterations = n
+		return nil
+	}
+}
+
+// GlitchBlend composites the glitch over the original image with a blend
+// mode, opacity goes from 0 for just the original to 1
+func GlitchBlend(mode blend.Mode, opacity float64) GlitchOption {
+	return func(args *glitch_options) error {
+		if _, err := blend.ParseMode(mode.String()); err != nil {
+			return err
+		}
+		if opacity < 0 || opacity > 1 {
+			return fmt.Errorf("opacity must be between 0 and 1")
+		}
+		args.blending = true
+		args.blendMode = mode
+		args.opacity = opacity
+		return nil
+	}
+}
+
+// GlitchBlendLinear mixes the colors of GlitchBlend as linear light instead
+// of sRGB values
+func GlitchBlendLinear(enabled bool) GlitchOption {
+	return func(args *glitch_options) error {
+		args.blendLinear = enabled
+		return nil
+	}
+}
+
+// GlitchRecord records every image glitched in r, so it can be saved and replayed
+func GlitchRecord(r *Recipe) GlitchOption {
+	return func(args *glitch_options) error {
+		if r == nil {
+			return fmt.Errorf("recipe to record to is nil")
+		}
+		args.recipe = r
+		return nil
+	}
+}
+
+// GlitchReplay glitches with the plans of a recipe instead of picking new
+// steps, frame i uses plan i. The brightness, scanlines, palette, delay and
+// blend of the recipe replace the ones set before it.
+func GlitchReplay(r *Recipe) GlitchOption {
+	return func(args *glitch_options) error {
+		if r == nil || len(r.Frames) == 0 {
+			return fmt.Errorf("recipe has no frames")
+		}
+		pal, err := parsePalette(r.Palette)
+		if err != nil {
+			return err
+		}
+		args.replay = r
+		args.brightness = r.Brightness
+		args.scanlines = r.Scanlines
+		args.colors = pal
+		args.frames = len(r.Frames)
+		args.frameDelay = r.Delay
+
+		args.blending = r.Blend != nil
+		if args.blending {
+			if args.blendMode, err = blend.ParseMode(r.Blend.Mode); err != nil {
+				return err
+			}
+			args.opacity = r.Blend.Opacity
+			args.blendLinear = r.Blend.Linear
+		}
+		return nil
+	}
+}
+
+func unknownTransform(name string) error {
+	var names []string
+	for _, t := range Registered() {
+		names = append(names, t.Name)
+	}
+	return fmt.Errorf("unknown glitch transform %q: must be one of [%s]", name, strings.Join(names, "|"))
+}
+
+// NewRand seeds a rng from the seed string, without one every glitch is different
+func NewRand(seed string) *rand.Rand {
+	if seed == "" {
+		return rand.New(rand.NewSource(rand.Int63()))
+	}
+	return rand.New(rand.NewSource(randseed(seed)))
+}
+
 // generate a random seed from a str value
 func randseed(seed string) int64 {
 	hasher := md5.New()
 	hasher.Write([]byte(seed))
 	hash := hasher.Sum(nil)
 
-	length := len(hash)
-	var seedInt int64
-
-	for i, hashByte := range hash {
-		// get byte shift offset
-		shift := uint64((length - i - length) * 8)
-		// binary OR the shifted byte onto the return value
-		seedInt |= int64(hashByte) << shift
-	}
-	return seedInt
+	return int64(binary.BigEndian.Uint64(hash))
 }
 
 // glitch an image with the defualt options
@@ -123,20 +339,13 @@ func Glitch(srcImg image.Image) (image.Image, error) {
 	return GlitchWithOpts(srcImg)
 }
 
-// glitch an image with the defualt options
-func GlitchGif(srcImg image.Image, writer io.Writer, opts ...GlitchOption) (*gif.GIF, error) {
-	seed, err := os.Hostname()
-	if err != nil {
-		seed = "unknown_333"
-	}
-
-	rand.New(rand.NewSource(randseed(seed)))
-
+// animationOptions applies the options on top of the defaults for animations
+func animationOptions(opts []GlitchOption) (*glitch_options, error) {
 	defaultOpts := &glitch_options{
 		brightness:   5.0,
 		glitchFactor: 5.0,
 		scanlines:    true,
-		seed:         seed,
+		iterations:   defaultIterations,
 		frames:       7,
 		frameDelay:   0,
 	}
@@ -152,46 +361,91 @@ func GlitchGif(srcImg image.Image, writer io.Writer, opts ...GlitchOption) (*gif
 		}
 	}
 
-	output, err := defaultOpts.GlitchImage(srcImg)
+	defaultOpts.rng = NewRand(defaultOpts.seed)
+	return defaultOpts, nil
+}
+
+// GlitchSequence glitches the image once for every frame, each frame gets a
+// different set of glitches
+func GlitchSequence(srcImg image.Image, opts ...GlitchOption) ([]image.Image, error) {
+	defaultOpts, err := animationOptions(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	outputgif := &gif.GIF{}
-	bounds := srcImg.Bounds()
-
-	pal := color.Palette{}
-	var palettedImage *image.Paletted
+	frames := make([]image.Image, 0, defaultOpts.frames)
+	for i := 0; i < defaultOpts.frames; i++ {
+		output, err := defaultOpts.GlitchImage(srcImg)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, output)
+	}
 
-	pal = palette.Plan9[:256]
-	palettedImage = image.NewPaletted(bounds, palette.Plan9[:256])
+	return frames, nil
+}
 
-	draw.FloydSteinberg.Draw(palettedImage, bounds, output, image.Pt(0, 0))
+// GlitchAnimation glitches the image once for every frame, the delay is in
+// 100ths of a second like GIFs, and like GIF viewers 0 plays at 10fps
+func GlitchAnimation(srcImg image.Image, opts ...GlitchOption) (*anim.Animation, error) {
+	defaultOpts, err := animationOptions(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	outputgif.Image = append(outputgif.Image, palettedImage)
-	outputgif.Delay = append(outputgif.Delay, defaultOpts.frameDelay)
-	defaultOpts.frames--
+	frames, err := GlitchSequence(srcImg, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		palettedImage = image.NewPaletted(bounds, pal)
-		draw.FloydSteinberg.Draw(palettedImage, bounds, output, image.Pt(0, 0))
+	delay := time.Duration(defaultOpts.frameDelay) * 10 * time.Millisecond
+	if delay == 0 {
+		delay = anim.DefaultDelay
+	}
 
-		// Add new frame to animated GIF
-		outputgif.Image = append(outputgif.Image, palettedImage)
-		outputgif.Delay = append(outputgif.Delay, defaultOpts.frameDelay)
+	return anim.New(frames, delay), nil
+}
 
-		defaultOpts.frames--
+// GlitchAPNG creates a full color animated PNG, unlike GlitchGif the colors
+// aren't reduced to a 256 color palette
+func GlitchAPNG(srcImg image.Image, writer io.Writer, opts ...GlitchOption) (*apng.APNG, error) {
+	a, err := GlitchAnimation(srcImg, opts...)
+	if err != nil {
+		return nil, err
+	}
 
-		if defaultOpts.frames == 0 {
-			break
+	output := a.ToAPNG()
+	if writer != nil {
+		if err := apng.Encode(writer, output); err != nil {
+			return nil, err
 		}
+	}
 
-		output, err = defaultOpts.GlitchImage(srcImg)
+	return output, nil
+}
+
+// GlitchGif creates an animated GIF with a palette quantized from the glitched frames
+func GlitchGif(srcImg image.Image, writer io.Writer, opts ...GlitchOption) (*gif.GIF, error) {
+	defaultOpts, err := animationOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := GlitchSequence(srcImg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := time.Duration(defaultOpts.frameDelay) * 10 * time.Millisecond
+	outputgif, err := gifenc.Build(frames, []time.Duration{delay})
+	if err != nil {
+		return nil, err
 	}
 
 	if writer != nil {
-		err = gif.EncodeAll(writer, outputgif)
-		return outputgif, nil
+		if err := gif.EncodeAll(writer, outputgif); err != nil {
+			return nil, err
+		}
 	}
 
 	return outputgif, nil
@@ -199,18 +453,11 @@ func GlitchGif(srcImg image.Image, writer io.Writer, opts ...GlitchOption) (*gif
 
 // glitch an image with the specified options
 func GlitchWithOpts(srcImg image.Image, opts ...GlitchOption) (image.Image, error) {
-	seed, err := os.Hostname()
-	if err != nil {
-		seed = "unknown_333"
-	}
-
-	rand.New(rand.NewSource(randseed(seed)))
-
 	defaultOpts := &glitch_options{
 		brightness:   5.0,
 		glitchFactor: 5.0,
 		scanlines:    true,
-		seed:         seed,
+		iterations:   defaultIterations,
 		frames:       0,
 	}
 
@@ -225,6 +472,7 @@ func GlitchWithOpts(srcImg image.Image, opts ...GlitchOption) (image.Image, erro
 		}
 	}
 
+	defaultOpts.rng = NewRand(defaultOpts.seed)
 	return defaultOpts.GlitchImage(srcImg)
 }
 
@@ -242,16 +490,45 @@ func (g *glitch_options) GlitchImage(img image.Image) (image.Image, error) {
 		draw.Draw(output, bounds, imgq, bounds.Min, draw.Src)
 	}
 
-	glitchify(input, output, bounds, g.glitchFactor)
+	plan, err := g.nextPlan(bounds)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.apply(input, output); err != nil {
+		return nil, err
+	}
+	if g.recipe != nil {
+		g.recipe.record(g, plan)
+	}
+
 	effects.ApplyBrightness(output, g.brightness)
 
 	if g.scanlines {
 		effects.ApplyScanlines(output)
 	}
 
+	if g.blending {
+		blended, err := blend.Blend(img, output, g.blendMode, blend.Opacity(g.opacity), blend.Linear(g.blendLinear))
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(output, bounds, blended, bounds.Min, draw.Src)
+	}
+
 	return output, nil
 }
 
+// nextPlan is the next plan of the recipe being replayed, or a new one
+func (g *glitch_options) nextPlan(bounds image.Rectangle) (*Plan, error) {
+	if g.replay == nil {
+		return g.plan(bounds)
+	}
+
+	p := g.replay.Frames[g.replayed%len(g.replay.Frames)].clone()
+	g.replayed++
+	return p, nil
+}
+
 func GetColorPalette(img image.Image, level int) []color.Color {
 	pal := []color.Color{}
 	colors := quantize.Palette(img, level)
@@ -260,191 +537,3 @@ func GetColorPalette(img image.Image, level int) []color.Color {
 	}
 	return pal
 }
-
-func glitchify(input, output *image.RGBA, bounds image.Rectangle, glitchFactor float64) {
-	copyInput := image.NewRGBA(bounds)
-	copy(copyInput.Pix, input.Pix)
-
-	eightBitted := image.NewRGBA(bounds)
-	copy(eightBitted.Pix, input.Pix)
-	dither.EightBit(eightBitted, utils.Random(0, 255))
-
-	atkinsons := image.NewRGBA(bounds)
-	copy(atkinsons.Pix, input.Pix)
-	dither.Atkinsons(atkinsons, uint8(utils.Random(0, 255)))
-
-	bayer := image.NewRGBA(bounds)
-	copy(bayer.Pix, input.Pix)
-	dither.Bayer(bayer)
-
-	halftone := image.NewRGBA(bounds)
-	copy(halftone.Pix, input.Pix)
-	dither.Halftone(halftone, uint16(utils.Random(0, 255)))
-
-	floydsteinberg := image.NewRGBA(bounds)
-	copy(floydsteinberg.Pix, input.Pix)
-	dither.FloydSteinberg(floydsteinberg, uint8(utils.Random(0, 255)))
-
-	redOnly := image.NewRGBA(bounds)
-	effects.CopyChannel(redOnly, input, utils.Red)
-
-	greenOnly := image.NewRGBA(bounds)
-	effects.CopyChannel(greenOnly, input, utils.Green)
-
-	blueOnly := image.NewRGBA(bounds)
-	effects.CopyChannel(blueOnly, input, utils.Blue)
-
-	alphaMask := image.NewAlpha(bounds)
-	for i := range alphaMask.Pix {
-		alphaMask.Pix[i] = input.Pix[i*4]
-	}
-
-	srcs := []*image.RGBA{
-		eightBitted,
-		halftone,
-		redOnly,
-		greenOnly,
-		blueOnly,
-		copyInput,
-	}
-	srcNames := []string{
-		"8bit",
-		"halftone",
-		"red",
-		"green",
-		"blue",
-		"original",
-	}
-
-	wrapSlice := func(in, out *image.RGBA, op draw.Op) {
-		width, height := bounds.Max.X, bounds.Max.Y
-		maxOffset := int(glitchFactor / 100.0 * float64(width))
-
-		// Random image slice offsetting
-		for i := 0.0; i < glitchFactor; i++ {
-			startY := utils.Random(0, height)
-			chunkHeight := int(math.Min(float64(height-startY), float64(utils.Random(1, int(float64(height/2)*glitchFactor/100.0)))))
-			offset := utils.Random(-maxOffset, maxOffset)
-			effects.WrapSlice(out, in, offset, startY, chunkHeight, alphaMask, op)
-		}
-	}
-
-	transforms := []func(in, out *image.RGBA){
-		func(in, out *image.RGBA) {
-			newIn := image.NewRGBA(bounds)
-			copy(newIn.Pix, in.Pix)
-			dither.Atkinsons(newIn, uint8(utils.Random(64, 192)))
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = newIn.Pix[i*4]
-			}
-			wrapSlice(newIn, out, draw.Over)
-		},
-		func(in, out *image.RGBA) {
-			newIn := image.NewRGBA(bounds)
-			copy(newIn.Pix, in.Pix)
-			dither.EightBit(newIn, utils.Random(64, 192))
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = newIn.Pix[i*4]
-			}
-			wrapSlice(newIn, out, draw.Over)
-		},
-		func(in, out *image.RGBA) {
-			newIn := image.NewRGBA(bounds)
-			copy(newIn.Pix, in.Pix)
-			dither.Bayer(newIn)
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = newIn.Pix[i*4]
-			}
-			wrapSlice(newIn, out, draw.Over)
-		},
-		func(in, out *image.RGBA) {
-			newIn := image.NewRGBA(bounds)
-			copy(newIn.Pix, in.Pix)
-			dither.Halftone(newIn, uint16(utils.Random(64, 192)))
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = newIn.Pix[i*4]
-			}
-			wrapSlice(newIn, out, draw.Over)
-		},
-		func(in, out *image.RGBA) {
-			newIn := image.NewRGBA(bounds)
-			copy(newIn.Pix, in.Pix)
-			dither.FloydSteinberg(newIn, uint8(utils.Random(64, 192)))
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = newIn.Pix[i*4]
-			}
-			wrapSlice(newIn, out, draw.Over)
-		},
-		func(in, out *image.RGBA) { wrapSlice(in, out, draw.Over) },
-		func(in, out *image.RGBA) { wrapSlice(in, out, draw.Src) },
-		func(in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Red) },
-		func(in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Green) },
-		func(in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Blue) },
-		func(in, out *image.RGBA) {
-			for i := range alphaMask.Pix {
-				alphaMask.Pix[i] = in.Pix[i*4]
-			}
-		},
-	}
-	transformNames := []string{
-		"atkinsons",
-		"8bit",
-		"bayer",
-		"halftone",
-		"floydsteinberg",
-		"wrapOver",
-		"wrapSrc",
-		"copyRed",
-		"copyGreen",
-		"copyBlue",
-		"copyAlpha",
-	}
-
-	i := len(transforms)
-	for i > 0 {
-		destIdx := utils.Random(0, len(srcs))
-		srcIdx := utils.Random(0, len(srcs))
-		fIdx := utils.Random(0, len(transforms))
-		transforms[fIdx](srcs[srcIdx], srcs[destIdx])
-		debug("transform[%v] %v -> %v\n", transformNames[fIdx], srcNames[srcIdx], srcNames[destIdx])
-		destIdx = utils.Random(0, len(srcs))
-		fIdx = utils.Random(0, len(transforms))
-		transforms[fIdx](input, srcs[destIdx])
-
-		i--
-	}
-
-	for i, src := range srcs {
-		debug("transform[wrapOver] %v -> output\n", srcNames[i])
-		wrapSlice(src, output, draw.Over)
-	}
-
-	debug("reset alpha mask")
-	for i := range alphaMask.Pix {
-		alphaMask.Pix[i] = 255
-	}
-
-	finalOutput := image.NewRGBA(bounds)
-	copy(finalOutput.Pix, output.Pix)
-	debug("imageglitcher for final output")
-	imageglitcher(finalOutput, output, bounds, glitchFactor)
-}
-
-// The imageglitcher algorithm from airtight interactive
-func imageglitcher(inputData, outputData *image.RGBA, bounds image.Rectangle, glitchFactor float64) {
-	width, height := bounds.Max.X, bounds.Max.Y
-	maxOffset := int(glitchFactor / 100.0 * float64(width))
-	mask := image.NewUniform(color.Alpha{A: 255})
-
-	// Random image slice offsetting
-	for i := 0.0; i < glitchFactor*2; i++ {
-		startY := utils.Random(0, height)
-		chunkHeight := int(math.Min(float64(height-startY), float64(utils.Random(1, height/4))))
-		offset := utils.Random(-maxOffset, maxOffset)
-
-		effects.WrapSlice(outputData, inputData, offset, startY, chunkHeight, mask, draw.Src)
-	}
-
-	// Copy a random channel from the pristene original input data onto the slice-offsetted output data
-	effects.CopyChannel(outputData, inputData, utils.RandomChannel())
-}
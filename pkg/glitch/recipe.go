@@ -0,0 +1,240 @@
+package glitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"math/rand"
+
+	"pix/pkg/blend"
+	"pix/pkg/glitch/databend"
+	"pix/pkg/glitch/sonify"
+)
+
+// Recipe records everything a glitch did, one plan per frame. Replaying it
+// gives the same glitch on the same image and the same glitch scaled to the
+// size of another image.
+type Recipe struct {
+	Brightness float64    `json:"brightness"`
+	Scanlines  bool       `json:"scanlines"`
+	Palette    []string   `json:"palette,omitempty"`
+	Delay      int        `json:"delay,omitempty"`
+	Blend      *BlendStep `json:"blend,omitempty"`
+	Frames     []*Plan    `json:"frames"`
+}
+
+// BlendStep composites the glitch over the original image
+type BlendStep struct {
+	Mode    string  `json:"mode"`
+	Opacity float64 `json:"opacity"`
+	Linear  bool    `json:"linear,omitempty"`
+}
+
+// ReadRecipe reads a recipe saved with Write
+func ReadRecipe(r io.Reader) (*Recipe, error) {
+	var recipe Recipe
+	if err := json.NewDecoder(r).Decode(&recipe); err != nil {
+		return nil, fmt.Errorf("recipe: %w", err)
+	}
+	if len(recipe.Frames) == 0 {
+		return nil, fmt.Errorf("recipe has no frames")
+	}
+	if _, err := parsePalette(recipe.Palette); err != nil {
+		return nil, err
+	}
+	if recipe.Blend != nil {
+		if _, err := blend.ParseMode(recipe.Blend.Mode); err != nil {
+			return nil, err
+		}
+	}
+	return &recipe, nil
+}
+
+// Write saves the recipe as JSON
+func (r *Recipe) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Frame is a recipe for just frame i, wrapping around when the recipe has
+// fewer frames, for glitching the frames of an animation one at a time
+func (r *Recipe) Frame(i int) *Recipe {
+	frame := *r
+	frame.Frames = []*Plan{r.Frames[i%len(r.Frames)]}
+	return &frame
+}
+
+// Mutate returns a copy of the recipe with small changes for variations of a
+// glitch, amount goes from 0 for none to 1 for a lot. Thresholds and slices
+// are nudged, channels swapped and some transforms replaced by new ones.
+func (r *Recipe) Mutate(amount float64, rng *rand.Rand) (*Recipe, error) {
+	if amount < 0 || amount > 1 {
+		return nil, fmt.Errorf("mutate amount must be between 0 and 1")
+	}
+
+	out := *r
+	if r.Blend != nil {
+		b := *r.Blend
+		out.Blend = &b
+	}
+	out.Frames = make([]*Plan, len(r.Frames))
+	for i, p := range r.Frames {
+		out.Frames[i] = p.clone()
+		out.Frames[i].mutate(amount, rng)
+	}
+	return &out, nil
+}
+
+// record adds a glitched frame to the recipe
+func (r *Recipe) record(g *glitch_options, p *Plan) {
+	r.Brightness = g.brightness
+	r.Scanlines = g.scanlines
+	r.Delay = g.frameDelay
+	r.Blend = nil
+	if g.blending {
+		r.Blend = &BlendStep{g.blendMode.String(), g.opacity, g.blendLinear}
+	}
+	r.Palette = r.Palette[:0]
+	for _, c := range g.colors {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		r.Palette = append(r.Palette, fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B))
+	}
+	if len(r.Palette) == 0 {
+		r.Palette = nil
+	}
+	r.Frames = append(r.Frames, p)
+}
+
+func parsePalette(hex []string) ([]color.Color, error) {
+	var pal []color.Color
+	for _, h := range hex {
+		var c color.RGBA
+		if _, err := fmt.Sscanf(h, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+			return nil, fmt.Errorf("recipe: bad palette color %q", h)
+		}
+		c.A = 255
+		pal = append(pal, c)
+	}
+	return pal, nil
+}
+
+// apply runs the plan on output, the steps draw from input
+func (p *Plan) apply(input, output *image.RGBA) error {
+	bounds := output.Bounds()
+
+	if p.Databend != nil {
+		format, err := databend.ParseFormat(p.Databend.Format)
+		if err != nil {
+			return err
+		}
+		bent, err := databend.Bend(output, format, p.Databend.Intensity, rand.New(rand.NewSource(p.Databend.Seed)))
+		if err != nil {
+			return err
+		}
+		draw.Draw(output, bounds, bent, bent.Bounds().Min, draw.Src)
+	}
+
+	if p.Sonify != nil {
+		chain, err := sonify.ParseChain(p.Sonify.Chain)
+		if err != nil {
+			return err
+		}
+		order, err := sonify.ParseOrder(p.Sonify.Order)
+		if err != nil {
+			return err
+		}
+		sonified, err := sonify.Sonify(output, chain, sonify.Ordering(order))
+		if err != nil {
+			return err
+		}
+		draw.Draw(output, bounds, sonified, sonified.Bounds().Min, draw.Src)
+	}
+
+	if len(p.Steps) == 0 {
+		return nil
+	}
+	return p.execute(input, output)
+}
+
+func (p *Plan) clone() *Plan {
+	c := *p
+	c.Steps = make([]Step, len(p.Steps))
+	for i, s := range p.Steps {
+		if s.Params != nil {
+			params := Params{}
+			for k, v := range s.Params {
+				params[k] = v
+			}
+			s.Params = params
+		}
+		if s.Threshold != nil {
+			t := *s.Threshold
+			s.Threshold = &t
+		}
+		s.Slices = append([]Slice(nil), s.Slices...)
+		c.Steps[i] = s
+	}
+	if p.Databend != nil {
+		bend := *p.Databend
+		c.Databend = &bend
+	}
+	if p.Sonify != nil {
+		son := *p.Sonify
+		c.Sonify = &son
+	}
+	return &c
+}
+
+func (p *Plan) mutate(amount float64, rng *rand.Rand) {
+	jitter := func(v, spread int) int {
+		return v + int(math.Round(rng.NormFloat64()*amount*float64(spread)))
+	}
+
+	p.EightBit = clampInt(jitter(p.EightBit, 64), 0, 254)
+	p.Halftone = clampInt(jitter(p.Halftone, 64), 0, 254)
+	if p.Databend != nil && rng.Float64() < amount {
+		p.Databend.Seed = rng.Int63()
+	}
+
+	var candidates []Registration
+	for _, t := range Registered() {
+		if t.Weight > 0 {
+			candidates = append(candidates, t)
+		}
+	}
+
+	for i := range p.Steps {
+		s := &p.Steps[i]
+
+		// the steps that finish the output stay, the ones before can change
+		// into something else that makes its own choices when it runs
+		if s.Dst != "output" && len(candidates) > 0 && rng.Float64() < amount/2 {
+			*s = Step{
+				Transform: candidates[rng.Intn(len(candidates))].Name,
+				Src:       s.Src,
+				Dst:       s.Dst,
+				Seed:      rng.Int63(),
+			}
+			continue
+		}
+
+		if s.Threshold != nil {
+			t := clampInt(jitter(*s.Threshold, 64), 0, 255)
+			s.Threshold = &t
+		}
+		if s.Channel != "" && rng.Float64() < amount {
+			s.Channel = []string{"red", "green", "blue"}[rng.Intn(3)]
+		}
+		for j := range s.Slices {
+			sl := &s.Slices[j]
+			sl.Y = clampInt(jitter(sl.Y, p.Height/8), 0, max(0, p.Height-1))
+			sl.Height = clampInt(jitter(sl.Height, max(1, sl.Height/2)), 1, max(1, p.Height-sl.Y))
+			sl.Offset = jitter(sl.Offset, max(1, p.Width/16))
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package glitch
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"pix/pkg/blend"
+	"pix/pkg/glitch/databend"
+	"pix/pkg/glitch/sonify"
+)
+
+func glitchPix(t *testing.T, img image.Image, opts ...GlitchOption) []uint8 {
+	t.Helper()
+	out, err := GlitchWithOpts(img, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.(*image.RGBA).Pix
+}
+
+func TestRecipeReplay(t *testing.T) {
+	var recipe Recipe
+	want := glitchPix(t, gradient(), GlitchRecord(&recipe),
+		GlitchPalette([]color.Color{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.Black}))
+
+	// every random choice is in the recipe, the recorded steps say what they did
+	var slices, thresholds, channels int
+	for _, s := range recipe.Frames[0].Steps {
+		slices += len(s.Slices)
+		if s.Threshold != nil {
+			thresholds++
+		}
+		if s.Channel != "" {
+			channels++
+		}
+	}
+	if slices == 0 || channels != 1 {
+		t.Errorf("recorded %d slices, %d thresholds and %d channels", slices, thresholds, channels)
+	}
+
+	var buf bytes.Buffer
+	if err := recipe.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadRecipe(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a seed only the recipe can repeat the glitch
+	if got := glitchPix(t, gradient(), GlitchReplay(loaded)); !bytes.Equal(got, want) {
+		t.Error("replaying the recipe gave a different image")
+	}
+
+	// replaying keeps the recipe as it was
+	var again Recipe
+	glitchPix(t, gradient(), GlitchReplay(loaded), GlitchRecord(&again))
+	if !reflect.DeepEqual(again.Frames, loaded.Frames) {
+		t.Error("replaying recorded a different recipe")
+	}
+}
+
+func TestRecipeReplayScaled(t *testing.T) {
+	var recipe Recipe
+	glitchPix(t, gradient(), GlitchSeed("scale"), GlitchRecord(&recipe))
+
+	big := image.NewRGBA(image.Rect(0, 0, 160, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 160; x++ {
+			big.Set(x, y, gradient().At(x/2, y/2))
+		}
+	}
+
+	out, err := GlitchWithOpts(big, GlitchReplay(&recipe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds() != big.Bounds() {
+		t.Errorf("replay on a bigger image gave bounds %v", out.Bounds())
+	}
+
+	// a 2x image gets the slices at twice the size
+	small := recipe.Frames[0]
+	var replayed Recipe
+	glitchPix(t, big, GlitchReplay(&recipe), GlitchRecord(&replayed))
+	if !reflect.DeepEqual(replayed.Frames[0].Steps, small.Steps) {
+		t.Error("the recipe changed when replayed at another size")
+	}
+}
+
+func TestRecipeDatabendAndSonify(t *testing.T) {
+	chain, err := sonify.ParseChain("echo:0.001,0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recipe Recipe
+	want := glitchPix(t, gradient(), GlitchRecord(&recipe),
+		GlitchDatabend(databend.PNG, 0.5), GlitchSonify(chain, sonify.Columns))
+
+	p := recipe.Frames[0]
+	if p.Databend == nil || p.Sonify == nil || p.Sonify.Order != "columns" || len(p.Steps) != 0 {
+		t.Fatalf("recorded %+v", p)
+	}
+	if got := glitchPix(t, gradient(), GlitchReplay(&recipe)); !bytes.Equal(got, want) {
+		t.Error("replaying a databend and sonify gave a different image")
+	}
+}
+
+func TestRecipeMutate(t *testing.T) {
+	var recipe Recipe
+	want := glitchPix(t, gradient(), GlitchSeed("mutate"), GlitchRecord(&recipe))
+
+	same, err := recipe.Mutate(0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(same, &recipe) {
+		t.Error("mutating by 0 changed the recipe")
+	}
+
+	a, err := recipe.Mutate(0.3, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := recipe.Mutate(0.3, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same rng mutated differently")
+	}
+	if reflect.DeepEqual(a, &recipe) {
+		t.Error("mutating didn't change anything")
+	}
+	if len(a.Frames[0].Steps) != len(recipe.Frames[0].Steps) {
+		t.Error("mutating changed the number of steps")
+	}
+
+	// the original is left alone
+	if got := glitchPix(t, gradient(), GlitchReplay(&recipe)); !bytes.Equal(got, want) {
+		t.Error("mutating changed the original recipe")
+	}
+	if got := glitchPix(t, gradient(), GlitchReplay(a)); bytes.Equal(got, want) {
+		t.Error("a mutated recipe gave the same image")
+	}
+
+	if _, err := recipe.Mutate(2, rand.New(rand.NewSource(1))); err == nil {
+		t.Error("expected an error for amount 2")
+	}
+}
+
+func TestRecipeFrames(t *testing.T) {
+	var recipe Recipe
+	frames, err := GlitchSequence(gradient(), GlitchFrames(3), GlitchSeed("frames"), GlitchRecord(&recipe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipe.Frames) != 3 {
+		t.Fatalf("recorded %d frames, want 3", len(recipe.Frames))
+	}
+
+	replayed, err := GlitchSequence(gradient(), GlitchReplay(&recipe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 3 {
+		t.Fatalf("replayed %d frames, want 3", len(replayed))
+	}
+	for i := range frames {
+		if !bytes.Equal(frames[i].(*image.RGBA).Pix, replayed[i].(*image.RGBA).Pix) {
+			t.Errorf("frame %d replayed differently", i)
+		}
+	}
+
+	// frames of an animation are glitched one at a time
+	if got := glitchPix(t, gradient(), GlitchReplay(recipe.Frame(4))); !bytes.Equal(got, frames[1].(*image.RGBA).Pix) {
+		t.Error("frame 4 of a 3 frame recipe should be frame 1")
+	}
+}
+
+func TestRecipeBlend(t *testing.T) {
+	plain := glitchPix(t, gradient(), GlitchSeed("blend"))
+
+	var recipe Recipe
+	want := glitchPix(t, gradient(), GlitchSeed("blend"), GlitchBlend(blend.Multiply, 0.5), GlitchRecord(&recipe))
+	if bytes.Equal(plain, want) {
+		t.Error("blending didn't change the glitch")
+	}
+	if recipe.Blend == nil || recipe.Blend.Mode != "multiply" || recipe.Blend.Opacity != 0.5 {
+		t.Fatalf("recorded blend %+v", recipe.Blend)
+	}
+
+	var buf bytes.Buffer
+	if err := recipe.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadRecipe(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := glitchPix(t, gradient(), GlitchReplay(loaded)); !bytes.Equal(got, want) {
+		t.Error("replaying a blended recipe gave a different image")
+	}
+
+	// blending as light is kept in the recipe
+	var linear Recipe
+	lin := glitchPix(t, gradient(), GlitchSeed("blend"), GlitchBlend(blend.Multiply, 0.5), GlitchBlendLinear(true), GlitchRecord(&linear))
+	if bytes.Equal(lin, want) || !linear.Blend.Linear {
+		t.Errorf("linear blend recorded %+v", linear.Blend)
+	}
+	if got := glitchPix(t, gradient(), GlitchReplay(&linear)); !bytes.Equal(got, lin) {
+		t.Error("replaying a linear blend gave a different image")
+	}
+
+	// at 0 opacity only the original is left
+	out, err := GlitchWithOpts(gradient(), GlitchSeed("blend"), GlitchBlend(blend.Screen, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.(*image.RGBA).Pix, gradient().Pix) {
+		t.Error("a blend at 0 opacity changed the original")
+	}
+
+	if _, err := GlitchWithOpts(gradient(), GlitchBlend(blend.Normal, 1.5)); err == nil {
+		t.Error("expected an error for opacity 1.5")
+	}
+}
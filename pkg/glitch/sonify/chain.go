@@ -0,0 +1,190 @@
+package sonify
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chain is a list of effects applied in order
+type Chain []Effect
+
+// Apply runs every effect over the signal
+func (c Chain) Apply(signal []float64, sampleRate int) {
+	for _, e := range c {
+		e.Apply(signal, sampleRate)
+	}
+}
+
+// String gives the chain back in the syntax ParseChain reads
+func (c Chain) String() string {
+	s := make([]string, len(c))
+	for i, e := range c {
+		s[i] = e.String()
+	}
+	return strings.Join(s, ";")
+}
+
+// effect describes how an effect is written in a chain, optional values get
+// the defaults
+type effect struct {
+	usage    string
+	required int
+	defaults []float64
+	build    func(p []float64) (Effect, error)
+}
+
+func filter(kind FilterKind) effect {
+	return effect{
+		usage:    kind.String() + ":freq[,q]",
+		required: 1,
+		defaults: []float64{0.707},
+		build: func(p []float64) (Effect, error) {
+			if p[0] <= 0 {
+				return nil, fmt.Errorf("filter frequency must be above 0")
+			}
+			if p[1] <= 0 {
+				return nil, fmt.Errorf("filter q must be above 0")
+			}
+			return Biquad{kind, p[0], p[1]}, nil
+		},
+	}
+}
+
+var effects = map[string]effect{
+	"echo": {
+		usage:    "echo:delay,feedback[,mix]",
+		required: 2,
+		defaults: []float64{0.5},
+		build: func(p []float64) (Effect, error) {
+			if p[0] <= 0 {
+				return nil, fmt.Errorf("echo delay must be above 0")
+			}
+			if p[1] < 0 || p[1] >= 1 {
+				return nil, fmt.Errorf("echo feedback must be between 0 and 1")
+			}
+			return Echo{p[0], p[1], p[2]}, checkMix(p[2])
+		},
+	},
+	"reverb": {
+		usage:    "reverb:size[,mix]",
+		required: 1,
+		defaults: []float64{0.5},
+		build: func(p []float64) (Effect, error) {
+			if p[0] < 0 || p[0] > 1 {
+				return nil, fmt.Errorf("reverb size must be between 0 and 1")
+			}
+			return Reverb{p[0], p[1]}, checkMix(p[1])
+		},
+	},
+	"lowpass":  filter(LowPass),
+	"highpass": filter(HighPass),
+	"bandpass": filter(BandPass),
+	"notch":    filter(Notch),
+	"bitcrush": {
+		usage:    "bitcrush:bits",
+		required: 1,
+		build: func(p []float64) (Effect, error) {
+			if p[0] < 1 || p[0] > 16 || p[0] != float64(int(p[0])) {
+				return nil, fmt.Errorf("bitcrush bits must be a whole number between 1 and 16")
+			}
+			return Bitcrush{int(p[0])}, nil
+		},
+	},
+	"downsample": {
+		usage:    "downsample:factor",
+		required: 1,
+		build: func(p []float64) (Effect, error) {
+			if p[0] < 1 || p[0] != float64(int(p[0])) {
+				return nil, fmt.Errorf("downsample factor must be a whole number of at least 1")
+			}
+			return Downsample{int(p[0])}, nil
+		},
+	},
+	"chorus": {
+		usage:    "chorus:rate,depth[,mix]",
+		required: 2,
+		defaults: []float64{0.5},
+		build: func(p []float64) (Effect, error) {
+			if p[0] < 0 || p[1] < 0 {
+				return nil, fmt.Errorf("chorus rate and depth cannot be negative")
+			}
+			return Chorus{p[0], p[1], p[2]}, checkMix(p[2])
+		},
+	},
+	"phaser": {
+		usage:    "phaser:rate[,feedback[,mix]]",
+		required: 1,
+		defaults: []float64{0.5, 0.5},
+		build: func(p []float64) (Effect, error) {
+			if p[0] < 0 {
+				return nil, fmt.Errorf("phaser rate cannot be negative")
+			}
+			if p[1] < 0 || p[1] >= 1 {
+				return nil, fmt.Errorf("phaser feedback must be between 0 and 1")
+			}
+			return Phaser{p[0], p[1], p[2]}, checkMix(p[2])
+		},
+	},
+}
+
+func checkMix(m float64) error {
+	if m < 0 || m > 1 {
+		return fmt.Errorf("mix must be between 0 and 1")
+	}
+	return nil
+}
+
+// Effects lists the effects a chain can use
+func Effects() []string {
+	var names []string
+	for name := range effects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseChain parses effects separated by semicolons, each effect is its name
+// and comma separated values, eg "echo:0.3,0.5;bitcrush:4"
+func ParseChain(s string) (Chain, error) {
+	var chain Chain
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, args, _ := strings.Cut(part, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		e, ok := effects[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown sonify effect %q: must be one of [%s]", name, strings.Join(Effects(), "|"))
+		}
+
+		var params []float64
+		if strings.TrimSpace(args) != "" {
+			for _, a := range strings.Split(args, ",") {
+				v, err := strconv.ParseFloat(strings.TrimSpace(a), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s: bad value %q, usage %s", name, a, e.usage)
+				}
+				params = append(params, v)
+			}
+		}
+
+		if len(params) < e.required || len(params) > e.required+len(e.defaults) {
+			return nil, fmt.Errorf("%s: wrong number of values, usage %s", name, e.usage)
+		}
+		params = append(params, e.defaults[len(params)-e.required:]...)
+
+		effect, err := e.build(params)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		chain = append(chain, effect)
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,278 @@
+package sonify
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Effect processes a signal in place, times are in seconds at sampleRate
+type Effect interface {
+	Apply(signal []float64, sampleRate int)
+	// String gives the effect back in chain syntax
+	String() string
+}
+
+// Echo repeats the signal after Delay seconds, every repeat is Feedback times
+// quieter and Mix sets how much of the echoes is heard
+type Echo struct {
+	Delay    float64
+	Feedback float64
+	Mix      float64
+}
+
+func (e Echo) Apply(signal []float64, sampleRate int) {
+	d := int(e.Delay * float64(sampleRate))
+	if d < 1 {
+		return
+	}
+
+	wet := make([]float64, len(signal))
+	for i, x := range signal {
+		wet[i] = x
+		if i >= d {
+			wet[i] += e.Feedback * wet[i-d]
+		}
+	}
+	mix(signal, wet, e.Mix)
+}
+
+func (e Echo) String() string {
+	return format("echo", e.Delay, e.Feedback, e.Mix)
+}
+
+// Reverb is a Schroeder reverb, four damped comb filters into two allpass
+// filters. Size goes from 0 to 1 and makes the tail longer.
+type Reverb struct {
+	Size float64
+	Mix  float64
+}
+
+// comb and allpass lengths from freeverb, tuned for 44.1kHz
+var (
+	combLengths    = []int{1116, 1188, 1277, 1356}
+	allpassLengths = []int{556, 441}
+)
+
+func (r Reverb) Apply(signal []float64, sampleRate int) {
+	scale := float64(sampleRate) / 44100
+	feedback := 0.7 + 0.28*r.Size
+	const damp = 0.2
+
+	wet := make([]float64, len(signal))
+	for _, l := range combLengths {
+		buf := make([]float64, max(1, int(float64(l)*scale)))
+		filter := 0.0
+		for i, x := range signal {
+			j := i % len(buf)
+			out := buf[j]
+			filter = out*(1-damp) + filter*damp
+			buf[j] = x + filter*feedback
+			wet[i] += out / float64(len(combLengths))
+		}
+	}
+
+	for _, l := range allpassLengths {
+		buf := make([]float64, max(1, int(float64(l)*scale)))
+		for i, x := range wet {
+			j := i % len(buf)
+			out := buf[j]
+			buf[j] = x + out*0.5
+			wet[i] = out - x
+		}
+	}
+
+	mix(signal, wet, r.Mix)
+}
+
+func (r Reverb) String() string {
+	return format("reverb", r.Size, r.Mix)
+}
+
+// FilterKind is the response of a biquad filter
+type FilterKind int
+
+const (
+	LowPass FilterKind = iota
+	HighPass
+	BandPass
+	Notch
+)
+
+var filterNames = []string{"lowpass", "highpass", "bandpass", "notch"}
+
+func (k FilterKind) String() string {
+	if k < LowPass || k > Notch {
+		return fmt.Sprintf("FilterKind(%d)", int(k))
+	}
+	return filterNames[k]
+}
+
+// Biquad is a second order filter from the audio EQ cookbook, Freq is in Hz
+// and Q sets how sharp the filter is
+type Biquad struct {
+	Kind FilterKind
+	Freq float64
+	Q    float64
+}
+
+func (f Biquad) Apply(signal []float64, sampleRate int) {
+	// frequencies past nyquist alias, keep them just under it
+	freq := min(f.Freq, 0.49*float64(sampleRate))
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*f.Q)
+
+	var b0, b1, b2 float64
+	switch f.Kind {
+	case LowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+	case HighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+	case BandPass:
+		b0, b1, b2 = alpha, 0, -alpha
+	case Notch:
+		b0, b1, b2 = 1, -2*cos, 1
+	}
+	a0, a1, a2 := 1+alpha, -2*cos, 1-alpha
+
+	var x1, x2, y1, y2 float64
+	for i, x := range signal {
+		y := (b0*x + b1*x1 + b2*x2 - a1*y1 - a2*y2) / a0
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		signal[i] = y
+	}
+}
+
+func (f Biquad) String() string {
+	return format(f.Kind.String(), f.Freq, f.Q)
+}
+
+// Bitcrush reduces the signal to Bits bits, pixels have 8 so less than that
+// posterizes the image
+type Bitcrush struct {
+	Bits int
+}
+
+func (b Bitcrush) Apply(signal []float64, _ int) {
+	if b.Bits < 1 {
+		return
+	}
+	levels := float64(int(1)<<b.Bits - 1)
+	for i, x := range signal {
+		signal[i] = math.Round((x+1)/2*levels)/levels*2 - 1
+	}
+}
+
+func (b Bitcrush) String() string {
+	return format("bitcrush", float64(b.Bits))
+}
+
+// Downsample holds every Factor-th sample, like playing back at a lower
+// sample rate without filtering
+type Downsample struct {
+	Factor int
+}
+
+func (d Downsample) Apply(signal []float64, _ int) {
+	if d.Factor < 2 {
+		return
+	}
+	for i := range signal {
+		signal[i] = signal[i-i%d.Factor]
+	}
+}
+
+func (d Downsample) String() string {
+	return format("downsample", float64(d.Factor))
+}
+
+// chorusDelay is the delay the chorus sweeps around, in seconds
+const chorusDelay = 0.015
+
+// Chorus mixes in a copy of the signal with a delay that sweeps Rate times
+// a second over Depth seconds, the pixels wobble sideways
+type Chorus struct {
+	Rate  float64
+	Depth float64
+	Mix   float64
+}
+
+func (c Chorus) Apply(signal []float64, sampleRate int) {
+	sr := float64(sampleRate)
+	src := append([]float64(nil), signal...)
+
+	wet := make([]float64, len(signal))
+	for i := range signal {
+		lfo := (1 + math.Sin(2*math.Pi*c.Rate*float64(i)/sr)) / 2
+		pos := float64(i) - (chorusDelay+c.Depth*lfo)*sr
+		if pos < 0 {
+			wet[i] = src[i]
+			continue
+		}
+		j, frac := int(pos), pos-math.Floor(pos)
+		wet[i] = src[j]*(1-frac) + src[min(j+1, len(src)-1)]*frac
+	}
+	mix(signal, wet, c.Mix)
+}
+
+func (c Chorus) String() string {
+	return format("chorus", c.Rate, c.Depth, c.Mix)
+}
+
+// phaser sweep range in Hz
+const (
+	phaserMin = 200
+	phaserMax = 4000
+)
+
+// Phaser sweeps notches through the signal with a chain of allpass filters,
+// Rate is the sweeps per second and Feedback deepens the notches
+type Phaser struct {
+	Rate     float64
+	Feedback float64
+	Mix      float64
+}
+
+func (p Phaser) Apply(signal []float64, sampleRate int) {
+	sr := float64(sampleRate)
+	var x1, y1 [4]float64
+	last := 0.0
+
+	wet := make([]float64, len(signal))
+	for i, x := range signal {
+		lfo := (1 + math.Sin(2*math.Pi*p.Rate*float64(i)/sr)) / 2
+		t := math.Tan(math.Pi * (phaserMin + (phaserMax-phaserMin)*lfo) / sr)
+		a := (1 - t) / (1 + t)
+
+		v := x + last*p.Feedback
+		for s := range x1 {
+			y := a*v + x1[s] - a*y1[s]
+			x1[s], y1[s] = v, y
+			v = y
+		}
+		last = v
+		wet[i] = v
+	}
+	mix(signal, wet, p.Mix)
+}
+
+func (p Phaser) String() string {
+	return format("phaser", p.Rate, p.Feedback, p.Mix)
+}
+
+// mix blends wet into signal
+func mix(signal, wet []float64, amount float64) {
+	for i := range signal {
+		signal[i] = signal[i]*(1-amount) + wet[i]*amount
+	}
+}
+
+func format(name string, params ...float64) string {
+	s := make([]string, len(params))
+	for i, p := range params {
+		s[i] = strconv.FormatFloat(p, 'g', -1, 64)
+	}
+	return name + ":" + strings.Join(s, ",")
+}
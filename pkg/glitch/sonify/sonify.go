@@ -0,0 +1,184 @@
+// Package sonify glitches images like loading their raw bytes into an audio
+// editor does. The pixels are read as one long signal, run through audio
+// effects such as echo, reverb or a bitcrusher and written back, so the
+// effects smear along the rows (or columns) and bleed between channels.
+// Everything is deterministic, the same chain always gives the same image.
+package sonify
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+)
+
+// DefaultSampleRate is the rate the pixel stream is played at, time based
+// parameters like the echo delay are in seconds of it
+const DefaultSampleRate = 44100
+
+// Order is how the pixels are laid out in the signal
+type Order int
+
+const (
+	// Rows interleaves the channels row after row, what opening the raw data
+	// in an audio editor gives
+	Rows Order = iota
+	// Columns interleaves the channels column after column so effects run down the image
+	Columns
+	// Planar plays all the red, then the green, then the blue so the
+	// channels don't bleed into each other
+	Planar
+)
+
+func (o Order) String() string {
+	switch o {
+	case Rows:
+		return "rows"
+	case Columns:
+		return "columns"
+	case Planar:
+		return "planar"
+	}
+	return fmt.Sprintf("Order(%d)", int(o))
+}
+
+// ParseOrder parses a pixel order name, [rows|columns|planar]
+func ParseOrder(s string) (Order, error) {
+	switch strings.ToLower(s) {
+	case "rows", "row":
+		return Rows, nil
+	case "columns", "column", "cols":
+		return Columns, nil
+	case "planar", "channels":
+		return Planar, nil
+	}
+	return Rows, fmt.Errorf("unknown sonify order %q: must be one of [rows|columns|planar]", s)
+}
+
+type options struct {
+	order      Order
+	sampleRate int
+}
+
+// Option changes how the pixels are turned into a signal
+type Option func(o *options) error
+
+// Ordering sets the order the pixels are played in, rows by default
+func Ordering(order Order) Option {
+	return func(o *options) error {
+		if order < Rows || order > Planar {
+			return fmt.Errorf("unknown sonify order %v", order)
+		}
+		o.order = order
+		return nil
+	}
+}
+
+// SampleRate sets the rate the pixels are played at, 44100 by default
+func SampleRate(n int) Option {
+	return func(o *options) error {
+		if n < 1000 {
+			return fmt.Errorf("sample rate must be at least 1000")
+		}
+		o.sampleRate = n
+		return nil
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		order:      Rows,
+		sampleRate: DefaultSampleRate,
+	}
+
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Sonify runs the pixels of img through the chain, alpha is left alone
+func Sonify(img image.Image, chain Chain, opts ...Option) (*image.NRGBA, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := toNRGBA(img)
+	offsets := o.offsets(out)
+
+	signal := make([]float64, len(offsets))
+	for i, off := range offsets {
+		signal[i] = toSample(out.Pix[off])
+	}
+
+	chain.Apply(signal, o.sampleRate)
+
+	for i, off := range offsets {
+		out.Pix[off] = fromSample(signal[i])
+	}
+	return out, nil
+}
+
+// offsets lists where every sample of the signal lives in the image
+func (o *options) offsets(img *image.NRGBA) []int {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	offsets := make([]int, 0, w*h*3)
+
+	switch o.order {
+	case Columns:
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				i := y*img.Stride + x*4
+				offsets = append(offsets, i, i+1, i+2)
+			}
+		}
+	case Planar:
+		for c := 0; c < 3; c++ {
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					offsets = append(offsets, y*img.Stride+x*4+c)
+				}
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := y*img.Stride + x*4
+				offsets = append(offsets, i, i+1, i+2)
+			}
+		}
+	}
+
+	return offsets
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Src)
+	return out
+}
+
+// toSample maps a byte to -1 - 1 like 8 bit audio
+func toSample(v uint8) float64 {
+	return float64(v)/127.5 - 1
+}
+
+// fromSample maps a sample back to a byte, clipping like an overdriven signal
+func fromSample(s float64) uint8 {
+	v := (s + 1) * 127.5
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
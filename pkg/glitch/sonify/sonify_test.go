@@ -0,0 +1,229 @@
+package sonify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 5), uint8(x ^ y), uint8(200 + y)})
+		}
+	}
+	return img
+}
+
+func TestParseChain(t *testing.T) {
+	chain, err := ParseChain("echo:0.3,0.5; bitcrush:4;LOWPASS:2000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "echo:0.3,0.5,0.5;bitcrush:4;lowpass:2000,0.707"
+	if chain.String() != want {
+		t.Errorf("got %q, want %q", chain.String(), want)
+	}
+
+	again, err := ParseChain(chain.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != want {
+		t.Errorf("chain didn't survive a round trip: %q", again.String())
+	}
+
+	for _, bad := range []string{
+		"wobble:1",
+		"echo:0.3",
+		"echo:0.3,0.5,0.5,1",
+		"echo:0.3,x",
+		"echo:0.3,1.5",
+		"bitcrush:2.5",
+		"reverb:0.5,2",
+		"lowpass:-10",
+	} {
+		if _, err := ParseChain(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestSonifyEmptyChain(t *testing.T) {
+	src := testImage()
+	out, err := Sonify(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Pix, src.Pix) {
+		t.Error("an empty chain changed the image")
+	}
+}
+
+func TestSonifyDeterministic(t *testing.T) {
+	chain, err := ParseChain("echo:0.01,0.6;reverb:0.8;chorus:3,0.002;phaser:1;highpass:500")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Sonify(testImage(), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Sonify(testImage(), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Error("the same chain gave different images")
+	}
+	if bytes.Equal(a.Pix, testImage().Pix) {
+		t.Error("the chain didn't change the image")
+	}
+
+	// alpha isn't part of the signal
+	for i := 3; i < len(a.Pix); i += 4 {
+		if a.Pix[i] != testImage().Pix[i] {
+			t.Fatalf("alpha changed at %d", i)
+		}
+	}
+}
+
+func TestBitcrush(t *testing.T) {
+	out, err := Sonify(testImage(), Chain{Bitcrush{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range out.Pix {
+		if i%4 != 3 && v != 0 && v != 255 {
+			t.Fatalf("1 bit left value %d", v)
+		}
+	}
+}
+
+func TestDownsampleOrder(t *testing.T) {
+	src := testImage()
+
+	// in column order the held samples run down the image
+	out, err := Sonify(src, Chain{Downsample{48 * 3}}, Ordering(Columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 48; y++ {
+		if out.NRGBAAt(5, y).R != src.NRGBAAt(5, 0).R {
+			t.Fatalf("column 5 row %d wasn't held", y)
+		}
+	}
+
+	// and in planar order one channel never leaks into another, the planes
+	// are a multiple of the factor long
+	out, err = Sonify(src, Chain{Downsample{8}}, Ordering(Planar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(out.Pix); i += 4 {
+		if out.Pix[i+1]%5 != 0 {
+			t.Fatalf("green got a value %d from another channel", out.Pix[i+1])
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	signal := make([]float64, 100)
+	signal[0] = 1
+	Echo{Delay: 10.0 / DefaultSampleRate, Feedback: 0.5, Mix: 1}.Apply(signal, DefaultSampleRate)
+
+	for i, want := range map[int]float64{0: 1, 10: 0.5, 20: 0.25, 5: 0} {
+		if math.Abs(signal[i]-want) > 1e-9 {
+			t.Errorf("sample %d: got %v, want %v", i, signal[i], want)
+		}
+	}
+}
+
+func TestBiquad(t *testing.T) {
+	// a highpass removes a constant signal and a lowpass removes the
+	// fastest one there is
+	flat := make([]float64, 4000)
+	fast := make([]float64, 4000)
+	for i := range flat {
+		flat[i] = 0.5
+		fast[i] = float64(1 - 2*(i%2))
+	}
+
+	Biquad{HighPass, 1000, 0.707}.Apply(flat, DefaultSampleRate)
+	Biquad{LowPass, 1000, 0.707}.Apply(fast, DefaultSampleRate)
+
+	if math.Abs(flat[len(flat)-1]) > 0.01 {
+		t.Errorf("highpass left %v of a constant", flat[len(flat)-1])
+	}
+	if math.Abs(fast[len(fast)-1]) > 0.01 {
+		t.Errorf("lowpass left %v of nyquist", fast[len(fast)-1])
+	}
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	src := testImage()
+
+	for _, order := range []Order{Rows, Columns, Planar} {
+		var buf bytes.Buffer
+		if err := Export(&buf, src, Ordering(order)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the edited file is imported over a blank image of the same size
+		ref := image.NewNRGBA(src.Bounds())
+		copy(ref.Pix, src.Pix)
+		for i := 0; i < len(ref.Pix); i += 4 {
+			ref.Pix[i], ref.Pix[i+1], ref.Pix[i+2] = 0, 0, 0
+		}
+
+		out, err := Import(&buf, ref, Ordering(order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Pix, src.Pix) {
+			t.Errorf("%v: wav round trip changed the image", order)
+		}
+	}
+}
+
+func TestImport16Bit(t *testing.T) {
+	// a stereo 16 bit file, like an editor saves, with only two samples
+	var data bytes.Buffer
+	for _, s := range []int16{32767, 0, -32768, 0} {
+		binary.Write(&data, binary.LittleEndian, s)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(wavPCM), uint16(2), uint32(44100), uint32(44100 * 4), uint16(4), uint16(16)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{1, 2, 3, 0})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+
+	ref := testImage()
+	out, err := Import(&buf, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Pix[0] != 255 || out.Pix[1] != 0 {
+		t.Errorf("got samples %d %d, want 255 0", out.Pix[0], out.Pix[1])
+	}
+	if !bytes.Equal(out.Pix[2:], ref.Pix[2:]) {
+		t.Error("pixels past the end of the file changed")
+	}
+}
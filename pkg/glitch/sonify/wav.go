@@ -0,0 +1,187 @@
+package sonify
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// wav format codes
+const (
+	wavPCM   = 1
+	wavFloat = 3
+)
+
+// Export writes the pixels of img as a mono 8 bit WAV, every byte of the
+// image is one sample so the file can be edited in any audio editor and
+// brought back with Import
+func Export(w io.Writer, img image.Image, opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	src := toNRGBA(img)
+	offsets := o.offsets(src)
+
+	data := make([]byte, len(offsets))
+	for i, off := range offsets {
+		data[i] = src.Pix[off]
+	}
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)+len(data)%2))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], wavPCM)
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(o.sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(o.sampleRate)) // bytes per second
+	binary.LittleEndian.PutUint16(header[32:], 1)                    // block align
+	binary.LittleEndian.PutUint16(header[34:], 8)                    // bits per sample
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	// chunks are padded to an even length
+	if len(data)%2 == 1 {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+// Import reads a WAV back into the pixels of ref, which gives the size and
+// alpha. Editors often save 16 bit or float files so any PCM or float WAV is
+// read, only the first channel is used. A short file leaves the rest of the
+// pixels as they are in ref and extra samples are dropped.
+func Import(r io.Reader, ref image.Image, opts ...Option) (*image.NRGBA, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := readWAV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	out := toNRGBA(ref)
+	for i, off := range o.offsets(out) {
+		if i >= len(samples) {
+			break
+		}
+		out.Pix[off] = fromSample(samples[i])
+	}
+	return out, nil
+}
+
+type wavFormat struct {
+	code     uint16
+	channels int
+	bits     int
+}
+
+// readWAV reads the first channel of a WAV as samples from -1 to 1
+func readWAV(r io.Reader) ([]float64, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("wav: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, errors.New("wav: not a wav file")
+	}
+
+	var format *wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, errors.New("wav: no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			b := make([]byte, size)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return nil, fmt.Errorf("wav: %w", err)
+			}
+			if len(b) < 16 {
+				return nil, errors.New("wav: fmt chunk too short")
+			}
+			format = &wavFormat{
+				code:     binary.LittleEndian.Uint16(b[0:]),
+				channels: int(binary.LittleEndian.Uint16(b[2:])),
+				bits:     int(binary.LittleEndian.Uint16(b[14:])),
+			}
+			// extensible files keep the real format in the sub format guid
+			if format.code == 0xfffe && len(b) >= 26 {
+				format.code = binary.LittleEndian.Uint16(b[24:])
+			}
+		case "data":
+			if format == nil {
+				return nil, errors.New("wav: data before fmt chunk")
+			}
+			b := make([]byte, size)
+			n, err := io.ReadFull(r, b)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("wav: %w", err)
+			}
+			// some tools write a wrong size when streaming, use what is there
+			return format.decode(b[:n])
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, fmt.Errorf("wav: %w", err)
+			}
+			continue
+		}
+
+		if size%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, fmt.Errorf("wav: %w", err)
+			}
+		}
+	}
+}
+
+func (f *wavFormat) decode(data []byte) ([]float64, error) {
+	width := f.bits / 8
+	if f.channels < 1 || width < 1 {
+		return nil, fmt.Errorf("wav: bad format, %d channels of %d bits", f.channels, f.bits)
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case f.code == wavPCM && f.bits == 8:
+		sample = func(b []byte) float64 { return toSample(b[0]) }
+	case f.code == wavPCM && f.bits == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case f.code == wavPCM && f.bits == 24:
+		sample = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / 8388608
+		}
+	case f.code == wavPCM && f.bits == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648 }
+	case f.code == wavFloat && f.bits == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case f.code == wavFloat && f.bits == 64:
+		sample = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return nil, fmt.Errorf("wav: unsupported format %d with %d bits", f.code, f.bits)
+	}
+
+	frame := width * f.channels
+	samples := make([]float64, len(data)/frame)
+	for i := range samples {
+		samples[i] = sample(data[i*frame:])
+	}
+	return samples, nil
+}
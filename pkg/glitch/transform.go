@@ -0,0 +1,513 @@
+package glitch
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"pix/pkg/glitch/dither"
+	"pix/pkg/glitch/effects"
+	"pix/pkg/glitch/utils"
+)
+
+// Params are the settings of a transform, like the threshold range of a dither
+type Params map[string]float64
+
+// Context is what a transform gets for one step. The mask is shared by every
+// step of a glitch, the wrap transforms only draw where it is set and some
+// transforms change it.
+type Context struct {
+	Bounds image.Rectangle
+	Factor float64
+	Mask   *image.Alpha
+	Params Params
+	Rand   *rand.Rand
+
+	// the step being run, random choices are recorded in it or read back
+	// from it when it is replayed, scaled from the size it was recorded at
+	step   *Step
+	sx, sy float64
+}
+
+// Intn returns a random int in [min, max), or min when the range is empty
+func (c *Context) Intn(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + c.Rand.Intn(max-min)
+}
+
+// Threshold picks a threshold in [min, max), or the one the step recorded
+func (c *Context) Threshold(min, max int) int {
+	if c.step != nil && c.step.Threshold != nil {
+		return *c.step.Threshold
+	}
+	t := c.Intn(min, max)
+	if c.step != nil {
+		c.step.Threshold = &t
+	}
+	return t
+}
+
+// Channel picks a random color channel, or the one the step recorded, alpha is left out
+func (c *Context) Channel() utils.Channel {
+	if c.step != nil {
+		if ch, ok := channelNames[c.step.Channel]; ok {
+			return ch
+		}
+	}
+	ch := []utils.Channel{utils.Red, utils.Green, utils.Blue}[c.Rand.Intn(3)]
+	if c.step != nil {
+		for name, v := range channelNames {
+			if v == ch {
+				c.step.Channel = name
+			}
+		}
+	}
+	return ch
+}
+
+var channelNames = map[string]utils.Channel{
+	"red":   utils.Red,
+	"green": utils.Green,
+	"blue":  utils.Blue,
+}
+
+// Slice is a band of rows that is shifted sideways
+type Slice struct {
+	Y      int `json:"y"`
+	Height int `json:"height"`
+	Offset int `json:"offset"`
+}
+
+// Slices returns the slices from fn, or the ones the step recorded scaled to the image
+func (c *Context) Slices(fn func() []Slice) []Slice {
+	if c.step == nil || c.step.Slices == nil {
+		slices := fn()
+		if c.step != nil {
+			c.step.Slices = slices
+		}
+		return slices
+	}
+
+	height := c.Bounds.Max.Y
+	slices := make([]Slice, len(c.step.Slices))
+	for i, s := range c.step.Slices {
+		y := clampInt(int(math.Round(float64(s.Y)*c.sy)), 0, height-1)
+		slices[i] = Slice{
+			Y:      y,
+			Height: clampInt(int(math.Round(float64(s.Height)*c.sy)), 1, height-y),
+			Offset: int(math.Round(float64(s.Offset) * c.sx)),
+		}
+	}
+	return slices
+}
+
+// Transform draws from in onto out, all randomness has to come from the
+// context so a step can be replayed
+type Transform interface {
+	Apply(ctx *Context, in, out *image.RGBA)
+}
+
+// TransformFunc lets a plain function be a Transform
+type TransformFunc func(ctx *Context, in, out *image.RGBA)
+
+func (f TransformFunc) Apply(ctx *Context, in, out *image.RGBA) {
+	f(ctx, in, out)
+}
+
+// Registration is a transform and how it is picked, transforms are picked
+// at random in proportion to their weight and a weight of 0 is only run when
+// asked for
+type Registration struct {
+	Name      string
+	Transform Transform
+	Weight    float64
+	Params    Params
+}
+
+var registry struct {
+	sync.RWMutex
+	transforms []Registration
+}
+
+// Register adds a transform that glitches can pick from
+func Register(r Registration) error {
+	if r.Name == "" || r.Transform == nil {
+		return fmt.Errorf("transform needs a name and a transform")
+	}
+	if r.Weight < 0 {
+		return fmt.Errorf("transform %s: weight cannot be negative", r.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	for _, t := range registry.transforms {
+		if strings.EqualFold(t.Name, r.Name) {
+			return fmt.Errorf("transform %s is already registered", r.Name)
+		}
+	}
+	registry.transforms = append(registry.transforms, r)
+	return nil
+}
+
+// Registered lists the transforms in the order they were registered
+func Registered() []Registration {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Registration(nil), registry.transforms...)
+}
+
+func lookup(name string) (Registration, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, t := range registry.transforms {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return Registration{}, false
+}
+
+// Step is one transform that ran with everything needed to run it again.
+// The built in transforms record the random choices they made, anything else
+// they need comes from the seed.
+type Step struct {
+	Transform string  `json:"transform"`
+	Src       string  `json:"src"`
+	Dst       string  `json:"dst"`
+	Seed      int64   `json:"seed"`
+	Params    Params  `json:"params,omitempty"`
+	Threshold *int    `json:"threshold,omitempty"`
+	Channel   string  `json:"channel,omitempty"`
+	Slices    []Slice `json:"slices,omitempty"`
+}
+
+func (s Step) String() string {
+	str := fmt.Sprintf("transform[%v] %v -> %v seed=%d", s.Transform, s.Src, s.Dst, s.Seed)
+	if s.Threshold != nil {
+		str += fmt.Sprintf(" threshold=%d", *s.Threshold)
+	}
+	if s.Channel != "" {
+		str += " channel=" + s.Channel
+	}
+	if len(s.Slices) > 0 {
+		str += fmt.Sprintf(" slices=%d", len(s.Slices))
+	}
+	keys := make([]string, 0, len(s.Params))
+	for k := range s.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		str += fmt.Sprintf(" %s=%v", k, s.Params[k])
+	}
+	return str
+}
+
+// Plan is everything done to glitch one image, running it again on the same
+// image gives the same result and on another image the slices are scaled to
+// its size. The thresholds set up the 8bit and halftone sources the steps
+// draw between.
+type Plan struct {
+	Width    int         `json:"width"`
+	Height   int         `json:"height"`
+	Factor   float64     `json:"factor"`
+	EightBit int         `json:"8bit"`
+	Halftone int         `json:"halftone"`
+	Steps    []Step      `json:"steps,omitempty"`
+	Databend *BendStep   `json:"databend,omitempty"`
+	Sonify   *SonifyStep `json:"sonify,omitempty"`
+}
+
+// BendStep is a databend, the seed picks the corrupted bytes
+type BendStep struct {
+	Format    string  `json:"format"`
+	Intensity float64 `json:"intensity"`
+	Seed      int64   `json:"seed"`
+}
+
+// SonifyStep is a sonify effect chain
+type SonifyStep struct {
+	Chain string `json:"chain"`
+	Order string `json:"order"`
+}
+
+// the images steps draw between, input is the image before glitching and
+// output is the result
+var sourceNames = []string{"8bit", "halftone", "red", "green", "blue", "original"}
+
+// plan picks the steps of one glitch of an image of the given size
+func (g *glitch_options) plan(bounds image.Rectangle) (*Plan, error) {
+	p := &Plan{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Factor:   g.glitchFactor,
+		EightBit: g.rng.Intn(255),
+		Halftone: g.rng.Intn(255),
+	}
+
+	if g.databend {
+		p.Databend = &BendStep{g.databendFormat.String(), g.databendIntensity, g.rng.Int63()}
+	}
+	if g.sonify {
+		p.Sonify = &SonifyStep{g.sonifyFx.String(), g.sonifyOrder.String()}
+	}
+	if g.databend || g.sonify {
+		return p, nil
+	}
+
+	var candidates []Registration
+	var weights []float64
+	total := 0.0
+	for _, t := range Registered() {
+		w, ok := g.weights[strings.ToLower(t.Name)]
+		if !ok {
+			w = t.Weight
+			// naming a transform that only runs when asked for is asking
+			if w == 0 && g.only[strings.ToLower(t.Name)] {
+				w = 1
+			}
+		}
+		if !g.allowed(t.Name) || w <= 0 {
+			continue
+		}
+		candidates = append(candidates, t)
+		weights = append(weights, w)
+		total += w
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no glitch transforms left to pick from")
+	}
+
+	pick := func() Registration {
+		r := g.rng.Float64() * total
+		for i, w := range weights {
+			if r < w {
+				return candidates[i]
+			}
+			r -= w
+		}
+		return candidates[len(candidates)-1]
+	}
+
+	step := func(t Registration, src, dst string) {
+		p.Steps = append(p.Steps, Step{
+			Transform: t.Name,
+			Src:       src,
+			Dst:       dst,
+			Seed:      g.rng.Int63(),
+			Params:    g.stepParams(t),
+		})
+	}
+
+	// transforms mix the sources with each other and with the input
+	for i := 0; i < g.iterations; i++ {
+		src := sourceNames[g.rng.Intn(len(sourceNames))]
+		dst := sourceNames[g.rng.Intn(len(sourceNames))]
+		step(pick(), src, dst)
+		step(pick(), "input", sourceNames[g.rng.Intn(len(sourceNames))])
+	}
+
+	// then every source is wrapped onto the output and the output is glitched once more
+	wrap, _ := lookup("wrapOver")
+	for _, src := range sourceNames {
+		step(wrap, src, "output")
+	}
+	final, _ := lookup("imageglitcher")
+	step(final, "output", "output")
+
+	return p, nil
+}
+
+func (g *glitch_options) allowed(name string) bool {
+	name = strings.ToLower(name)
+	if len(g.only) > 0 && !g.only[name] {
+		return false
+	}
+	return !g.exclude[name]
+}
+
+// stepParams are the transform's params with the ones set in the options on top
+func (g *glitch_options) stepParams(t Registration) Params {
+	if len(t.Params) == 0 && len(g.params[strings.ToLower(t.Name)]) == 0 {
+		return nil
+	}
+	p := Params{}
+	for k, v := range t.Params {
+		p[k] = v
+	}
+	for k, v := range g.params[strings.ToLower(t.Name)] {
+		p[k] = v
+	}
+	return p
+}
+
+// execute runs the steps of the plan, drawing the input glitched onto output.
+// Random choices the steps make are recorded in them.
+func (p *Plan) execute(input, output *image.RGBA) error {
+	bounds := input.Bounds()
+	debug("plan %dx%d factor=%v 8bit=%d halftone=%d\n", p.Width, p.Height, p.Factor, p.EightBit, p.Halftone)
+
+	sx, sy := 1.0, 1.0
+	if p.Width > 0 && p.Height > 0 {
+		sx = float64(bounds.Dx()) / float64(p.Width)
+		sy = float64(bounds.Dy()) / float64(p.Height)
+	}
+
+	images := map[string]*image.RGBA{
+		"input":  input,
+		"output": output,
+	}
+	for _, name := range sourceNames {
+		images[name] = image.NewRGBA(bounds)
+	}
+	copy(images["8bit"].Pix, input.Pix)
+	dither.EightBit(images["8bit"], p.EightBit)
+	copy(images["halftone"].Pix, input.Pix)
+	dither.Halftone(images["halftone"], uint16(p.Halftone))
+	effects.CopyChannel(images["red"], input, utils.Red)
+	effects.CopyChannel(images["green"], input, utils.Green)
+	effects.CopyChannel(images["blue"], input, utils.Blue)
+	copy(images["original"].Pix, input.Pix)
+
+	mask := image.NewAlpha(bounds)
+	for i := range mask.Pix {
+		mask.Pix[i] = input.Pix[i*4]
+	}
+
+	for i := range p.Steps {
+		s := &p.Steps[i]
+		t, ok := lookup(s.Transform)
+		if !ok {
+			return fmt.Errorf("unknown glitch transform %q", s.Transform)
+		}
+		src, dst := images[s.Src], images[s.Dst]
+		if src == nil || dst == nil {
+			return fmt.Errorf("transform %s: unknown image %q -> %q", s.Transform, s.Src, s.Dst)
+		}
+
+		// params missing from a saved plan fall back to the defaults
+		params := Params{}
+		for k, v := range t.Params {
+			params[k] = v
+		}
+		for k, v := range s.Params {
+			params[k] = v
+		}
+
+		t.Transform.Apply(&Context{
+			Bounds: bounds,
+			Factor: p.Factor,
+			Mask:   mask,
+			Params: params,
+			Rand:   rand.New(rand.NewSource(s.Seed)),
+			step:   s,
+			sx:     sx,
+			sy:     sy,
+		}, src, dst)
+		debug("%v\n", s)
+	}
+
+	return nil
+}
+
+// wrapSlice offsets random slices of in onto out where the mask is set
+func wrapSlice(ctx *Context, in, out *image.RGBA, op draw.Op) {
+	width, height := ctx.Bounds.Max.X, ctx.Bounds.Max.Y
+	maxOffset := int(ctx.Factor / 100.0 * float64(width))
+
+	// Random image slice offsetting
+	slices := ctx.Slices(func() []Slice {
+		var slices []Slice
+		for i := 0.0; i < ctx.Factor; i++ {
+			startY := ctx.Intn(0, height)
+			chunkHeight := int(math.Min(float64(height-startY), float64(ctx.Intn(1, int(float64(height/2)*ctx.Factor/100.0)))))
+			offset := ctx.Intn(-maxOffset, maxOffset)
+			slices = append(slices, Slice{startY, chunkHeight, offset})
+		}
+		return slices
+	})
+
+	for _, s := range slices {
+		effects.WrapSlice(out, in, s.Offset, s.Y, s.Height, ctx.Mask, op)
+	}
+}
+
+// ditherWrap dithers a copy of in with a random threshold from the params,
+// masks with it and wraps it onto out
+func ditherWrap(fn func(img *image.RGBA, threshold int)) TransformFunc {
+	return func(ctx *Context, in, out *image.RGBA) {
+		newIn := image.NewRGBA(ctx.Bounds)
+		copy(newIn.Pix, in.Pix)
+		fn(newIn, ctx.Threshold(int(ctx.Params["min"]), int(ctx.Params["max"])))
+		for i := range ctx.Mask.Pix {
+			ctx.Mask.Pix[i] = newIn.Pix[i*4]
+		}
+		wrapSlice(ctx, newIn, out, draw.Over)
+	}
+}
+
+// imageglitcher is the algorithm from airtight interactive
+func imageglitcher(ctx *Context, in, out *image.RGBA) {
+	inputData := image.NewRGBA(in.Bounds())
+	copy(inputData.Pix, in.Pix)
+
+	width, height := ctx.Bounds.Max.X, ctx.Bounds.Max.Y
+	maxOffset := int(ctx.Factor / 100.0 * float64(width))
+	mask := image.NewUniform(color.Alpha{A: 255})
+
+	// Random image slice offsetting
+	slices := ctx.Slices(func() []Slice {
+		var slices []Slice
+		for i := 0.0; i < ctx.Factor*2; i++ {
+			startY := ctx.Intn(0, height)
+			chunkHeight := int(math.Min(float64(height-startY), float64(ctx.Intn(1, height/4))))
+			offset := ctx.Intn(-maxOffset, maxOffset)
+			slices = append(slices, Slice{startY, chunkHeight, offset})
+		}
+		return slices
+	})
+
+	for _, s := range slices {
+		effects.WrapSlice(out, inputData, s.Offset, s.Y, s.Height, mask, draw.Src)
+	}
+
+	// Copy a random channel from the pristene original input data onto the slice-offsetted output data
+	effects.CopyChannel(out, inputData, ctx.Channel())
+}
+
+func init() {
+	thresholds := Params{"min": 64, "max": 192}
+	builtin := []Registration{
+		{"atkinsons", ditherWrap(func(img *image.RGBA, t int) { dither.Atkinsons(img, uint8(t)) }), 1, thresholds},
+		{"8bit", ditherWrap(dither.EightBit), 1, thresholds},
+		{"bayer", ditherWrap(func(img *image.RGBA, _ int) { dither.Bayer(img) }), 1, nil},
+		{"halftone", ditherWrap(func(img *image.RGBA, t int) { dither.Halftone(img, uint16(t)) }), 1, thresholds},
+		{"floydsteinberg", ditherWrap(func(img *image.RGBA, t int) { dither.FloydSteinberg(img, uint8(t)) }), 1, thresholds},
+		{"wrapOver", TransformFunc(func(ctx *Context, in, out *image.RGBA) { wrapSlice(ctx, in, out, draw.Over) }), 1, nil},
+		{"wrapSrc", TransformFunc(func(ctx *Context, in, out *image.RGBA) { wrapSlice(ctx, in, out, draw.Src) }), 1, nil},
+		{"copyRed", TransformFunc(func(_ *Context, in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Red) }), 1, nil},
+		{"copyGreen", TransformFunc(func(_ *Context, in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Green) }), 1, nil},
+		{"copyBlue", TransformFunc(func(_ *Context, in, out *image.RGBA) { effects.CopyChannel(out, in, utils.Blue) }), 1, nil},
+		{"copyAlpha", TransformFunc(func(ctx *Context, in, _ *image.RGBA) {
+			for i := range ctx.Mask.Pix {
+				ctx.Mask.Pix[i] = in.Pix[i*4]
+			}
+		}), 1, nil},
+		// only runs at the end of a glitch unless it is given a weight
+		{"imageglitcher", TransformFunc(imageglitcher), 0, nil},
+	}
+
+	for _, r := range builtin {
+		if err := Register(r); err != nil {
+			panic(err)
+		}
+	}
+}
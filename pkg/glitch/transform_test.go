@@ -0,0 +1,147 @@
+package glitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func gradient() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 80, 60))
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 80; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 3), uint8(y * 4), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func record(t *testing.T, opts ...GlitchOption) (image.Image, []*Plan) {
+	t.Helper()
+	var recipe Recipe
+	out, err := GlitchWithOpts(gradient(), append(opts, GlitchRecord(&recipe))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out, recipe.Frames
+}
+
+func TestGlitchSeedRepeats(t *testing.T) {
+	a, planA := record(t, GlitchSeed("hello"))
+	b, planB := record(t, GlitchSeed("hello"))
+	c, _ := record(t, GlitchSeed("goodbye"))
+
+	if !reflect.DeepEqual(planA, planB) {
+		t.Error("the same seed planned different steps")
+	}
+	if !bytes.Equal(a.(*image.RGBA).Pix, b.(*image.RGBA).Pix) {
+		t.Error("the same seed glitched differently")
+	}
+	if bytes.Equal(a.(*image.RGBA).Pix, c.(*image.RGBA).Pix) {
+		t.Error("different seeds glitched the same")
+	}
+}
+
+func TestPlanReplay(t *testing.T) {
+	_, plans := record(t, GlitchSeed("replay"))
+	if len(plans) != 1 {
+		t.Fatalf("recorded %d plans, want 1", len(plans))
+	}
+
+	// a plan survives being saved and runs the same every time
+	data, err := json.Marshal(plans[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Plan
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(p *Plan) []uint8 {
+		in, out := gradient(), gradient()
+		if err := p.execute(in, out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Pix
+	}
+	if !bytes.Equal(run(plans[0]), run(&loaded)) {
+		t.Error("a loaded plan ran differently")
+	}
+
+	loaded.Steps[0].Transform = "nope"
+	if err := loaded.execute(gradient(), gradient()); err == nil {
+		t.Error("expected an error for an unknown transform")
+	}
+}
+
+func TestGlitchOnlyAndIterations(t *testing.T) {
+	_, plans := record(t, GlitchSeed("only"), GlitchOnly("copyRed", "wrapSrc"), GlitchIterations(4))
+
+	steps := plans[0].Steps
+	if len(steps) != 4*2+len(sourceNames)+1 {
+		t.Fatalf("got %d steps, want %d", len(steps), 4*2+len(sourceNames)+1)
+	}
+	for _, s := range steps[:8] {
+		if s.Transform != "copyRed" && s.Transform != "wrapSrc" {
+			t.Errorf("step ran %s", s.Transform)
+		}
+	}
+
+	if _, err := GlitchWithOpts(gradient(), GlitchOnly("copyRed"), GlitchExclude("copyRed")); err == nil {
+		t.Error("expected an error with every transform excluded")
+	}
+	if _, err := GlitchWithOpts(gradient(), GlitchOnly("nope")); err == nil {
+		t.Error("expected an error for an unknown transform")
+	}
+}
+
+func TestGlitchWeights(t *testing.T) {
+	_, plans := record(t, GlitchSeed("weights"), GlitchIterations(200),
+		GlitchWeights(map[string]float64{"bayer": 50, "copyAlpha": 0}))
+
+	counts := map[string]int{}
+	for _, s := range plans[0].Steps[:400] {
+		counts[s.Transform]++
+	}
+	if counts["copyAlpha"] != 0 {
+		t.Error("a transform with weight 0 was picked")
+	}
+	if counts["bayer"] < 200 {
+		t.Errorf("bayer picked %d times out of 400, want most of them", counts["bayer"])
+	}
+}
+
+func TestRegisterTransform(t *testing.T) {
+	calls := 0
+	err := Register(Registration{
+		Name:   "testInvert",
+		Weight: 0,
+		Params: Params{"amount": 255},
+		Transform: TransformFunc(func(ctx *Context, in, out *image.RGBA) {
+			calls++
+			for i := range out.Pix {
+				if i%4 != 3 {
+					out.Pix[i] = uint8(ctx.Params["amount"]) - in.Pix[i]
+				}
+			}
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Register(Registration{Name: "testinvert", Transform: TransformFunc(nil)}); err == nil {
+		t.Error("expected an error registering a name twice")
+	}
+
+	_, plans := record(t, GlitchOnly("testInvert"), GlitchIterations(3), GlitchParams("testInvert", Params{"amount": 128}))
+	if calls != 6 {
+		t.Errorf("custom transform ran %d times, want 6", calls)
+	}
+	if got := plans[0].Steps[0].Params["amount"]; got != 128 {
+		t.Errorf("step params have amount %v, want 128", got)
+	}
+}
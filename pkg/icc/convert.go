@@ -0,0 +1,158 @@
+package icc
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Transform converts colors from a profile to sRGB
+type Transform struct {
+	// in linearizes each channel by its 16 bit value
+	in     [3][]float32
+	matrix [3][3]float64
+}
+
+// NewTransform prepares the conversion from p to sRGB
+func NewTransform(p *Profile) (*Transform, error) {
+	if !p.matrixOK {
+		return nil, ErrUnsupported
+	}
+	toSRGB, ok := invert(srgbMatrix)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if _, ok := invert(p.matrix); !ok {
+		return nil, ErrUnsupported
+	}
+
+	t := &Transform{matrix: multiply(toSRGB, p.matrix)}
+	for c := range t.in {
+		// channels sharing a curve share the table
+		for prev := 0; prev < c; prev++ {
+			if sameCurve(p.trc[prev], p.trc[c]) {
+				t.in[c] = t.in[prev]
+				break
+			}
+		}
+		if t.in[c] != nil {
+			continue
+		}
+		lut := make([]float32, 65536)
+		for i := range lut {
+			lut[i] = float32(p.trc[c].eval(float64(i) / 65535))
+		}
+		t.in[c] = lut
+	}
+	return t, nil
+}
+
+func sameCurve(a, b curve) bool {
+	if a.fn != b.fn || len(a.params) != len(b.params) || len(a.table) != len(b.table) {
+		return false
+	}
+	for i := range a.params {
+		if a.params[i] != b.params[i] {
+			return false
+		}
+	}
+	for i := range a.table {
+		if a.table[i] != b.table[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	encodeOnce sync.Once
+	// encodeLUT applies the sRGB curve to 16 bit linear values
+	encodeLUT []uint16
+)
+
+func encode(v float64) uint16 {
+	encodeOnce.Do(func() {
+		encodeLUT = make([]uint16, 65536)
+		for i := range encodeLUT {
+			encodeLUT[i] = uint16(math.Round(linearToSRGB(float64(i)/65535) * 65535))
+		}
+	})
+	if v <= 0 {
+		return 0
+	}
+	if v >= 1 {
+		return 65535
+	}
+	return encodeLUT[int(v*65535+0.5)]
+}
+
+// Convert returns the color c converted to sRGB, colors out of the sRGB
+// gamut are clipped
+func (t *Transform) Convert(c color.Color) color.NRGBA64 {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	r, g, b := t.convert(n.R, n.G, n.B)
+	return color.NRGBA64{r, g, b, n.A}
+}
+
+func (t *Transform) convert(r, g, b uint16) (uint16, uint16, uint16) {
+	lr, lg, lb := float64(t.in[0][r]), float64(t.in[1][g]), float64(t.in[2][b])
+	m := &t.matrix
+	return encode(m[0][0]*lr + m[0][1]*lg + m[0][2]*lb),
+		encode(m[1][0]*lr + m[1][1]*lg + m[1][2]*lb),
+		encode(m[2][0]*lr + m[2][1]*lg + m[2][2]*lb)
+}
+
+// Image converts every pixel of img to sRGB. Images with 16 bits per channel
+// come back as *image.NRGBA64 and everything else as *image.NRGBA.
+func (t *Transform) Image(img image.Image) image.Image {
+	bounds := img.Bounds()
+	deep := false
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16:
+		deep = true
+	}
+
+	var out8 *image.NRGBA
+	var out16 *image.NRGBA64
+	if deep {
+		out16 = image.NewNRGBA64(bounds)
+	} else {
+		out8 = image.NewNRGBA(bounds)
+	}
+
+	rows := make(chan int, bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					c := t.Convert(img.At(x, y))
+					if deep {
+						out16.SetNRGBA64(x, y, c)
+						continue
+					}
+					out8.SetNRGBA(x, y, color.NRGBA{to8(c.R), to8(c.G), to8(c.B), to8(c.A)})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if deep {
+		return out16
+	}
+	return out8
+}
+
+func to8(v uint16) uint8 {
+	return uint8((uint32(v)*255 + 32767) / 65535)
+}
@@ -0,0 +1,199 @@
+package icc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+// jpegICCMarker starts the APP2 segments that carry a profile in a jpeg
+const jpegICCMarker = "ICC_PROFILE\x00"
+
+// Extract returns the ICC profile embedded in a PNG or JPEG file, or nil
+// when there isn't one
+func Extract(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte(pngHeader)):
+		return extractPNG(data)
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return extractJPEG(data)
+	}
+	return nil, nil
+}
+
+// pngChunks calls fn with the type and data of every chunk before the image data
+func pngChunks(data []byte, fn func(typ string, start, end int) bool) {
+	for i := len(pngHeader); i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		end := i + 12 + n
+		if n < 0 || end > len(data) || typ == "IDAT" {
+			return
+		}
+		if !fn(typ, i, end) {
+			return
+		}
+		i = end
+	}
+}
+
+func extractPNG(data []byte) ([]byte, error) {
+	var profile []byte
+	var err error
+	pngChunks(data, func(typ string, start, end int) bool {
+		if typ != "iCCP" {
+			return true
+		}
+		body := data[start+8 : end-4]
+		// a profile name, a null and the compression method come first
+		name := bytes.IndexByte(body, 0)
+		if name < 0 || name+2 > len(body) {
+			err = ErrFormat
+			return false
+		}
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(body[name+2:])); err != nil {
+			return false
+		}
+		defer zr.Close()
+		profile, err = io.ReadAll(zr)
+		return false
+	})
+	return profile, err
+}
+
+// jpegSegments calls fn with the marker and bounds of every segment before the
+// scan, a segment length that doesn't fit the data is ErrFormat
+func jpegSegments(data []byte, fn func(marker byte, start, end int) bool) error {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			i++
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 {
+			return nil
+		}
+		// the length counts its own 2 bytes
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + n
+		if n < 2 || end > len(data) {
+			return ErrFormat
+		}
+		if !fn(marker, i, end) {
+			return nil
+		}
+		i = end
+	}
+	return nil
+}
+
+func extractJPEG(data []byte) ([]byte, error) {
+	// big profiles are split over several segments, each with its number
+	chunks := map[int][]byte{}
+	err := jpegSegments(data, func(marker byte, start, end int) bool {
+		body := data[start+4 : end]
+		if marker == 0xe2 && len(body) > len(jpegICCMarker)+2 && string(body[:len(jpegICCMarker)]) == jpegICCMarker {
+			chunks[int(body[len(jpegICCMarker)])] = body[len(jpegICCMarker)+2:]
+		}
+		return true
+	})
+	if err != nil || len(chunks) == 0 {
+		return nil, err
+	}
+
+	seqs := make([]int, 0, len(chunks))
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	var profile []byte
+	for _, seq := range seqs {
+		profile = append(profile, chunks[seq]...)
+	}
+	return profile, nil
+}
+
+// TagPNG marks an encoded PNG as sRGB, any color space chunks it had are dropped
+func TagPNG(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte(pngHeader)) {
+		return data
+	}
+
+	var out bytes.Buffer
+	out.WriteString(pngHeader)
+	rest := len(pngHeader)
+	pngChunks(data, func(typ string, start, end int) bool {
+		switch typ {
+		case "IHDR":
+			out.Write(data[start:end])
+			writeChunk(&out, "sRGB", []byte{0})
+			// gamma 1/2.2 for decoders that don't know sRGB
+			writeChunk(&out, "gAMA", binary.BigEndian.AppendUint32(nil, 45455))
+		case "iCCP", "sRGB", "gAMA", "cHRM":
+		default:
+			out.Write(data[start:end])
+		}
+		rest = end
+		return true
+	})
+	out.Write(data[rest:])
+	return out.Bytes()
+}
+
+func writeChunk(w *bytes.Buffer, typ string, body []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(body)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(body)
+	w.WriteString(typ)
+	w.Write(body)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// TagJPEG embeds the sRGB profile in an encoded JPEG, replacing any profile it had
+func TagJPEG(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return data
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	rest := 2
+	tagged := false
+	tag := func() {
+		profile := SRGB()
+		out.Write([]byte{0xff, 0xe2})
+		binary.Write(&out, binary.BigEndian, uint16(2+len(jpegICCMarker)+2+len(profile)))
+		out.WriteString(jpegICCMarker)
+		out.Write([]byte{1, 1})
+		out.Write(profile)
+		tagged = true
+	}
+	// a broken segment ends the scan, it is copied along with the rest
+	jpegSegments(data, func(marker byte, start, end int) bool {
+		// the profile goes after the JFIF and EXIF headers
+		if !tagged && marker != 0xe0 && marker != 0xe1 {
+			tag()
+		}
+		body := data[start+4 : end]
+		if marker != 0xe2 || !bytes.HasPrefix(body, []byte(jpegICCMarker)) {
+			out.Write(data[start:end])
+		}
+		rest = end
+		return true
+	})
+	if !tagged {
+		tag()
+	}
+	out.Write(data[rest:])
+	return out.Bytes()
+}
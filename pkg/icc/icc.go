@@ -0,0 +1,314 @@
+// Package icc reads the ICC color profiles embedded in PNG and JPEG files and
+// converts images from RGB matrix profiles, like Display P3 and Adobe RGB, to
+// sRGB. It can also tag encoded PNG and JPEG files as sRGB.
+//
+// Only matrix/TRC profiles are understood, which covers the profiles cameras
+// and phones write. Profiles built on lookup tables, CMYK and greyscale ones
+// return ErrUnsupported.
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf16"
+)
+
+var (
+	// ErrFormat is returned for data that isn't an ICC profile
+	ErrFormat = errors.New("icc: not a valid profile")
+	// ErrUnsupported is returned for profiles that can't be converted to sRGB
+	ErrUnsupported = errors.New("icc: unsupported profile")
+)
+
+// Profile is a parsed RGB matrix/TRC profile
+type Profile struct {
+	// Description is the name of the profile, like "Display P3"
+	Description string
+	// ColorSpace is the data color space signature, like "RGB " or "CMYK"
+	ColorSpace string
+
+	// matrix takes linear RGB to the D50 XYZ connection space, the columns
+	// are the red, green and blue colorants
+	matrix [3][3]float64
+	trc    [3]curve
+	// matrixOK is set when all the colorant and curve tags were found
+	matrixOK bool
+}
+
+// curve is a tone reproduction curve, from encoded values to linear light
+type curve struct {
+	// fn is the parametric function type, -1 for a table
+	fn     int
+	params []float64
+	table  []float64
+}
+
+func (c curve) eval(x float64) float64 {
+	if c.fn < 0 {
+		if len(c.table) == 0 {
+			return x
+		}
+		p := math.Min(math.Max(x, 0), 1) * float64(len(c.table)-1)
+		i := int(p)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		f := p - float64(i)
+		return c.table[i]*(1-f) + c.table[i+1]*f
+	}
+
+	g := c.params
+	switch c.fn {
+	case 1:
+		if x >= -g[2]/g[1] {
+			return math.Pow(g[1]*x+g[2], g[0])
+		}
+		return 0
+	case 2:
+		if x >= -g[2]/g[1] {
+			return math.Pow(g[1]*x+g[2], g[0]) + g[3]
+		}
+		return g[3]
+	case 3:
+		if x >= g[4] {
+			return math.Pow(g[1]*x+g[2], g[0])
+		}
+		return g[3] * x
+	case 4:
+		if x >= g[4] {
+			return math.Pow(g[1]*x+g[2], g[0]) + g[5]
+		}
+		return g[3]*x + g[6]
+	}
+	return math.Pow(math.Max(x, 0), g[0])
+}
+
+// paramCount is the number of parameters of each parametric curve type
+var paramCount = []int{1, 3, 4, 5, 7}
+
+// Parse reads an ICC profile
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, ErrFormat
+	}
+	p := &Profile{ColorSpace: string(data[16:20])}
+
+	type tag struct{ offset, size uint32 }
+	tags := map[string]tag{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	if count > (len(data)-132)/12 {
+		return nil, ErrFormat
+	}
+	for i := 0; i < count; i++ {
+		e := data[132+i*12:]
+		t := tag{binary.BigEndian.Uint32(e[4:]), binary.BigEndian.Uint32(e[8:])}
+		if uint64(t.offset)+uint64(t.size) > uint64(len(data)) || t.size < 8 {
+			return nil, fmt.Errorf("icc: tag %q is out of bounds", e[:4])
+		}
+		tags[string(e[:4])] = t
+	}
+	body := func(sig string) []byte {
+		t, ok := tags[sig]
+		if !ok {
+			return nil
+		}
+		return data[t.offset : t.offset+t.size]
+	}
+
+	p.Description = parseText(body("desc"))
+
+	if p.ColorSpace != "RGB " {
+		return p, nil
+	}
+	p.matrixOK = true
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, ok := parseXYZ(body(sig))
+		if !ok {
+			p.matrixOK = false
+			break
+		}
+		for row := range xyz {
+			p.matrix[row][i] = xyz[row]
+		}
+	}
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		c, ok := parseCurve(body(sig))
+		if !ok {
+			p.matrixOK = false
+			break
+		}
+		p.trc[i] = c
+	}
+	return p, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func parseXYZ(b []byte) ([3]float64, bool) {
+	if len(b) < 20 || string(b[:4]) != "XYZ " {
+		return [3]float64{}, false
+	}
+	return [3]float64{s15Fixed16(b[8:]), s15Fixed16(b[12:]), s15Fixed16(b[16:])}, true
+}
+
+func parseCurve(b []byte) (curve, bool) {
+	if len(b) < 12 {
+		return curve{}, false
+	}
+	switch string(b[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+2*n {
+			return curve{}, false
+		}
+		switch n {
+		case 0:
+			return curve{fn: 0, params: []float64{1}}, true
+		case 1:
+			return curve{fn: 0, params: []float64{float64(binary.BigEndian.Uint16(b[12:])) / 256}}, true
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(b[12+2*i:])) / 65535
+		}
+		return curve{fn: -1, table: table}, true
+	case "para":
+		fn := int(binary.BigEndian.Uint16(b[8:]))
+		if fn >= len(paramCount) || len(b) < 12+4*paramCount[fn] {
+			return curve{}, false
+		}
+		params := make([]float64, paramCount[fn])
+		for i := range params {
+			params[i] = s15Fixed16(b[12+4*i:])
+		}
+		if fn > 0 && params[1] == 0 {
+			return curve{}, false
+		}
+		return curve{fn: fn, params: params}, true
+	}
+	return curve{}, false
+}
+
+// parseText reads a v2 textDescriptionType or a v4 multiLocalizedUnicodeType
+func parseText(b []byte) string {
+	if len(b) < 12 {
+		return ""
+	}
+	switch string(b[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(b[8:]))
+		if n == 0 || len(b) < 12+n {
+			return ""
+		}
+		s := b[12 : 12+n]
+		for i, c := range s {
+			if c == 0 {
+				s = s[:i]
+				break
+			}
+		}
+		return string(s)
+	case "mluc":
+		if len(b) < 28 {
+			return ""
+		}
+		length := int(binary.BigEndian.Uint32(b[20:]))
+		offset := int(binary.BigEndian.Uint32(b[24:]))
+		if offset+length > len(b) {
+			return ""
+		}
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[offset+2*i:])
+		}
+		return string(utf16.Decode(units))
+	case "text":
+		s := b[8:]
+		for i, c := range s {
+			if c == 0 {
+				s = s[:i]
+				break
+			}
+		}
+		return string(s)
+	}
+	return ""
+}
+
+// srgbMatrix is the sRGB colorants adapted to D50, as in the sRGB profile
+var srgbMatrix = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// IsSRGB reports whether the profile describes sRGB closely enough that
+// converting would change nothing
+func (p *Profile) IsSRGB() bool {
+	if !p.matrixOK {
+		return false
+	}
+	for i := range p.matrix {
+		for j := range p.matrix[i] {
+			if math.Abs(p.matrix[i][j]-srgbMatrix[i][j]) > 0.003 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.trc {
+		for x := 0.0; x <= 1; x += 1.0 / 32 {
+			if math.Abs(c.eval(x)-srgbToLinear(x)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invert(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return m, false
+	}
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			a, b := m[(j+1)%3][(i+1)%3], m[(j+2)%3][(i+2)%3]
+			c, d := m[(j+1)%3][(i+2)%3], m[(j+2)%3][(i+1)%3]
+			inv[i][j] = (a*b - c*d) / det
+		}
+	}
+	return inv, true
+}
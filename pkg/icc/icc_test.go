@@ -0,0 +1,196 @@
+package icc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// displayP3 has the P3 primaries with the sRGB curve, adapted to D50 like Apple's profile
+var displayP3 = [3][3]float64{
+	{0.5151, 0.2920, 0.1571},
+	{0.2412, 0.6922, 0.0666},
+	{-0.0011, 0.0419, 0.7841},
+}
+
+var adobeRGB = [3][3]float64{
+	{0.6097, 0.2053, 0.1492},
+	{0.3111, 0.6257, 0.0632},
+	{0.0195, 0.0609, 0.7446},
+}
+
+func transform(t *testing.T, data []byte) (*Profile, *Transform) {
+	t.Helper()
+	p, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTransform(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, tr
+}
+
+func TestSRGB(t *testing.T) {
+	p, tr := transform(t, SRGB())
+	if p.Description != "sRGB" || p.ColorSpace != "RGB " {
+		t.Errorf("parsed %q in %q", p.Description, p.ColorSpace)
+	}
+	if !p.IsSRGB() {
+		t.Error("the sRGB profile isn't sRGB")
+	}
+
+	// converting sRGB to sRGB changes nothing
+	for v := 0; v < 256; v += 5 {
+		c := color.NRGBA{uint8(v), uint8(255 - v), uint8(v / 2), 255}
+		got := tr.Image(pixel(c)).(*image.NRGBA).NRGBAAt(0, 0)
+		if got != c {
+			t.Fatalf("%v became %v", c, got)
+		}
+	}
+}
+
+func pixel(c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, c)
+	return img
+}
+
+func TestConvert(t *testing.T) {
+	table := make([]uint16, 1024)
+	for i := range table {
+		table[i] = uint16(srgbToLinear(float64(i)/1023)*65535 + 0.5)
+	}
+	p3, fromP3 := transform(t, build("Display P3", displayP3, table))
+	if p3.IsSRGB() {
+		t.Error("display p3 passed as sRGB")
+	}
+
+	// the same white and curve, greys stay put
+	grey := color.NRGBA{128, 128, 128, 255}
+	if got := fromP3.Image(pixel(grey)).(*image.NRGBA).NRGBAAt(0, 0); got != grey {
+		t.Errorf("p3 grey became %v", got)
+	}
+	// p3 is more saturated, its orange is out of the sRGB gamut
+	got := fromP3.Image(pixel(color.NRGBA{200, 100, 50, 255})).(*image.NRGBA).NRGBAAt(0, 0)
+	if got.R <= 200 || got.B >= 50 {
+		t.Errorf("p3 orange became %v", got)
+	}
+
+	// adobe rgb is a plain 2.2 gamma, written as a single entry curve
+	_, fromAdobe := transform(t, build("Adobe RGB (1998)", adobeRGB, []uint16{563}))
+	got = fromAdobe.Image(pixel(grey)).(*image.NRGBA).NRGBAAt(0, 0)
+	if got.R != got.G || got.G != got.B || got.R < 126 || got.R > 130 || got.R == 128 {
+		t.Errorf("adobe rgb grey became %v", got)
+	}
+
+	// 16 bit images keep their depth
+	deep := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	deep.SetNRGBA64(0, 0, color.NRGBA64{0x8080, 0x4040, 0x2020, 0xffff})
+	if _, ok := fromP3.Image(deep).(*image.NRGBA64); !ok {
+		t.Error("a 16 bit image came back 8 bit")
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if _, err := Parse([]byte("not a profile")); err != ErrFormat {
+		t.Errorf("got %v for garbage", err)
+	}
+
+	cmyk := append([]byte(nil), SRGB()...)
+	copy(cmyk[16:], "CMYK")
+	p, err := Parse(cmyk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTransform(p); err != ErrUnsupported {
+		t.Errorf("got %v for a cmyk profile", err)
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	return img
+}
+
+func TestPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	if profile, err := Extract(plain); profile != nil || err != nil {
+		t.Errorf("found a profile %v, %v in a plain png", profile, err)
+	}
+
+	// put a profile after the header
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(SRGB())
+	zw.Close()
+	var tagged bytes.Buffer
+	tagged.Write(plain[:33])
+	writeChunk(&tagged, "iCCP", append([]byte("sRGB\x00\x00"), z.Bytes()...))
+	tagged.Write(plain[33:])
+
+	profile, err := Extract(tagged.Bytes())
+	if err != nil || !bytes.Equal(profile, SRGB()) {
+		t.Fatalf("extracted %d bytes, %v", len(profile), err)
+	}
+
+	// tagging swaps the profile for an sRGB chunk
+	out := TagPNG(tagged.Bytes())
+	if profile, _ := Extract(out); profile != nil {
+		t.Error("the profile is still there after tagging")
+	}
+	if !bytes.Contains(out, []byte("sRGB\x00")) || !bytes.Contains(out, []byte("gAMA")) {
+		t.Error("no sRGB chunk in the tagged png")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("tagged png doesn't decode: %v", err)
+	}
+}
+
+func TestJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if profile, err := extractJPEG(buf.Bytes()); profile != nil || err != nil {
+		t.Errorf("found a profile in a plain jpeg: %v", err)
+	}
+
+	out := TagJPEG(buf.Bytes())
+	profile, err := Extract(out)
+	if err != nil || !bytes.Equal(profile, SRGB()) {
+		t.Fatalf("extracted %d bytes, %v", len(profile), err)
+	}
+	if again := TagJPEG(out); len(again) != len(out) {
+		t.Error("tagging twice added a second profile")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("tagged jpeg doesn't decode: %v", err)
+	}
+
+	// segment lengths below 2 or past the end of the data
+	for _, data := range [][]byte{
+		{0xff, 0xd8, 0xff, 0xe2, 0x00, 0x00, 0xff, 0xd9},
+		{0xff, 0xd8, 0xff, 0xe2, 0x00, 0x01, 0xff, 0xd9},
+		{0xff, 0xd8, 0xff, 0xe2, 0x00, 0x40, 0xff, 0xd9},
+	} {
+		if _, err := Extract(data); err != ErrFormat {
+			t.Errorf("% x: got %v want ErrFormat", data, err)
+		}
+		if out := TagJPEG(data); !bytes.HasSuffix(out, data[2:]) {
+			t.Errorf("% x: tagging dropped the broken segment", data)
+		}
+	}
+}
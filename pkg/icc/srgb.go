@@ -0,0 +1,104 @@
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+var (
+	srgbOnce    sync.Once
+	srgbProfile []byte
+)
+
+// SRGB is a small ICC v2 sRGB profile, the one TagJPEG embeds
+func SRGB() []byte {
+	srgbOnce.Do(func() {
+		table := make([]uint16, 1024)
+		for i := range table {
+			table[i] = uint16(math.Round(srgbToLinear(float64(i)/1023) * 65535))
+		}
+		srgbProfile = build("sRGB", srgbMatrix, table)
+	})
+	return srgbProfile
+}
+
+// d50 is the white point of the profile connection space
+var d50 = [3]float64{0.9642, 1.0, 0.8249}
+
+// build writes a display profile with the colorants in the columns of matrix
+// and one tone curve for all channels, a single entry table is a gamma
+func build(desc string, matrix [3][3]float64, trc []uint16) []byte {
+	xyz := func(v [3]float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, f := range v {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(f*65536))))
+		}
+		return b
+	}
+	column := func(i int) [3]float64 { return [3]float64{matrix[0][i], matrix[1][i], matrix[2][i]} }
+
+	text := []byte("desc\x00\x00\x00\x00")
+	text = binary.BigEndian.AppendUint32(text, uint32(len(desc)+1))
+	text = append(text, desc...)
+	text = append(text, 0)
+	// no unicode or scriptcode descriptions
+	text = append(text, make([]byte, 8+3+67)...)
+
+	curv := []byte("curv\x00\x00\x00\x00")
+	curv = binary.BigEndian.AppendUint32(curv, uint32(len(trc)))
+	for _, v := range trc {
+		curv = binary.BigEndian.AppendUint16(curv, v)
+	}
+
+	type tag struct {
+		sig  string
+		body []byte
+	}
+	tags := []tag{
+		{"desc", text},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(d50)},
+		{"rXYZ", xyz(column(0))},
+		{"gXYZ", xyz(column(1))},
+		{"bXYZ", xyz(column(2))},
+		{"rTRC", curv},
+		{"gTRC", curv},
+		{"bTRC", curv},
+	}
+
+	var body bytes.Buffer
+	var table bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	start := 128 + 4 + 12*len(tags)
+	offsets := map[string]int{}
+	for _, t := range tags {
+		// the channels share one curve
+		key := string(t.body)
+		offset, ok := offsets[key]
+		if !ok {
+			offset = start + body.Len()
+			offsets[key] = offset
+			body.Write(t.body)
+			for body.Len()%4 != 0 {
+				body.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(offset))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.body)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(128+table.Len()+body.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(d50)[8:])
+
+	out := append(header, table.Bytes()...)
+	return append(out, body.Bytes()...)
+}
@@ -236,18 +236,23 @@ func sigmoid(a, b, x float64) float64 {
 
 // adjustLUT applies the given lookup table to the colors of the image.
 func adjustLUT(img image.Image, lut []uint8) *image.NRGBA {
+	return adjustLUTs(img, lut, lut, lut)
+}
+
+// adjustLUTs applies a separate lookup table to each of the R, G and B channels.
+func adjustLUTs(img image.Image, r, g, b []uint8) *image.NRGBA {
 	src := newScanner(img)
 	dst := image.NewNRGBA(image.Rect(0, 0, src.w, src.h))
-	lut = lut[0:256]
+	r, g, b = r[0:256], g[0:256], b[0:256]
 	parallel(0, src.h, func(ys <-chan int) {
 		for y := range ys {
 			i := y * dst.Stride
 			src.scan(0, y, src.w, y+1, dst.Pix[i:i+src.w*4])
 			for x := 0; x < src.w; x++ {
 				d := dst.Pix[i : i+3 : i+3]
-				d[0] = lut[d[0]]
-				d[1] = lut[d[1]]
-				d[2] = lut[d[2]]
+				d[0] = r[d[0]]
+				d[1] = g[d[1]]
+				d[2] = b[d[2]]
 				i += 4
 			}
 		}
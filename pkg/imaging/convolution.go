@@ -2,6 +2,7 @@ package imaging
 
 import (
 	"image"
+	"image/color"
 )
 
 // ConvolveOptions are convolution parameters.
@@ -14,21 +15,48 @@ type ConvolveOptions struct {
 
 	// Bias is added to each color channel value after convolution.
 	Bias int
+
+	// Border is how pixels past the edges of the image are read, they repeat
+	// the edge pixels by default.
+	Border Border
+
+	// Constant is the color read past the edges with BorderConstant, its
+	// alpha is ignored.
+	Constant color.NRGBA
 }
 
 // Convolve3x3 convolves the image with the specified 3x3 convolution kernel.
 // Default parameters are used if a nil *ConvolveOptions is passed.
 func Convolve3x3(img image.Image, kernel [9]float64, options *ConvolveOptions) *image.NRGBA {
-	return convolve(img, kernel[:], options)
+	return convolveKernel(img, Kernel{Width: 3, Height: 3, Values: kernel[:]}, options, false)
 }
 
 // Convolve5x5 convolves the image with the specified 5x5 convolution kernel.
 // Default parameters are used if a nil *ConvolveOptions is passed.
 func Convolve5x5(img image.Image, kernel [25]float64, options *ConvolveOptions) *image.NRGBA {
-	return convolve(img, kernel[:], options)
+	return convolveKernel(img, Kernel{Width: 5, Height: 5, Values: kernel[:]}, options, false)
+}
+
+// Convolve convolves the image with a kernel of any size. Separable kernels
+// are applied as a row and a column, which is much faster for large kernels.
+// A kernel whose Values don't fill it leaves the image unchanged.
+// Default parameters are used if a nil *ConvolveOptions is passed.
+//
+// Example:
+//
+//	kernel, err := imaging.ParseKernel("motion:15,30")
+//	dstImage := imaging.Convolve(srcImage, kernel, &imaging.ConvolveOptions{Border: imaging.BorderMirror})
+func Convolve(img image.Image, kernel Kernel, options *ConvolveOptions) *image.NRGBA {
+	return convolveKernel(img, kernel, options, true)
 }
 
-func convolve(img image.Image, kernel []float64, options *ConvolveOptions) *image.NRGBA {
+// convolveKernel is Convolve, the separable split rounds a little differently
+// so the fixed size kernels always take the full one to keep their output
+func convolveKernel(img image.Image, kernel Kernel, options *ConvolveOptions, separable bool) *image.NRGBA {
+	if !kernel.valid() {
+		return Clone(img)
+	}
+
 	src := toNRGBA(img)
 	w := src.Bounds().Max.X
 	h := src.Bounds().Max.Y
@@ -42,29 +70,66 @@ func convolve(img image.Image, kernel []float64, options *ConvolveOptions) *imag
 		options = &ConvolveOptions{}
 	}
 
+	values := append([]float64(nil), kernel.Values...)
 	if options.Normalize {
-		normalizeKernel(kernel)
+		normalizeKernel(values)
+	}
+	kernel.Values = values
+
+	// the split only pays off once the kernel is bigger than its row and column
+	if column, row, ok := kernel.Separable(); separable && ok && len(values) >= 2*(len(column)+len(row)) {
+		convolveSeparable(src, dst, column, row, options)
+	} else {
+		convolve(src, dst, kernel, options)
+	}
+	return dst
+}
+
+// constant is the color a constant border reads
+func (o *ConvolveOptions) constant() (r, g, b float64) {
+	return float64(o.Constant.R), float64(o.Constant.G), float64(o.Constant.B)
+}
+
+// finish applies Abs and Bias to a convolved color
+func (o *ConvolveOptions) finish(d []uint8, r, g, b float64) {
+	if o.Abs {
+		if r < 0 {
+			r = -r
+		}
+		if g < 0 {
+			g = -g
+		}
+		if b < 0 {
+			b = -b
+		}
+	}
+
+	if o.Bias != 0 {
+		r += float64(o.Bias)
+		g += float64(o.Bias)
+		b += float64(o.Bias)
 	}
 
+	d[0] = clamp(r)
+	d[1] = clamp(g)
+	d[2] = clamp(b)
+}
+
+func convolve(src, dst *image.NRGBA, kernel Kernel, options *ConvolveOptions) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	cr, cg, cb := options.constant()
+
 	type coef struct {
 		x, y int
 		k    float64
 	}
 	var coefs []coef
-	var m int
-
-	switch len(kernel) {
-	case 9:
-		m = 1
-	case 25:
-		m = 2
-	}
 
 	i := 0
-	for y := -m; y <= m; y++ {
-		for x := -m; x <= m; x++ {
-			if kernel[i] != 0 {
-				coefs = append(coefs, coef{x: x, y: y, k: kernel[i]})
+	for y := 0; y < kernel.Height; y++ {
+		for x := 0; x < kernel.Width; x++ {
+			if kernel.Values[i] != 0 {
+				coefs = append(coefs, coef{x: x - kernel.Width/2, y: y - kernel.Height/2, k: kernel.Values[i]})
 			}
 			i++
 		}
@@ -75,18 +140,13 @@ func convolve(img image.Image, kernel []float64, options *ConvolveOptions) *imag
 			for x := 0; x < w; x++ {
 				var r, g, b float64
 				for _, c := range coefs {
-					ix := x + c.x
-					if ix < 0 {
-						ix = 0
-					} else if ix >= w {
-						ix = w - 1
-					}
-
-					iy := y + c.y
-					if iy < 0 {
-						iy = 0
-					} else if iy >= h {
-						iy = h - 1
+					ix, okx := options.Border.index(x+c.x, w)
+					iy, oky := options.Border.index(y+c.y, h)
+					if !okx || !oky {
+						r += cr * c.k
+						g += cg * c.k
+						b += cb * c.k
+						continue
 					}
 
 					off := iy*src.Stride + ix*4
@@ -96,36 +156,77 @@ func convolve(img image.Image, kernel []float64, options *ConvolveOptions) *imag
 					b += float64(s[2]) * c.k
 				}
 
-				if options.Abs {
-					if r < 0 {
-						r = -r
-					}
-					if g < 0 {
-						g = -g
-					}
-					if b < 0 {
-						b = -b
-					}
-				}
-
-				if options.Bias != 0 {
-					r += float64(options.Bias)
-					g += float64(options.Bias)
-					b += float64(options.Bias)
-				}
-
 				srcOff := y*src.Stride + x*4
 				dstOff := y*dst.Stride + x*4
 				d := dst.Pix[dstOff : dstOff+4 : dstOff+4]
-				d[0] = clamp(r)
-				d[1] = clamp(g)
-				d[2] = clamp(b)
+				options.finish(d, r, g, b)
 				d[3] = src.Pix[srcOff+3]
 			}
 		}
 	})
+}
 
-	return dst
+// convolveSeparable convolves with row first and then column, the rows in
+// between are kept as floats so nothing is rounded twice
+func convolveSeparable(src, dst *image.NRGBA, column, row []float64, options *ConvolveOptions) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	cr, cg, cb := options.constant()
+	ax, ay := len(row)/2, len(column)/2
+
+	tmp := make([]float64, w*h*3)
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				var r, g, b float64
+				for j, k := range row {
+					ix, ok := options.Border.index(x+j-ax, w)
+					if !ok {
+						r += cr * k
+						g += cg * k
+						b += cb * k
+						continue
+					}
+					s := src.Pix[y*src.Stride+ix*4 : y*src.Stride+ix*4+3 : y*src.Stride+ix*4+3]
+					r += float64(s[0]) * k
+					g += float64(s[1]) * k
+					b += float64(s[2]) * k
+				}
+				t := tmp[(y*w+x)*3 : (y*w+x)*3+3 : (y*w+x)*3+3]
+				t[0], t[1], t[2] = r, g, b
+			}
+		}
+	})
+
+	// a row past a constant border is the constant convolved with row
+	var rowSum float64
+	for _, k := range row {
+		rowSum += k
+	}
+
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				var r, g, b float64
+				for i, k := range column {
+					iy, ok := options.Border.index(y+i-ay, h)
+					if !ok {
+						r += cr * rowSum * k
+						g += cg * rowSum * k
+						b += cb * rowSum * k
+						continue
+					}
+					t := tmp[(iy*w+x)*3 : (iy*w+x)*3+3 : (iy*w+x)*3+3]
+					r += t[0] * k
+					g += t[1] * k
+					b += t[2] * k
+				}
+
+				d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4 : y*dst.Stride+x*4+4]
+				options.finish(d, r, g, b)
+				d[3] = src.Pix[y*src.Stride+x*4+3]
+			}
+		}
+	})
 }
 
 func normalizeKernel(kernel []float64) {
@@ -0,0 +1,396 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync"
+
+	"pix/pkg/colors"
+)
+
+// FloatImage is an image with float32 channels from 0 to 1, stored as
+// premultiplied RGBA like image.RGBA. The colors are either sRGB encoded or,
+// when Linear is set, linear light. Resizing, blurring and compositing linear
+// light doesn't darken fine detail and edges the way working on sRGB values does,
+// and floats keep the precision of 16-bit sources.
+type FloatImage struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+	Linear bool
+}
+
+// NewFloat creates a transparent FloatImage with the specified dimensions.
+func NewFloat(width, height int, linear bool) *FloatImage {
+	if width <= 0 || height <= 0 {
+		return &FloatImage{Linear: linear}
+	}
+	return &FloatImage{
+		Pix:    make([]float32, width*height*4),
+		Stride: width * 4,
+		Rect:   image.Rect(0, 0, width, height),
+		Linear: linear,
+	}
+}
+
+var (
+	linearOnce sync.Once
+	// toLinear is the linear light of each 16-bit sRGB value
+	toLinear []float32
+	// fromLinear is the 16-bit sRGB value of each 16-bit step of linear light
+	fromLinear []uint16
+)
+
+func linearTables() {
+	linearOnce.Do(func() {
+		toLinear = make([]float32, 65536)
+		fromLinear = make([]uint16, 65536)
+		for i := range toLinear {
+			toLinear[i] = float32(colors.SRGBToLinear(float64(i) / 65535))
+			fromLinear[i] = uint16(math.Round(colors.LinearToSRGB(float64(i)/65535) * 65535))
+		}
+	})
+}
+
+// ToFloat converts the image to a FloatImage, as linear light or sRGB values.
+// 16-bit images keep their full precision.
+func ToFloat(img image.Image, linear bool) *FloatImage {
+	if f, ok := img.(*FloatImage); ok {
+		return f.convert(linear)
+	}
+
+	bounds := img.Bounds()
+	dst := NewFloat(bounds.Dx(), bounds.Dy(), linear)
+	if linear {
+		linearTables()
+	}
+
+	src, fast := img.(image.RGBA64Image)
+	parallel(0, bounds.Dy(), func(ys <-chan int) {
+		for y := range ys {
+			d := dst.Pix[y*dst.Stride : (y+1)*dst.Stride]
+			for x := 0; x < bounds.Dx(); x++ {
+				var r, g, b, a uint32
+				if fast {
+					c := src.RGBA64At(bounds.Min.X+x, bounds.Min.Y+y)
+					r, g, b, a = uint32(c.R), uint32(c.G), uint32(c.B), uint32(c.A)
+				} else {
+					r, g, b, a = img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				}
+
+				p := d[x*4 : x*4+4 : x*4+4]
+				p[3] = float32(a) / 65535
+				if !linear {
+					p[0] = float32(r) / 65535
+					p[1] = float32(g) / 65535
+					p[2] = float32(b) / 65535
+					continue
+				}
+				if a == 0 {
+					p[0], p[1], p[2] = 0, 0, 0
+					continue
+				}
+				// unpremultiply to look up the curve, then premultiply again
+				p[0] = toLinear[min(r*65535/a, 65535)] * p[3]
+				p[1] = toLinear[min(g*65535/a, 65535)] * p[3]
+				p[2] = toLinear[min(b*65535/a, 65535)] * p[3]
+			}
+		}
+	})
+	return dst
+}
+
+// convert copies the image as linear light or sRGB values.
+func (f *FloatImage) convert(linear bool) *FloatImage {
+	dst := f.clone()
+	if f.Linear == linear {
+		return dst
+	}
+	curve := colors.SRGBToLinear
+	if f.Linear {
+		curve = colors.LinearToSRGB
+	}
+	dst.Linear = linear
+	parallel(0, dst.Rect.Dy(), func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < dst.Rect.Dx(); x++ {
+				i := y*dst.Stride + x*4
+				p := dst.Pix[i : i+4 : i+4]
+				a := math.Min(math.Max(float64(p[3]), 0), 1)
+				if a == 0 {
+					continue
+				}
+				for c := 0; c < 3; c++ {
+					p[c] = float32(curve(math.Min(math.Max(float64(p[c])/a, 0), 1)) * a)
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// HighBitDepth reports whether the image has more than 8 bits per channel,
+// like 16-bit PNG and TIFF images or a FloatImage.
+func HighBitDepth(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.NRGBA64Model, color.RGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// ColorModel returns the color model of the image, colors are given as sRGB.
+func (f *FloatImage) ColorModel() color.Model { return color.NRGBA64Model }
+
+// Bounds returns the domain for which At can return non-zero color.
+func (f *FloatImage) Bounds() image.Rectangle { return f.Rect }
+
+// At returns the sRGB color of the pixel at (x, y).
+func (f *FloatImage) At(x, y int) color.Color { return f.NRGBA64At(x, y) }
+
+// NRGBA64At returns the sRGB color of the pixel at (x, y).
+func (f *FloatImage) NRGBA64At(x, y int) color.NRGBA64 {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return color.NRGBA64{}
+	}
+	if f.Linear {
+		linearTables()
+	}
+	i := (y-f.Rect.Min.Y)*f.Stride + (x-f.Rect.Min.X)*4
+	return f.nrgba64(f.Pix[i:i+4:i+4], true)
+}
+
+// nrgba64 unpremultiplies a pixel and encodes it as sRGB. The lookup table is
+// plenty for 8-bit output, but 16-bit shadows need the exact curve.
+func (f *FloatImage) nrgba64(p []float32, exact bool) color.NRGBA64 {
+	a := math.Min(math.Max(float64(p[3]), 0), 1)
+	if a == 0 {
+		return color.NRGBA64{}
+	}
+	channel := func(v float32) uint16 {
+		c := math.Min(math.Max(float64(v)/a, 0), 1)
+		switch {
+		case !f.Linear:
+		case exact:
+			c = colors.LinearToSRGB(c)
+		default:
+			return fromLinear[int(c*65535+0.5)]
+		}
+		return uint16(c*65535 + 0.5)
+	}
+	return color.NRGBA64{channel(p[0]), channel(p[1]), channel(p[2]), uint16(a*65535 + 0.5)}
+}
+
+// NRGBA64 converts the image to 16-bit sRGB.
+func (f *FloatImage) NRGBA64() *image.NRGBA64 {
+	if f.Linear {
+		linearTables()
+	}
+	w, h := f.Rect.Dx(), f.Rect.Dy()
+	dst := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				i := y*f.Stride + x*4
+				c := f.nrgba64(f.Pix[i:i+4:i+4], true)
+				d := dst.Pix[y*dst.Stride+x*8 : y*dst.Stride+x*8+8 : y*dst.Stride+x*8+8]
+				d[0], d[1] = uint8(c.R>>8), uint8(c.R)
+				d[2], d[3] = uint8(c.G>>8), uint8(c.G)
+				d[4], d[5] = uint8(c.B>>8), uint8(c.B)
+				d[6], d[7] = uint8(c.A>>8), uint8(c.A)
+			}
+		}
+	})
+	return dst
+}
+
+// NRGBA converts the image to 8-bit sRGB.
+func (f *FloatImage) NRGBA() *image.NRGBA {
+	if f.Linear {
+		linearTables()
+	}
+	w, h := f.Rect.Dx(), f.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	to8 := func(v uint16) uint8 { return uint8((uint32(v)*255 + 32767) / 65535) }
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				i := y*f.Stride + x*4
+				c := f.nrgba64(f.Pix[i:i+4:i+4], false)
+				d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4 : y*dst.Stride+x*4+4]
+				d[0], d[1], d[2], d[3] = to8(c.R), to8(c.G), to8(c.B), to8(c.A)
+			}
+		}
+	})
+	return dst
+}
+
+// ResizeFloat resizes a FloatImage like Resize. The result is linear light when the source is.
+func ResizeFloat(img *FloatImage, width, height int, filter ResampleFilter) *FloatImage {
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	if width < 0 || height < 0 || (width == 0 && height == 0) || srcW <= 0 || srcH <= 0 {
+		return &FloatImage{Linear: img.Linear}
+	}
+
+	// If new width or height is 0 then preserve aspect ratio, minimum 1px.
+	if width == 0 {
+		width = int(math.Max(1.0, math.Floor(float64(height)*float64(srcW)/float64(srcH)+0.5)))
+	}
+	if height == 0 {
+		height = int(math.Max(1.0, math.Floor(float64(width)*float64(srcH)/float64(srcW)+0.5)))
+	}
+
+	if filter.Support <= 0 {
+		dst := NewFloat(width, height, img.Linear)
+		parallel(0, height, func(ys <-chan int) {
+			for y := range ys {
+				sy := (2*y + 1) * srcH / (2 * height)
+				for x := 0; x < width; x++ {
+					sx := (2*x + 1) * srcW / (2 * width)
+					i := sy*img.Stride + sx*4
+					copy(dst.Pix[y*dst.Stride+x*4:], img.Pix[i:i+4])
+				}
+			}
+		})
+		return dst
+	}
+
+	tmp := img
+	if width != srcW {
+		tmp = NewFloat(width, srcH, img.Linear)
+		weights := precomputeWeights(width, srcW, filter)
+		parallel(0, srcH, func(ys <-chan int) {
+			for y := range ys {
+				row := img.Pix[y*img.Stride:]
+				d := tmp.Pix[y*tmp.Stride:]
+				for x, ws := range weights {
+					var r, g, b, a float64
+					for _, w := range ws {
+						s := row[w.index*4 : w.index*4+4 : w.index*4+4]
+						r += float64(s[0]) * w.weight
+						g += float64(s[1]) * w.weight
+						b += float64(s[2]) * w.weight
+						a += float64(s[3]) * w.weight
+					}
+					d[x*4], d[x*4+1], d[x*4+2], d[x*4+3] = float32(r), float32(g), float32(b), float32(a)
+				}
+			}
+		})
+	}
+
+	if height == srcH {
+		if tmp == img {
+			return img.clone()
+		}
+		return tmp
+	}
+	dst := NewFloat(width, height, img.Linear)
+	weights := precomputeWeights(height, srcH, filter)
+	parallel(0, width, func(xs <-chan int) {
+		for x := range xs {
+			for y, ws := range weights {
+				var r, g, b, a float64
+				for _, w := range ws {
+					i := w.index*tmp.Stride + x*4
+					s := tmp.Pix[i : i+4 : i+4]
+					r += float64(s[0]) * w.weight
+					g += float64(s[1]) * w.weight
+					b += float64(s[2]) * w.weight
+					a += float64(s[3]) * w.weight
+				}
+				i := y*dst.Stride + x*4
+				dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = float32(r), float32(g), float32(b), float32(a)
+			}
+		}
+	})
+	return dst
+}
+
+func (f *FloatImage) clone() *FloatImage {
+	dst := NewFloat(f.Rect.Dx(), f.Rect.Dy(), f.Linear)
+	for y := 0; y < f.Rect.Dy(); y++ {
+		copy(dst.Pix[y*dst.Stride:(y+1)*dst.Stride], f.Pix[y*f.Stride:])
+	}
+	return dst
+}
+
+// BlurFloat blurs a FloatImage like Blur. The result is linear light when the source is.
+func BlurFloat(img *FloatImage, sigma float64) *FloatImage {
+	if sigma <= 0 {
+		return img.clone()
+	}
+
+	radius := int(math.Ceil(sigma * 3.0))
+	kernel := make([]float64, radius+1)
+	for i := 0; i <= radius; i++ {
+		kernel[i] = gaussianBlurKernel(float64(i), sigma)
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	// blur one line of n pixels, step apart in pix, starting at start
+	line := func(src, dst []float32, start, step, n int) {
+		for i := 0; i < n; i++ {
+			var r, g, b, a, wsum float64
+			for k := max(0, i-radius); k <= min(n-1, i+radius); k++ {
+				d := i - k
+				if d < 0 {
+					d = -d
+				}
+				weight := kernel[d]
+				s := src[start+k*step : start+k*step+4 : start+k*step+4]
+				r += float64(s[0]) * weight
+				g += float64(s[1]) * weight
+				b += float64(s[2]) * weight
+				a += float64(s[3]) * weight
+				wsum += weight
+			}
+			d := dst[start+i*step : start+i*step+4 : start+i*step+4]
+			d[0], d[1], d[2], d[3] = float32(r/wsum), float32(g/wsum), float32(b/wsum), float32(a/wsum)
+		}
+	}
+
+	src := img.clone()
+	tmp := NewFloat(w, h, img.Linear)
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			line(src.Pix, tmp.Pix, y*src.Stride, 4, w)
+		}
+	})
+	dst := NewFloat(w, h, img.Linear)
+	parallel(0, w, func(xs <-chan int) {
+		for x := range xs {
+			line(tmp.Pix, dst.Pix, x*4, tmp.Stride, h)
+		}
+	})
+	return dst
+}
+
+// OverlayFloat draws img over background at pos like Overlay. The images should
+// both be linear light or both be sRGB.
+func OverlayFloat(background, img *FloatImage, pos image.Point, opacity float64) *FloatImage {
+	op := float32(math.Min(math.Max(opacity, 0.0), 1.0))
+	dst := background.clone()
+	pos = pos.Sub(background.Rect.Min)
+	pasteRect := image.Rectangle{Min: pos, Max: pos.Add(img.Rect.Size())}
+	interRect := pasteRect.Intersect(dst.Rect)
+	if interRect.Empty() {
+		return dst
+	}
+	parallel(interRect.Min.Y, interRect.Max.Y, func(ys <-chan int) {
+		for y := range ys {
+			for x := interRect.Min.X; x < interRect.Max.X; x++ {
+				i := y*dst.Stride + x*4
+				j := (y-pasteRect.Min.Y)*img.Stride + (x-pasteRect.Min.X)*4
+				d := dst.Pix[i : i+4 : i+4]
+				s := img.Pix[j : j+4 : j+4]
+				k := 1 - s[3]*op
+				d[0] = s[0]*op + d[0]*k
+				d[1] = s[1]*op + d[1]*k
+				d[2] = s[2]*op + d[2]*k
+				d[3] = s[3]*op + d[3]*k
+			}
+		}
+	})
+	return dst
+}
@@ -0,0 +1,319 @@
+package imaging
+
+import (
+	"math"
+
+	"pix/pkg/colors"
+)
+
+// clampUnit limits a channel to the range 0 - 1.
+func clampUnit(v float64) float64 {
+	return math.Min(math.Max(v, 0), 1)
+}
+
+// AdjustFuncFloat applies the fn function to each pixel of a FloatImage like AdjustFunc.
+// The channels fn gets and returns are unpremultiplied sRGB values from 0 to 1,
+// linear images are encoded for fn and decoded again. Alpha is kept.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustFuncFloat(
+//		srcImage,
+//		func(r, g, b float64) (float64, float64, float64) {
+//			// Swap the red and blue channels.
+//			return b, g, r
+//		},
+//	)
+func AdjustFuncFloat(img *FloatImage, fn func(r, g, b float64) (float64, float64, float64)) *FloatImage {
+	dst := img.clone()
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				i := y*dst.Stride + x*4
+				p := dst.Pix[i : i+4 : i+4]
+				a := clampUnit(float64(p[3]))
+				if a == 0 {
+					continue
+				}
+				r, g, b := clampUnit(float64(p[0])/a), clampUnit(float64(p[1])/a), clampUnit(float64(p[2])/a)
+				if dst.Linear {
+					r, g, b = colors.LinearToSRGB(r), colors.LinearToSRGB(g), colors.LinearToSRGB(b)
+				}
+				r, g, b = fn(r, g, b)
+				r, g, b = clampUnit(r), clampUnit(g), clampUnit(b)
+				if dst.Linear {
+					r, g, b = colors.SRGBToLinear(r), colors.SRGBToLinear(g), colors.SRGBToLinear(b)
+				}
+				p[0], p[1], p[2] = float32(r*a), float32(g*a), float32(b*a)
+			}
+		}
+	})
+	return dst
+}
+
+// adjustCurveFloat applies the same curve to the R, G and B channels.
+func adjustCurveFloat(img *FloatImage, curve func(v float64) float64) *FloatImage {
+	return AdjustFuncFloat(img, func(r, g, b float64) (float64, float64, float64) {
+		return curve(r), curve(g), curve(b)
+	})
+}
+
+// GrayscaleFloat produces a grayscale version of a FloatImage like Grayscale.
+func GrayscaleFloat(img *FloatImage) *FloatImage {
+	return AdjustFuncFloat(img, func(r, g, b float64) (float64, float64, float64) {
+		y := 0.299*r + 0.587*g + 0.114*b
+		return y, y, y
+	})
+}
+
+// InvertFloat produces an inverted version of a FloatImage like Invert.
+func InvertFloat(img *FloatImage) *FloatImage {
+	return adjustCurveFloat(img, func(v float64) float64 { return 1 - v })
+}
+
+// AdjustSaturationFloat changes the saturation of a FloatImage like AdjustSaturation.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustSaturationFloat(srcImage, 25) // Increase image saturation by 25%.
+func AdjustSaturationFloat(img *FloatImage, percentage float64) *FloatImage {
+	if percentage == 0 {
+		return img.clone()
+	}
+
+	multiplier := 1 + math.Min(math.Max(percentage, -100), 100)/100
+	return AdjustFuncFloat(img, func(r, g, b float64) (float64, float64, float64) {
+		h, s, l := rgbToHSLFloat(r, g, b)
+		return hslToRGBFloat(h, math.Min(s*multiplier, 1), l)
+	})
+}
+
+// AdjustHueFloat changes the hue of a FloatImage like AdjustHue.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustHueFloat(srcImage, 90) // Shift Hue by 90°.
+func AdjustHueFloat(img *FloatImage, shift float64) *FloatImage {
+	if math.Mod(shift, 360) == 0 {
+		return img.clone()
+	}
+
+	summand := shift / 360
+	return AdjustFuncFloat(img, func(r, g, b float64) (float64, float64, float64) {
+		h, s, l := rgbToHSLFloat(r, g, b)
+		h = math.Mod(h+summand, 1)
+		if h < 0 {
+			h++
+		}
+		return hslToRGBFloat(h, s, l)
+	})
+}
+
+// AdjustContrastFloat changes the contrast of a FloatImage like AdjustContrast.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustContrastFloat(srcImage, 20) // Increase image contrast by 20%.
+func AdjustContrastFloat(img *FloatImage, percentage float64) *FloatImage {
+	if percentage == 0 {
+		return img.clone()
+	}
+
+	v := (100 + math.Min(math.Max(percentage, -100), 100)) / 100
+	return adjustCurveFloat(img, func(x float64) float64 {
+		switch {
+		case 0 <= v && v <= 1:
+			return 0.5 + (x-0.5)*v
+		case 1 < v && v < 2:
+			return 0.5 + (x-0.5)/(2-v)
+		default:
+			return math.Floor(x + 0.5)
+		}
+	})
+}
+
+// AdjustBrightnessFloat changes the brightness of a FloatImage like AdjustBrightness.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustBrightnessFloat(srcImage, -15) // Decrease image brightness by 15%.
+func AdjustBrightnessFloat(img *FloatImage, percentage float64) *FloatImage {
+	if percentage == 0 {
+		return img.clone()
+	}
+
+	shift := math.Min(math.Max(percentage, -100), 100) / 100
+	return adjustCurveFloat(img, func(x float64) float64 { return x + shift })
+}
+
+// AdjustGammaFloat performs a gamma correction on a FloatImage like AdjustGamma.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustGammaFloat(srcImage, 0.7)
+func AdjustGammaFloat(img *FloatImage, gamma float64) *FloatImage {
+	if gamma == 1 {
+		return img.clone()
+	}
+
+	e := 1 / math.Max(gamma, 0.0001)
+	return adjustCurveFloat(img, func(x float64) float64 { return math.Pow(x, e) })
+}
+
+// AdjustSigmoidFloat changes the contrast of a FloatImage using a sigmoidal function like AdjustSigmoid.
+//
+// Example:
+//
+//	dstImage = imaging.AdjustSigmoidFloat(srcImage, 0.5, 3.0) // Increase the contrast.
+func AdjustSigmoidFloat(img *FloatImage, midpoint, factor float64) *FloatImage {
+	if factor == 0 {
+		return img.clone()
+	}
+
+	a := math.Min(math.Max(midpoint, 0.0), 1.0)
+	b := math.Abs(factor)
+	sig0 := sigmoid(a, b, 0)
+	sig1 := sigmoid(a, b, 1)
+	e := 1.0e-6
+
+	if factor > 0 {
+		return adjustCurveFloat(img, func(x float64) float64 {
+			return (sigmoid(a, b, x) - sig0) / (sig1 - sig0)
+		})
+	}
+	return adjustCurveFloat(img, func(x float64) float64 {
+		arg := math.Min(math.Max((sig1-sig0)*x+sig0, e), 1.0-e)
+		return a - math.Log(1.0/arg-1.0)/b
+	})
+}
+
+// SharpenFloat produces a sharpened version of a FloatImage like Sharpen.
+//
+// Example:
+//
+//	dstImage := imaging.SharpenFloat(srcImage, 3.5)
+func SharpenFloat(img *FloatImage, sigma float64) *FloatImage {
+	if sigma <= 0 {
+		return img.clone()
+	}
+
+	dst := img.clone()
+	blurred := BlurFloat(dst, sigma)
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				i := y*dst.Stride + x*4
+				d := dst.Pix[i : i+4 : i+4]
+				s := blurred.Pix[i : i+4 : i+4]
+				// premultiplied colors can't be brighter than their alpha
+				a := float32(clampUnit(float64(2*d[3] - s[3])))
+				d[0] = float32(math.Min(math.Max(float64(2*d[0]-s[0]), 0), float64(a)))
+				d[1] = float32(math.Min(math.Max(float64(2*d[1]-s[1]), 0), float64(a)))
+				d[2] = float32(math.Min(math.Max(float64(2*d[2]-s[2]), 0), float64(a)))
+				d[3] = a
+			}
+		}
+	})
+	return dst
+}
+
+// Convolve3x3Float convolves a FloatImage with the specified 3x3 convolution kernel
+// like Convolve3x3. The kernel is applied to the values as they are stored, linear
+// light for linear images. Bias is in steps of 1/255 like the 8-bit version.
+func Convolve3x3Float(img *FloatImage, kernel [9]float64, options *ConvolveOptions) *FloatImage {
+	return ConvolveFloat(img, Kernel{Width: 3, Height: 3, Values: kernel[:]}, options)
+}
+
+// Convolve5x5Float convolves a FloatImage with the specified 5x5 convolution kernel
+// like Convolve5x5.
+func Convolve5x5Float(img *FloatImage, kernel [25]float64, options *ConvolveOptions) *FloatImage {
+	return ConvolveFloat(img, Kernel{Width: 5, Height: 5, Values: kernel[:]}, options)
+}
+
+// ConvolveFloat convolves a FloatImage with a kernel of any size like Convolve.
+func ConvolveFloat(img *FloatImage, kernel Kernel, options *ConvolveOptions) *FloatImage {
+	if !kernel.valid() {
+		return img.clone()
+	}
+
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := NewFloat(w, h, img.Linear)
+	if w < 1 || h < 1 {
+		return dst
+	}
+
+	if options == nil {
+		options = &ConvolveOptions{}
+	}
+	values := append([]float64(nil), kernel.Values...)
+	if options.Normalize {
+		normalizeKernel(values)
+	}
+	bias := float64(options.Bias) / 255
+	cr, cg, cb := options.constant()
+	cr, cg, cb = cr/255, cg/255, cb/255
+
+	// the kernel works on unpremultiplied colors like the 8-bit version
+	src := img.clone()
+	for i := 0; i < len(src.Pix); i += 4 {
+		if a := src.Pix[i+3]; a > 0 {
+			src.Pix[i] /= a
+			src.Pix[i+1] /= a
+			src.Pix[i+2] /= a
+		}
+	}
+
+	type coef struct {
+		x, y int
+		k    float64
+	}
+	var coefs []coef
+	i := 0
+	for y := 0; y < kernel.Height; y++ {
+		for x := 0; x < kernel.Width; x++ {
+			if values[i] != 0 {
+				coefs = append(coefs, coef{x: x - kernel.Width/2, y: y - kernel.Height/2, k: values[i]})
+			}
+			i++
+		}
+	}
+
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				var r, g, b float64
+				for _, c := range coefs {
+					ix, okx := options.Border.index(x+c.x, w)
+					iy, oky := options.Border.index(y+c.y, h)
+					if !okx || !oky {
+						r += cr * c.k
+						g += cg * c.k
+						b += cb * c.k
+						continue
+					}
+					off := iy*src.Stride + ix*4
+					s := src.Pix[off : off+3 : off+3]
+					r += float64(s[0]) * c.k
+					g += float64(s[1]) * c.k
+					b += float64(s[2]) * c.k
+				}
+
+				if options.Abs {
+					r, g, b = math.Abs(r), math.Abs(g), math.Abs(b)
+				}
+
+				off := y*dst.Stride + x*4
+				a := src.Pix[off+3]
+				d := dst.Pix[off : off+4 : off+4]
+				d[0] = float32(clampUnit(r+bias)) * a
+				d[1] = float32(clampUnit(g+bias)) * a
+				d[2] = float32(clampUnit(b+bias)) * a
+				d[3] = a
+			}
+		}
+	})
+
+	return dst
+}
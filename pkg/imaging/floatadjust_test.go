@@ -0,0 +1,176 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// gradient16 is a 16-bit ramp with steps far finer than 8 bits can hold
+func gradient16() *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		v := uint16(0x4000 + x*16)
+		img.SetNRGBA64(x, 0, color.NRGBA64{v, v, v, 0xffff})
+	}
+	return img
+}
+
+func TestAdjustFloat(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 11)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 0xff
+	}
+
+	// the float versions give the same colors as the 8-bit ones, sharpening
+	// and convolution work on the stored values so only match for sRGB
+	testCases := []struct {
+		name   string
+		eight  func(image.Image) *image.NRGBA
+		float  func(*FloatImage) *FloatImage
+		stored bool
+	}{
+		{"Grayscale", Grayscale, GrayscaleFloat, false},
+		{"Invert", Invert, InvertFloat, false},
+		{
+			"Saturation",
+			func(img image.Image) *image.NRGBA { return AdjustSaturation(img, 40) },
+			func(img *FloatImage) *FloatImage { return AdjustSaturationFloat(img, 40) },
+
+			false,
+		},
+		{
+			"Hue",
+			func(img image.Image) *image.NRGBA { return AdjustHue(img, -120) },
+			func(img *FloatImage) *FloatImage { return AdjustHueFloat(img, -120) },
+
+			false,
+		},
+		{
+			"Contrast",
+			func(img image.Image) *image.NRGBA { return AdjustContrast(img, 30) },
+			func(img *FloatImage) *FloatImage { return AdjustContrastFloat(img, 30) },
+
+			false,
+		},
+		{
+			"Brightness",
+			func(img image.Image) *image.NRGBA { return AdjustBrightness(img, -20) },
+			func(img *FloatImage) *FloatImage { return AdjustBrightnessFloat(img, -20) },
+
+			false,
+		},
+		{
+			"Gamma",
+			func(img image.Image) *image.NRGBA { return AdjustGamma(img, 1.8) },
+			func(img *FloatImage) *FloatImage { return AdjustGammaFloat(img, 1.8) },
+
+			false,
+		},
+		{
+			"Sigmoid",
+			func(img image.Image) *image.NRGBA { return AdjustSigmoid(img, 0.5, -3) },
+			func(img *FloatImage) *FloatImage { return AdjustSigmoidFloat(img, 0.5, -3) },
+
+			false,
+		},
+		{
+			"Sharpen",
+			func(img image.Image) *image.NRGBA { return Sharpen(img, 1) },
+			func(img *FloatImage) *FloatImage { return SharpenFloat(img, 1) },
+			true,
+		},
+		{
+			"Convolve",
+			func(img image.Image) *image.NRGBA {
+				return Convolve3x3(img, [9]float64{-1, -1, 0, -1, 0, 1, 0, 1, 1}, &ConvolveOptions{Bias: 128})
+			},
+			func(img *FloatImage) *FloatImage {
+				return Convolve3x3Float(img, [9]float64{-1, -1, 0, -1, 0, 1, 0, 1, 1}, &ConvolveOptions{Bias: 128})
+			},
+			true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.eight(src)
+			for _, linear := range []bool{false, true} {
+				got := tc.float(ToFloat(src, linear))
+				if got.Linear != linear {
+					t.Fatalf("linear %v: the result came back as linear %v", linear, got.Linear)
+				}
+				if linear && tc.stored {
+					continue
+				}
+				if !compareNRGBA(got.NRGBA(), want, 1) {
+					t.Errorf("linear %v: got %v want %v", linear, got.NRGBA().Pix[:16], want.Pix[:16])
+				}
+			}
+		})
+	}
+}
+
+func TestAdjustFloatPrecision(t *testing.T) {
+	src := gradient16()
+
+	// an 8-bit brightness change squashes the ramp to a handful of values
+	// while floats keep every step
+	steps := func(img image.Image) int {
+		seen := map[uint16]bool{}
+		for x := 0; x < 256; x++ {
+			r, _, _, _ := img.At(x, 0).RGBA()
+			seen[uint16(r)] = true
+		}
+		return len(seen)
+	}
+	if n := steps(AdjustBrightness(src, 10)); n > 20 {
+		t.Fatalf("8-bit brightness kept %d steps", n)
+	}
+	got := AdjustBrightnessFloat(ToFloat(src, false), 10).NRGBA64()
+	if n := steps(got); n != 256 {
+		t.Errorf("float brightness kept %d steps, want 256", n)
+	}
+	if c := got.NRGBA64At(0, 0); c.R < 0x4000+0x1999-1 || c.R > 0x4000+0x1999+1 {
+		t.Errorf("brightening %#x by 10%% gave %#x", 0x4000, c.R)
+	}
+
+	if HighBitDepth(image.NewNRGBA(image.Rect(0, 0, 1, 1))) || !HighBitDepth(src) || !HighBitDepth(ToFloat(src, false)) {
+		t.Error("HighBitDepth got the depth wrong")
+	}
+}
+
+func TestConvolveFloat(t *testing.T) {
+	src := ToFloat(gradient16(), false)
+	identity := [25]float64{12: 1}
+	got := Convolve5x5Float(src, identity, nil).NRGBA64()
+	if want := src.NRGBA64(); string(got.Pix) != string(want.Pix) {
+		t.Error("the identity kernel changed the image")
+	}
+
+	// transparent pixels stay transparent
+	clear := NewFloat(3, 3, false)
+	if got := Convolve3x3Float(clear, [9]float64{1, 1, 1, 1, 1, 1, 1, 1, 1}, &ConvolveOptions{Bias: 255}); got.Pix[4*4+3] != 0 || got.Pix[4*4] != 0 {
+		t.Errorf("got %v for a transparent pixel", got.Pix[4*4:4*4+4])
+	}
+}
+
+func TestToFloatConvert(t *testing.T) {
+	src := ToFloat(gradient16(), false)
+	linear := ToFloat(src, true)
+	if !linear.Linear {
+		t.Fatal("converting to linear didn't")
+	}
+	// mid grey is about a fifth of the light of white
+	if v := linear.Pix[0]; v < 0.04 || v > 0.06 {
+		t.Errorf("%#x as linear light is %v", 0x4000, v)
+	}
+	back := ToFloat(linear, false)
+	for i := range src.Pix {
+		if d := src.Pix[i] - back.Pix[i]; d > 1e-5 || d < -1e-5 {
+			t.Fatalf("round trip changed %v to %v", src.Pix[i], back.Pix[i])
+		}
+	}
+}
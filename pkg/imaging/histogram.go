@@ -50,3 +50,61 @@ func Histogram(img image.Image) [256]float64 {
 	}
 	return histogram
 }
+
+// Histograms holds a normalized histogram for each channel of an image.
+type Histograms struct {
+	Red, Green, Blue, Alpha, Luma [256]float64
+}
+
+// ChannelHistograms returns normalized histograms of the red, green, blue and alpha
+// channels of an image, along with the luminance histogram returned by Histogram.
+func ChannelHistograms(img image.Image) Histograms {
+	var mu sync.Mutex
+	var hist Histograms
+	var total float64
+
+	src := newScanner(img)
+	if src.w == 0 || src.h == 0 {
+		return hist
+	}
+
+	parallel(0, src.h, func(ys <-chan int) {
+		var tmp Histograms
+		var tmpTotal float64
+		scanLine := make([]uint8, src.w*4)
+		for y := range ys {
+			src.scan(0, y, src.w, y+1, scanLine)
+			i := 0
+			for x := 0; x < src.w; x++ {
+				s := scanLine[i : i+4 : i+4]
+				tmp.Red[s[0]]++
+				tmp.Green[s[1]]++
+				tmp.Blue[s[2]]++
+				tmp.Alpha[s[3]]++
+				y := 0.299*float32(s[0]) + 0.587*float32(s[1]) + 0.114*float32(s[2])
+				tmp.Luma[int(y+0.5)]++
+				tmpTotal++
+				i += 4
+			}
+		}
+		mu.Lock()
+		for i := 0; i < 256; i++ {
+			hist.Red[i] += tmp.Red[i]
+			hist.Green[i] += tmp.Green[i]
+			hist.Blue[i] += tmp.Blue[i]
+			hist.Alpha[i] += tmp.Alpha[i]
+			hist.Luma[i] += tmp.Luma[i]
+		}
+		total += tmpTotal
+		mu.Unlock()
+	})
+
+	for i := 0; i < 256; i++ {
+		hist.Red[i] /= total
+		hist.Green[i] /= total
+		hist.Blue[i] /= total
+		hist.Alpha[i] /= total
+		hist.Luma[i] /= total
+	}
+	return hist
+}
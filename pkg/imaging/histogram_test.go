@@ -51,6 +51,30 @@ func TestHistogram(t *testing.T) {
 	}
 }
 
+func TestChannelHistograms(t *testing.T) {
+	img := &image.NRGBA{
+		Rect:   image.Rect(-1, -1, 1, 1),
+		Stride: 2 * 4,
+		Pix: []uint8{
+			0x00, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0xff,
+			0xff, 0x80, 0x00, 0x80, 0xff, 0xff, 0xff, 0xff,
+		},
+	}
+	want := Histograms{
+		Red:   [256]float64{0x00: 0.25, 0xff: 0.75},
+		Green: [256]float64{0x00: 0.5, 0x80: 0.25, 0xff: 0.25},
+		Blue:  [256]float64{0x00: 0.75, 0xff: 0.25},
+		Alpha: [256]float64{0x80: 0.25, 0xff: 0.75},
+		Luma:  Histogram(img),
+	}
+	if got := ChannelHistograms(img); got != want {
+		t.Fatalf("got histograms %#v want %#v", got, want)
+	}
+	if got := ChannelHistograms(&image.NRGBA{}); got != (Histograms{}) {
+		t.Fatalf("got histograms %#v for an empty image", got)
+	}
+}
+
 func BenchmarkHistogram(b *testing.B) {
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
@@ -1,6 +1,7 @@
 package imaging
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"image"
@@ -14,8 +15,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"pix/pkg/icc"
+	"pix/pkg/pnm"
+	"pix/pkg/qoi"
+
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 type fileSystem interface {
@@ -32,10 +38,12 @@ var fs fileSystem = localFS{}
 
 type decodeConfig struct {
 	autoOrientation bool
+	convertProfile  bool
 }
 
 var defaultDecodeConfig = decodeConfig{
 	autoOrientation: false,
+	convertProfile:  false,
 }
 
 // DecodeOption sets an optional parameter for the Decode and Open functions.
@@ -50,6 +58,16 @@ func AutoOrientation(enabled bool) DecodeOption {
 	}
 }
 
+// ConvertProfile returns a DecodeOption that sets the color profile conversion mode.
+// If it's enabled, PNG and JPEG images with an embedded ICC profile, like Display P3
+// or Adobe RGB, are converted to sRGB after decoding. Profiles that can't be converted
+// are ignored. By default it's disabled.
+func ConvertProfile(enabled bool) DecodeOption {
+	return func(c *decodeConfig) {
+		c.convertProfile = enabled
+	}
+}
+
 // Decode reads an image from r.
 func Decode(r io.Reader, opts ...DecodeOption) (image.Image, error) {
 	cfg := defaultDecodeConfig
@@ -57,6 +75,39 @@ func Decode(r io.Reader, opts ...DecodeOption) (image.Image, error) {
 		option(&cfg)
 	}
 
+	if !cfg.convertProfile {
+		return decode(r, cfg)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := decode(bytes.NewReader(data), cfg)
+	if err != nil {
+		return nil, err
+	}
+	return convertProfile(img, data), nil
+}
+
+// convertProfile converts img to sRGB from the profile embedded in data, if it has one.
+func convertProfile(img image.Image, data []byte) image.Image {
+	profile, err := icc.Extract(data)
+	if err != nil || profile == nil {
+		return img
+	}
+	p, err := icc.Parse(profile)
+	if err != nil || p.IsSRGB() {
+		return img
+	}
+	t, err := icc.NewTransform(p)
+	if err != nil {
+		return img
+	}
+	return t.Image(img)
+}
+
+func decode(r io.Reader, cfg decodeConfig) (image.Image, error) {
 	if !cfg.autoOrientation {
 		img, _, err := image.Decode(r)
 		return img, err
@@ -111,6 +162,12 @@ const (
 	GIF
 	TIFF
 	BMP
+	WEBP
+	QOI
+	PBM
+	PGM
+	PPM
+	PAM
 )
 
 var formatExts = map[string]Format{
@@ -121,6 +178,13 @@ var formatExts = map[string]Format{
 	"tif":  TIFF,
 	"tiff": TIFF,
 	"bmp":  BMP,
+	"webp": WEBP,
+	"qoi":  QOI,
+	"pbm":  PBM,
+	"pgm":  PGM,
+	"ppm":  PPM,
+	"pnm":  PPM,
+	"pam":  PAM,
 }
 
 var formatNames = map[Format]string{
@@ -129,6 +193,12 @@ var formatNames = map[Format]string{
 	GIF:  "GIF",
 	TIFF: "TIFF",
 	BMP:  "BMP",
+	WEBP: "WEBP",
+	QOI:  "QOI",
+	PBM:  "PBM",
+	PGM:  "PGM",
+	PPM:  "PPM",
+	PAM:  "PAM",
 }
 
 func (f Format) String() string {
@@ -139,7 +209,8 @@ func (f Format) String() string {
 var ErrUnsupportedFormat = errors.New("imaging: unsupported image format")
 
 // FormatFromExtension parses image format from filename extension:
-// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff") and "bmp" are supported.
+// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff"), "bmp", "webp", "qoi",
+// "pbm", "pgm", "ppm" (or "pnm") and "pam" are supported.
 func FormatFromExtension(ext string) (Format, error) {
 	if f, ok := formatExts[strings.ToLower(strings.TrimPrefix(ext, "."))]; ok {
 		return f, nil
@@ -148,7 +219,8 @@ func FormatFromExtension(ext string) (Format, error) {
 }
 
 // FormatFromFilename parses image format from filename:
-// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff") and "bmp" are supported.
+// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff"), "bmp", "webp", "qoi",
+// "pbm", "pgm", "ppm" (or "pnm") and "pam" are supported.
 func FormatFromFilename(filename string) (Format, error) {
 	ext := filepath.Ext(filename)
 	return FormatFromExtension(ext)
@@ -160,6 +232,7 @@ type encodeConfig struct {
 	gifQuantizer        draw.Quantizer
 	gifDrawer           draw.Drawer
 	pngCompressionLevel png.CompressionLevel
+	tagSRGB             bool
 }
 
 var defaultEncodeConfig = encodeConfig{
@@ -168,6 +241,7 @@ var defaultEncodeConfig = encodeConfig{
 	gifQuantizer:        nil,
 	gifDrawer:           nil,
 	pngCompressionLevel: png.DefaultCompression,
+	tagSRGB:             false,
 }
 
 // EncodeOption sets an optional parameter for the Encode and Save functions.
@@ -213,13 +287,36 @@ func PNGCompressionLevel(level png.CompressionLevel) EncodeOption {
 	}
 }
 
-// Encode writes the image img to w in the specified format (JPEG, PNG, GIF, TIFF or BMP).
+// TagSRGB returns an EncodeOption that marks PNG and JPEG images as sRGB: PNG images
+// get an sRGB chunk and JPEG images an embedded sRGB ICC profile. Other formats are
+// written as they are. By default it's disabled.
+func TagSRGB(enabled bool) EncodeOption {
+	return func(c *encodeConfig) {
+		c.tagSRGB = enabled
+	}
+}
+
+// Encode writes the image img to w in the specified format (JPEG, PNG, GIF, TIFF, BMP,
+// QOI, PBM, PGM, PPM or PAM). WebP can only be decoded, encoding it returns ErrUnsupportedFormat.
 func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) error {
 	cfg := defaultEncodeConfig
 	for _, option := range opts {
 		option(&cfg)
 	}
 
+	if cfg.tagSRGB && (format == JPEG || format == PNG) {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, format, append(opts[:len(opts):len(opts)], TagSRGB(false))...); err != nil {
+			return err
+		}
+		tag := icc.TagPNG
+		if format == JPEG {
+			tag = icc.TagJPEG
+		}
+		_, err := w.Write(tag(buf.Bytes()))
+		return err
+	}
+
 	switch format {
 	case JPEG:
 		if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Opaque() {
@@ -248,6 +345,21 @@ func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) e
 
 	case BMP:
 		return bmp.Encode(w, img)
+
+	case QOI:
+		return qoi.Encode(w, img)
+
+	case PBM:
+		return pnm.Encode(w, img, pnm.PBM)
+
+	case PGM:
+		return pnm.Encode(w, img, pnm.PGM)
+
+	case PPM:
+		return pnm.Encode(w, img, pnm.PPM)
+
+	case PAM:
+		return pnm.Encode(w, img, pnm.PAM)
 	}
 
 	return ErrUnsupportedFormat
@@ -255,7 +367,8 @@ func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) e
 
 // Save saves the image to file with the specified filename.
 // The format is determined from the filename extension:
-// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff") and "bmp" are supported.
+// "jpg" (or "jpeg"), "png", "gif", "tif" (or "tiff"), "bmp", "qoi",
+// "pbm", "pgm", "ppm" (or "pnm") and "pam" are supported.
 //
 // Examples:
 //
@@ -270,6 +383,9 @@ func Save(img image.Image, filename string, opts ...EncodeOption) (err error) {
 	if err != nil {
 		return err
 	}
+	if f == WEBP {
+		return ErrUnsupportedFormat
+	}
 	file, err := fs.Create(filename)
 	if err != nil {
 		return err
@@ -2,7 +2,10 @@ package imaging
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"image"
 	"image/color"
 	"image/color/palette"
@@ -14,6 +17,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"pix/pkg/icc"
 )
 
 var (
@@ -99,11 +104,11 @@ func TestOpenSave(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	for _, ext := range []string{"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff"} {
+	for _, ext := range []string{"jpg", "jpeg", "png", "gif", "bmp", "tif", "tiff", "qoi", "ppm", "pam"} {
 		filename := filepath.Join(dir, "test."+ext)
 
 		img := imgWithoutAlpha
-		if ext == "png" {
+		if ext == "png" || ext == "qoi" || ext == "pam" {
 			img = imgWithAlpha
 		}
 
@@ -153,6 +158,11 @@ func TestOpenSave(t *testing.T) {
 		t.Fatalf("got %v want ErrUnsupportedFormat", err)
 	}
 
+	err = Save(imgWithAlpha, filepath.Join(dir, "test.webp"))
+	if err != ErrUnsupportedFormat {
+		t.Fatalf("got %v want ErrUnsupportedFormat", err)
+	}
+
 	prevFS := fs
 	fs = badFS{}
 	defer func() { fs = prevFS }()
@@ -180,6 +190,12 @@ func TestFormats(t *testing.T) {
 		GIF:        "GIF",
 		BMP:        "BMP",
 		TIFF:       "TIFF",
+		WEBP:       "WEBP",
+		QOI:        "QOI",
+		PBM:        "PBM",
+		PGM:        "PGM",
+		PPM:        "PPM",
+		PAM:        "PAM",
 		Format(-1): "",
 	}
 	for format, name := range formatNames {
@@ -212,6 +228,16 @@ func TestFormatFromExtension(t *testing.T) {
 			ext:  ".JPG",
 			want: JPEG,
 		},
+		{
+			name: "pnm is ppm",
+			ext:  ".pnm",
+			want: PPM,
+		},
+		{
+			name: "webp",
+			ext:  "webp",
+			want: WEBP,
+		},
 		{
 			name: "unsupported",
 			ext:  ".unsupportedextension",
@@ -433,3 +459,115 @@ func TestAutoOrientation(t *testing.T) {
 		t.Fatal("expected error got nil")
 	}
 }
+
+// withProfile embeds an ICC profile in a PNG
+func withProfile(t *testing.T, img image.Image, profile []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(profile)
+	zw.Close()
+	body := append([]byte("test\x00\x00"), z.Bytes()...)
+
+	// the chunk goes right after the 8 byte signature and the 25 byte header
+	out := append([]byte(nil), buf.Bytes()[:33]...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(body)))
+	chunk := append([]byte("iCCP"), body...)
+	out = append(out, chunk...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(chunk))
+	return append(out, buf.Bytes()[33:]...)
+}
+
+// displayP3 swaps the colorants of the sRGB profile for the P3 ones, the curve is the same
+func displayP3() []byte {
+	p := append([]byte(nil), icc.SRGB()...)
+	colorants := map[string][3]float64{
+		"rXYZ": {0.5151, 0.2412, -0.0011},
+		"gXYZ": {0.2920, 0.6922, 0.0419},
+		"bXYZ": {0.1571, 0.0666, 0.7841},
+	}
+	count := int(binary.BigEndian.Uint32(p[128:]))
+	for i := 0; i < count; i++ {
+		e := p[132+i*12:]
+		xyz, ok := colorants[string(e[:4])]
+		if !ok {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(e[4:]))
+		for j, v := range xyz {
+			binary.BigEndian.PutUint32(p[offset+8+4*j:], uint32(int32(v*65536)))
+		}
+	}
+	return p
+}
+
+func TestConvertProfile(t *testing.T) {
+	orange := color.NRGBA{200, 100, 50, 255}
+	data := withProfile(t, New(2, 2, orange), displayP3())
+
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(0, 0)); c != orange {
+		t.Errorf("without conversion the color changed to %v", c)
+	}
+
+	img, err = Decode(bytes.NewReader(data), ConvertProfile(true), AutoOrientation(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// p3 orange is more saturated than sRGB can show
+	if c := color.NRGBAModel.Convert(img.At(1, 1)).(color.NRGBA); c.R <= orange.R || c.B >= orange.B {
+		t.Errorf("converting from display p3 gave %v", c)
+	}
+
+	// an sRGB profile changes nothing
+	img, err = Decode(bytes.NewReader(withProfile(t, New(2, 2, orange), icc.SRGB())), ConvertProfile(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(img.At(0, 0)); c != orange {
+		t.Errorf("an sRGB profile changed the color to %v", c)
+	}
+}
+
+func TestTagSRGB(t *testing.T) {
+	img := New(4, 4, color.NRGBA{10, 200, 30, 255})
+
+	for _, format := range []Format{PNG, JPEG} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, format, TagSRGB(true)); err != nil {
+			t.Fatal(err)
+		}
+		profile, err := icc.Extract(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch format {
+		case PNG:
+			if profile != nil || !bytes.Contains(buf.Bytes(), []byte("sRGB")) {
+				t.Error("no sRGB chunk in the png")
+			}
+		case JPEG:
+			if !bytes.Equal(profile, icc.SRGB()) {
+				t.Error("no sRGB profile in the jpeg")
+			}
+		}
+		if _, err := Decode(&buf, ConvertProfile(true)); err != nil {
+			t.Errorf("%v: tagged image doesn't decode: %v", format, err)
+		}
+	}
+
+	// other formats are left as they are
+	var tagged, plain bytes.Buffer
+	Encode(&tagged, img, BMP, TagSRGB(true))
+	Encode(&plain, img, BMP)
+	if !bytes.Equal(tagged.Bytes(), plain.Bytes()) {
+		t.Error("tagging changed a bmp")
+	}
+}
@@ -0,0 +1,315 @@
+package imaging
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kernel is a convolution kernel of any size. Values holds Width x Height
+// weights row by row from the top, the pixel being computed sits under the
+// middle weight, or the one right and below of the middle for even sizes.
+type Kernel struct {
+	Width, Height int
+	Values        []float64
+}
+
+// valid reports whether the kernel has a size and values to fill it
+func (k Kernel) valid() bool {
+	return k.Width > 0 && k.Height > 0 && len(k.Values) == k.Width*k.Height
+}
+
+// Separable reports whether the kernel is the product of a column and a row,
+// like box and gaussian blurs are. Convolving with the row and then the
+// column gives the same result as the kernel in Width + Height steps per
+// pixel instead of Width x Height.
+func (k Kernel) Separable() (column, row []float64, ok bool) {
+	if !k.valid() {
+		return nil, nil, false
+	}
+
+	// the largest weight is the most accurate pivot
+	pi, pj, peak := 0, 0, 0.0
+	for i := 0; i < k.Height; i++ {
+		for j := 0; j < k.Width; j++ {
+			if v := math.Abs(k.Values[i*k.Width+j]); v > peak {
+				pi, pj, peak = i, j, v
+			}
+		}
+	}
+	if peak == 0 {
+		return nil, nil, false
+	}
+
+	row = append([]float64(nil), k.Values[pi*k.Width:(pi+1)*k.Width]...)
+	column = make([]float64, k.Height)
+	for i := range column {
+		column[i] = k.Values[i*k.Width+pj] / k.Values[pi*k.Width+pj]
+	}
+
+	for i := 0; i < k.Height; i++ {
+		for j := 0; j < k.Width; j++ {
+			if math.Abs(k.Values[i*k.Width+j]-column[i]*row[j]) > 1e-9*peak {
+				return nil, nil, false
+			}
+		}
+	}
+	return column, row, true
+}
+
+// Border is how a convolution reads pixels past the edges of the image.
+type Border int
+
+const (
+	// BorderClamp repeats the edge pixels.
+	BorderClamp Border = iota
+
+	// BorderWrap tiles the image, reading from the opposite edge.
+	BorderWrap
+
+	// BorderMirror reflects the image around its edge pixels.
+	BorderMirror
+
+	// BorderConstant reads the Constant color of the ConvolveOptions.
+	BorderConstant
+)
+
+var borderNames = []string{"clamp", "wrap", "mirror", "constant"}
+
+// ParseBorder returns the border mode with the given name.
+func ParseBorder(s string) (Border, error) {
+	for i, name := range borderNames {
+		if strings.EqualFold(s, name) {
+			return Border(i), nil
+		}
+	}
+	return BorderClamp, fmt.Errorf("unknown border %q: must be one of [%s]", s, strings.Join(borderNames, "|"))
+}
+
+func (b Border) String() string {
+	if b < 0 || int(b) >= len(borderNames) {
+		return fmt.Sprintf("Border(%d)", int(b))
+	}
+	return borderNames[b]
+}
+
+// index maps i onto 0 - n-1, false means it is past the edge of a constant
+// border
+func (b Border) index(i, n int) (int, bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+
+	switch b {
+	case BorderWrap:
+		if i %= n; i < 0 {
+			i += n
+		}
+		return i, true
+	case BorderMirror:
+		if n == 1 {
+			return 0, true
+		}
+		period := 2 * (n - 1)
+		if i %= period; i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - i
+		}
+		return i, true
+	case BorderConstant:
+		return 0, false
+	}
+	return min(max(i, 0), n-1), true
+}
+
+// BoxKernel is a size x size kernel averaging every pixel under it.
+func BoxKernel(size int) Kernel {
+	size = max(size, 1)
+	k := Kernel{Width: size, Height: size, Values: make([]float64, size*size)}
+	for i := range k.Values {
+		k.Values[i] = 1 / float64(size*size)
+	}
+	return k
+}
+
+// GaussianKernel is a gaussian blur of sigma, reaching out 3 sigma.
+func GaussianKernel(sigma float64) Kernel {
+	if sigma <= 0 {
+		return Kernel{Width: 1, Height: 1, Values: []float64{1}}
+	}
+
+	radius := int(math.Ceil(sigma * 3))
+	size := 2*radius + 1
+	line := make([]float64, size)
+	var sum float64
+	for i := range line {
+		d := float64(i - radius)
+		line[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += line[i]
+	}
+
+	k := Kernel{Width: size, Height: size, Values: make([]float64, size*size)}
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			k.Values[i*size+j] = line[i] * line[j] / (sum * sum)
+		}
+	}
+	return k
+}
+
+// MotionBlurKernel smears the image along a line of length pixels through the
+// center, at angle degrees counter-clockwise from the horizontal.
+func MotionBlurKernel(length int, angle float64) Kernel {
+	// an odd size keeps the line centered
+	size := max(length, 1) | 1
+	k := Kernel{Width: size, Height: size, Values: make([]float64, size*size)}
+
+	c := size / 2
+	cos, sin := math.Cos(angle*math.Pi/180), math.Sin(angle*math.Pi/180)
+	half := float64(max(length, 1)) / 2
+
+	// every pixel is covered by how close it is to the line and how much of
+	// it lies within the length, y points down so the angle turns it around
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x-c), float64(c-y)
+			along := math.Abs(dx*cos + dy*sin)
+			across := math.Abs(-dx*sin + dy*cos)
+			k.Values[y*size+x] = math.Max(1-across, 0) * math.Min(math.Max(half+0.5-along, 0), 1)
+		}
+	}
+
+	normalizeKernel(k.Values)
+	return k
+}
+
+// UnsharpKernel sharpens by adding amount times the difference between the
+// image and a gaussian blur of sigma to the image.
+func UnsharpKernel(sigma, amount float64) Kernel {
+	k := GaussianKernel(sigma)
+	for i := range k.Values {
+		k.Values[i] *= -amount
+	}
+	k.Values[len(k.Values)/2] += 1 + amount
+	return k
+}
+
+// fixedKernels are the built-in kernels without settings
+var fixedKernels = map[string]Kernel{
+	"sharpen": {3, 3, []float64{0, -1, 0, -1, 5, -1, 0, -1, 0}},
+	"outline": {3, 3, []float64{-1, -1, -1, -1, 8, -1, -1, -1, -1}},
+	"ridge":   {3, 3, []float64{0, -1, 0, -1, 4, -1, 0, -1, 0}},
+	"emboss":  {3, 3, []float64{-2, -1, 0, -1, 1, 1, 0, 1, 2}},
+}
+
+// ParseKernel reads a kernel written out as its size and weights, with an
+// optional divisor for all the weights:
+//
+//	3x3: 0 -1 0 -1 5 -1 0 -1 0
+//	3x3/16: 1 2 1, 2 4 2, 1 2 1
+//
+// Weights are separated by spaces, commas or new lines and # starts a
+// comment, so the same text works as a kernel file. It also knows built-in
+// kernels by name, with optional comma separated settings:
+//
+//	box:size              (3)
+//	gaussian:sigma        (1)
+//	motion:length,angle   (9,0)
+//	unsharp:sigma,amount  (1,1)
+//	sharpen, outline, ridge, emboss
+func ParseKernel(spec string) (Kernel, error) {
+	var lines []string
+	for _, line := range strings.Split(spec, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		lines = append(lines, line)
+	}
+	spec = strings.TrimSpace(strings.Join(lines, "\n"))
+
+	name, args, _ := strings.Cut(spec, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	values := strings.FieldsFunc(args, func(r rune) bool { return unicode.IsSpace(r) || r == ',' })
+
+	if k, ok := fixedKernels[name]; ok {
+		if len(values) > 0 {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %s has no settings", spec, name)
+		}
+		return Kernel{k.Width, k.Height, append([]float64(nil), k.Values...)}, nil
+	}
+
+	switch name {
+	case "box":
+		v, err := parseKernelFloats(values, 3)
+		if err != nil {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %w", spec, err)
+		}
+		return BoxKernel(int(v[0])), nil
+	case "gaussian":
+		v, err := parseKernelFloats(values, 1)
+		if err != nil {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %w", spec, err)
+		}
+		return GaussianKernel(v[0]), nil
+	case "motion":
+		v, err := parseKernelFloats(values, 9, 0)
+		if err != nil {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %w", spec, err)
+		}
+		return MotionBlurKernel(int(v[0]), v[1]), nil
+	case "unsharp":
+		v, err := parseKernelFloats(values, 1, 1)
+		if err != nil {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %w", spec, err)
+		}
+		return UnsharpKernel(v[0], v[1]), nil
+	}
+
+	size, divisor, hasDivisor := strings.Cut(name, "/")
+	ws, hs, ok := strings.Cut(size, "x")
+	if !ok {
+		return Kernel{}, fmt.Errorf("unknown kernel %q: must be WxH: weights or one of [box|gaussian|motion|unsharp|sharpen|outline|ridge|emboss]", spec)
+	}
+	w, errw := strconv.Atoi(ws)
+	h, errh := strconv.Atoi(hs)
+	if errw != nil || errh != nil || w < 1 || h < 1 {
+		return Kernel{}, fmt.Errorf("bad kernel %q: %q is not a size", spec, size)
+	}
+	if len(values) != w*h {
+		return Kernel{}, fmt.Errorf("bad kernel %q: %dx%d needs %d weights, got %d", spec, w, h, w*h, len(values))
+	}
+
+	v, err := parseKernelFloats(values, make([]float64, w*h)...)
+	if err != nil {
+		return Kernel{}, fmt.Errorf("bad kernel %q: %w", spec, err)
+	}
+	if hasDivisor {
+		d, err := strconv.ParseFloat(divisor, 64)
+		if err != nil || d == 0 {
+			return Kernel{}, fmt.Errorf("bad kernel %q: %q is not a divisor", spec, divisor)
+		}
+		for i := range v {
+			v[i] /= d
+		}
+	}
+	return Kernel{Width: w, Height: h, Values: v}, nil
+}
+
+// parseKernelFloats parses up to len(defaults) values, missing ones are the
+// defaults
+func parseKernelFloats(values []string, defaults ...float64) ([]float64, error) {
+	if len(values) > len(defaults) {
+		return nil, fmt.Errorf("expected at most %d values", len(defaults))
+	}
+	out := append([]float64(nil), defaults...)
+	for i, s := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
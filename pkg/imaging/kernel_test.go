@@ -0,0 +1,202 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestParseKernel(t *testing.T) {
+	testCases := []struct {
+		spec string
+		w, h int
+		want []float64
+	}{
+		{"3x3: 0 -1 0 -1 5 -1 0 -1 0", 3, 3, []float64{0, -1, 0, -1, 5, -1, 0, -1, 0}},
+		{"3x1/4: 1, 2, 1", 3, 1, []float64{0.25, 0.5, 0.25}},
+		{"# a kernel file\n2x2:\n 1 2 # top\n 3 4\n", 2, 2, []float64{1, 2, 3, 4}},
+		{"box:2", 2, 2, []float64{0.25, 0.25, 0.25, 0.25}},
+		{"Outline", 3, 3, []float64{-1, -1, -1, -1, 8, -1, -1, -1, -1}},
+		{"motion:3", 3, 3, []float64{0, 0, 0, 1.0 / 3, 1.0 / 3, 1.0 / 3, 0, 0, 0}},
+		{"motion:3,90", 3, 3, []float64{0, 1.0 / 3, 0, 0, 1.0 / 3, 0, 0, 1.0 / 3, 0}},
+	}
+	for _, tc := range testCases {
+		k, err := ParseKernel(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.spec, err)
+		}
+		if k.Width != tc.w || k.Height != tc.h || len(k.Values) != len(tc.want) {
+			t.Fatalf("%q: got %dx%d %v", tc.spec, k.Width, k.Height, k.Values)
+		}
+		for i := range tc.want {
+			if math.Abs(k.Values[i]-tc.want[i]) > 1e-9 {
+				t.Fatalf("%q: got %v want %v", tc.spec, k.Values, tc.want)
+			}
+		}
+	}
+
+	for _, spec := range []string{"", "nope", "3x3: 1 2", "3x: 1", "0x0:", "2x1/0: 1 1", "3x1: 1 a 1", "box:1,2", "sharpen:2"} {
+		if _, err := ParseKernel(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestKernels(t *testing.T) {
+	for name, k := range map[string]Kernel{
+		"box":      BoxKernel(4),
+		"gaussian": GaussianKernel(1.5),
+		"motion":   MotionBlurKernel(12, 33),
+		"unsharp":  UnsharpKernel(1, 2),
+	} {
+		var sum float64
+		for _, v := range k.Values {
+			sum += v
+		}
+		if !k.valid() || math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%s: %dx%d sums to %v", name, k.Width, k.Height, sum)
+		}
+	}
+
+	// a diagonal line is the same mirrored through the center
+	k := MotionBlurKernel(9, 45)
+	for i, v := range k.Values {
+		if math.Abs(v-k.Values[len(k.Values)-1-i]) > 1e-9 {
+			t.Fatalf("motion blur isn't symmetric: %v", k.Values)
+		}
+	}
+}
+
+func TestSeparable(t *testing.T) {
+	if _, _, ok := GaussianKernel(2).Separable(); !ok {
+		t.Error("gaussian should be separable")
+	}
+	column, row, ok := Kernel{3, 2, []float64{1, 2, 3, -2, -4, -6}}.Separable()
+	if !ok {
+		t.Fatal("outer product should be separable")
+	}
+	for i := range column {
+		for j := range row {
+			if got := column[i] * row[j]; got != []float64{1, 2, 3, -2, -4, -6}[i*3+j] {
+				t.Fatalf("%v x %v", column, row)
+			}
+		}
+	}
+	for _, name := range []string{"outline", "sharpen", "emboss"} {
+		if _, _, ok := fixedKernels[name].Separable(); ok {
+			t.Errorf("%s shouldn't be separable", name)
+		}
+	}
+}
+
+func TestBorderIndex(t *testing.T) {
+	testCases := []struct {
+		border Border
+		want   []int // for -3 to 6 in 0 - 3
+	}{
+		{BorderClamp, []int{0, 0, 0, 0, 1, 2, 3, 3, 3, 3}},
+		{BorderWrap, []int{1, 2, 3, 0, 1, 2, 3, 0, 1, 2}},
+		{BorderMirror, []int{3, 2, 1, 0, 1, 2, 3, 2, 1, 0}},
+		{BorderConstant, []int{-1, -1, -1, 0, 1, 2, 3, -1, -1, -1}},
+	}
+	for _, tc := range testCases {
+		for i, want := range tc.want {
+			got, ok := tc.border.index(i-3, 4)
+			if !ok {
+				got = -1
+			}
+			if got != want {
+				t.Errorf("%v: %d maps to %d want %d", tc.border, i-3, got, want)
+			}
+		}
+		if b, err := ParseBorder(tc.border.String()); err != nil || b != tc.border {
+			t.Errorf("parsed %v, %v", b, err)
+		}
+	}
+	if _, err := ParseBorder("repeat"); err == nil {
+		t.Error("expected an error for an unknown border")
+	}
+}
+
+func TestConvolveBorders(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	for x := 0; x < 4; x++ {
+		src.SetNRGBA(x, 0, color.NRGBA{uint8(10 * (x + 1)), 0, 0, 255})
+	}
+	// reads the pixel two to the left
+	shift := Kernel{Width: 5, Height: 1, Values: []float64{1, 0, 0, 0, 0}}
+
+	testCases := []struct {
+		options ConvolveOptions
+		want    []uint8
+	}{
+		{ConvolveOptions{}, []uint8{10, 10, 10, 20}},
+		{ConvolveOptions{Border: BorderWrap}, []uint8{30, 40, 10, 20}},
+		{ConvolveOptions{Border: BorderMirror}, []uint8{30, 20, 10, 20}},
+		{ConvolveOptions{Border: BorderConstant, Constant: color.NRGBA{R: 99}}, []uint8{99, 99, 10, 20}},
+	}
+	for _, tc := range testCases {
+		got := Convolve(src, shift, &tc.options)
+		for x, want := range tc.want {
+			if c := got.NRGBAAt(x, 0); c.R != want || c.A != 255 {
+				t.Errorf("%v: pixel %d is %v want %d", tc.options.Border, x, c, want)
+			}
+		}
+	}
+}
+
+func TestConvolveSeparable(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 23, 17))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 37)
+	}
+
+	kernel := GaussianKernel(1.5)
+	for _, border := range []Border{BorderClamp, BorderWrap, BorderMirror, BorderConstant} {
+		options := &ConvolveOptions{Border: border, Constant: color.NRGBA{200, 100, 50, 255}}
+		got := Convolve(src, kernel, options)
+
+		want := image.NewNRGBA(got.Rect)
+		convolve(src, want, kernel, options)
+		if !compareNRGBA(got, want, 1) {
+			t.Errorf("%v: separable result differs from the full kernel", border)
+		}
+	}
+
+	if got := Convolve(src, Kernel{Width: 3, Height: 3}, nil); !compareNRGBA(got, src, 0) {
+		t.Error("an empty kernel should leave the image alone")
+	}
+
+	// the fixed size kernels always take the full kernel, so their output
+	// can't drift with the order the split adds things up in
+	for _, kernel := range []Kernel{GaussianKernel(0.6), BoxKernel(5)} {
+		var k5 [25]float64
+		copy(k5[:], kernel.Values)
+		got := Convolve5x5(src, k5, nil)
+		want := image.NewNRGBA(got.Rect)
+		convolve(src, want, Kernel{5, 5, k5[:]}, &ConvolveOptions{})
+		if !compareNRGBA(got, want, 0) {
+			t.Errorf("Convolve5x5 %v differs from the full kernel", k5)
+		}
+	}
+}
+
+func TestConvolveFloatBorders(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 9, 7))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 53)
+	}
+	for i := 3; i < len(src.Pix); i += 4 {
+		src.Pix[i] = 0xff
+	}
+
+	kernel := MotionBlurKernel(5, 20)
+	for _, border := range []Border{BorderClamp, BorderWrap, BorderMirror, BorderConstant} {
+		options := &ConvolveOptions{Border: border, Constant: color.NRGBA{R: 255}}
+		got := ConvolveFloat(ToFloat(src, false), kernel, options).NRGBA()
+		if want := Convolve(src, kernel, options); !compareNRGBA(got, want, 1) {
+			t.Errorf("%v: float result differs from 8 bits", border)
+		}
+	}
+}
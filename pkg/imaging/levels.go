@@ -0,0 +1,421 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Channel selects the color channels an adjustment is applied to.
+type Channel int
+
+const (
+	// ChannelRGB applies the adjustment to the red, green and blue channels alike.
+	ChannelRGB Channel = iota
+	// ChannelRed applies the adjustment to the red channel only.
+	ChannelRed
+	// ChannelGreen applies the adjustment to the green channel only.
+	ChannelGreen
+	// ChannelBlue applies the adjustment to the blue channel only.
+	ChannelBlue
+)
+
+// adjustChannel applies the lookup table to the selected channels and leaves the rest as they are.
+func adjustChannel(img image.Image, ch Channel, lut []uint8) *image.NRGBA {
+	id := identityLUT()
+	switch ch {
+	case ChannelRed:
+		return adjustLUTs(img, lut, id, id)
+	case ChannelGreen:
+		return adjustLUTs(img, id, lut, id)
+	case ChannelBlue:
+		return adjustLUTs(img, id, id, lut)
+	}
+	return adjustLUT(img, lut)
+}
+
+func identityLUT() []uint8 {
+	lut := make([]uint8, 256)
+	for i := range lut {
+		lut[i] = uint8(i)
+	}
+	return lut
+}
+
+// Levels describes an input and output levels adjustment. Input values at or below
+// InBlack become OutBlack and values at or above InWhite become OutWhite, with the
+// values in between spread along a gamma curve. A Gamma greater than 1.0 lightens
+// the midtones and less than 1.0 darkens them, 0 is taken as 1.0.
+type Levels struct {
+	InBlack, InWhite   uint8
+	Gamma              float64
+	OutBlack, OutWhite uint8
+}
+
+func (l Levels) lut() []uint8 {
+	gamma := l.Gamma
+	if gamma <= 0 {
+		gamma = 1
+	}
+	e := 1.0 / gamma
+	lo, hi := float64(l.OutBlack), float64(l.OutWhite)
+
+	lut := make([]uint8, 256)
+	for i := range lut {
+		var v float64
+		if l.InWhite <= l.InBlack {
+			// no input range left, threshold at the black point
+			if i > int(l.InBlack) {
+				v = 1
+			}
+		} else {
+			v = (float64(i) - float64(l.InBlack)) / (float64(l.InWhite) - float64(l.InBlack))
+			v = math.Pow(math.Min(math.Max(v, 0), 1), e)
+		}
+		lut[i] = clamp(lo + v*(hi-lo))
+	}
+	return lut
+}
+
+// AdjustLevels remaps the levels of the selected channels of the image and returns the adjusted image.
+// An OutWhite lower than OutBlack inverts the channel.
+//
+// Examples:
+//
+//	dstImage = imaging.AdjustLevels(srcImage, imaging.ChannelRGB, imaging.Levels{InBlack: 20, InWhite: 235, Gamma: 1.2, OutWhite: 255})
+//	dstImage = imaging.AdjustLevels(srcImage, imaging.ChannelBlue, imaging.Levels{InWhite: 255, Gamma: 0.8, OutBlack: 30, OutWhite: 255})
+func AdjustLevels(img image.Image, ch Channel, l Levels) *image.NRGBA {
+	return adjustChannel(img, ch, l.lut())
+}
+
+// Curve is a tone curve through control points, X is the input and Y the output
+// level from 0 to 255. The points are joined by a monotone cubic spline, so the
+// curve never overshoots between them, and it is flat before the first and after
+// the last point. An empty curve leaves the levels as they are.
+type Curve []image.Point
+
+func (c Curve) lut() []uint8 {
+	if len(c) == 0 {
+		return identityLUT()
+	}
+
+	pts := make([]image.Point, len(c))
+	for i, p := range c {
+		pts[i] = image.Pt(clampInt(p.X, 0, 255), clampInt(p.Y, 0, 255))
+	}
+	sort.SliceStable(pts, func(i, j int) bool { return pts[i].X < pts[j].X })
+	// a later point with the same input replaces the earlier one
+	n := 0
+	for _, p := range pts {
+		if n > 0 && pts[n-1].X == p.X {
+			pts[n-1] = p
+			continue
+		}
+		pts[n] = p
+		n++
+	}
+	pts = pts[:n]
+
+	lut := make([]uint8, 256)
+	if n == 1 {
+		for i := range lut {
+			lut[i] = uint8(pts[0].Y)
+		}
+		return lut
+	}
+
+	// Fritsch-Carlson tangents
+	delta := make([]float64, n-1)
+	for k := range delta {
+		delta[k] = float64(pts[k+1].Y-pts[k].Y) / float64(pts[k+1].X-pts[k].X)
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = delta[0], delta[n-2]
+	for k := 1; k < n-1; k++ {
+		if delta[k-1]*delta[k] > 0 {
+			m[k] = (delta[k-1] + delta[k]) / 2
+		}
+	}
+	for k, d := range delta {
+		if d == 0 {
+			m[k], m[k+1] = 0, 0
+			continue
+		}
+		a, b := m[k]/d, m[k+1]/d
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			m[k], m[k+1] = t*a*d, t*b*d
+		}
+	}
+
+	k := 0
+	for i := range lut {
+		switch {
+		case i <= pts[0].X:
+			lut[i] = uint8(pts[0].Y)
+		case i >= pts[n-1].X:
+			lut[i] = uint8(pts[n-1].Y)
+		default:
+			for i > pts[k+1].X {
+				k++
+			}
+			h := float64(pts[k+1].X - pts[k].X)
+			t := (float64(i) - float64(pts[k].X)) / h
+			t2, t3 := t*t, t*t*t
+			v := (2*t3-3*t2+1)*float64(pts[k].Y) + (t3-2*t2+t)*h*m[k] +
+				(-2*t3+3*t2)*float64(pts[k+1].Y) + (t3-t2)*h*m[k+1]
+			lut[i] = clamp(v)
+		}
+	}
+	return lut
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// Curves holds a master curve for all color channels and a curve for each channel.
+// The channel curves are applied first and the RGB curve after them.
+type Curves struct {
+	RGB, Red, Green, Blue Curve
+}
+
+// AdjustCurves applies tone curves to the image and returns the adjusted image.
+//
+// Examples:
+//
+//	// An S-curve that adds contrast.
+//	dstImage = imaging.AdjustCurves(srcImage, imaging.Curves{RGB: imaging.Curve{{0, 0}, {64, 48}, {192, 208}, {255, 255}}})
+//
+//	// Warm up the image by lifting the red midtones and lowering the blue ones.
+//	dstImage = imaging.AdjustCurves(srcImage, imaging.Curves{
+//		Red:  imaging.Curve{{0, 0}, {128, 144}, {255, 255}},
+//		Blue: imaging.Curve{{0, 0}, {128, 112}, {255, 255}},
+//	})
+func AdjustCurves(img image.Image, c Curves) *image.NRGBA {
+	master := c.RGB.lut()
+	channel := func(curve Curve) []uint8 {
+		lut := curve.lut()
+		for i, v := range lut {
+			lut[i] = master[v]
+		}
+		return lut
+	}
+	return adjustLUTs(img, channel(c.Red), channel(c.Green), channel(c.Blue))
+}
+
+// clipRange finds the levels below and above which the given percentage of the histogram lies.
+func clipRange(hist *[256]float64, clip float64) (lo, hi int) {
+	clip = math.Min(math.Max(clip, 0), 49.9) / 100
+	var sum float64
+	for lo = 0; lo < 255; lo++ {
+		if sum += hist[lo]; sum > clip {
+			break
+		}
+	}
+	sum = 0
+	for hi = 255; hi > 0; hi-- {
+		if sum += hist[hi]; sum > clip {
+			break
+		}
+	}
+	return lo, hi
+}
+
+// stretchLUT maps lo to black and hi to white, a range that is empty is left as it is.
+func stretchLUT(lo, hi int) []uint8 {
+	if hi <= lo {
+		return identityLUT()
+	}
+	lut := make([]uint8, 256)
+	for i := range lut {
+		lut[i] = clamp(float64(i-lo) * 255 / float64(hi-lo))
+	}
+	return lut
+}
+
+// AutoLevels stretches each color channel on its own so its darkest value becomes black
+// and its lightest white, and returns the adjusted image. Since the channels are stretched
+// apart it also takes out color casts. The clip parameter is the percentage of pixels at
+// each end of a channel that are allowed to clip, which keeps a few stray pixels from
+// setting the range, typically between 0.1 and 1.
+//
+// Example:
+//
+//	dstImage = imaging.AutoLevels(srcImage, 0.5)
+func AutoLevels(img image.Image, clip float64) *image.NRGBA {
+	hist := ChannelHistograms(img)
+	r := stretchLUT(clipRange(&hist.Red, clip))
+	g := stretchLUT(clipRange(&hist.Green, clip))
+	b := stretchLUT(clipRange(&hist.Blue, clip))
+	return adjustLUTs(img, r, g, b)
+}
+
+// AutoContrast stretches all color channels together so the darkest value of any channel
+// becomes black and the lightest white, and returns the adjusted image. Unlike AutoLevels
+// it keeps the colors of the image. The clip parameter is the percentage of pixels at
+// each end of a channel that are allowed to clip.
+//
+// Example:
+//
+//	dstImage = imaging.AutoContrast(srcImage, 0.5)
+func AutoContrast(img image.Image, clip float64) *image.NRGBA {
+	hist := ChannelHistograms(img)
+	lo, hi := 255, 0
+	for _, h := range []*[256]float64{&hist.Red, &hist.Green, &hist.Blue} {
+		l, u := clipRange(h, clip)
+		if l < lo {
+			lo = l
+		}
+		if u > hi {
+			hi = u
+		}
+	}
+	return adjustLUT(img, stretchLUT(lo, hi))
+}
+
+// equalizeLUT maps each level to its place in the cumulative histogram.
+func equalizeLUT(hist *[256]float64, scale float64) []uint8 {
+	lut := make([]uint8, 256)
+	var cdf float64
+	for i := range lut {
+		cdf += hist[i]
+		lut[i] = clamp(cdf / scale * 255)
+	}
+	return lut
+}
+
+// Equalize spreads the luminance of the image evenly over the whole range using
+// histogram equalization and returns the adjusted image. The same curve is applied
+// to every color channel so hues are mostly kept.
+//
+// Example:
+//
+//	dstImage = imaging.Equalize(srcImage)
+func Equalize(img image.Image) *image.NRGBA {
+	hist := Histogram(img)
+
+	// the darkest level present stays black
+	var first float64
+	for _, v := range hist {
+		if v > 0 {
+			first = v
+			break
+		}
+	}
+	if first == 0 || first >= 1 {
+		return Clone(img)
+	}
+
+	lut := make([]uint8, 256)
+	var cdf float64
+	for i := range lut {
+		cdf += hist[i]
+		lut[i] = clamp((cdf - first) / (1 - first) * 255)
+	}
+	return adjustLUT(img, lut)
+}
+
+// CLAHE performs contrast limited adaptive histogram equalization and returns the adjusted image.
+// The image is split into a grid of tiles by tiles and the luminance of each tile is equalized
+// on its own, blending between neighbouring tiles so no seams show. The clipLimit parameter
+// limits how much contrast is added: histogram bins higher than clipLimit times the average
+// are clipped and spread over the rest, typically between 2 and 4. A clipLimit of 0 or less
+// equalizes each tile without a limit.
+//
+// Example:
+//
+//	dstImage = imaging.CLAHE(srcImage, 8, 3.0)
+func CLAHE(img image.Image, tiles int, clipLimit float64) *image.NRGBA {
+	dst := Clone(img)
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return dst
+	}
+	tx := clampInt(tiles, 1, w)
+	ty := clampInt(tiles, 1, h)
+
+	luma := make([]uint8, w*h)
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			i := y * dst.Stride
+			for x := 0; x < w; x++ {
+				s := dst.Pix[i : i+3 : i+3]
+				f := 0.299*float64(s[0]) + 0.587*float64(s[1]) + 0.114*float64(s[2])
+				luma[y*w+x] = uint8(f + 0.5)
+				i += 4
+			}
+		}
+	})
+
+	luts := make([][]uint8, tx*ty)
+	parallel(0, tx*ty, func(ts <-chan int) {
+		for t := range ts {
+			x0, x1 := (t%tx)*w/tx, (t%tx+1)*w/tx
+			y0, y1 := (t/tx)*h/ty, (t/tx+1)*h/ty
+
+			var hist [256]float64
+			for y := y0; y < y1; y++ {
+				for _, v := range luma[y*w+x0 : y*w+x1] {
+					hist[v]++
+				}
+			}
+			area := float64((x1 - x0) * (y1 - y0))
+
+			if clipLimit > 0 {
+				limit := clipLimit * area / 256
+				var excess float64
+				for i, v := range hist {
+					if v > limit {
+						excess += v - limit
+						hist[i] = limit
+					}
+				}
+				for i := range hist {
+					hist[i] += excess / 256
+				}
+			}
+			luts[t] = equalizeLUT(&hist, area)
+		}
+	})
+
+	// position of a pixel between the centers of the tiles around it
+	between := func(p, size, n int) (int, int, float64) {
+		f := (float64(p)+0.5)*float64(n)/float64(size) - 0.5
+		i := int(math.Floor(f))
+		if i < 0 {
+			return 0, 0, 0
+		}
+		if i >= n-1 {
+			return n - 1, n - 1, 0
+		}
+		return i, i + 1, f - float64(i)
+	}
+
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			t0, t1, fy := between(y, h, ty)
+			i := y * dst.Stride
+			for x := 0; x < w; x++ {
+				l0, l1, fx := between(x, w, tx)
+				v := luma[y*w+x]
+				top := float64(luts[t0*tx+l0][v])*(1-fx) + float64(luts[t0*tx+l1][v])*fx
+				bottom := float64(luts[t1*tx+l0][v])*(1-fx) + float64(luts[t1*tx+l1][v])*fx
+				shift := top*(1-fy) + bottom*fy - float64(v)
+
+				d := dst.Pix[i : i+3 : i+3]
+				d[0] = clamp(float64(d[0]) + shift)
+				d[1] = clamp(float64(d[1]) + shift)
+				d[2] = clamp(float64(d[2]) + shift)
+				i += 4
+			}
+		}
+	})
+	return dst
+}
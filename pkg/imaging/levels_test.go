@@ -0,0 +1,221 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// rampImage is a one row image with the given grey levels.
+func rampImage(levels ...uint8) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(levels), 1))
+	for x, v := range levels {
+		img.SetNRGBA(x, 0, color.NRGBA{v, v, v, 0xff})
+	}
+	return img
+}
+
+func TestAdjustLevels(t *testing.T) {
+	src := rampImage(0x00, 0x20, 0x80, 0xe0, 0xff)
+
+	testCases := []struct {
+		name   string
+		levels Levels
+		want   []uint8
+	}{
+		{
+			"identity",
+			Levels{InWhite: 0xff, Gamma: 1, OutWhite: 0xff},
+			[]uint8{0x00, 0x20, 0x80, 0xe0, 0xff},
+		},
+		{
+			"input range",
+			Levels{InBlack: 0x20, InWhite: 0xe0, OutWhite: 0xff},
+			[]uint8{0x00, 0x00, 0x80, 0xff, 0xff},
+		},
+		{
+			"output range",
+			Levels{InWhite: 0xff, OutBlack: 0x40, OutWhite: 0xc0},
+			[]uint8{0x40, 0x50, 0x80, 0xb0, 0xc0},
+		},
+		{
+			"gamma",
+			Levels{InWhite: 0xff, Gamma: 2, OutWhite: 0xff},
+			[]uint8{0x00, 0x5a, 0xb5, 0xef, 0xff},
+		},
+		{
+			"invert",
+			Levels{InWhite: 0xff, OutBlack: 0xff},
+			[]uint8{0xff, 0xdf, 0x7f, 0x1f, 0x00},
+		},
+		{
+			"threshold",
+			Levels{InBlack: 0x80, InWhite: 0x80, OutWhite: 0xff},
+			[]uint8{0x00, 0x00, 0x00, 0xff, 0xff},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := AdjustLevels(src, ChannelRGB, tc.levels)
+			if !compareNRGBA(got, rampImage(tc.want...), 0) {
+				t.Fatalf("got result %#v want %#v", got.Pix, rampImage(tc.want...).Pix)
+			}
+		})
+	}
+
+	// a single channel leaves the others alone
+	got := AdjustLevels(src, ChannelGreen, Levels{InWhite: 0xff, OutBlack: 0xff})
+	if c := got.NRGBAAt(1, 0); c != (color.NRGBA{0x20, 0xdf, 0x20, 0xff}) {
+		t.Errorf("green levels gave %v", c)
+	}
+}
+
+func TestAdjustCurves(t *testing.T) {
+	src := rampImage(0x00, 0x40, 0x80, 0xc0, 0xff)
+
+	identity := AdjustCurves(src, Curves{RGB: Curve{{0, 0}, {255, 255}}})
+	if !compareNRGBA(identity, src, 0) {
+		t.Errorf("straight curve changed the image to %v", identity.Pix)
+	}
+	if got := AdjustCurves(src, Curves{}); !compareNRGBA(got, src, 0) {
+		t.Errorf("empty curves changed the image to %v", got.Pix)
+	}
+
+	// the curve goes through its points and stays within them
+	s := Curve{{255, 255}, {0, 0}, {64, 32}, {192, 224}}
+	lut := s.lut()
+	for _, p := range s {
+		if int(lut[p.X]) != p.Y {
+			t.Errorf("curve gives %d at %d, want %d", lut[p.X], p.X, p.Y)
+		}
+	}
+	for i := 1; i < 256; i++ {
+		if lut[i] < lut[i-1] {
+			t.Fatalf("curve through rising points falls at %d", i)
+		}
+	}
+
+	// flat outside the points
+	lut = Curve{{32, 16}, {200, 240}}.lut()
+	if lut[0] != 16 || lut[20] != 16 || lut[230] != 240 {
+		t.Errorf("curve isn't flat past its ends: %d %d %d", lut[0], lut[20], lut[230])
+	}
+
+	// the channel curve runs before the master curve
+	got := AdjustCurves(src, Curves{
+		RGB: Curve{{0, 255}, {255, 0}},
+		Red: Curve{{0, 0}, {128, 0}, {255, 0}},
+	})
+	if c := got.NRGBAAt(3, 0); c != (color.NRGBA{0xff, 0x3f, 0x3f, 0xff}) {
+		t.Errorf("curves gave %v", c)
+	}
+}
+
+func TestAutoLevels(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{0x40, 0x10, 0x20, 0xff})
+	src.SetNRGBA(1, 0, color.NRGBA{0x80, 0x50, 0x60, 0xff})
+	src.SetNRGBA(2, 0, color.NRGBA{0xc0, 0x90, 0xa0, 0xff})
+
+	got := AutoLevels(src, 0)
+	want := []color.NRGBA{{0, 0, 0, 0xff}, {0x80, 0x80, 0x80, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	for x, c := range want {
+		if got.NRGBAAt(x, 0) != c {
+			t.Errorf("pixel %d: got %v want %v", x, got.NRGBAAt(x, 0), c)
+		}
+	}
+
+	// stretching all channels together keeps the cast
+	got = AutoContrast(src, 0)
+	if c := got.NRGBAAt(0, 0); c.G != 0 || c.R <= c.B {
+		t.Errorf("darkest pixel stretched to %v", c)
+	}
+	if c := got.NRGBAAt(2, 0); c.R != 0xff || c.R <= c.B {
+		t.Errorf("lightest pixel stretched to %v", c)
+	}
+
+	// clipping ignores stray pixels
+	levels := make([]uint8, 100)
+	for i := range levels {
+		levels[i] = 0x60
+	}
+	levels[0], levels[1], levels[98], levels[99] = 0x00, 0x40, 0xa0, 0xff
+	got = AutoContrast(rampImage(levels...), 1)
+	if got.Pix[4] != 0 || got.Pix[98*4] != 0xff {
+		t.Errorf("clipped stretch gave %d and %d", got.Pix[4], got.Pix[98*4])
+	}
+
+	// a flat image is left alone
+	flat := rampImage(0x70, 0x70)
+	if got := AutoLevels(flat, 0); !compareNRGBA(got, flat, 0) {
+		t.Errorf("flat image changed to %v", got.Pix)
+	}
+}
+
+func TestEqualize(t *testing.T) {
+	src := rampImage(0x40, 0x40, 0x48, 0x50)
+	got := Equalize(src)
+	want := rampImage(0x00, 0x00, 0x80, 0xff)
+	if !compareNRGBA(got, want, 0) {
+		t.Fatalf("got result %#v want %#v", got.Pix, want.Pix)
+	}
+
+	flat := rampImage(0x70, 0x70)
+	if got := Equalize(flat); !compareNRGBA(got, flat, 0) {
+		t.Errorf("flat image changed to %v", got.Pix)
+	}
+}
+
+func TestCLAHE(t *testing.T) {
+	// a dim left half and a bright right half, each with little contrast
+	src := image.NewNRGBA(image.Rect(-4, -4, 60, 28))
+	for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+		for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+			v := uint8(0x20 + (x+y)%16)
+			if x >= 28 {
+				v += 0xa0
+			}
+			src.SetNRGBA(x, y, color.NRGBA{v, v, v, 0x80})
+		}
+	}
+
+	spread := func(img *image.NRGBA, x0, x1 int) int {
+		lo, hi := 255, 0
+		for y := 0; y < img.Rect.Dy(); y++ {
+			for x := x0; x < x1; x++ {
+				v := int(img.Pix[y*img.Stride+x*4])
+				if v < lo {
+					lo = v
+				}
+				if v > hi {
+					hi = v
+				}
+			}
+		}
+		return hi - lo
+	}
+
+	got := CLAHE(src, 4, 0)
+	if got.Rect != image.Rect(0, 0, 64, 32) {
+		t.Fatalf("got bounds %v", got.Rect)
+	}
+	if got.Pix[3] != 0x80 {
+		t.Errorf("alpha changed to %d", got.Pix[3])
+	}
+	before, after := spread(Clone(src), 0, 16), spread(got, 0, 16)
+	if after <= 2*before {
+		t.Errorf("local contrast went from %d to %d", before, after)
+	}
+
+	limited := CLAHE(src, 4, 2)
+	if l := spread(limited, 0, 16); l >= after || l <= before {
+		t.Errorf("clip limit gave contrast %d, between %d and %d expected", l, before, after)
+	}
+}
+
+func BenchmarkCLAHE(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CLAHE(testdataBranchesJPG, 8, 3)
+	}
+}
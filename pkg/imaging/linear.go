@@ -0,0 +1,36 @@
+package imaging
+
+import "image"
+
+// ResizeLinear resizes the image like Resize but mixes the colors as linear light
+// rather than sRGB values. Fine detail and edges between bright and dark colors
+// keep their brightness instead of turning darker, and alpha is premultiplied
+// so transparent pixels don't bleed their color.
+//
+// Example:
+//
+//	dstImage := imaging.ResizeLinear(srcImage, 800, 0, imaging.Lanczos)
+func ResizeLinear(img image.Image, width, height int, filter ResampleFilter) *image.NRGBA {
+	return ResizeFloat(ToFloat(img, true), width, height, filter).NRGBA()
+}
+
+// BlurLinear blurs the image like Blur but as linear light, so bright areas
+// glow into dark ones the way an out of focus lens does.
+//
+// Example:
+//
+//	dstImage := imaging.BlurLinear(srcImage, 3.5)
+func BlurLinear(img image.Image, sigma float64) *image.NRGBA {
+	return BlurFloat(ToFloat(img, true), sigma).NRGBA()
+}
+
+// OverlayLinear draws img over background at pos like Overlay but mixes the
+// colors as linear light.
+//
+// Example:
+//
+//	dstImage := imaging.OverlayLinear(backgroundImage, spriteImage, image.Pt(50, 50), 0.5)
+func OverlayLinear(background, img image.Image, pos image.Point, opacity float64) *image.NRGBA {
+	pos = pos.Sub(background.Bounds().Min)
+	return OverlayFloat(ToFloat(background, true), ToFloat(img, true), pos, opacity).NRGBA()
+}
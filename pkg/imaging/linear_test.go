@@ -0,0 +1,144 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// checkerboard alternates black and white pixels, half the light of white on average
+func checkerboard(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x+y)%2 == 0 {
+				img.SetNRGBA(x, y, color.NRGBA{0xff, 0xff, 0xff, 0xff})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0x00, 0x00, 0x00, 0xff})
+			}
+		}
+	}
+	return img
+}
+
+func TestResizeLinear(t *testing.T) {
+	src := checkerboard(16, 16)
+
+	// averaging sRGB values gives 50% grey, which looks darker than the
+	// checkerboard from a distance, half the light of white is 188
+	testCases := []struct {
+		name   string
+		resize func(image.Image, int, int, ResampleFilter) *image.NRGBA
+		want   *image.NRGBA
+	}{
+		{"sRGB", Resize, New(4, 4, color.NRGBA{0x80, 0x80, 0x80, 0xff})},
+		{"linear", ResizeLinear, New(4, 4, color.NRGBA{0xbc, 0xbc, 0xbc, 0xff})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.resize(src, 4, 4, Box)
+			if !compareNRGBA(got, tc.want, 1) {
+				t.Fatalf("got %v want %v", got.NRGBAAt(0, 0), tc.want.NRGBAAt(0, 0))
+			}
+		})
+	}
+
+	// transparent pixels don't bleed their color into the opaque ones
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{0xff, 0x00, 0x00, 0xff})
+	img.SetNRGBA(1, 0, color.NRGBA{0x00, 0xff, 0x00, 0x00})
+	if c := ResizeLinear(img, 1, 1, Box).NRGBAAt(0, 0); c.R != 0xff || c.G != 0 || c.A != 0x80 {
+		t.Errorf("resizing over transparency gave %v", c)
+	}
+
+	if got := ResizeLinear(src, 0, 8, Lanczos); got.Rect != image.Rect(0, 0, 8, 8) {
+		t.Errorf("got bounds %v", got.Rect)
+	}
+}
+
+func TestBlurLinear(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 10, 1))
+	for x := 5; x < 10; x++ {
+		src.SetNRGBA(x, 0, color.NRGBA{0xff, 0xff, 0xff, 0xff})
+	}
+	for x := 0; x < 5; x++ {
+		src.SetNRGBA(x, 0, color.NRGBA{0x00, 0x00, 0x00, 0xff})
+	}
+
+	// light spills further into the dark side
+	plain, linear := Blur(src, 1.5), BlurLinear(src, 1.5)
+	if linear.Pix[3*4] <= plain.Pix[3*4] {
+		t.Errorf("linear blur gave %d next to the edge, sRGB blur %d", linear.Pix[3*4], plain.Pix[3*4])
+	}
+	if got := BlurLinear(src, 0); !compareNRGBA(got, src, 0) {
+		t.Error("a blur of 0 changed the image")
+	}
+}
+
+func TestOverlayLinear(t *testing.T) {
+	black := New(2, 2, color.NRGBA{0x00, 0x00, 0x00, 0xff})
+	white := New(2, 2, color.NRGBA{0xff, 0xff, 0xff, 0xff})
+
+	if c := Overlay(black, white, image.Pt(0, 0), 0.5).NRGBAAt(0, 0); c.R != 0x7f {
+		t.Errorf("sRGB overlay gave %v", c)
+	}
+	if c := OverlayLinear(black, white, image.Pt(0, 0), 0.5).NRGBAAt(0, 0); c.R != 0xbc {
+		t.Errorf("linear overlay gave %v", c)
+	}
+
+	// only the overlapping pixel changes
+	got := OverlayLinear(black, white, image.Pt(1, 1), 1)
+	if got.NRGBAAt(0, 0).R != 0 || got.NRGBAAt(1, 1).R != 0xff {
+		t.Errorf("offset overlay gave %v", got.Pix)
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(-1, -1, 15, 15))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 13)
+	}
+	for _, linear := range []bool{false, true} {
+		f := ToFloat(img, linear)
+		if got := f.NRGBA(); !compareNRGBA(got, Clone(img), 0) {
+			t.Errorf("linear %v: 8-bit round trip changed the image", linear)
+		}
+	}
+
+	deep := image.NewNRGBA64(image.Rect(0, 0, 16, 16))
+	for i := range deep.Pix {
+		deep.Pix[i] = uint8(i * 31)
+	}
+	for i := 7; i < len(deep.Pix); i += 8 {
+		deep.Pix[i-1] = 0xff
+	}
+	for _, linear := range []bool{false, true} {
+		got := ToFloat(deep, linear).NRGBA64()
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				a, b := got.NRGBA64At(x, y), deep.NRGBA64At(x, y)
+				for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+					if d > 1 || d < -1 {
+						t.Fatalf("linear %v: 16-bit round trip changed %v to %v", linear, b, a)
+					}
+				}
+			}
+		}
+	}
+
+	// a FloatImage is an image.Image like any other
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	f := ToFloat(img, true)
+	if got := Clone(f); !compareNRGBA(got, Clone(img), 0) {
+		t.Error("cloning a FloatImage changed it")
+	}
+}
+
+func BenchmarkResizeLinear(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ResizeLinear(testdataBranchesJPG, 256, 256, Lanczos)
+	}
+}
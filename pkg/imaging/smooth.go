@@ -0,0 +1,212 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// Median replaces every pixel with the median of each channel in the square
+// of radius around it. It removes specks and noise while keeping edges sharp,
+// larger radii flatten textures into patches.
+//
+// Example:
+//
+//	dstImage := imaging.Median(srcImage, 2)
+func Median(img image.Image, radius int) *image.NRGBA {
+	src := Clone(img)
+	if radius <= 0 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(src.Rect)
+	size := (2*radius + 1) * (2*radius + 1)
+
+	parallel(0, h, func(ys <-chan int) {
+		// a histogram per channel slides along the row
+		var hist [4][256]int
+		for y := range ys {
+			hist = [4][256]int{}
+			for dy := -radius; dy <= radius; dy++ {
+				sy := clampInt(y+dy, 0, h-1)
+				for dx := -radius; dx <= radius; dx++ {
+					i := sy*src.Stride + clampInt(dx, 0, w-1)*4
+					for c := 0; c < 4; c++ {
+						hist[c][src.Pix[i+c]]++
+					}
+				}
+			}
+
+			for x := 0; x < w; x++ {
+				if x > 0 {
+					out, in := clampInt(x-radius-1, 0, w-1)*4, clampInt(x+radius, 0, w-1)*4
+					for dy := -radius; dy <= radius; dy++ {
+						row := clampInt(y+dy, 0, h-1) * src.Stride
+						for c := 0; c < 4; c++ {
+							hist[c][src.Pix[row+out+c]]--
+							hist[c][src.Pix[row+in+c]]++
+						}
+					}
+				}
+
+				d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4 : y*dst.Stride+x*4+4]
+				for c := 0; c < 4; c++ {
+					n := 0
+					for v := 0; v < 256; v++ {
+						if n += hist[c][v]; 2*n > size {
+							d[c] = uint8(v)
+							break
+						}
+					}
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// Bilateral blurs the image but only mixes pixels with similar colors, so
+// edges stay sharp while flat areas and skin turn smooth. sigmaSpace is the
+// size of the blur in pixels and sigmaColor how far apart (0 - 255) colors
+// can be and still be mixed, around 30 is a gentle smoothing.
+//
+// Example:
+//
+//	dstImage := imaging.Bilateral(srcImage, 4, 30)
+func Bilateral(img image.Image, sigmaSpace, sigmaColor float64) *image.NRGBA {
+	src := Clone(img)
+	if sigmaSpace <= 0 || sigmaColor <= 0 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(src.Rect)
+
+	radius := int(math.Ceil(sigmaSpace * 2))
+	space := make([]float64, (2*radius+1)*(2*radius+1))
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			space[(dy+radius)*(2*radius+1)+dx+radius] = math.Exp(-float64(dx*dx+dy*dy) / (2 * sigmaSpace * sigmaSpace))
+		}
+	}
+	// the color weight of a difference in one channel, the three multiply
+	var rng [256]float64
+	for i := range rng {
+		rng[i] = math.Exp(-float64(i*i) / (2 * sigmaColor * sigmaColor))
+	}
+
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				c := src.Pix[y*src.Stride+x*4 : y*src.Stride+x*4+4 : y*src.Stride+x*4+4]
+				var r, g, b, a, total float64
+				for dy := -radius; dy <= radius; dy++ {
+					sy := clampInt(y+dy, 0, h-1)
+					for dx := -radius; dx <= radius; dx++ {
+						sx := clampInt(x+dx, 0, w-1)
+						s := src.Pix[sy*src.Stride+sx*4 : sy*src.Stride+sx*4+4 : sy*src.Stride+sx*4+4]
+						weight := space[(dy+radius)*(2*radius+1)+dx+radius] *
+							rng[absInt(int(s[0])-int(c[0]))] * rng[absInt(int(s[1])-int(c[1]))] * rng[absInt(int(s[2])-int(c[2]))]
+						// transparent pixels don't bleed their color
+						aw := weight * float64(s[3])
+						r += float64(s[0]) * aw
+						g += float64(s[1]) * aw
+						b += float64(s[2]) * aw
+						a += aw
+						total += weight
+					}
+				}
+
+				d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4 : y*dst.Stride+x*4+4]
+				if a == 0 {
+					continue
+				}
+				d[0], d[1], d[2], d[3] = clamp(r/a), clamp(g/a), clamp(b/a), clamp(a/total)
+			}
+		}
+	})
+	return dst
+}
+
+// Guided is the guided filter using the image as its own guide. It smooths
+// like Bilateral but in constant time for any radius and without gradient
+// reversal at edges. epsilon (0 - 1) is how much variance in a window counts
+// as detail to keep, 0.01 smooths gently and 0.1 heavily.
+//
+// Example:
+//
+//	dstImage := imaging.Guided(srcImage, 8, 0.02)
+func Guided(img image.Image, radius int, epsilon float64) *image.NRGBA {
+	src := Clone(img)
+	if radius <= 0 || epsilon <= 0 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(src.Rect)
+
+	p := make([]float64, w*h)
+	pp := make([]float64, w*h)
+	for c := 0; c < 3; c++ {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := float64(src.Pix[y*src.Stride+x*4+c]) / 255
+				p[y*w+x], pp[y*w+x] = v, v*v
+			}
+		}
+
+		// fit out = a * in + b in every window, then average the fits
+		mean, meanSq := boxMean(p, w, h, radius), boxMean(pp, w, h, radius)
+		a, b := make([]float64, w*h), make([]float64, w*h)
+		for i := range a {
+			variance := meanSq[i] - mean[i]*mean[i]
+			a[i] = variance / (variance + epsilon)
+			b[i] = mean[i] - a[i]*mean[i]
+		}
+		a, b = boxMean(a, w, h, radius), boxMean(b, w, h, radius)
+
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				i := y*w + x
+				dst.Pix[y*dst.Stride+x*4+c] = clamp((a[i]*p[i] + b[i]) * 255)
+			}
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Pix[y*dst.Stride+x*4+3] = src.Pix[y*src.Stride+x*4+3]
+		}
+	}
+	return dst
+}
+
+// boxMean is the mean of the square of radius around every value of a w x h
+// plane, from a summed area table so the radius doesn't matter. Windows are
+// cut off at the edges.
+func boxMean(p []float64, w, h, radius int) []float64 {
+	sat := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row float64
+		for x := 0; x < w; x++ {
+			row += p[y*w+x]
+			sat[(y+1)*(w+1)+x+1] = sat[y*(w+1)+x+1] + row
+		}
+	}
+
+	out := make([]float64, w*h)
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			y0, y1 := max(y-radius, 0), min(y+radius+1, h)
+			for x := 0; x < w; x++ {
+				x0, x1 := max(x-radius, 0), min(x+radius+1, w)
+				sum := sat[y1*(w+1)+x1] - sat[y0*(w+1)+x1] - sat[y1*(w+1)+x0] + sat[y0*(w+1)+x0]
+				out[y*w+x] = sum / float64((x1-x0)*(y1-y0))
+			}
+		}
+	})
+	return out
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// noisyStep is dark on the left and light from x = 16 on, with a speck of
+// noise on every other pixel
+func noisyStep() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			v := 40
+			if x >= 16 {
+				v = 210
+			}
+			if (x+y)%2 == 0 {
+				v += 12
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(v), uint8(v), 255})
+		}
+	}
+	return img
+}
+
+func TestSmooth(t *testing.T) {
+	testCases := []struct {
+		name string
+		fn   func(image.Image) *image.NRGBA
+	}{
+		{"Bilateral", func(img image.Image) *image.NRGBA { return Bilateral(img, 2, 30) }},
+		{"Guided", func(img image.Image) *image.NRGBA { return Guided(img, 3, 0.01) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := tc.fn(noisyStep())
+			// the noise is gone and the step is still a step
+			for _, x := range []int{4, 5, 10, 11} {
+				if v := int(dst.NRGBAAt(x, 8).R); v < 42 || v > 50 {
+					t.Errorf("dark side at %d is %d", x, v)
+				}
+			}
+			for _, x := range []int{20, 21, 27, 28} {
+				if v := int(dst.NRGBAAt(x, 8).R); v < 212 || v > 220 {
+					t.Errorf("light side at %d is %d", x, v)
+				}
+			}
+			if l, r := dst.NRGBAAt(14, 8).R, dst.NRGBAAt(17, 8).R; r-l < 150 {
+				t.Errorf("the step is blurred, %d to %d", l, r)
+			}
+			if dst.NRGBAAt(0, 0).A != 255 {
+				t.Errorf("alpha is %d", dst.NRGBAAt(0, 0).A)
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	img := noisyStep()
+	// single white and black specks that a median removes entirely
+	img.SetNRGBA(5, 8, color.NRGBA{255, 255, 255, 255})
+	img.SetNRGBA(25, 8, color.NRGBA{0, 0, 0, 255})
+
+	dst := Median(img, 2)
+	if v := dst.NRGBAAt(5, 8).R; v != 40 && v != 52 {
+		t.Errorf("white speck is %d", v)
+	}
+	if v := dst.NRGBAAt(25, 8).R; v != 210 && v != 222 {
+		t.Errorf("black speck is %d", v)
+	}
+	if l, r := dst.NRGBAAt(15, 8).R, dst.NRGBAAt(16, 8).R; l > 52 || r < 210 {
+		t.Errorf("the step moved, %d to %d", l, r)
+	}
+	if Median(img, 0).NRGBAAt(5, 8).R != 255 {
+		t.Error("a radius of 0 should change nothing")
+	}
+}
+
+func TestSmoothSubImage(t *testing.T) {
+	sub := noisyStep().SubImage(image.Rect(8, 4, 24, 12))
+	for name, dst := range map[string]*image.NRGBA{
+		"Median":    Median(sub, 1),
+		"Bilateral": Bilateral(sub, 1, 20),
+		"Guided":    Guided(sub, 2, 0.01),
+	} {
+		if dst.Bounds() != image.Rect(0, 0, 16, 8) {
+			t.Errorf("%s: bounds %v", name, dst.Bounds())
+		}
+		if dst.NRGBAAt(0, 0).R > 100 || dst.NRGBAAt(15, 7).R < 150 {
+			t.Errorf("%s: corners %v %v", name, dst.NRGBAAt(0, 0), dst.NRGBAAt(15, 7))
+		}
+	}
+}
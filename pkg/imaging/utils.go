@@ -100,10 +100,11 @@ func toNRGBA(img image.Image) *image.NRGBA {
 
 // rgbToHSL converts a color from RGB to HSL.
 func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
-	rr := float64(r) / 255
-	gg := float64(g) / 255
-	bb := float64(b) / 255
+	return rgbToHSLFloat(float64(r)/255, float64(g)/255, float64(b)/255)
+}
 
+// rgbToHSLFloat converts a color from RGB to HSL, all channels from 0 to 1.
+func rgbToHSLFloat(rr, gg, bb float64) (float64, float64, float64) {
 	max := math.Max(rr, math.Max(gg, bb))
 	min := math.Min(rr, math.Min(gg, bb))
 
@@ -124,7 +125,7 @@ func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
 	switch max {
 	case rr:
 		h = (gg - bb) / d
-		if g < b {
+		if gg < bb {
 			h += 6
 		}
 	case gg:
@@ -139,10 +140,15 @@ func rgbToHSL(r, g, b uint8) (float64, float64, float64) {
 
 // hslToRGB converts a color from HSL to RGB.
 func hslToRGB(h, s, l float64) (uint8, uint8, uint8) {
+	r, g, b := hslToRGBFloat(h, s, l)
+	return clamp(r * 255), clamp(g * 255), clamp(b * 255)
+}
+
+// hslToRGBFloat converts a color from HSL to RGB, all channels from 0 to 1.
+func hslToRGBFloat(h, s, l float64) (float64, float64, float64) {
 	var r, g, b float64
 	if s == 0 {
-		v := clamp(l * 255)
-		return v, v, v
+		return l, l, l
 	}
 
 	var q float64
@@ -157,7 +163,7 @@ func hslToRGB(h, s, l float64) (uint8, uint8, uint8) {
 	g = hueToRGB(p, q, h)
 	b = hueToRGB(p, q, h-1/3.0)
 
-	return clamp(r * 255), clamp(g * 255), clamp(b * 255)
+	return r, g, b
 }
 
 func hueToRGB(p, q, t float64) float64 {
@@ -0,0 +1,218 @@
+package kuwahara
+
+import (
+	"image"
+	"math"
+
+	"pix/pkg/edge"
+	"pix/pkg/imaging"
+)
+
+// sectors is how many slices the neighbourhood of a pixel is cut into
+const sectors = 8
+
+// sector sums the colors that fall into one slice, weighted
+type sector struct {
+	w, r, g, b, rr, gg, bb float64
+}
+
+func (s *sector) add(w float64, c []uint8) {
+	r, g, b := float64(c[0]), float64(c[1]), float64(c[2])
+	s.w += w
+	s.r += w * r
+	s.g += w * g
+	s.b += w * b
+	s.rr += w * r * r
+	s.gg += w * g * g
+	s.bb += w * b * b
+}
+
+// Generalized is the generalized Kuwahara filter. The disc of radius around
+// each pixel is cut into eight overlapping sectors with a gaussian falloff,
+// and their means are blended by how little the colors in them vary. q is the
+// sharpness of the blend, large values pick the calmest sector like the
+// classic filter, 8 gives soft painterly strokes without the blocks.
+func Generalized(img image.Image, radius int, q float64) *image.NRGBA {
+	r := float64(max(radius, 1))
+	return filter(imaging.Clone(img), q, func(x, y int) (a, b, cos, sin float64) {
+		return r, r, 1, 0
+	})
+}
+
+// Anisotropic is the anisotropic Kuwahara filter, the generalized filter with
+// the disc squashed into an ellipse that follows the edges of the image as
+// found by a structure tensor. Strokes run along the edges and stay thin
+// across them, flat areas get round strokes of radius.
+func Anisotropic(img image.Image, radius int, q float64) *image.NRGBA {
+	src := imaging.Clone(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	r := float64(max(radius, 1))
+
+	// the structure tensor, smoothed so nearby edges agree on a direction
+	grad := edge.Gradient(src, edge.Sobel)
+	e, f, g := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	for i := range e {
+		gx, gy := grad.X[i], grad.Y[i]
+		e[i], f[i], g[i] = gx*gx, gx*gy, gy*gy
+	}
+	e, f, g = blur(e, w, h, 2), blur(f, w, h, 2), blur(g, w, h, 2)
+
+	return filter(src, q, func(x, y int) (a, b, cos, sin float64) {
+		i := y*w + x
+		E, F, G := e[i], f[i], g[i]
+		root := math.Sqrt((E-G)*(E-G) + 4*F*F)
+		l1, l2 := (E+G+root)/2, (E+G-root)/2
+
+		// how strongly the pixel has one direction, 0 for flat areas and corners
+		var anisotropy float64
+		if l1+l2 > 0 {
+			anisotropy = (l1 - l2) / (l1 + l2)
+		}
+
+		// the edge runs across the gradient, the eigenvector of the smaller value
+		tx, ty := l1-E, -F
+		if n := math.Hypot(tx, ty); n > 0 {
+			tx, ty = tx/n, ty/n
+		} else {
+			tx, ty = 0, 1
+		}
+		return r * (1 + anisotropy), r / (1 + anisotropy), tx, ty
+	})
+}
+
+// filter blends the sectors of an ellipse around every pixel, shape gives its
+// semi axes, a along the direction cos, sin and b across it
+func filter(src *image.NRGBA, q float64, shape func(x, y int) (a, b, cos, sin float64)) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(src.Rect)
+
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				a, b, cos, sin := shape(x, y)
+				extent := int(math.Ceil(math.Max(a, b)))
+
+				var acc [sectors]sector
+				for dy := -extent; dy <= extent; dy++ {
+					sy := clamp(y+dy, 0, h-1)
+					for dx := -extent; dx <= extent; dx++ {
+						// the offset in the frame of the ellipse, scaled to a unit disc
+						u := (float64(dx)*cos + float64(dy)*sin) / a
+						v := (-float64(dx)*sin + float64(dy)*cos) / b
+						d := u*u + v*v
+						if d > 1 {
+							continue
+						}
+
+						sx := clamp(x+dx, 0, w-1)
+						c := src.Pix[sy*src.Stride+sx*4 : sy*src.Stride+sx*4+3 : sy*src.Stride+sx*4+3]
+						falloff := math.Exp(-2 * d)
+
+						// the center belongs to every sector
+						if dx == 0 && dy == 0 {
+							for k := range acc {
+								acc[k].add(falloff, c)
+							}
+							continue
+						}
+
+						// split between the two nearest sectors, the weights add up to 1
+						s := math.Atan2(v, u) / (2 * math.Pi / sectors)
+						fl := math.Floor(s)
+						t := (s - fl) * math.Pi / 2
+						k := (int(fl) + sectors) % sectors
+						acc[k].add(falloff*math.Cos(t)*math.Cos(t), c)
+						acc[(k+1)%sectors].add(falloff*math.Sin(t)*math.Sin(t), c)
+					}
+				}
+
+				d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4 : y*dst.Stride+x*4+4]
+				d[0], d[1], d[2] = blend(&acc, q)
+				d[3] = src.Pix[y*src.Stride+x*4+3]
+			}
+		}
+	})
+	return dst
+}
+
+// blend mixes the means of the sectors, the ones that vary less count more.
+// The weights are relative to the calmest sector so they can't all vanish.
+func blend(acc *[sectors]sector, q float64) (r, g, b uint8) {
+	var means [sectors][3]float64
+	var spread [sectors]float64
+	calmest := math.Inf(1)
+	for k, s := range acc {
+		if s.w <= 0 {
+			continue
+		}
+		mr, mg, mb := s.r/s.w, s.g/s.w, s.b/s.w
+		variance := s.rr/s.w - mr*mr + s.gg/s.w - mg*mg + s.bb/s.w - mb*mb
+		means[k] = [3]float64{mr, mg, mb}
+		spread[k] = 1 + math.Sqrt(math.Max(variance, 0))
+		calmest = math.Min(calmest, spread[k])
+	}
+
+	var sr, sg, sb, total float64
+	for k, s := range acc {
+		if s.w <= 0 {
+			continue
+		}
+		alpha := math.Pow(calmest/spread[k], q)
+		sr += alpha * means[k][0]
+		sg += alpha * means[k][1]
+		sb += alpha * means[k][2]
+		total += alpha
+	}
+	if total == 0 {
+		return 0, 0, 0
+	}
+	return clampByte(sr / total), clampByte(sg / total), clampByte(sb / total)
+}
+
+// blur is a gaussian blur of a w x h plane
+func blur(p []float64, w, h int, sigma float64) []float64 {
+	size := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, size*2+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - size)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	tmp, out := make([]float64, w*h), make([]float64, w*h)
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				var v float64
+				for k, weight := range kernel {
+					v += p[y*w+clamp(x+k-size, 0, w-1)] * weight
+				}
+				tmp[y*w+x] = v
+			}
+		}
+	})
+	parallel(0, h, func(ys <-chan int) {
+		for y := range ys {
+			for x := 0; x < w; x++ {
+				var v float64
+				for k, weight := range kernel {
+					v += tmp[clamp(y+k-size, 0, h-1)*w+x] * weight
+				}
+				out[y*w+x] = v
+			}
+		}
+	})
+	return out
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Min(math.Max(v, 0), 255) + 0.5)
+}
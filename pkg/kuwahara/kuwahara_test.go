@@ -0,0 +1,83 @@
+package kuwahara
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// step is dark on the left and light from x = 16 on, offset so its bounds
+// don't start at 0, 0
+func step() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(10, 20, 42, 44))
+	for y := 20; y < 44; y++ {
+		for x := 10; x < 42; x++ {
+			v := uint8(30)
+			if x >= 26 {
+				v = 220
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestFilters(t *testing.T) {
+	testCases := []struct {
+		name string
+		fn   func(*image.NRGBA) *image.NRGBA
+	}{
+		{"Kuwahara", func(img *image.NRGBA) *image.NRGBA { return KuwaharaNRGBA(img, 3) }},
+		{"Generalized", func(img *image.NRGBA) *image.NRGBA { return Generalized(img, 4, 8) }},
+		{"Anisotropic", func(img *image.NRGBA) *image.NRGBA { return Anisotropic(img, 4, 8) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := step()
+			dst := tc.fn(src)
+			if w, h := dst.Bounds().Dx(), dst.Bounds().Dy(); w != 32 || h != 24 {
+				t.Fatalf("size %dx%d", w, h)
+			}
+			at := func(x, y int) color.NRGBA {
+				return dst.NRGBAAt(dst.Rect.Min.X+x, dst.Rect.Min.Y+y)
+			}
+
+			// flat areas stay flat and the edge stays sharp
+			for _, x := range []int{0, 5, 14} {
+				if c := at(x, 12); c.R < 28 || c.R > 32 || c.A != 255 {
+					t.Errorf("dark side at %d is %v", x, c)
+				}
+			}
+			for _, x := range []int{17, 25, 31} {
+				if c := at(x, 12); c.R < 218 || c.R > 222 {
+					t.Errorf("light side at %d is %v", x, c)
+				}
+			}
+			if l, r := at(15, 12).R, at(16, 12).R; r-l < 150 {
+				t.Errorf("the edge is blurred, %d to %d", l, r)
+			}
+		})
+	}
+}
+
+func TestSubImage(t *testing.T) {
+	// a window on the light half only, nothing from outside it may leak in
+	sub := step().SubImage(image.Rect(28, 22, 40, 40)).(*image.NRGBA)
+	for name, dst := range map[string]*image.NRGBA{
+		"Kuwahara":    KuwaharaNRGBA(sub, 2),
+		"Generalized": Generalized(sub, 3, 8),
+		"Anisotropic": Anisotropic(sub, 3, 8),
+	} {
+		b := dst.Bounds()
+		if b.Dx() != 12 || b.Dy() != 18 {
+			t.Errorf("%s: bounds %v", name, b)
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c := dst.NRGBAAt(x, y); c.R != 220 {
+					t.Fatalf("%s: %d, %d is %v", name, x, y, c)
+				}
+			}
+		}
+	}
+}
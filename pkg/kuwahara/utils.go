@@ -9,24 +9,51 @@ import (
 	"log"
 	"math"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 )
 
+// parallel runs fn for the rows from start to stop on every CPU, like
+// imaging does
+func parallel(start, stop int, fn func(<-chan int)) {
+	count := stop - start
+	if count < 1 {
+		return
+	}
+
+	procs := min(runtime.GOMAXPROCS(0), count)
+	c := make(chan int, count)
+	for i := start; i < stop; i++ {
+		c <- i
+	}
+	close(c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < procs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(c)
+		}()
+	}
+	wg.Wait()
+}
+
+// getAperture is the range of a quadrant along one axis, from apertureMin to
+// apertureMax around axisValue inclusive and cut off at 0 and axisMax, so
+// every quadrant holds the center
 func getAperture(axisValue, axisMax, apertureMin, apertureMax int) (int, int) {
 	start, end := 0, axisMax
 	if axisValue+apertureMin > 0 {
 		start = axisValue + apertureMin
 	}
-	if axisValue+apertureMax < axisMax {
-		end = axisValue + apertureMax
+	if axisValue+apertureMax+1 < axisMax {
+		end = axisValue + apertureMax + 1
 	}
 	return start, end
 }
 
-func getCoordinates(pixel, width int) (int, int) {
-	return pixel % width, int(math.Floor(float64(pixel) / float64(width)))
-}
-
 func getGradientPoint(axisValue, shift, axisLength int) int {
 	if (axisValue + shift) >= axisLength {
 		return axisLength - axisValue - 1
@@ -34,19 +61,6 @@ func getGradientPoint(axisValue, shift, axisLength int) int {
 	return shift
 }
 
-func getPixel(x, y, width int) int {
-	return ((y * width) + x) * 4
-}
-
-func getPixPerThread(pixLen, threads int) int {
-	pixPerThreadRaw := float64(pixLen) / float64(threads)
-	module := math.Mod(pixPerThreadRaw, 4.0)
-	if module == 0 {
-		return int(pixPerThreadRaw)
-	}
-	return int(pixPerThreadRaw + (float64(threads) - math.Mod(pixPerThreadRaw, 4.0)))
-}
-
 func openfile(path string) *image.RGBA {
 	file, err := os.Open(path)
 	if err != nil {
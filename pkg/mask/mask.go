@@ -0,0 +1,246 @@
+// Package mask limits an effect to part of an image. A mask is an alpha
+// image the size of the original, 255 where the effect shows and 0 where the
+// original is kept, built from a shape, a key on the colors of the image, the
+// subject smartcrop finds, its edges or another image.
+package mask
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"pix/pkg/edge"
+	"pix/pkg/pixlib"
+
+	"github.com/muesli/smartcrop"
+	"github.com/muesli/smartcrop/nfnt"
+	"golang.org/x/image/draw"
+)
+
+// Source builds the mask for an image
+type Source func(img image.Image) (*image.Alpha, error)
+
+// Image uses the brightness of m as the mask, scaled to the size of the
+// image, transparent parts of m mask the effect out
+func Image(m image.Image) Source {
+	return func(img image.Image) (*image.Alpha, error) {
+		bounds := img.Bounds()
+		gray := image.NewGray(bounds)
+		draw.BiLinear.Scale(gray, bounds, m, m.Bounds(), draw.Src, nil)
+		return &image.Alpha{Pix: gray.Pix, Stride: gray.Stride, Rect: gray.Rect}, nil
+	}
+}
+
+// Rect masks the pixels with their centers inside r
+func Rect(r pixlib.Rect) Source {
+	r = r.Norm()
+	return shape(func(x, y float64) bool {
+		return x >= r.Min.X && x < r.Max.X && y >= r.Min.Y && y < r.Max.Y
+	})
+}
+
+// Ellipse masks the ellipse that fits inside r
+func Ellipse(r pixlib.Rect) Source {
+	r = r.Norm()
+	c := r.Center()
+	rx, ry := r.W()/2, r.H()/2
+	return shape(func(x, y float64) bool {
+		if rx == 0 || ry == 0 {
+			return false
+		}
+		dx, dy := (x-c.X)/rx, (y-c.Y)/ry
+		return dx*dx+dy*dy <= 1
+	})
+}
+
+// Polygon masks the inside of p
+func Polygon(p pixlib.Polygon) Source {
+	return shape(func(x, y float64) bool {
+		return pixlib.V(x, y).In(p)
+	})
+}
+
+// shape masks the pixels whose centers are inside
+func shape(inside func(x, y float64) bool) Source {
+	return func(img image.Image) (*image.Alpha, error) {
+		bounds := img.Bounds()
+		m := image.NewAlpha(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if inside(float64(x)+0.5, float64(y)+0.5) {
+					m.SetAlpha(x, y, color.Alpha{255})
+				}
+			}
+		}
+		return m, nil
+	}
+}
+
+// Luma keys on brightness, pixels from min to max (0 - 1) are masked
+func Luma(min, max float64) Source {
+	return key(func(c color.NRGBA) bool {
+		l := (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+		return l >= min && l <= max
+	})
+}
+
+// Hue keys on color, pixels within width/2 degrees of hue are masked. Greys
+// have no hue to speak of and are never masked.
+func Hue(hue, width float64) Source {
+	return key(func(c color.NRGBA) bool {
+		h, s := hueSat(c)
+		if s < 0.15 {
+			return false
+		}
+		d := math.Abs(math.Mod(h-hue, 360))
+		if d > 180 {
+			d = 360 - d
+		}
+		return d <= width/2
+	})
+}
+
+func key(match func(c color.NRGBA) bool) Source {
+	return func(img image.Image) (*image.Alpha, error) {
+		bounds := img.Bounds()
+		m := image.NewAlpha(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				if c.A > 0 && match(c) {
+					m.SetAlpha(x, y, color.Alpha{255})
+				}
+			}
+		}
+		return m, nil
+	}
+}
+
+// hueSat is the hue in degrees and the saturation (0 - 1) of c
+func hueSat(c color.NRGBA) (float64, float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	hi := math.Max(r, math.Max(g, b))
+	lo := math.Min(r, math.Min(g, b))
+	if hi == lo {
+		return 0, 0
+	}
+
+	d := hi - lo
+	var h float64
+	switch hi {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, d / hi
+}
+
+// Subject masks an ellipse around the part of the image smartcrop would keep
+// for a square crop, going by skin tones, saturation and detail
+func Subject() Source {
+	return func(img image.Image) (*image.Alpha, error) {
+		analyzer := smartcrop.NewAnalyzer(nfnt.NewDefaultResizer())
+		crop, err := analyzer.FindBestCrop(img, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		crop = crop.Add(img.Bounds().Min)
+		return Ellipse(pixlib.BoundsToRect(crop))(img)
+	}
+}
+
+// Edges masks the edges found by detector, stronger edges more
+func Edges(detector edge.Detector) Source {
+	return func(img image.Image) (*image.Alpha, error) {
+		g := detector(img)
+		return &image.Alpha{Pix: g.Pix, Stride: g.Stride, Rect: g.Rect}, nil
+	}
+}
+
+// Invert swaps the masked and unmasked parts of m
+func Invert(m *image.Alpha) {
+	for i, a := range m.Pix {
+		m.Pix[i] = 255 - a
+	}
+}
+
+// Feather softens the edge of m over about radius pixels
+func Feather(m *image.Alpha, radius float64) *image.Alpha {
+	if radius <= 0 {
+		return m
+	}
+
+	sigma := radius / 2
+	size := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, size*2+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - size)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	bounds := m.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	src := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			src[y*w+x] = float64(m.Pix[y*m.Stride+x])
+		}
+	}
+
+	// blur the rows then the columns, the edges repeat
+	tmp := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				v += src[y*w+clamp(x+k-size, 0, w-1)] * weight
+			}
+			tmp[y*w+x] = v
+		}
+	}
+
+	out := image.NewAlpha(bounds)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				v += tmp[clamp(y+k-size, 0, h-1)*w+x] * weight
+			}
+			out.Pix[y*out.Stride+x] = uint8(clamp(int(math.Round(v)), 0, 255))
+		}
+	}
+	return out
+}
+
+// Blend draws effect over original through m. The effect has to be the size
+// of the original, a mask can't follow pixels that were moved around, like
+// by a resize or the characters of ascii art.
+func Blend(original, effect image.Image, m *image.Alpha) (*image.RGBA, error) {
+	bounds := effect.Bounds()
+	if original.Bounds().Size() != bounds.Size() || m.Bounds().Size() != bounds.Size() {
+		return nil, fmt.Errorf("can't mask a %dx%d effect onto a %dx%d image", bounds.Dx(), bounds.Dy(), original.Bounds().Dx(), original.Bounds().Dy())
+	}
+
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, original, original.Bounds().Min, draw.Src)
+	draw.DrawMask(out, bounds, effect, bounds.Min, m, m.Bounds().Min, draw.Over)
+	return out, nil
+}
+
+func clamp(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
@@ -0,0 +1,231 @@
+package mask
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pix/pkg/pixlib"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b, a := c.RGBA()
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+	}
+	return img
+}
+
+func build(t *testing.T, src Source, img image.Image) *image.Alpha {
+	t.Helper()
+	m, err := src(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != img.Bounds() {
+		t.Fatalf("mask bounds %v, want %v", m.Bounds(), img.Bounds())
+	}
+	return m
+}
+
+func count(m *image.Alpha) int {
+	n := 0
+	for _, a := range m.Pix {
+		if a == 255 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestShapes(t *testing.T) {
+	img := solid(100, 50, color.White)
+
+	rect := build(t, Rect(pixlib.R(10, 10, 30, 20)), img)
+	if got := count(rect); got != 20*10 {
+		t.Errorf("rect masked %d pixels, want 200", got)
+	}
+	if rect.AlphaAt(10, 10).A != 255 || rect.AlphaAt(30, 10).A != 0 {
+		t.Error("rect edges are off")
+	}
+
+	ellipse := build(t, Ellipse(pixlib.R(0, 0, 100, 50)), img)
+	if ellipse.AlphaAt(50, 25).A != 255 || ellipse.AlphaAt(0, 0).A != 0 || ellipse.AlphaAt(99, 49).A != 0 {
+		t.Error("ellipse should cover the center and not the corners")
+	}
+
+	tri := build(t, Polygon(pixlib.Polygon{pixlib.V(0, 0), pixlib.V(100, 0), pixlib.V(0, 50)}), img)
+	if tri.AlphaAt(5, 5).A != 255 || tri.AlphaAt(95, 45).A != 0 {
+		t.Error("polygon should cover the top left half")
+	}
+}
+
+func TestParse(t *testing.T) {
+	img := solid(200, 100, color.White)
+
+	for spec, want := range map[string]int{
+		"rect:0,0,50%,50%":               100 * 50,
+		"rect:10,10,20,20":               100,
+		"poly:0,0,100%,0,100%,50%,0,50%": 200 * 50,
+	} {
+		src, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if got := count(build(t, src, img)); got != want {
+			t.Errorf("%s masked %d pixels, want %d", spec, got, want)
+		}
+	}
+
+	for _, spec := range []string{"rect:1,2,3", "poly:0,0,1,1", "luma:a,b", "hue", "ellipse:1,2,3,x%", "edges:nope", "nope.png"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	// a white square on black, half the size of the image it masks
+	file := image.NewGray(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 10; x < 20; x++ {
+			file.SetGray(x, y, color.Gray{255})
+		}
+	}
+	name := filepath.Join(t.TempDir(), "mask.png")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, file); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	src, err := Parse(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := build(t, src, solid(40, 20, color.White))
+	if m.AlphaAt(5, 10).A != 0 || m.AlphaAt(35, 10).A != 255 {
+		t.Error("the mask image wasn't scaled to the image")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.Black)
+	img.Set(1, 0, color.White)
+	img.Set(2, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(3, 0, color.RGBA{0, 0, 255, 255})
+
+	luma := build(t, Luma(0.5, 1), img)
+	if luma.Pix[0] != 0 || luma.Pix[1] != 255 {
+		t.Errorf("luma key masked %v", luma.Pix)
+	}
+
+	red := build(t, Hue(350, 40), img)
+	if red.Pix[2] != 255 || red.Pix[3] != 0 || red.Pix[1] != 0 {
+		t.Errorf("hue key for red masked %v", red.Pix)
+	}
+	blue := build(t, Hue(240, 30), img)
+	if blue.Pix[3] != 255 || blue.Pix[2] != 0 {
+		t.Errorf("hue key for blue masked %v", blue.Pix)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	// black on the left, white on the right
+	img := solid(40, 20, color.Black)
+	for y := 0; y < 20; y++ {
+		for x := 20; x < 40; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+
+	for _, spec := range []string{"edges", "edges:canny"} {
+		src, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		m := build(t, src, img)
+		if m.AlphaAt(5, 10).A != 0 || m.AlphaAt(35, 10).A != 0 {
+			t.Errorf("%s masked the flat parts", spec)
+		}
+		if m.AlphaAt(19, 10).A != 255 && m.AlphaAt(20, 10).A != 255 {
+			t.Errorf("%s missed the edge: %v", spec, m.Pix[10*m.Stride+16:10*m.Stride+24])
+		}
+	}
+}
+
+func TestSubject(t *testing.T) {
+	// a busy saturated patch on a flat grey background
+	img := solid(300, 100, color.Gray{128})
+	for y := 20; y < 80; y++ {
+		for x := 220; x < 280; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 7), 200, uint8(y * 13), 255})
+		}
+	}
+
+	m := build(t, Subject(), img)
+	if count(m) == 0 {
+		t.Fatal("subject mask is empty")
+	}
+	if m.AlphaAt(250, 50).A != 255 || m.AlphaAt(20, 50).A != 0 {
+		t.Error("subject mask missed the busy patch")
+	}
+}
+
+func TestInvertAndFeather(t *testing.T) {
+	m := build(t, Rect(pixlib.R(0, 0, 50, 20)), solid(100, 20, color.White))
+
+	soft := Feather(m, 10)
+	if soft.AlphaAt(10, 10).A != 255 || soft.AlphaAt(90, 10).A != 0 {
+		t.Error("feathering changed the mask away from the edge")
+	}
+	edge := soft.AlphaAt(50, 10).A
+	if edge < 64 || edge > 192 {
+		t.Errorf("feathered edge is %d, want about half", edge)
+	}
+	for x := 41; x < 60; x++ {
+		if soft.AlphaAt(x, 10).A > soft.AlphaAt(x-1, 10).A {
+			t.Fatalf("feathered edge isn't a ramp at x=%d", x)
+		}
+	}
+
+	Invert(m)
+	if m.AlphaAt(10, 10).A != 0 || m.AlphaAt(90, 10).A != 255 {
+		t.Error("invert didn't swap the mask")
+	}
+}
+
+func TestBlend(t *testing.T) {
+	original := solid(10, 10, color.RGBA{255, 0, 0, 255})
+	effect := solid(10, 10, color.RGBA{0, 0, 255, 255})
+	m := build(t, Rect(pixlib.R(0, 0, 5, 10)), original)
+	m.SetAlpha(9, 9, color.Alpha{128})
+
+	out, err := Blend(original, effect, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.RGBAAt(0, 0) != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("masked pixel is %v, want the effect", out.RGBAAt(0, 0))
+	}
+	if out.RGBAAt(7, 0) != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("unmasked pixel is %v, want the original", out.RGBAAt(7, 0))
+	}
+	if c := out.RGBAAt(9, 9); c.R < 120 || c.R > 135 || c.B < 120 || c.B > 135 {
+		t.Errorf("half masked pixel is %v, want a mix", c)
+	}
+
+	// effects that resize, like ascii, can't line up with the mask
+	big := solid(20, 20, color.RGBA{0, 0, 255, 255})
+	if _, err := Blend(original, big, m); err == nil {
+		t.Error("expected an error blending an effect of another size")
+	}
+}
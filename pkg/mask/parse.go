@@ -0,0 +1,161 @@
+package mask
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"pix/pkg/edge"
+	"pix/pkg/imaging"
+	"pix/pkg/pixlib"
+)
+
+// Parse reads a mask spec, anything that isn't one of these is an image file:
+//
+//	rect:x0,y0,x1,y1
+//	ellipse:x0,y0,x1,y1
+//	poly:x,y,x,y,x,y,...
+//	luma:min,max
+//	hue:degrees,width
+//	subject
+//	edges:detector
+//
+// Shape coordinates are pixels or a percentage of the image, eg 25%. Luma
+// goes from 0 - 1 and defaults to the highlights (0.5,1), the hue width
+// defaults to 30 degrees. Edges takes an edge.Parse spec and defaults to sobel.
+func Parse(spec string) (Source, error) {
+	name, args, _ := strings.Cut(spec, ":")
+	var values []string
+	if args != "" {
+		values = strings.Split(args, ",")
+	}
+
+	switch strings.ToLower(name) {
+	case "rect", "ellipse":
+		if len(values) != 4 {
+			return nil, fmt.Errorf("bad mask %q: %s needs x0,y0,x1,y1", spec, name)
+		}
+		coords, err := parseCoords(values)
+		if err != nil {
+			return nil, fmt.Errorf("bad mask %q: %w", spec, err)
+		}
+
+		fn := Rect
+		if strings.ToLower(name) == "ellipse" {
+			fn = Ellipse
+		}
+		return func(img image.Image) (*image.Alpha, error) {
+			p := resolve(coords, img.Bounds())
+			return fn(pixlib.NewRect(p[0], p[1]))(img)
+		}, nil
+
+	case "poly", "polygon":
+		if len(values) < 6 || len(values)%2 != 0 {
+			return nil, fmt.Errorf("bad mask %q: a polygon needs at least 3 x,y points", spec)
+		}
+		coords, err := parseCoords(values)
+		if err != nil {
+			return nil, fmt.Errorf("bad mask %q: %w", spec, err)
+		}
+		return func(img image.Image) (*image.Alpha, error) {
+			return Polygon(resolve(coords, img.Bounds()))(img)
+		}, nil
+
+	case "luma":
+		v, err := parseFloats(values, 0.5, 1)
+		if err != nil {
+			return nil, fmt.Errorf("bad mask %q: %w", spec, err)
+		}
+		return Luma(v[0], v[1]), nil
+
+	case "hue":
+		if len(values) == 0 {
+			return nil, fmt.Errorf("bad mask %q: hue needs degrees", spec)
+		}
+		v, err := parseFloats(values, 0, 30)
+		if err != nil {
+			return nil, fmt.Errorf("bad mask %q: %w", spec, err)
+		}
+		return Hue(v[0], v[1]), nil
+
+	case "subject":
+		return Subject(), nil
+
+	case "edges", "edge":
+		if args == "" {
+			args = "sobel"
+		}
+		detector, err := edge.Parse(args)
+		if err != nil {
+			return nil, fmt.Errorf("bad mask %q: %w", spec, err)
+		}
+		return Edges(detector), nil
+	}
+
+	m, err := imaging.Open(spec, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("unknown mask %q: must be an image or one of [rect|ellipse|poly|luma|hue|subject|edges]: %w", spec, err)
+	}
+	return Image(m), nil
+}
+
+// coord is a value in pixels or a fraction of the image
+type coord struct {
+	v        float64
+	relative bool
+}
+
+func parseCoords(values []string) ([]coord, error) {
+	coords := make([]coord, len(values))
+	for i, s := range values {
+		s = strings.TrimSpace(s)
+		num, pct := strings.CutSuffix(s, "%")
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number or a percentage", s)
+		}
+		if pct {
+			v /= 100
+		}
+		coords[i] = coord{v, pct}
+	}
+	return coords, nil
+}
+
+// resolve turns pairs of coords into points inside bounds
+func resolve(coords []coord, bounds image.Rectangle) pixlib.Polygon {
+	size := [2]float64{float64(bounds.Dx()), float64(bounds.Dy())}
+	origin := [2]float64{float64(bounds.Min.X), float64(bounds.Min.Y)}
+
+	var p pixlib.Polygon
+	for i := 0; i+1 < len(coords); i += 2 {
+		var xy [2]float64
+		for j := range xy {
+			c := coords[i+j]
+			xy[j] = c.v
+			if c.relative {
+				xy[j] *= size[j]
+			}
+			xy[j] += origin[j]
+		}
+		p = append(p, pixlib.V(xy[0], xy[1]))
+	}
+	return p
+}
+
+// parseFloats parses up to len(defaults) values, missing ones are the defaults
+func parseFloats(values []string, defaults ...float64) ([]float64, error) {
+	if len(values) > len(defaults) {
+		return nil, fmt.Errorf("expected at most %d values", len(defaults))
+	}
+	out := append([]float64(nil), defaults...)
+	for i, s := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,281 @@
+// Package montage lays out thumbnails of many images in a grid, also known as a contact sheet
+package montage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"pix/pkg/ascii"
+	"pix/pkg/imaging"
+)
+
+// Tile is one cell of the sheet, images are loaded lazily so only one page
+// worth of images is held in memory at a time
+type Tile struct {
+	Load    func() (image.Image, error)
+	Caption []string // one line each, ie the filename and resolution
+}
+
+// FileTile returns a tile that opens the image at path when it is drawn
+func FileTile(path string, caption ...string) Tile {
+	return Tile{
+		Load: func() (image.Image, error) {
+			return imaging.Open(path, imaging.AutoOrientation(true))
+		},
+		Caption: caption,
+	}
+}
+
+type options struct {
+	columns    int
+	rows       int
+	cellWidth  int
+	cellHeight int
+	padding    int
+	background color.Color
+	foreground color.Color
+	captions   bool
+	fontPts    float64
+	filter     imaging.ResampleFilter
+}
+
+// Option changes how the sheet is laid out
+type Option func(o *options) error
+
+// Columns sets the number of thumbnails in each row
+func Columns(n int) Option {
+	return func(o *options) error {
+		if n < 1 {
+			return fmt.Errorf("columns must be at least 1")
+		}
+		o.columns = n
+		return nil
+	}
+}
+
+// Rows sets the number of rows on each page, 0 puts everything on one page
+func Rows(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("rows cannot be negative")
+		}
+		o.rows = n
+		return nil
+	}
+}
+
+// CellSize sets the size each thumbnail is cropped to
+func CellSize(width, height int) Option {
+	return func(o *options) error {
+		if width < 1 || height < 1 {
+			return fmt.Errorf("cell size must be at least 1x1")
+		}
+		o.cellWidth, o.cellHeight = width, height
+		return nil
+	}
+}
+
+// Padding sets the space in pixels around every cell
+func Padding(px int) Option {
+	return func(o *options) error {
+		if px < 0 {
+			return fmt.Errorf("padding cannot be negative")
+		}
+		o.padding = px
+		return nil
+	}
+}
+
+// Background sets the color behind the thumbnails, the caption color is
+// picked to contrast with it
+func Background(c color.Color) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("background color cannot be nil")
+		}
+		o.background = c
+		o.foreground = contrast(c)
+		return nil
+	}
+}
+
+// Captions turns the text under each thumbnail on or off
+func Captions(on bool) Option {
+	return func(o *options) error {
+		o.captions = on
+		return nil
+	}
+}
+
+// FontPts sets the caption font size in points
+func FontPts(pts float64) Option {
+	return func(o *options) error {
+		if pts <= 0 {
+			return fmt.Errorf("font size cannot be smaller than 0")
+		}
+		o.fontPts = pts
+		return nil
+	}
+}
+
+// Montage renders pages of tiles with a fixed layout
+type Montage struct {
+	opts  options
+	label *ascii.Label
+}
+
+// New returns a Montage, by default 6 columns of 320x180 cells with captions on one page
+func New(opts ...Option) (*Montage, error) {
+	o := options{
+		columns:    6,
+		cellWidth:  320,
+		cellHeight: 180,
+		padding:    8,
+		background: color.RGBA{0x1d, 0x20, 0x21, 0xff},
+		foreground: color.RGBA{0xeb, 0xdb, 0xb2, 0xff},
+		captions:   true,
+		fontPts:    12,
+		filter:     imaging.Linear,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Montage{opts: o}
+	if o.captions {
+		l, err := ascii.NewLabel(nil, o.fontPts)
+		if err != nil {
+			return nil, err
+		}
+		m.label = l
+	}
+	return m, nil
+}
+
+// PerPage returns how many tiles fit on a page, 0 means there is no limit
+func (m *Montage) PerPage() int {
+	return m.opts.columns * m.opts.rows
+}
+
+// Pages splits the tiles into one slice per page
+func (m *Montage) Pages(tiles []Tile) [][]Tile {
+	per := m.PerPage()
+	if per == 0 || len(tiles) <= per {
+		return [][]Tile{tiles}
+	}
+
+	var pages [][]Tile
+	for len(tiles) > 0 {
+		n := min(per, len(tiles))
+		pages = append(pages, tiles[:n])
+		tiles = tiles[n:]
+	}
+	return pages
+}
+
+// captionHeight is the space under each thumbnail reserved for captions
+func (m *Montage) captionHeight(tiles []Tile) int {
+	if m.label == nil {
+		return 0
+	}
+	lines := 0
+	for _, t := range tiles {
+		lines = max(lines, len(t.Caption))
+	}
+	if lines == 0 {
+		return 0
+	}
+	return lines*m.label.Height() + m.opts.padding/2
+}
+
+// Sheet draws the tiles in a single grid. Images that fail to load leave an
+// empty cell with the error as the caption instead of failing the whole sheet.
+func (m *Montage) Sheet(tiles []Tile) (*image.NRGBA, error) {
+	if len(tiles) == 0 {
+		return nil, fmt.Errorf("no images to put on the sheet")
+	}
+
+	o := m.opts
+	cols := min(o.columns, len(tiles))
+	rows := (len(tiles) + o.columns - 1) / o.columns
+	capH := m.captionHeight(tiles)
+	cellH := o.cellHeight + capH
+
+	width := cols*o.cellWidth + (cols+1)*o.padding
+	height := rows*cellH + (rows+1)*o.padding
+	dst := imaging.New(width, height, o.background)
+
+	thumbs := make([]*image.NRGBA, len(tiles))
+	errs := make([]error, len(tiles))
+
+	// decoding dominates, so load and scale the thumbnails in parallel
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, t := range tiles {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, t Tile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			img, err := t.Load()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			thumbs[i] = imaging.Thumbnail(img, o.cellWidth, o.cellHeight, o.filter)
+		}(i, t)
+	}
+	wg.Wait()
+
+	for i, t := range tiles {
+		x := o.padding + (i%o.columns)*(o.cellWidth+o.padding)
+		y := o.padding + (i/o.columns)*(cellH+o.padding)
+
+		if thumbs[i] != nil {
+			draw.Draw(dst, thumbs[i].Bounds().Add(image.Pt(x, y)), thumbs[i], image.Point{}, draw.Src)
+		}
+
+		if m.label == nil {
+			continue
+		}
+
+		caption := t.Caption
+		if errs[i] != nil {
+			caption = []string{errs[i].Error()}
+		}
+		for j, line := range caption {
+			line = m.label.Fit(line, o.cellWidth)
+			m.label.Draw(dst, line, o.foreground, x, y+o.cellHeight+o.padding/2+j*m.label.Height())
+		}
+	}
+
+	return dst, nil
+}
+
+// PageName returns the file name of a page, the first page keeps the name as is
+// and later ones get a number ie (out.png, out-2.png, out-3.png)
+func PageName(name string, page int) string {
+	if page <= 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), page, ext)
+}
+
+// contrast picks a light or dark caption color for the background
+func contrast(bg color.Color) color.Color {
+	r, g, b, _ := bg.RGBA()
+	lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+	if lum > 0.5 {
+		return color.RGBA{0x28, 0x28, 0x28, 0xff}
+	}
+	return color.RGBA{0xeb, 0xdb, 0xb2, 0xff}
+}
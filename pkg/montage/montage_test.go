@@ -0,0 +1,87 @@
+package montage
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"pix/pkg/imaging"
+)
+
+func solidTile(c color.Color, w, h int) Tile {
+	return Tile{
+		Load: func() (image.Image, error) {
+			return imaging.New(w, h, c), nil
+		},
+		Caption: []string{"tile.png", "1920x1080"},
+	}
+}
+
+func TestSheetLayout(t *testing.T) {
+	m, err := New(Columns(3), CellSize(40, 20), Padding(4), Captions(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	red := color.NRGBA{255, 0, 0, 255}
+	tiles := []Tile{
+		solidTile(red, 160, 90),
+		solidTile(red, 90, 160),
+		solidTile(red, 50, 50),
+		solidTile(red, 10, 10),
+	}
+
+	sheet, err := m.Sheet(tiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 columns and 2 rows of 40x20 cells with 4px of padding around them
+	if w, h := sheet.Bounds().Dx(), sheet.Bounds().Dy(); w != 3*40+4*4 || h != 2*20+3*4 {
+		t.Fatalf("sheet is %dx%d, want %dx%d", w, h, 3*40+4*4, 2*20+3*4)
+	}
+
+	// first cell of the second row is filled, the one next to it is background
+	if c := sheet.NRGBAAt(4+20, 4+20+4+10); c != red {
+		t.Errorf("cell pixel is %v, want %v", c, red)
+	}
+	if c := sheet.NRGBAAt(4+40+4+20, 4+20+4+10); c == red {
+		t.Errorf("empty cell pixel is %v, want the background", c)
+	}
+}
+
+func TestSheetLoadError(t *testing.T) {
+	m, err := New(Columns(2), CellSize(64, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiles := []Tile{
+		solidTile(color.White, 64, 64),
+		{Load: func() (image.Image, error) { return nil, errors.New("broken") }},
+	}
+	if _, err := m.Sheet(tiles); err != nil {
+		t.Fatalf("a broken image shouldn't fail the sheet: %v", err)
+	}
+}
+
+func TestPages(t *testing.T) {
+	m, err := New(Columns(4), Rows(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tiles := make([]Tile, 19)
+	pages := m.Pages(tiles)
+	if len(pages) != 3 || len(pages[0]) != 8 || len(pages[2]) != 3 {
+		t.Fatalf("got %d pages, want 3 pages of 8, 8 and 3 tiles", len(pages))
+	}
+
+	names := map[int]string{1: "out.png", 2: "out-2.png", 3: "out-3.png"}
+	for page, want := range names {
+		if got := PageName("out.png", page); got != want {
+			t.Errorf("PageName(out.png, %d) = %s, want %s", page, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"pix/pkg/imaging"
+)
+
+// Hash is a 64 bit perceptual fingerprint of an image
+type Hash uint64
+
+// Kind selects the hashing algorithm
+type Kind int
+
+const (
+	// AHash compares each pixel of an 8x8 grayscale thumbnail to the mean
+	AHash Kind = iota
+	// DHash compares horizontally adjacent pixels of a 9x8 grayscale thumbnail
+	DHash
+	// PHash thresholds the low frequencies of a 32x32 DCT at their median
+	PHash
+)
+
+var kindNames = map[Kind]string{
+	AHash: "ahash",
+	DHash: "dhash",
+	PHash: "phash",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// ParseKind turns a name like "dhash" (or "d") into a Kind
+func ParseKind(s string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "ahash", "average", "a":
+		return AHash, nil
+	case "dhash", "difference", "d":
+		return DHash, nil
+	case "phash", "perceptual", "dct", "p":
+		return PHash, nil
+	}
+	return -1, fmt.Errorf("unknown hash type: %q must be one of [ahash|dhash|phash]", s)
+}
+
+// Distance returns the hamming distance between two hashes, 0 means identical
+// and 64 means every bit differs
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// String returns the hash as a 16 character hex string
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Compute hashes an image with the given algorithm
+func Compute(img image.Image, kind Kind) Hash {
+	switch kind {
+	case AHash:
+		return Average(img)
+	case PHash:
+		return Perceptual(img)
+	default:
+		return Difference(img)
+	}
+}
+
+// grayThumb downsamples the image and returns its luminance values row by row
+func grayThumb(img image.Image, w, h int) []float64 {
+	small := imaging.Resize(img, w, h, imaging.Box)
+	out := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*small.Stride + x*4
+			p := small.Pix[i : i+3 : i+3]
+			out[y*w+x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+		}
+	}
+	return out
+}
+
+// Average computes the aHash of an image
+func Average(img image.Image) Hash {
+	px := grayThumb(img, 8, 8)
+
+	var mean float64
+	for _, v := range px {
+		mean += v
+	}
+	mean /= float64(len(px))
+
+	var h Hash
+	for i, v := range px {
+		if v > mean {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// Difference computes the dHash of an image
+func Difference(img image.Image) Hash {
+	px := grayThumb(img, 9, 8)
+
+	var h Hash
+	bit := 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if px[y*9+x] > px[y*9+x+1] {
+				h |= 1 << uint(bit)
+			}
+			bit++
+		}
+	}
+	return h
+}
+
+// Perceptual computes the DCT based pHash of an image
+func Perceptual(img image.Image) Hash {
+	const size = 32
+	const low = 8
+
+	px := grayThumb(img, size, size)
+	coeffs := dct2D(px, size)
+
+	// keep the top left 8x8 block of low frequencies, skipping the DC term
+	// when computing the median since it only encodes average brightness
+	block := make([]float64, 0, low*low)
+	for y := 0; y < low; y++ {
+		for x := 0; x < low; x++ {
+			block = append(block, coeffs[y*size+x])
+		}
+	}
+
+	sorted := append([]float64{}, block[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var h Hash
+	for i, v := range block {
+		if v > median {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// dct2D runs a separable type-II DCT over an n x n block
+func dct2D(px []float64, n int) []float64 {
+	table := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			table[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += px[y*n+x] * table[k*n+x]
+			}
+			rows[y*n+k] = sum
+		}
+	}
+
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*n+x] * table[k*n+y]
+			}
+			out[k*n+x] = sum
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"pix/pkg/imaging"
+)
+
+func gradient(w, h int, phase float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 128 + 127*math.Sin(fx*9+phase)*math.Cos(fy*7)
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(255 * fx), uint8(255 * fy), 255})
+		}
+	}
+	return img
+}
+
+func TestDistance(t *testing.T) {
+	testCases := []struct {
+		a, b Hash
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^Hash(0), 64},
+	}
+	for _, tc := range testCases {
+		if got := Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("Distance(%v, %v) = %d want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	src := gradient(320, 180, 0)
+	resized := imaging.Resize(src, 160, 90, imaging.Lanczos)
+	brighter := imaging.AdjustBrightness(src, 5)
+	other := gradient(320, 180, math.Pi)
+
+	for _, kind := range []Kind{AHash, DHash, PHash} {
+		t.Run(kind.String(), func(t *testing.T) {
+			h := Compute(src, kind)
+			if d := Distance(h, Compute(resized, kind)); d > 6 {
+				t.Errorf("resized copy distance %d, want <= 6", d)
+			}
+			if d := Distance(h, Compute(brighter, kind)); d > 6 {
+				t.Errorf("brightened copy distance %d, want <= 6", d)
+			}
+			if d := Distance(h, Compute(other, kind)); d < 12 {
+				t.Errorf("different image distance %d, want >= 12", d)
+			}
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for name, want := range map[string]Kind{"ahash": AHash, "D": DHash, "phash": PHash} {
+		got, err := ParseKind(name)
+		if err != nil || got != want {
+			t.Errorf("ParseKind(%q) = %v, %v want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseKind("sha256"); err == nil {
+		t.Error("expected an error for an unknown hash type")
+	}
+}
@@ -12,6 +12,11 @@ import (
 // ZP is the zero image.Point.
 var ZP = image.Point{0, 0}
 
+// MaxPixels is the largest image the decoders allocate, a header asking for
+// more is almost certainly corrupt. At 16 bits per channel it still takes
+// 800 MB.
+const MaxPixels = 100_000_000
+
 // NewImage creates an image of the given size (optionally filled with a color)
 func NewImage(w, h int, colors ...color.Color) *image.RGBA {
 	m := NewRGBA(IR(0, 0, w, h))
@@ -0,0 +1,479 @@
+// Package pnm implements a decoder and encoder for the Netpbm formats, PBM
+// (bitmaps), PGM (grayscale), PPM (color) and PAM (any of those with alpha).
+//
+// Both the plain (P1-P3) and the binary (P4-P7) variants are decoded, images
+// are always encoded in binary. Samples with a maxval above 255 are decoded to
+// 16 bit images and 16 bit images are encoded with a maxval of 65535.
+package pnm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"pix/pkg/pixlib"
+)
+
+// Format selects which Netpbm format to encode to
+type Format int
+
+const (
+	// PBM is a 1 bit black and white bitmap
+	PBM Format = iota
+	// PGM is grayscale
+	PGM
+	// PPM is RGB
+	PPM
+	// PAM stores grayscale or RGB with an alpha channel
+	PAM
+)
+
+// ErrFormat is returned when the data isn't a valid Netpbm image
+var ErrFormat = errors.New("pnm: invalid format")
+
+type header struct {
+	magic    string // P1 - P7
+	width    int
+	height   int
+	depth    int // samples per pixel
+	maxval   int
+	tupltype string
+	plain    bool
+}
+
+// bitmap reports whether the image is a PBM, where 1 means black instead of
+// full intensity. PAM black and white images use 1 for white like every other type.
+func (h header) bitmap() bool {
+	return h.magic == "P1" || h.magic == "P4"
+}
+
+// reader reads whitespace separated tokens and skips # comments
+type reader struct {
+	*bufio.Reader
+}
+
+func (r reader) token() (string, error) {
+	var sb strings.Builder
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			return "", err
+		}
+
+		if b == '#' {
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", err
+			}
+			if sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			continue
+		}
+
+		if isSpace(b) {
+			if sb.Len() > 0 {
+				return sb.String(), nil
+			}
+			continue
+		}
+
+		sb.WriteByte(b)
+	}
+}
+
+func (r reader) int() (int, error) {
+	t, err := r.token()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(t)
+	if err != nil || n < 0 {
+		return 0, ErrFormat
+	}
+	return n, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func readHeader(r reader) (header, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return header{}, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return header{}, ErrFormat
+	}
+
+	h := header{magic: string(magic[:]), plain: magic[1] <= '3'}
+	if magic[1] == '7' {
+		if err := readPAMHeader(r, &h); err != nil {
+			return header{}, err
+		}
+	} else {
+		var err error
+		if h.width, err = r.int(); err != nil {
+			return header{}, err
+		}
+		if h.height, err = r.int(); err != nil {
+			return header{}, err
+		}
+
+		h.maxval, h.depth = 1, 1
+		switch h.magic {
+		case "P2", "P5":
+			h.maxval, err = r.int()
+		case "P3", "P6":
+			h.depth = 3
+			h.maxval, err = r.int()
+		}
+		if err != nil {
+			return header{}, err
+		}
+	}
+
+	// divided so huge sizes can't overflow past the limit
+	if h.width == 0 || h.height == 0 || h.width > pixlib.MaxPixels/h.height {
+		return header{}, ErrFormat
+	}
+	if h.maxval < 1 || h.maxval > 65535 || h.depth < 1 || h.depth > 4 {
+		return header{}, ErrFormat
+	}
+	return h, nil
+}
+
+func readPAMHeader(r reader, h *header) error {
+	for {
+		key, err := r.token()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "ENDHDR":
+			// the newline after it was consumed with the token, the raster starts here
+			return nil
+		case "TUPLTYPE":
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			h.tupltype = strings.TrimSpace(line)
+		case "WIDTH", "HEIGHT", "DEPTH", "MAXVAL":
+			n, err := r.int()
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "WIDTH":
+				h.width = n
+			case "HEIGHT":
+				h.height = n
+			case "DEPTH":
+				h.depth = n
+			case "MAXVAL":
+				h.maxval = n
+			}
+		default:
+			return fmt.Errorf("pnm: unknown PAM header field %q", key)
+		}
+	}
+}
+
+func config(h header) image.Config {
+	deep := h.maxval > 255
+	var model color.Model
+	switch {
+	case h.depth == 1 && deep:
+		model = color.Gray16Model
+	case h.depth == 1:
+		model = color.GrayModel
+	case deep:
+		model = color.NRGBA64Model
+	default:
+		model = color.NRGBAModel
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}
+}
+
+// DecodeConfig returns the color model and dimensions of a Netpbm image without decoding it
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(reader{bufio.NewReader(r)})
+	if err != nil {
+		return image.Config{}, err
+	}
+	return config(h), nil
+}
+
+// Decode reads a Netpbm image from r. Grayscale images are returned as
+// *image.Gray or *image.Gray16, everything else as *image.NRGBA or *image.NRGBA64.
+func Decode(r io.Reader) (image.Image, error) {
+	rd := reader{bufio.NewReader(r)}
+	h, err := readHeader(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := sampleReader(rd, h)
+	if err != nil {
+		return nil, err
+	}
+
+	// scale samples from 0-maxval to 0-65535
+	scale := func(v int) uint16 {
+		if v > h.maxval {
+			v = h.maxval
+		}
+		return uint16((v*65535 + h.maxval/2) / h.maxval)
+	}
+
+	cfg := config(h)
+	rect := image.Rect(0, 0, h.width, h.height)
+	samples := make([]uint16, h.depth)
+
+	var set func(x, y int, s []uint16)
+	var img image.Image
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		m := image.NewGray(rect)
+		set = func(x, y int, s []uint16) { m.Pix[y*m.Stride+x] = uint8(s[0] >> 8) }
+		img = m
+	case color.Gray16Model:
+		m := image.NewGray16(rect)
+		set = func(x, y int, s []uint16) { m.SetGray16(x, y, color.Gray16{s[0]}) }
+		img = m
+	case color.NRGBAModel:
+		m := image.NewNRGBA(rect)
+		set = func(x, y int, s []uint16) {
+			c := toNRGBA64(h, s)
+			i := y*m.Stride + x*4
+			m.Pix[i+0], m.Pix[i+1], m.Pix[i+2], m.Pix[i+3] = uint8(c.R>>8), uint8(c.G>>8), uint8(c.B>>8), uint8(c.A>>8)
+		}
+		img = m
+	default:
+		m := image.NewNRGBA64(rect)
+		set = func(x, y int, s []uint16) { m.SetNRGBA64(x, y, toNRGBA64(h, s)) }
+		img = m
+	}
+
+	for y := 0; y < h.height; y++ {
+		for x := 0; x < h.width; x++ {
+			for i := range samples {
+				v, err := next(x)
+				if err != nil {
+					return nil, err
+				}
+				samples[i] = scale(v)
+			}
+			if h.bitmap() {
+				// 1 is black in bitmaps
+				samples[0] = ^samples[0]
+			}
+			set(x, y, samples)
+		}
+	}
+
+	return img, nil
+}
+
+// toNRGBA64 spreads 1 to 4 samples over the color channels
+func toNRGBA64(h header, s []uint16) color.NRGBA64 {
+	switch h.depth {
+	case 1:
+		return color.NRGBA64{s[0], s[0], s[0], 0xffff}
+	case 2:
+		return color.NRGBA64{s[0], s[0], s[0], s[1]}
+	case 3:
+		return color.NRGBA64{s[0], s[1], s[2], 0xffff}
+	default:
+		return color.NRGBA64{s[0], s[1], s[2], s[3]}
+	}
+}
+
+// sampleReader returns a function that reads the next sample of the raster,
+// x is the column of the pixel the sample belongs to
+func sampleReader(r reader, h header) (func(x int) (int, error), error) {
+	switch {
+	case h.plain:
+		return func(int) (int, error) {
+			if h.magic == "P1" {
+				// bits don't need to be separated by whitespace
+				for {
+					b, err := r.ReadByte()
+					if err != nil {
+						return 0, unexpectedEOF(err)
+					}
+					switch {
+					case b == '0' || b == '1':
+						return int(b - '0'), nil
+					case b == '#':
+						r.ReadString('\n')
+					case !isSpace(b):
+						return 0, ErrFormat
+					}
+				}
+			}
+			v, err := r.int()
+			return v, unexpectedEOF(err)
+		}, nil
+
+	case h.magic == "P4":
+		// rows are packed 8 pixels to a byte, msb first, and padded to a whole byte
+		var cur byte
+		return func(x int) (int, error) {
+			if x%8 == 0 {
+				b, err := r.ReadByte()
+				if err != nil {
+					return 0, unexpectedEOF(err)
+				}
+				cur = b
+			}
+			return int(cur>>(7-uint(x%8))) & 1, nil
+		}, nil
+
+	case h.maxval > 255:
+		var buf [2]byte
+		return func(int) (int, error) {
+			if _, err := io.ReadFull(r, buf[:]); err != nil {
+				return 0, unexpectedEOF(err)
+			}
+			return int(buf[0])<<8 | int(buf[1]), nil
+		}, nil
+
+	default:
+		return func(int) (int, error) {
+			b, err := r.ReadByte()
+			return int(b), unexpectedEOF(err)
+		}, nil
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Encode writes img to w in the given format. PBM thresholds the luminance at
+// 50%, PGM drops the color and PAM keeps the alpha channel, storing grayscale
+// images as GRAYSCALE_ALPHA and everything else as RGB_ALPHA.
+func Encode(w io.Writer, img image.Image, format Format) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("pnm: can't encode an empty image")
+	}
+
+	deep := false
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model:
+		deep = true
+	}
+	maxval := 255
+	if deep {
+		maxval = 65535
+	}
+
+	gray := img.ColorModel() == color.GrayModel || img.ColorModel() == color.Gray16Model
+
+	bw := bufio.NewWriter(w)
+	var depth int
+	switch format {
+	case PBM:
+		fmt.Fprintf(bw, "P4\n%d %d\n", b.Dx(), b.Dy())
+	case PGM:
+		depth = 1
+		fmt.Fprintf(bw, "P5\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	case PPM:
+		depth = 3
+		fmt.Fprintf(bw, "P6\n%d %d\n%d\n", b.Dx(), b.Dy(), maxval)
+	case PAM:
+		depth = 4
+		tupl := "RGB_ALPHA"
+		if gray {
+			depth, tupl = 2, "GRAYSCALE_ALPHA"
+		}
+		fmt.Fprintf(bw, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\nTUPLTYPE %s\nENDHDR\n", b.Dx(), b.Dy(), depth, maxval, tupl)
+	default:
+		return fmt.Errorf("pnm: unknown format %d", format)
+	}
+
+	if format == PBM {
+		row := make([]byte, (b.Dx()+7)/8)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			clear(row)
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y < 0x8000 {
+					i := x - b.Min.X
+					row[i/8] |= 0x80 >> uint(i%8)
+				}
+			}
+			bw.Write(row)
+		}
+		return bw.Flush()
+	}
+
+	samples := make([]uint16, 0, 4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := nrgba64At(img, x, y)
+			lum := color.Gray16Model.Convert(color.RGBA64{c.R, c.G, c.B, 0xffff}).(color.Gray16).Y
+
+			samples = samples[:0]
+			switch depth {
+			case 1:
+				samples = append(samples, lum)
+			case 2:
+				samples = append(samples, lum, c.A)
+			case 3:
+				samples = append(samples, c.R, c.G, c.B)
+			case 4:
+				samples = append(samples, c.R, c.G, c.B, c.A)
+			}
+
+			for _, s := range samples {
+				if deep {
+					bw.WriteByte(byte(s >> 8))
+					bw.WriteByte(byte(s))
+				} else {
+					bw.WriteByte(byte(s >> 8))
+				}
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// nrgba64At reads non-premultiplied images directly so the color of
+// transparent pixels survives in PAM files
+func nrgba64At(img image.Image, x, y int) color.NRGBA64 {
+	switch m := img.(type) {
+	case *image.NRGBA:
+		c := m.NRGBAAt(x, y)
+		return color.NRGBA64{uint16(c.R) * 0x101, uint16(c.G) * 0x101, uint16(c.B) * 0x101, uint16(c.A) * 0x101}
+	case *image.NRGBA64:
+		return m.NRGBA64At(x, y)
+	}
+	return color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+}
+
+func init() {
+	for _, m := range []struct{ name, magic string }{
+		{"pbm", "P1"}, {"pbm", "P4"},
+		{"pgm", "P2"}, {"pgm", "P5"},
+		{"ppm", "P3"}, {"ppm", "P6"},
+		{"pam", "P7"},
+	} {
+		image.RegisterFormat(m.name, m.magic, Decode, DecodeConfig)
+	}
+}
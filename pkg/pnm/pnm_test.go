@@ -0,0 +1,153 @@
+package pnm
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDecodePlain(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+		want []color.Color
+	}{
+		{
+			name: "pbm",
+			data: "P1\n# comment\n3 1\n101",
+			want: []color.Color{color.Gray{0}, color.Gray{255}, color.Gray{0}},
+		},
+		{
+			name: "pgm",
+			data: "P2 3 1 10\n0 5 10\n",
+			want: []color.Color{color.Gray{0}, color.Gray{128}, color.Gray{255}},
+		},
+		{
+			name: "ppm",
+			data: "P3\n2 1\n255\n255 0 0  # red\n0 0 255\n",
+			want: []color.Color{color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, format, err := image.Decode(bytes.NewReader([]byte(tc.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tc.name {
+				t.Errorf("got format %q want %q", format, tc.name)
+			}
+			for x, want := range tc.want {
+				if got := m.At(x, 0); got != want {
+					t.Errorf("pixel %d: got %v want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 11, 7))
+	gray16 := image.NewGray16(image.Rect(0, 0, 11, 7))
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 11; x++ {
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 23), uint8(y * 36), uint8(x * y), uint8(255 - x*10)})
+			gray16.SetGray16(x, y, color.Gray16{uint16(x*y*811 + 1)})
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		img    image.Image
+		format Format
+		check  func(x, y int, got color.Color) bool
+	}{
+		{
+			name:   "pam keeps alpha",
+			img:    nrgba,
+			format: PAM,
+			check: func(x, y int, got color.Color) bool {
+				return got == nrgba.NRGBAAt(x, y)
+			},
+		},
+		{
+			name:   "ppm drops alpha",
+			img:    nrgba,
+			format: PPM,
+			check: func(x, y int, got color.Color) bool {
+				want := nrgba.NRGBAAt(x, y)
+				want.A = 255
+				return got == want
+			},
+		},
+		{
+			name:   "pgm keeps 16 bits",
+			img:    gray16,
+			format: PGM,
+			check: func(x, y int, got color.Color) bool {
+				return got == gray16.Gray16At(x, y)
+			},
+		},
+		{
+			name:   "pbm thresholds",
+			img:    gray16,
+			format: PBM,
+			check: func(x, y int, got color.Color) bool {
+				want := color.Gray{0}
+				if gray16.Gray16At(x, y).Y >= 0x8000 {
+					want.Y = 255
+				}
+				return got == want
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tc.img, tc.format); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Bounds() != tc.img.Bounds() {
+				t.Fatalf("got bounds %v want %v", m.Bounds(), tc.img.Bounds())
+			}
+
+			for y := 0; y < 7; y++ {
+				for x := 0; x < 11; x++ {
+					if !tc.check(x, y, m.At(x, y)) {
+						t.Fatalf("pixel %d,%d: got %v", x, y, m.At(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"not a pnm",
+		"P6 0 10 255\n",
+		"P5 2 2 70000\n",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 9\nMAXVAL 255\nENDHDR\n",
+		"P6 2 2 255\n\x00\x00",
+		// sizes past the pixel limit are rejected before anything is allocated
+		"P6 20000 20000 255\n",
+		"P5 4294967296 4294967296 255\n",
+		"P7\nWIDTH 100000\nHEIGHT 100000\nDEPTH 4\nMAXVAL 65535\nENDHDR\n",
+	} {
+		if _, err := Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+
+	if _, err := DecodeConfig(bytes.NewReader([]byte("P6 20000 20000 255\n"))); err != ErrFormat {
+		t.Errorf("DecodeConfig past the pixel limit: got %v want ErrFormat", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package qoi implements a decoder and encoder for the "Quite OK Image" format,
+// a fast lossless format that is handy for intermediate files.
+//
+// The specification is at https://qoiformat.org/qoi-specification.pdf
+package qoi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+
+	"pix/pkg/pixlib"
+)
+
+const (
+	magic      = "qoif"
+	headerSize = 14
+
+	opIndex = 0x00 // 00xxxxxx
+	opDiff  = 0x40 // 01xxxxxx
+	opLuma  = 0x80 // 10xxxxxx
+	opRun   = 0xc0 // 11xxxxxx
+	opRGB   = 0xfe // 11111110
+	opRGBA  = 0xff // 11111111
+	opMask  = 0xc0
+)
+
+var padding = [8]byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+// ErrFormat is returned when the data isn't a valid QOI image
+var ErrFormat = errors.New("qoi: invalid format")
+
+type header struct {
+	width, height uint32
+	channels      uint8
+	colorspace    uint8
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var b [headerSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return header{}, err
+	}
+	if string(b[:4]) != magic {
+		return header{}, ErrFormat
+	}
+
+	h := header{
+		width:      binary.BigEndian.Uint32(b[4:]),
+		height:     binary.BigEndian.Uint32(b[8:]),
+		channels:   b[12],
+		colorspace: b[13],
+	}
+	if h.width == 0 || h.height == 0 || uint64(h.width)*uint64(h.height) > pixlib.MaxPixels {
+		return header{}, ErrFormat
+	}
+	if h.channels != 3 && h.channels != 4 {
+		return header{}, ErrFormat
+	}
+	return h, nil
+}
+
+func hash(c color.NRGBA) byte {
+	return (c.R*3 + c.G*5 + c.B*7 + c.A*11) % 64
+}
+
+// DecodeConfig returns the dimensions of a QOI image without decoding it
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: color.NRGBAModel,
+		Width:      int(h.width),
+		Height:     int(h.height),
+	}, nil
+}
+
+// Decode reads a QOI image from r and returns it as an *image.NRGBA
+func Decode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, int(h.width), int(h.height)))
+
+	var index [64]color.NRGBA
+	px := color.NRGBA{A: 0xff}
+	run := 0
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			switch {
+			case b == opRGB:
+				var c [3]byte
+				if _, err := io.ReadFull(br, c[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px.R, px.G, px.B = c[0], c[1], c[2]
+			case b == opRGBA:
+				var c [4]byte
+				if _, err := io.ReadFull(br, c[:]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px = color.NRGBA{c[0], c[1], c[2], c[3]}
+			case b&opMask == opIndex:
+				px = index[b]
+			case b&opMask == opDiff:
+				px.R += (b>>4)&0x03 - 2
+				px.G += (b>>2)&0x03 - 2
+				px.B += b&0x03 - 2
+			case b&opMask == opLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				dg := b&0x3f - 32
+				px.R += dg - 8 + (b2>>4)&0x0f
+				px.G += dg
+				px.B += dg - 8 + b2&0x0f
+			case b&opMask == opRun:
+				run = int(b & 0x3f)
+			}
+
+			index[hash(px)] = px
+		}
+
+		img.Pix[i+0] = px.R
+		img.Pix[i+1] = px.G
+		img.Pix[i+2] = px.B
+		img.Pix[i+3] = px.A
+	}
+
+	return img, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Encode writes img to w in the QOI format. Opaque images are stored with 3
+// channels, anything with transparency with 4.
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return errors.New("qoi: can't encode an empty image")
+	}
+
+	src, ok := img.(*image.NRGBA)
+	if !ok || src.Rect.Min != (image.Point{}) {
+		src = image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	channels := uint8(4)
+	if src.Opaque() {
+		channels = 3
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var hdr [headerSize]byte
+	copy(hdr[:], magic)
+	binary.BigEndian.PutUint32(hdr[4:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hdr[8:], uint32(b.Dy()))
+	hdr[12] = channels
+	hdr[13] = 0 // sRGB with linear alpha
+	bw.Write(hdr[:])
+
+	var index [64]color.NRGBA
+	prev := color.NRGBA{A: 0xff}
+	run := 0
+	w4 := b.Dx() * 4
+
+	for y := 0; y < b.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w4]
+		for x := 0; x < w4; x += 4 {
+			px := color.NRGBA{row[x], row[x+1], row[x+2], row[x+3]}
+
+			if px == prev {
+				run++
+				if run == 62 {
+					bw.WriteByte(opRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+
+			if run > 0 {
+				bw.WriteByte(opRun | byte(run-1))
+				run = 0
+			}
+
+			h := hash(px)
+			if index[h] == px {
+				bw.WriteByte(opIndex | h)
+				prev = px
+				continue
+			}
+			index[h] = px
+
+			if px.A != prev.A {
+				bw.Write([]byte{opRGBA, px.R, px.G, px.B, px.A})
+				prev = px
+				continue
+			}
+
+			// wrapping differences, the decoder wraps the same way
+			dr := int8(px.R - prev.R)
+			dg := int8(px.G - prev.G)
+			db := int8(px.B - prev.B)
+			drg := dr - dg
+			dbg := db - dg
+
+			switch {
+			case dr >= -2 && dr <= 1 && dg >= -2 && dg <= 1 && db >= -2 && db <= 1:
+				bw.WriteByte(opDiff | byte(dr+2)<<4 | byte(dg+2)<<2 | byte(db+2))
+			case dg >= -32 && dg <= 31 && drg >= -8 && drg <= 7 && dbg >= -8 && dbg <= 7:
+				bw.Write([]byte{opLuma | byte(dg+32), byte(drg+8)<<4 | byte(dbg+8)})
+			default:
+				bw.Write([]byte{opRGB, px.R, px.G, px.B})
+			}
+			prev = px
+		}
+	}
+
+	if run > 0 {
+		bw.WriteByte(opRun | byte(run-1))
+	}
+
+	bw.Write(padding[:])
+	return bw.Flush()
+}
+
+func init() {
+	image.RegisterFormat("qoi", magic, Decode, DecodeConfig)
+}
@@ -0,0 +1,129 @@
+package qoi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func testImage(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+			switch {
+			case x < w/4:
+				// flat area for runs
+				c = color.NRGBA{10, 20, 30, 255}
+			case x < w/2:
+				// smooth gradient for diff and luma ops
+				c = color.NRGBA{uint8(x * 3), uint8(y * 2), uint8(x + y), 255}
+			default:
+				// noise for index and rgb ops
+				c = color.NRGBA{uint8(rnd.Intn(4) * 60), uint8(rnd.Intn(256)), uint8(rnd.Intn(3) * 100), 255}
+			}
+			if alpha {
+				c.A = uint8(y * 255 / h)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, alpha := range []bool{false, true} {
+		want := testImage(97, 61, alpha)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, want); err != nil {
+			t.Fatal(err)
+		}
+
+		if ch := buf.Bytes()[12]; (ch == 4) != alpha {
+			t.Errorf("alpha=%v: got %d channels", alpha, ch)
+		}
+
+		m, format, err := image.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "qoi" {
+			t.Errorf("got format %q want qoi", format)
+		}
+
+		got := m.(*image.NRGBA)
+		if got.Rect != want.Rect || !bytes.Equal(got.Pix, want.Pix) {
+			t.Fatalf("alpha=%v: decoded image differs from the original", alpha)
+		}
+
+		// lossless but still smaller than raw pixels
+		if raw := 97 * 61 * 4; buf.Len() >= raw {
+			t.Errorf("alpha=%v: encoded %d bytes, raw is %d", alpha, buf.Len(), raw)
+		}
+	}
+}
+
+func TestDecodeOps(t *testing.T) {
+	data := []byte{'q', 'o', 'i', 'f', 0, 0, 0, 6, 0, 0, 0, 1, 4, 0}
+	data = append(data,
+		opRGB, 100, 100, 100, // 100,100,100
+		opDiff|3<<4|2<<2|1,             // +1, +0, -1
+		opLuma|(32+10), (8+2)<<4|(8-3), // g+10, r+12, b+7
+		opRun|1, // repeat twice
+		opIndex|hash(color.NRGBA{100, 100, 100, 255}),
+	)
+	data = append(data, padding[:]...)
+
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []color.NRGBA{
+		{100, 100, 100, 255},
+		{101, 100, 99, 255},
+		{113, 110, 106, 255},
+		{113, 110, 106, 255},
+		{113, 110, 106, 255},
+		{100, 100, 100, 255},
+	}
+	img := m.(*image.NRGBA)
+	for x, c := range want {
+		if got := img.NRGBAAt(x, 0); got != c {
+			t.Errorf("pixel %d: got %v want %v", x, got, c)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(bytes.NewReader([]byte("not a qoi image"))); err != ErrFormat {
+		t.Errorf("bad magic: got %v want ErrFormat", err)
+	}
+
+	var buf bytes.Buffer
+	Encode(&buf, testImage(16, 16, false))
+	if _, err := Decode(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Error("truncated image: expected an error")
+	}
+
+	cfg, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil || cfg.Width != 16 || cfg.Height != 16 {
+		t.Errorf("DecodeConfig: got %+v, %v", cfg, err)
+	}
+
+	// a corrupt size is rejected before the image is allocated
+	huge := append([]byte(nil), buf.Bytes()...)
+	binary.BigEndian.PutUint32(huge[4:], 20000)
+	binary.BigEndian.PutUint32(huge[8:], 20000)
+	if _, err := Decode(bytes.NewReader(huge)); err != ErrFormat {
+		t.Errorf("huge image: got %v want ErrFormat", err)
+	}
+	if _, err := DecodeConfig(bytes.NewReader(huge)); err != ErrFormat {
+		t.Errorf("huge image DecodeConfig: got %v want ErrFormat", err)
+	}
+}
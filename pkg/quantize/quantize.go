@@ -176,3 +176,52 @@ func Palette(img image.Image, levels int) []color.RGBA {
 	}
 	return Pixels(pixels, levels)
 }
+
+// MedianCut reduces the pixels to at most n colors. Unlike Pixels the box with
+// the widest spread is the one that gets split every time, so n doesn't have
+// to be a power of two and flat areas don't waste colors. The pixels are
+// reordered in place.
+func MedianCut(pixels []color.RGBA, n int) []color.RGBA {
+	if len(pixels) == 0 || n < 1 {
+		return nil
+	}
+
+	boxes := [][]color.RGBA{pixels}
+	spreads := []int{spread(pixels)}
+
+	for len(boxes) < n {
+		best := -1
+		for i, s := range spreads {
+			if len(boxes[i]) > 1 && s > 0 && (best < 0 || s > spreads[best]) {
+				best = i
+			}
+		}
+
+		// every box is a single color
+		if best < 0 {
+			break
+		}
+
+		left, right := Partition(boxes[best])
+		boxes[best], spreads[best] = left, spread(left)
+		boxes = append(boxes, right)
+		spreads = append(spreads, spread(right))
+	}
+
+	// a median can land in the middle of a run of one color and leave it in two boxes
+	averages := make([]color.RGBA, 0, len(boxes))
+	seen := make(map[color.RGBA]bool, len(boxes))
+	for _, box := range boxes {
+		c := Average(box)
+		if !seen[c] {
+			seen[c] = true
+			averages = append(averages, c)
+		}
+	}
+	return averages
+}
+
+func spread(pixels []color.RGBA) int {
+	r, g, b := Spread(pixels)
+	return int(max(r, max(g, b)))
+}
@@ -90,3 +90,23 @@ func TestPalette(t *testing.T) {
 		})
 	}
 }
+
+func TestMedianCut(t *testing.T) {
+	var pixels []color.RGBA
+	for i := 0; i < 1000; i++ {
+		pixels = append(pixels, color.RGBA{uint8(i % 256), uint8(i % 7 * 30), 40, 0xFF})
+	}
+
+	for _, n := range []int{1, 5, 100} {
+		p := MedianCut(append([]color.RGBA(nil), pixels...), n)
+		if len(p) != n {
+			t.Errorf("asked for %d colors, got %d", n, len(p))
+		}
+	}
+
+	// a flat image can't be split any further
+	flat := []color.RGBA{{1, 2, 3, 0xFF}, {1, 2, 3, 0xFF}, {9, 9, 9, 0xFF}}
+	if p := MedianCut(flat, 16); len(p) != 2 {
+		t.Errorf("got %d colors from 2 distinct colors", len(p))
+	}
+}
@@ -0,0 +1,401 @@
+// Package seam resizes images by seam carving. A seam is a connected path of
+// pixels from one edge of the image to the other, one per row or column, that
+// crosses as little detail as possible. Removing seams shrinks the image and
+// duplicating them grows it, so the background gives way while the subject
+// keeps its shape. The energy of a pixel is its gradient magnitude, and by
+// default the forward energy of the edges a removal would create is added so
+// straight lines don't get jagged.
+package seam
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+type options struct {
+	protect *image.Alpha
+	remove  *image.Alpha
+	forward bool
+}
+
+// Option changes how seams are found
+type Option func(o *options) error
+
+// Protect keeps seams out of the opaque parts of the mask, covering the
+// subject keeps it whole no matter how far the image is shrunk
+func Protect(m *image.Alpha) Option {
+	return func(o *options) error {
+		if m == nil {
+			return fmt.Errorf("protect mask is nil")
+		}
+		o.protect = m
+		return nil
+	}
+}
+
+// Remove carves the opaque parts of the mask out of the image before it is
+// resized, seams run through them first until nothing of them is left
+func Remove(m *image.Alpha) Option {
+	return func(o *options) error {
+		if m == nil {
+			return fmt.Errorf("remove mask is nil")
+		}
+		o.remove = m
+		return nil
+	}
+}
+
+// ForwardEnergy adds the cost of the edges that removing a pixel creates
+// between its neighbours to the energy, on by default
+func ForwardEnergy(enabled bool) Option {
+	return func(o *options) error {
+		o.forward = enabled
+		return nil
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{forward: true}
+
+	for _, setter := range opts {
+		if setter == nil {
+			return nil, fmt.Errorf("option supplied is nil")
+		}
+		if err := setter(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// Resize carves or grows the image to width x height. Masked parts set with
+// Remove are carved out first, then the width changes and then the height.
+// Growing by more than half the size is done in rounds, so no seam is
+// stretched more than twice per round.
+func Resize(img image.Image, width, height int, opts ...Option) (*image.NRGBA, error) {
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("seam carving needs a size of at least 1x1, got %dx%d", width, height)
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCarver(img, o)
+	c.removeMasked()
+
+	c.vertical()
+	c.resize(width)
+	c.horizontal()
+	c.resize(height)
+	c.vertical()
+
+	return c.image(), nil
+}
+
+// carver holds the image being carved, always carving vertical seams, the
+// planes are transposed to carve horizontal ones
+type carver struct {
+	w, h       int
+	transposed bool
+	forward    bool
+
+	pix    []color.NRGBA
+	luma   []float64
+	energy []float64
+	// bias is 1 where protected and -1 where removed
+	bias []float64
+	// orig is the column every pixel started in, when finding seams to insert
+	orig []int
+
+	cost []float64
+	from []int8
+}
+
+func newCarver(img image.Image, o *options) *carver {
+	b := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Rect, img, b.Min, draw.Src)
+
+	c := &carver{w: b.Dx(), h: b.Dy(), forward: o.forward}
+	c.pix = make([]color.NRGBA, c.w*c.h)
+	c.luma = make([]float64, c.w*c.h)
+	c.bias = make([]float64, c.w*c.h)
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			i := y*c.w + x
+			c.pix[i] = src.NRGBAAt(x, y)
+			c.luma[i] = luma(c.pix[i])
+			if o.protect != nil {
+				c.bias[i] += float64(o.protect.AlphaAt(b.Min.X+x, b.Min.Y+y).A) / 255
+			}
+			if o.remove != nil {
+				c.bias[i] -= float64(o.remove.AlphaAt(b.Min.X+x, b.Min.Y+y).A) / 255
+			}
+		}
+	}
+	c.updateEnergy()
+	return c
+}
+
+func luma(c color.NRGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// image is the carved image the right way round
+func (c *carver) image() *image.NRGBA {
+	c.vertical()
+	dst := image.NewNRGBA(image.Rect(0, 0, c.w, c.h))
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			dst.SetNRGBA(x, y, c.pix[y*c.w+x])
+		}
+	}
+	return dst
+}
+
+// vertical and horizontal turn the planes so seams run down the columns or
+// along the rows of the image
+func (c *carver) vertical() {
+	if c.transposed {
+		c.transpose()
+	}
+}
+
+func (c *carver) horizontal() {
+	if !c.transposed {
+		c.transpose()
+	}
+}
+
+func (c *carver) transpose() {
+	c.pix = transpose(c.pix, c.w, c.h)
+	c.luma = transpose(c.luma, c.w, c.h)
+	c.energy = transpose(c.energy, c.w, c.h)
+	c.bias = transpose(c.bias, c.w, c.h)
+	c.w, c.h = c.h, c.w
+	c.transposed = !c.transposed
+}
+
+func transpose[T any](p []T, w, h int) []T {
+	out := make([]T, len(p))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out[x*h+y] = p[y*w+x]
+		}
+	}
+	return out
+}
+
+// resize removes or inserts vertical seams until the width is size
+func (c *carver) resize(size int) {
+	for c.w > size {
+		c.remove(c.find())
+	}
+	for c.w < size {
+		// seams are inserted in rounds of at most half the width, each seam is
+		// doubled once per round
+		c.insert(min(size-c.w, max(c.w/2, 1)))
+	}
+}
+
+// removeMasked carves seams through the parts marked by Remove until they
+// are gone, along their shorter side
+func (c *carver) removeMasked() {
+	x0, y0, x1, y1 := c.w, c.h, -1, -1
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			if c.bias[y*c.w+x] < 0 {
+				x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+			}
+		}
+	}
+	if x1 < 0 {
+		return
+	}
+	if x1-x0 > y1-y0 {
+		c.horizontal()
+	}
+
+	for c.w > 1 && c.masked() {
+		c.remove(c.find())
+	}
+}
+
+func (c *carver) masked() bool {
+	for _, b := range c.bias {
+		if b < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *carver) updateEnergy() {
+	c.energy = make([]float64, c.w*c.h)
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			c.energy[y*c.w+x] = c.energyAt(x, y)
+		}
+	}
+}
+
+// energyAt is the sobel gradient magnitude of the luma, scaled so a step
+// from black to white is 255
+func (c *carver) energyAt(x, y int) float64 {
+	l := func(x, y int) float64 {
+		return c.luma[clamp(y, 0, c.h-1)*c.w+clamp(x, 0, c.w-1)]
+	}
+	gx := l(x+1, y-1) + 2*l(x+1, y) + l(x+1, y+1) - l(x-1, y-1) - 2*l(x-1, y) - l(x-1, y+1)
+	gy := l(x-1, y+1) + 2*l(x, y+1) + l(x+1, y+1) - l(x-1, y-1) - 2*l(x, y-1) - l(x+1, y-1)
+	return math.Hypot(gx, gy) / 4
+}
+
+// find returns the cheapest vertical seam, the column of the seam in every row
+func (c *carver) find() []int {
+	w, h := c.w, c.h
+	if cap(c.cost) < w*h {
+		c.cost, c.from = make([]float64, w*h), make([]int8, w*h)
+	}
+	// from is the step to the cheapest pixel in the row above, -1, 0 or 1
+	cost, from := c.cost[:w*h], c.from[:w*h]
+
+	// a protected pixel costs more than any seam without one, a removed one
+	// less than any seam without one
+	penalty := float64(h) * 2048
+
+	for x := 0; x < w; x++ {
+		cost[x] = c.energy[x] + c.bias[x]*penalty
+	}
+	for y := 1; y < h; y++ {
+		row, prev := y*w, (y-1)*w
+		for x := 0; x < w; x++ {
+			left, right := max(x-1, 0), min(x+1, w-1)
+
+			var up, cl, cr float64
+			if c.forward {
+				// the new neighbours when this pixel goes, and for diagonal steps
+				// the new neighbours in the row above too
+				up = math.Abs(c.luma[row+right] - c.luma[row+left])
+				cl = up + math.Abs(c.luma[prev+x]-c.luma[row+left])
+				cr = up + math.Abs(c.luma[prev+x]-c.luma[row+right])
+			}
+
+			best, step := cost[prev+x]+up, int8(0)
+			if x > 0 && cost[prev+x-1]+cl < best {
+				best, step = cost[prev+x-1]+cl, -1
+			}
+			if x < w-1 && cost[prev+x+1]+cr < best {
+				best, step = cost[prev+x+1]+cr, 1
+			}
+			cost[row+x] = best + c.energy[row+x] + c.bias[row+x]*penalty
+			from[row+x] = step
+		}
+	}
+
+	seam := make([]int, h)
+	last := (h - 1) * w
+	for x := 1; x < w; x++ {
+		if cost[last+x] < cost[last+seam[h-1]] {
+			seam[h-1] = x
+		}
+	}
+	for y := h - 1; y > 0; y-- {
+		seam[y-1] = seam[y] + int(from[y*w+seam[y]])
+	}
+	return seam
+}
+
+// remove takes the seam out of every plane and updates the energy around it
+func (c *carver) remove(seam []int) {
+	c.pix = removeSeam(c.pix, c.w, c.h, seam)
+	c.luma = removeSeam(c.luma, c.w, c.h, seam)
+	c.energy = removeSeam(c.energy, c.w, c.h, seam)
+	c.bias = removeSeam(c.bias, c.w, c.h, seam)
+	if c.orig != nil {
+		c.orig = removeSeam(c.orig, c.w, c.h, seam)
+	}
+	c.w--
+
+	// the pixels either side of the seam have new neighbours, as do the ones
+	// beside them in the rows above and below
+	for y := 0; y < c.h; y++ {
+		lo, hi := seam[y], seam[y]
+		if y > 0 {
+			lo, hi = min(lo, seam[y-1]), max(hi, seam[y-1])
+		}
+		if y < c.h-1 {
+			lo, hi = min(lo, seam[y+1]), max(hi, seam[y+1])
+		}
+		for x := max(lo-2, 0); x <= min(hi+1, c.w-1); x++ {
+			c.energy[y*c.w+x] = c.energyAt(x, y)
+		}
+	}
+}
+
+// removeSeam drops one value per row, the rows are packed in place
+func removeSeam[T any](p []T, w, h int, seam []int) []T {
+	n := 0
+	for y := 0; y < h; y++ {
+		n += copy(p[n:], p[y*w:y*w+seam[y]])
+		n += copy(p[n:], p[y*w+seam[y]+1:(y+1)*w])
+	}
+	return p[:n]
+}
+
+// insert grows the width by n, finding the n cheapest seams on a copy and
+// doubling them in the image, each doubled pixel is blended with the next
+func (c *carver) insert(n int) {
+	trial := &carver{w: c.w, h: c.h, forward: c.forward}
+	trial.pix = append([]color.NRGBA(nil), c.pix...)
+	trial.luma = append([]float64(nil), c.luma...)
+	trial.energy = append([]float64(nil), c.energy...)
+	trial.bias = append([]float64(nil), c.bias...)
+	trial.orig = make([]int, c.w*c.h)
+	for i := range trial.orig {
+		trial.orig[i] = i % c.w
+	}
+
+	doubled := make([]bool, c.w*c.h)
+	for i := 0; i < n; i++ {
+		seam := trial.find()
+		for y, x := range seam {
+			doubled[y*c.w+trial.orig[y*trial.w+x]] = true
+		}
+		trial.remove(seam)
+	}
+
+	w := c.w + n
+	pix := make([]color.NRGBA, 0, w*c.h)
+	lum := make([]float64, 0, w*c.h)
+	bias := make([]float64, 0, w*c.h)
+	for y := 0; y < c.h; y++ {
+		for x := 0; x < c.w; x++ {
+			i := y*c.w + x
+			pix, lum, bias = append(pix, c.pix[i]), append(lum, c.luma[i]), append(bias, c.bias[i])
+			if doubled[i] {
+				p := mix(c.pix[i], c.pix[y*c.w+min(x+1, c.w-1)])
+				pix, lum, bias = append(pix, p), append(lum, luma(p)), append(bias, c.bias[i])
+			}
+		}
+	}
+	c.pix, c.luma, c.bias, c.w = pix, lum, bias, w
+	c.updateEnergy()
+}
+
+func mix(a, b color.NRGBA) color.NRGBA {
+	return color.NRGBA{
+		uint8((int(a.R) + int(b.R) + 1) / 2),
+		uint8((int(a.G) + int(b.G) + 1) / 2),
+		uint8((int(a.B) + int(b.B) + 1) / 2),
+		uint8((int(a.A) + int(b.A) + 1) / 2),
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
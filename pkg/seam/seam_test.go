@@ -0,0 +1,194 @@
+package seam
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// noise is random black and white noise with a flat grey column band from x0
+// to x1
+func noise(w, h, x0, x1 int) *image.NRGBA {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(r.Intn(2) * 255)
+			if x >= x0 && x < x1 {
+				v = 128
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// flat counts the pixels of a row that are the flat grey
+func flat(img *image.NRGBA, y int) int {
+	n := 0
+	for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+		if img.NRGBAAt(x, y).R == 128 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFind(t *testing.T) {
+	// a diagonal strip of flat pixels through noise is the only cheap seam
+	img := noise(24, 12, 0, 0)
+	for y := 0; y < 12; y++ {
+		for x := 2 + y; x < 7+y; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{128, 128, 128, 255})
+		}
+	}
+	for _, forward := range []bool{true, false} {
+		c := newCarver(img, &options{forward: forward})
+		seam := c.find()
+		for y, x := range seam {
+			if x < 2+y || x > 6+y {
+				t.Fatalf("forward %v: seam %v leaves the diagonal", forward, seam)
+			}
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	img := noise(40, 16, 10, 20)
+	dst, err := Resize(img, 36, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Bounds() != image.Rect(0, 0, 36, 16) {
+		t.Fatalf("bounds %v", dst.Bounds())
+	}
+	// the seams come out of the flat band and leave the noise alone
+	for y := 0; y < 16; y++ {
+		if n := flat(dst, y); n != 6 {
+			t.Fatalf("row %d has %d flat pixels", y, n)
+		}
+	}
+	if dst.NRGBAAt(35, 5) != img.NRGBAAt(39, 5) || dst.NRGBAAt(0, 5) != img.NRGBAAt(0, 5) {
+		t.Error("the noise either side of the band moved")
+	}
+}
+
+func TestHeight(t *testing.T) {
+	// the band on its side in a sub-image away from the origin, carved with
+	// horizontal seams
+	src := noise(40, 16, 10, 20)
+	img := image.NewNRGBA(image.Rect(5, 5, 21, 45))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(5+x, 5+y, src.NRGBAAt(y, x))
+		}
+	}
+
+	dst, err := Resize(img.SubImage(image.Rect(5, 5, 21, 45)), 16, 36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Bounds() != image.Rect(0, 0, 16, 36) {
+		t.Fatalf("bounds %v", dst.Bounds())
+	}
+	for x := 0; x < 16; x++ {
+		n := 0
+		for y := 0; y < 36; y++ {
+			if dst.NRGBAAt(x, y).R == 128 {
+				n++
+			}
+		}
+		if n != 6 {
+			t.Fatalf("column %d has %d flat pixels", x, n)
+		}
+	}
+}
+
+func TestProtect(t *testing.T) {
+	img := noise(40, 16, 10, 16)
+	protect := image.NewAlpha(img.Rect)
+	for y := 0; y < 16; y++ {
+		for x := 8; x < 18; x++ {
+			protect.SetAlpha(x, y, color.Alpha{255})
+		}
+	}
+
+	dst, err := Resize(img, 30, 16, Protect(protect))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 16; y++ {
+		if n := flat(dst, y); n != 6 {
+			t.Fatalf("row %d has %d of the 6 protected flat pixels", y, n)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	// a noisy block sits in the middle of a flat field, nothing else would
+	// ever be carved through it
+	img := noise(40, 20, 0, 40)
+	r := rand.New(rand.NewSource(2))
+	remove := image.NewAlpha(img.Rect)
+	for y := 6; y < 14; y++ {
+		for x := 17; x < 21; x++ {
+			v := uint8(r.Intn(2) * 255)
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+			remove.SetAlpha(x, y, color.Alpha{255})
+		}
+	}
+
+	dst, err := Resize(img, 40, 20, Remove(remove))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Bounds() != image.Rect(0, 0, 40, 20) {
+		t.Fatalf("bounds %v", dst.Bounds())
+	}
+	for y := 0; y < 20; y++ {
+		if n := flat(dst, y); n != 40 {
+			t.Fatalf("row %d has %d flat pixels, the block survived", y, n)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	img := noise(20, 10, 5, 8)
+	dst, err := Resize(img, 45, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst.Bounds() != image.Rect(0, 0, 45, 10) {
+		t.Fatalf("bounds %v", dst.Bounds())
+	}
+
+	// every original pixel is still there in order
+	for y := 0; y < 10; y++ {
+		x := 0
+		for dx := 0; dx < 45 && x < 20; dx++ {
+			if dst.NRGBAAt(dx, y) == img.NRGBAAt(x, y) {
+				x++
+			}
+		}
+		if x != 20 {
+			t.Fatalf("row %d lost pixel %d", y, x)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	img := noise(8, 8, 0, 0)
+	if _, err := Resize(img, 0, 8); err == nil {
+		t.Error("expected an error for a zero width")
+	}
+	if _, err := Resize(img, 4, 4, nil); err == nil {
+		t.Error("expected an error for a nil option")
+	}
+	if _, err := Resize(img, 4, 4, Protect(nil)); err == nil {
+		t.Error("expected an error for a nil mask")
+	}
+	if dst, err := Resize(img, 8, 8, ForwardEnergy(false)); err != nil || dst.Bounds() != img.Bounds() {
+		t.Errorf("same size gave %v, %v", dst.Bounds(), err)
+	}
+}